@@ -0,0 +1,352 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Exit codes used by the command line mode
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// runCommand handles subcommands that run without starting a window.
+// It reports whether args named a subcommand, and the exit code to use.
+func runCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) (bool, int) {
+	if len(args) == 0 {
+		return false, exitOK
+	}
+
+	switch args[0] {
+	case "render":
+		return true, runRender(args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		printUsage(stdout)
+		return true, exitOK
+	}
+	return false, exitOK
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `Usage:
+  fynemd [--new-window] [file[:line[:col]]...]
+                                    open files in the editor
+  fynemd render [options] [file...] convert markdown to HTML without a window
+
+Editor options:
+  --new-window  start a separate editor instead of opening the files
+                in the one that is already running
+
+Render options:
+  -o path   output file, or a directory when several files are given
+            (default: standard output for one input, beside each input otherwise)
+  -code-style name
+            color scheme for fenced code blocks, any chroma style (default: github)
+  -code-classes
+            highlight code with CSS classes and a stylesheet instead of inline styles
+  -template name
+            page template: github, academic, dark, print, or the path of a
+            Go html/template file (default: github)
+  -self-contained
+            embed local images and stylesheets, so the page works on its own;
+            assets that cannot be read are reported and left as links
+  -embed-fonts
+            also embed the editor's fonts (implies -self-contained)
+  -math format
+            how formulas are written: mathml, or katex to leave them for
+            KaTeX to typeset in the browser (default: mathml)
+  -katex location
+            KaTeX to use with -math katex: bundled for the copy built into
+            fynemd, inlined so the page works offline, or the web address or
+            local folder of a KaTeX release (default: the jsDelivr CDN); with
+            -self-contained a local folder is embedded too
+
+Use - or no file to read markdown from standard input, and -- before
+files whose names start with -.
+`)
+}
+
+// openTarget is a file to open from the command line, with an optional
+// 1-based line and column to place the cursor at
+type openTarget struct {
+	Path   string `json:"path"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+// launchOptions describes how the editor was asked to start
+type launchOptions struct {
+	targets   []openTarget
+	newWindow bool
+}
+
+// parseLaunchArgs reads the files and options given when starting the editor
+func parseLaunchArgs(args []string, stderr io.Writer) (launchOptions, error) {
+	var opts launchOptions
+	flags := flag.NewFlagSet("fynemd", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { printUsage(stderr) }
+	flags.BoolVar(&opts.newWindow, "new-window", false, "start a separate editor")
+
+	paths, err := parseInterspersed(flags, args)
+	if err != nil {
+		return opts, err
+	}
+	for _, arg := range paths {
+		opts.targets = append(opts.targets, parseOpenTarget(arg))
+	}
+	return opts, nil
+}
+
+// parseOpenTarget splits a path:line:col argument. A path that exists as
+// given is never split, and splitting stops at a path that exists, so names
+// containing colons still open.
+func parseOpenTarget(arg string) openTarget {
+	target := openTarget{Path: arg}
+	if _, err := os.Stat(arg); err != nil {
+		var numbers []int
+		for len(numbers) < 2 {
+			i := strings.LastIndex(target.Path, ":")
+			if i <= 0 {
+				break
+			}
+			n, err := strconv.Atoi(target.Path[i+1:])
+			if err != nil || n < 1 {
+				break
+			}
+			numbers = append([]int{n}, numbers...)
+			target.Path = target.Path[:i]
+			if _, err := os.Stat(target.Path); err == nil {
+				break
+			}
+		}
+
+		if len(numbers) > 0 {
+			target.Line = numbers[0]
+		}
+		if len(numbers) > 1 {
+			target.Column = numbers[1]
+		}
+	}
+
+	// Paths are resolved here as a running editor may have another working directory
+	if abs, err := filepath.Abs(target.Path); err == nil {
+		target.Path = abs
+	}
+	return target
+}
+
+// runRender converts markdown files to HTML pages with the same pipeline
+// and template as the editor's HTML export
+func runRender(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("render", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() { printUsage(stderr) }
+	output := flags.String("o", "", "output file or directory")
+	var opts renderOptions
+	flags.StringVar(&opts.code.style, "code-style", codeStyleAuto, "color scheme for fenced code blocks")
+	flags.BoolVar(&opts.code.classes, "code-classes", false, "highlight code with CSS classes")
+	selfContained := flags.Bool("self-contained", false, "embed local images and stylesheets")
+	embedFonts := flags.Bool("embed-fonts", false, "embed the editor's fonts")
+	templateName := flags.String("template", pageTemplateDefault, "page template name or file")
+	mathFormat := flags.String("math", "mathml", "how formulas are written")
+	flags.StringVar(&opts.math.katexLocation, "katex", "", "location of KaTeX")
+
+	inputs, err := parseInterspersed(flags, args)
+	if err != nil {
+		return exitUsage
+	}
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	if len(inputs) > 1 && slices.Contains(inputs, "-") {
+		fmt.Fprintln(stderr, "render: cannot read standard input along with files")
+		return exitUsage
+	}
+	if !codeStyleExists(opts.code.style) {
+		fmt.Fprintf(stderr, "render: unknown code style %q\n", opts.code.style)
+		return exitUsage
+	}
+	switch *mathFormat {
+	case "mathml":
+	case "katex":
+		opts.math.katex = true
+	default:
+		fmt.Fprintf(stderr, "render: unknown math format %q\n", *mathFormat)
+		return exitUsage
+	}
+	if opts.math.katexLocation != "" && !opts.math.katex {
+		fmt.Fprintln(stderr, "render: -katex is only used with -math katex")
+		return exitUsage
+	}
+	if opts.page, err = loadPageTemplate(*templateName); err != nil {
+		fmt.Fprintln(stderr, "render:", err)
+		return exitUsage
+	}
+	if *selfContained || *embedFonts {
+		opts.embed = &embedOptions{stylesheets: true, fonts: *embedFonts}
+	}
+
+	// With several inputs the output names a directory to write them into
+	outDir := ""
+	if len(inputs) > 1 && *output != "" && *output != "-" {
+		outDir = *output
+	} else if len(inputs) > 1 && *output == "-" {
+		fmt.Fprintln(stderr, "render: cannot write several pages to standard output")
+		return exitUsage
+	}
+	dests := make([]string, len(inputs))
+	if len(inputs) == 1 {
+		dests[0] = *output
+	} else {
+		// Inputs with the same name would overwrite each other's page
+		written := make(map[string]string)
+		for i, input := range inputs {
+			dests[i] = htmlPathFor(input, outDir)
+			if other, ok := written[dests[i]]; ok {
+				fmt.Fprintf(stderr, "render: %s and %s would both be written to %s\n", other, input, dests[i])
+				return exitUsage
+			}
+			written[dests[i]] = input
+		}
+	}
+	if outDir != "" {
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			fmt.Fprintln(stderr, "render:", err)
+			return exitError
+		}
+	}
+
+	code := exitOK
+	for i, input := range inputs {
+		if err := renderFile(input, dests[i], opts, stdin, stdout, stderr); err != nil {
+			fmt.Fprintf(stderr, "render: %s: %v\n", displayName(input), err)
+			code = exitError
+		}
+	}
+	return code
+}
+
+// renderOptions are the settings shared by every file converted
+type renderOptions struct {
+	code codeHighlight
+	math mathOptions
+	page *pageTemplate
+	// embed, if not nil, makes each page self-contained
+	embed *embedOptions
+}
+
+// renderFile converts one input, where "-" or "" means the standard streams.
+// Assets that cannot be embedded are reported on stderr without failing.
+func renderFile(input, output string, opts renderOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+	var source []byte
+	var err error
+	if input == "-" {
+		source, err = io.ReadAll(stdin)
+	} else {
+		source, err = os.ReadFile(input)
+	}
+	if err != nil {
+		return err
+	}
+
+	title := "Untitled"
+	if input != "-" {
+		title = strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	}
+	page, err := renderHTMLPage(source, parseMarkdown(newMarkdown(), source), htmlPageOptions{code: opts.code, math: opts.math, page: opts.page, title: title})
+	if err != nil {
+		return err
+	}
+	if opts.embed != nil {
+		// Standard input has no folder, so its relative references resolve
+		// against the working directory
+		dir := "."
+		if input != "-" {
+			dir = filepath.Dir(input)
+		}
+		var missing []missingAsset
+		page, missing = embedAssets(page, dir, *opts.embed)
+		for _, asset := range missing {
+			fmt.Fprintf(stderr, "render: %s: missing asset %s\n", displayName(input), asset)
+		}
+	}
+
+	if output == "" || output == "-" {
+		_, err = io.WriteString(stdout, page)
+		return err
+	}
+	return writeFileAtomic(output, []byte(page), BackupNone)
+}
+
+// htmlPathFor returns where the page for an input is written, beside the
+// input unless an output directory is given
+func htmlPathFor(input, outDir string) string {
+	if input == "-" {
+		return "-"
+	}
+
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input)) + ".html"
+	if outDir == "" {
+		return filepath.Join(filepath.Dir(input), name)
+	}
+	return filepath.Join(outDir, name)
+}
+
+func displayName(input string) string {
+	if input == "-" {
+		return "<stdin>"
+	}
+	return input
+}
+
+// parseInterspersed parses flags that may appear before, between or after
+// positional arguments, returning the positional ones. Everything after --
+// is positional.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := flags.Args()
+		if endedByDashes(flags, args[:len(args)-len(rest)]) {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// endedByDashes reports whether the flags parsed from args were ended by --,
+// which the flag package drops, rather than -- being the value of a flag
+func endedByDashes(flags *flag.FlagSet, args []string) bool {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			return true
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(args[i], "-"), "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		// A flag that is not a switch takes the next argument as its value
+		if f := flags.Lookup(name); f != nil {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+				i++
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		output  string
+		verbose bool
+		wantErr bool
+	}{
+		{name: "flags first", args: []string{"-o", "out", "a.md"}, want: []string{"a.md"}, output: "out"},
+		{name: "flags between", args: []string{"a.md", "-v", "b.md", "-o=out"}, want: []string{"a.md", "b.md"}, output: "out", verbose: true},
+		{name: "flags after", args: []string{"a.md", "b.md", "--o", "out"}, want: []string{"a.md", "b.md"}, output: "out"},
+		{name: "dashes end flags", args: []string{"-v", "--", "-o", "a.md"}, want: []string{"-o", "a.md"}, verbose: true},
+		{name: "dashes after file", args: []string{"a.md", "--", "-v"}, want: []string{"a.md", "-v"}},
+		{name: "dashes as value", args: []string{"-o", "--", "a.md", "-v"}, want: []string{"a.md"}, output: "--", verbose: true},
+		{name: "standard input", args: []string{"-", "-v"}, want: []string{"-"}, verbose: true},
+		{name: "unknown flag", args: []string{"a.md", "-x"}, wantErr: true},
+		{name: "missing value", args: []string{"a.md", "-o"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags.SetOutput(io.Discard)
+			output := flags.String("o", "", "")
+			verbose := flags.Bool("v", false, "")
+
+			got, err := parseInterspersed(flags, test.args)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("error %v, want error %v", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if strings.Join(got, " ") != strings.Join(test.want, " ") {
+				t.Errorf("positional %q, want %q", got, test.want)
+			}
+			if *output != test.output || *verbose != test.verbose {
+				t.Errorf("-o %q -v %v, want -o %q -v %v", *output, *verbose, test.output, test.verbose)
+			}
+		})
+	}
+}
+
+func TestParseOpenTarget(t *testing.T) {
+	dir := t.TempDir()
+	colon := filepath.Join(dir, "a:1")
+	if err := os.WriteFile(colon, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	notes := filepath.Join(dir, "notes.md")
+
+	tests := []struct {
+		name string
+		arg  string
+		want openTarget
+	}{
+		{name: "path", arg: notes, want: openTarget{Path: notes}},
+		{name: "line", arg: notes + ":12", want: openTarget{Path: notes, Line: 12}},
+		{name: "line and column", arg: notes + ":12:3", want: openTarget{Path: notes, Line: 12, Column: 3}},
+		{name: "only two numbers", arg: notes + ":1:2:3", want: openTarget{Path: notes + ":1", Line: 2, Column: 3}},
+		{name: "zero is no line", arg: notes + ":0", want: openTarget{Path: notes + ":0"}},
+		{name: "not a number", arg: notes + ":end", want: openTarget{Path: notes + ":end"}},
+		{name: "existing name with colon", arg: colon, want: openTarget{Path: colon}},
+		{name: "existing name with line", arg: colon + ":4", want: openTarget{Path: colon, Line: 4}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := parseOpenTarget(test.arg); got != test.want {
+				t.Errorf("parseOpenTarget(%q) = %+v, want %+v", test.arg, got, test.want)
+			}
+		})
+	}
+}
+
+func TestRunRenderExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.md", "b.md", "sub/a.md", "sub/a.markdown"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# "+name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := func(name string) string { return filepath.Join(dir, name) }
+	out := t.TempDir()
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{name: "standard streams", args: nil, want: exitOK},
+		{name: "one file", args: []string{in("a.md"), "-o", filepath.Join(out, "a.html")}, want: exitOK},
+		{name: "several files", args: []string{"-o", out, in("a.md"), in("b.md")}, want: exitOK},
+		{name: "katex", args: []string{"-math", "katex", "-katex", "https://example.com/katex", in("a.md")}, want: exitOK},
+		{name: "missing file", args: []string{in("missing.md")}, want: exitError},
+		{name: "unknown flag", args: []string{"-x", in("a.md")}, want: exitUsage},
+		{name: "unknown code style", args: []string{"-code-style", "nope", in("a.md")}, want: exitUsage},
+		{name: "unknown math format", args: []string{"-math", "tex", in("a.md")}, want: exitUsage},
+		{name: "katex without katex math", args: []string{"-katex", "bundled", in("a.md")}, want: exitUsage},
+		{name: "unknown template", args: []string{"-template", in("missing.tmpl"), in("a.md")}, want: exitUsage},
+		{name: "standard input with files", args: []string{in("a.md"), "-"}, want: exitUsage},
+		{name: "several pages to standard output", args: []string{"-o", "-", in("a.md"), in("b.md")}, want: exitUsage},
+		{name: "same name in output folder", args: []string{"-o", out, in("a.md"), in("sub/a.md")}, want: exitUsage},
+		{name: "same name beside inputs", args: []string{in("sub/a.md"), in("sub/a.markdown")}, want: exitUsage},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr strings.Builder
+			if got := runRender(test.args, strings.NewReader("# stdin"), &stdout, &stderr); got != test.want {
+				t.Errorf("exit code %d, want %d\n%s", got, test.want, stderr.String())
+			}
+		})
+	}
+
+	// Files are not rendered when the names collide
+	if _, err := os.Stat(in("sub/a.html")); !os.IsNotExist(err) {
+		t.Errorf("page written despite the name collision: %v", err)
+	}
+}
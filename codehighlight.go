@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+)
+
+// Preference keys for highlighting fenced code blocks
+const (
+	preferenceCodeStyle   = "codeStyle"
+	preferenceCodeClasses = "codeClasses"
+)
+
+// codeStyleAuto picks a light or dark color scheme to match the theme
+const codeStyleAuto = ""
+
+// codeStyleChoices are the color schemes offered in the View menu. The
+// command line accepts any chroma style name.
+var codeStyleChoices = []string{
+	"github",
+	"github-dark",
+	"monokai",
+	"dracula",
+	"nord",
+	"solarized-light",
+	"solarized-dark",
+	"vs",
+	"xcode",
+}
+
+// codeHighlight describes how fenced code blocks are highlighted
+type codeHighlight struct {
+	// style is a chroma style name, or codeStyleAuto
+	style string
+	// classes exports CSS classes and a stylesheet rather than inline styles
+	classes bool
+}
+
+// codeStyleExists reports whether name is a known color scheme
+func codeStyleExists(name string) bool {
+	_, ok := styles.Registry[strings.ToLower(name)]
+	return name == codeStyleAuto || ok
+}
+
+// chromaStyle returns the color scheme to use on a light or dark background
+func (h codeHighlight) chromaStyle(dark bool) *chroma.Style {
+	name := h.style
+	if name == codeStyleAuto {
+		name = "github"
+		if dark {
+			name = "github-dark"
+		}
+	}
+	return styles.Get(name)
+}
+
+// htmlExtension returns the goldmark extension that highlights fenced code
+// in exported HTML, on a light or dark page
+func (h codeHighlight) htmlExtension(dark bool) goldmark.Extender {
+	return highlighting.NewHighlighting(
+		highlighting.WithCustomStyle(h.chromaStyle(dark)),
+		highlighting.WithFormatOptions(chromahtml.WithClasses(h.classes)),
+	)
+}
+
+// css returns the stylesheet needed by HTML exported with CSS classes, on a
+// light or dark page
+func (h codeHighlight) css(dark bool) string {
+	if !h.classes {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	formatter := chromahtml.New(chromahtml.WithClasses(true))
+	if err := formatter.WriteCSS(&buf, h.chromaStyle(dark)); err != nil {
+		fyne.LogError("Failed to write code highlighting CSS", err)
+	}
+	return buf.String()
+}
+
+// codeBlockSegment is a fenced code block in the preview, highlighted for its
+// language and drawn on the background of the color scheme
+type codeBlockSegment struct {
+	code      string
+	language  string
+	highlight codeHighlight
+}
+
+// Inline returns false as a code block is always shown on its own
+func (s *codeBlockSegment) Inline() bool {
+	return false
+}
+
+// Textual returns the code
+func (s *codeBlockSegment) Textual() string {
+	return s.code
+}
+
+// Visual returns the highlighted code on its background
+func (s *codeBlockSegment) Visual() fyne.CanvasObject {
+	background := canvas.NewRectangle(color.Transparent)
+	background.CornerRadius = theme.InputRadiusSize()
+	text := widget.NewRichText()
+	text.Wrapping = fyne.TextWrapWord
+
+	o := container.NewThemeOverride(container.NewStack(background, text), codeTheme{})
+	s.Update(o)
+	return o
+}
+
+// Update highlights the code again, as the theme may have changed
+func (s *codeBlockSegment) Update(o fyne.CanvasObject) {
+	override := o.(*container.ThemeOverride)
+	stack := override.Content.(*fyne.Container)
+	background := stack.Objects[0].(*canvas.Rectangle)
+	text := stack.Objects[1].(*widget.RichText)
+
+	style := s.highlight.chromaStyle(fyne.CurrentApp().Settings().ThemeVariant() == theme.VariantDark)
+	background.FillColor = chromaColor(style.Get(chroma.Background).Background)
+	background.Refresh()
+	text.Segments = highlightCode(s.code, s.language, style)
+	text.Refresh()
+}
+
+// Select does nothing as the preview text cannot be selected
+func (s *codeBlockSegment) Select(_, _ fyne.Position) {}
+
+// SelectedText returns an empty string as the preview text cannot be selected
+func (s *codeBlockSegment) SelectedText() string {
+	return ""
+}
+
+// Unselect does nothing as the preview text cannot be selected
+func (s *codeBlockSegment) Unselect() {}
+
+// highlightCode splits code into rich text segments colored by a scheme.
+// Code in an unknown language is shown in the scheme's text color.
+func highlightCode(code, language string, style *chroma.Style) []widget.RichTextSegment {
+	text := codeTextColor(style)
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return []widget.RichTextSegment{codeSegment(code, style.Get(chroma.Text), text)}
+	}
+
+	var segs []widget.RichTextSegment
+	var last chroma.StyleEntry
+	for _, token := range iterator.Tokens() {
+		entry := style.Get(token.Type)
+		if n := len(segs); n > 0 && entry == last {
+			segs[n-1].(*widget.TextSegment).Text += token.Value
+			continue
+		}
+		segs = append(segs, codeSegment(token.Value, entry, text))
+		last = entry
+	}
+
+	// The lexer ends the code with a line break that would show as an empty line
+	if n := len(segs); n > 0 {
+		seg := segs[n-1].(*widget.TextSegment)
+		seg.Text = strings.TrimSuffix(seg.Text, "\n")
+	}
+	return segs
+}
+
+// codeTokens splits code into tokens for its language, with tabs expanded
+func codeTokens(code, language string) []chroma.Token {
+	code = strings.ReplaceAll(code, "\t", strings.Repeat(" ", tabWidth))
+	lexer := lexers.Get(language)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return []chroma.Token{{Type: chroma.Text, Value: code}}
+	}
+	return iterator.Tokens()
+}
+
+// codeLines splits tokens into lines, wrapping lines longer than columns
+// characters unless columns is 0
+func codeLines(tokens []chroma.Token, columns int) [][]chroma.Token {
+	lines := [][]chroma.Token{nil}
+	width := 0
+	for _, token := range tokens {
+		for i, part := range strings.Split(token.Value, "\n") {
+			if i > 0 {
+				lines = append(lines, nil)
+				width = 0
+			}
+			runes := []rune(part)
+			for len(runes) > 0 {
+				n := len(runes)
+				if columns > 0 {
+					if width >= columns {
+						lines = append(lines, nil)
+						width = 0
+					}
+					n = min(n, columns-width)
+				}
+				last := len(lines) - 1
+				lines[last] = append(lines[last], chroma.Token{Type: token.Type, Value: string(runes[:n])})
+				runes = runes[n:]
+				width += n
+			}
+		}
+	}
+
+	// The lexer ends the code with a line break that would show as an empty line
+	if len(lines) > 1 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// codeTextColor returns the color of code that a scheme does not color. Some
+// schemes leave it to the page, so it is picked to contrast with the background.
+func codeTextColor(style *chroma.Style) chroma.Colour {
+	background := style.Get(chroma.Background)
+	switch {
+	case background.Colour.IsSet():
+		return background.Colour
+	case !background.Background.IsSet():
+		return 0
+	case background.Background.Brightness() < 0.5:
+		return chroma.ParseColour("#ffffff")
+	}
+	return chroma.ParseColour("#000000")
+}
+
+func codeSegment(text string, entry chroma.StyleEntry, fallback chroma.Colour) *widget.TextSegment {
+	colour := entry.Colour
+	if !colour.IsSet() {
+		colour = fallback
+	}
+	return &widget.TextSegment{
+		Text: text,
+		Style: widget.RichTextStyle{
+			Inline:    true,
+			ColorName: codeColorName(colour),
+			SizeName:  theme.SizeNameText,
+			TextStyle: fyne.TextStyle{
+				Monospace: true,
+				Bold:      entry.Bold == chroma.Yes,
+				Italic:    entry.Italic == chroma.Yes,
+			},
+		},
+	}
+}
+
+// codeColorPrefix marks the theme color names that carry a scheme color
+const codeColorPrefix = "codeColor"
+
+// codeColorName returns a theme color name for a color of a scheme. Colors
+// the scheme does not set use the theme's foreground.
+func codeColorName(c chroma.Colour) fyne.ThemeColorName {
+	if !c.IsSet() {
+		return theme.ColorNameForeground
+	}
+	return fyne.ThemeColorName(codeColorPrefix + c.String())
+}
+
+func chromaColor(c chroma.Colour) color.Color {
+	if !c.IsSet() {
+		return color.Transparent
+	}
+	return color.NRGBA{R: c.Red(), G: c.Green(), B: c.Blue(), A: 0xff}
+}
+
+// codeTheme resolves the color names of highlighted code, leaving the rest
+// to the application theme
+type codeTheme struct{}
+
+func (codeTheme) Color(name fyne.ThemeColorName, variant fyne.ThemeVariant) color.Color {
+	if hex, ok := strings.CutPrefix(string(name), codeColorPrefix); ok {
+		return chromaColor(chroma.ParseColour(hex))
+	}
+	return fyne.CurrentApp().Settings().Theme().Color(name, variant)
+}
+
+func (codeTheme) Font(style fyne.TextStyle) fyne.Resource {
+	return fyne.CurrentApp().Settings().Theme().Font(style)
+}
+
+func (codeTheme) Icon(name fyne.ThemeIconName) fyne.Resource {
+	return fyne.CurrentApp().Settings().Theme().Icon(name)
+}
+
+func (codeTheme) Size(name fyne.ThemeSizeName) float32 {
+	return fyne.CurrentApp().Settings().Theme().Size(name)
+}
@@ -1,42 +1,88 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
 	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/yuin/goldmark/ast"
 )
 
-// AppController manages the application state and coordinates between components
+// preferenceBackupPolicy stores the BackupPolicy applied when saving
+const preferenceBackupPolicy = "backupPolicy"
+
+// AppController manages the application state and coordinates between components.
+// The editor and preview fields always refer to the components of the active tab.
 type AppController struct {
 	window       fyne.Window
 	editor       *Editor
 	preview      *Preview
 	statusBar    *StatusBar
-	currentFile  fyne.URI
-	modified     bool
+	outline      *Outline
+	searchPanel  *SearchPanel
+	workspace    *Workspace
+	tabs         *container.DocTabs
+	documents    []*Document
+	current      *Document
+	recovery     *RecoveryJournal
+	watcher      *FileWatcher
 	saveMenuItem *fyne.MenuItem
+	recentMenu   *fyne.Menu
+
+	// syncing is set while one pane is scrolled to follow the other
+	syncing bool
 }
 
 // NewAppController creates a new application controller
 func NewAppController(window fyne.Window) *AppController {
-	return &AppController{
+	var root fyne.URI
+	if a := fyne.CurrentApp(); a != nil {
+		root = a.Storage().RootURI()
+	}
+
+	c := &AppController{
 		window:   window,
-		modified: false,
+		recovery: NewRecoveryJournal(root),
 	}
-}
 
-// SetEditor sets the editor component
-func (c *AppController) SetEditor(editor *Editor) {
-	c.editor = editor
+	watcher, err := NewFileWatcher(c.onFileChanged)
+	if err != nil {
+		fyne.LogError("Failed to start file watcher", err)
+	}
+	c.watcher = watcher
+	return c
 }
 
-// SetPreview sets the preview component
-func (c *AppController) SetPreview(preview *Preview) {
-	c.preview = preview
+// CreateTabs creates the document tabs, starting with an untitled document
+func (c *AppController) CreateTabs() fyne.CanvasObject {
+	c.tabs = container.NewDocTabs()
+	c.tabs.OnSelected = func(item *container.TabItem) {
+		if doc := c.documentForTab(item); doc != nil {
+			c.activate(doc)
+		}
+	}
+	c.tabs.CloseIntercept = func(item *container.TabItem) {
+		if doc := c.documentForTab(item); doc != nil {
+			c.closeDocuments([]*Document{doc}, nil)
+		}
+	}
+
+	c.addDocument()
+	return c.tabs
 }
 
 // SetStatusBar sets the status bar component
@@ -44,22 +90,51 @@ func (c *AppController) SetStatusBar(statusBar *StatusBar) {
 	c.statusBar = statusBar
 }
 
+// SetOutline sets the outline panel that follows the active document
+func (c *AppController) SetOutline(outline *Outline) {
+	c.outline = outline
+	c.updateOutline()
+}
+
+// SetSearchPanel sets the panel that finds and replaces in a folder
+func (c *AppController) SetSearchPanel(panel *SearchPanel) {
+	c.searchPanel = panel
+}
+
+// SetWorkspace sets the panel showing the files of the workspace folder
+func (c *AppController) SetWorkspace(workspace *Workspace) {
+	c.workspace = workspace
+}
+
 // SetSaveMenuItem sets the save menu item for enabling/disabling
 func (c *AppController) SetSaveMenuItem(item *fyne.MenuItem) {
 	c.saveMenuItem = item
 }
 
-// OnTextChanged handles text changes in the editor
-func (c *AppController) OnTextChanged(content string) {
-	// Update preview
-	if c.preview != nil {
-		c.preview.UpdateContent(content)
+// SetRecentMenu sets the Open Recent menu, filling it from the recent files list
+func (c *AppController) SetRecentMenu(menu *fyne.Menu) {
+	c.recentMenu = menu
+	c.updateRecentMenu()
+}
+
+// OnTextChanged handles text changes in the given editor
+func (c *AppController) OnTextChanged(editor *Editor, content string) {
+	doc := c.documentForEditor(editor)
+	if doc == nil {
+		return
 	}
+
+	// Update preview once typing pauses
+	c.schedulePreview(doc)
 	
 	// Mark as modified
-	if !c.modified {
-		c.modified = true
-		c.updateTitle()
+	if !doc.modified {
+		doc.modified = true
+		c.updateTabTitle(doc)
+	}
+
+	if doc != c.current {
+		return
 	}
 	
 	// Enable save menu item
@@ -71,30 +146,248 @@ func (c *AppController) OnTextChanged(content string) {
 	c.updateStatus()
 }
 
-// NewFile creates a new file
+// NewFile creates a new untitled document in its own tab
 func (c *AppController) NewFile() {
-	if c.modified {
-		dialog.ShowConfirm("Unsaved Changes", 
-			"Do you want to save your changes before creating a new file?",
-			func(save bool) {
-				if save {
-					c.Save()
-				}
-				c.createNewFile()
-			}, c.window)
-	} else {
-		c.createNewFile()
-	}
+	c.addDocument()
+}
+
+func (c *AppController) addDocument() *Document {
+	doc := NewDocument(c)
+	c.documents = append(c.documents, doc)
+	c.tabs.Append(doc.tab)
+	c.tabs.Select(doc.tab)
+	c.activate(doc)
+	return doc
 }
 
-func (c *AppController) createNewFile() {
-	c.editor.SetContent("")
-	c.currentFile = nil
-	c.modified = false
+// activate makes the document the one that menus, toolbar and status bar act on
+func (c *AppController) activate(doc *Document) {
+	c.current = doc
+	c.editor = doc.editor
+	c.preview = doc.preview
 	c.updateTitle()
 	c.updateStatus()
+	c.updateOutline()
+
 	if c.saveMenuItem != nil {
-		c.saveMenuItem.Disabled = true
+		c.saveMenuItem.Disabled = !doc.modified
+	}
+}
+
+// loadDocument replaces the content of a document with a file that has just been read
+func (c *AppController) loadDocument(doc *Document, content string, uri fyne.URI) {
+	doc.uri = uri
+	doc.preview.SetDir(doc.Dir())
+	doc.editor.SetContent(content)
+	doc.modified = false
+	c.updateTabTitle(doc)
+
+	if doc == c.current {
+		c.activate(doc)
+	}
+}
+
+// trackFile records the file content a document is now in sync with and
+// makes sure that the file is watched for changes by other programs
+func (c *AppController) trackFile(doc *Document, data []byte) {
+	sum := sha256.Sum256(data)
+	doc.diskHash = sum[:]
+
+	if path := doc.Path(); path != doc.watched {
+		c.watcher.Remove(doc.watched)
+		c.watcher.Add(path)
+		doc.watched = path
+	}
+}
+
+func (c *AppController) untrackFile(doc *Document) {
+	c.watcher.Remove(doc.watched)
+	doc.watched = ""
+	doc.diskHash = nil
+}
+
+func (c *AppController) onFileChanged(path string) {
+	for _, doc := range c.documents {
+		if doc.watched == path {
+			c.checkDisk(doc)
+		}
+	}
+}
+
+// checkDisk compares a document with its file and asks the user how to
+// reconcile them if another program has changed it
+func (c *AppController) checkDisk(doc *Document) {
+	disk, err := readURI(doc.uri)
+	if err != nil {
+		// The file was deleted or moved away, so the buffer is now the only copy
+		if doc.diskHash != nil && c.statusBar != nil {
+			c.statusBar.SetText(fmt.Sprintf("%s was removed from disk", doc.Name()))
+		}
+		doc.diskHash = nil
+		if !doc.modified {
+			doc.modified = true
+			c.updateTabTitle(doc)
+		}
+		if doc == c.current && c.saveMenuItem != nil {
+			c.saveMenuItem.Disabled = false
+		}
+		return
+	}
+
+	if doc.diskHash != nil && !doc.ChangedOnDisk([]byte(disk)) {
+		return
+	}
+	c.showConflict(doc, disk)
+}
+
+func (c *AppController) showConflict(doc *Document, disk string) {
+	if doc.conflictOpen {
+		return
+	}
+	doc.conflictOpen = true
+	c.tabs.Select(doc.tab)
+
+	message := widget.NewLabel(fmt.Sprintf("%s has been changed on disk by another program.\nReload it, or keep the version in the editor?", doc.Name()))
+	d := dialog.NewCustomWithoutButtons("File Changed on Disk", message, c.window)
+	d.SetButtons([]fyne.CanvasObject{
+		widget.NewButton("Show Diff", func() {
+			showDiffDialog("Disk version compared with "+doc.Name(), strings.ReplaceAll(disk, "\r\n", "\n"), doc.editor.GetContent(), c.window)
+		}),
+		widget.NewButton("Keep Mine", func() {
+			// Accept the disk version as seen so that the next save may replace it
+			c.trackFile(doc, []byte(disk))
+			doc.modified = true
+			c.updateTabTitle(doc)
+			if doc == c.current && c.saveMenuItem != nil {
+				c.saveMenuItem.Disabled = false
+			}
+			d.Hide()
+		}),
+		widget.NewButton("Reload", func() {
+			if latest, err := readURI(doc.uri); err == nil {
+				disk = latest
+			}
+			c.loadDocument(doc, disk, doc.uri)
+			c.trackFile(doc, []byte(disk))
+			d.Hide()
+		}),
+	})
+	d.SetOnClosed(func() {
+		doc.conflictOpen = false
+	})
+	d.Show()
+}
+
+// CloseTab closes the active document, asking to save unsaved changes first
+func (c *AppController) CloseTab() {
+	if c.current != nil {
+		c.closeDocuments([]*Document{c.current}, nil)
+	}
+}
+
+// CloseOtherTabs closes every document except the active one
+func (c *AppController) CloseOtherTabs() {
+	var others []*Document
+	for _, doc := range c.documents {
+		if doc != c.current {
+			others = append(others, doc)
+		}
+	}
+	c.closeDocuments(others, nil)
+}
+
+// CloseAllTabs closes every open document
+func (c *AppController) CloseAllTabs() {
+	c.closeDocuments(append([]*Document(nil), c.documents...), nil)
+}
+
+// closeDocuments closes each document in turn, asking to save any unsaved
+// changes first. Cancelling a save stops the remaining documents from closing.
+func (c *AppController) closeDocuments(docs []*Document, onClosed func()) {
+	if len(docs) == 0 {
+		if onClosed != nil {
+			onClosed()
+		}
+		return
+	}
+
+	doc, rest := docs[0], docs[1:]
+	next := func() {
+		c.removeDocument(doc)
+		c.closeDocuments(rest, onClosed)
+	}
+
+	if !doc.modified {
+		next()
+		return
+	}
+
+	c.tabs.Select(doc.tab)
+	dialog.ShowConfirm("Unsaved Changes",
+		fmt.Sprintf("Do you want to save your changes to %s before closing?", doc.Name()),
+		func(save bool) {
+			if save {
+				c.saveDocument(doc, next)
+				return
+			}
+			next()
+		}, c.window)
+}
+
+func (c *AppController) removeDocument(doc *Document) {
+	// Closing a tab settles its unsaved changes, so the journal copy is no longer needed
+	c.recovery.Remove(doc.id)
+	c.untrackFile(doc)
+
+	for i, d := range c.documents {
+		if d == doc {
+			c.documents = append(c.documents[:i], c.documents[i+1:]...)
+			break
+		}
+	}
+	c.tabs.Remove(doc.tab)
+
+	if len(c.documents) == 0 {
+		c.addDocument()
+		return
+	}
+	if selected := c.documentForTab(c.tabs.Selected()); selected != nil {
+		c.activate(selected)
+	}
+}
+
+func (c *AppController) documentForTab(item *container.TabItem) *Document {
+	for _, doc := range c.documents {
+		if doc.tab == item {
+			return doc
+		}
+	}
+	return nil
+}
+
+func (c *AppController) documentForEditor(editor *Editor) *Document {
+	for _, doc := range c.documents {
+		if doc.editor == editor {
+			return doc
+		}
+	}
+	return nil
+}
+
+func (c *AppController) documentForURI(uri fyne.URI) *Document {
+	for _, doc := range c.documents {
+		if doc.IsFile(uri) {
+			return doc
+		}
+	}
+	return nil
+}
+
+func (c *AppController) updateTabTitle(doc *Document) {
+	doc.tab.Text = doc.Title()
+	c.tabs.Refresh()
+	if doc == c.current {
+		c.updateTitle()
 	}
 }
 
@@ -116,169 +409,1267 @@ func (c *AppController) Open() {
 			return
 		}
 
-		c.editor.SetContent(string(data))
-		c.currentFile = reader.URI()
-		c.modified = false
-		c.updateTitle()
-		c.updateStatus()
-		
-		if c.saveMenuItem != nil {
-			c.saveMenuItem.Disabled = true
+		if doc := c.documentForURI(reader.URI()); doc != nil {
+			c.tabs.Select(doc.tab)
+			return
 		}
+		c.openDocument(reader.URI(), data, true)
 	}, c.window)
 
-	openDialog.SetFilter(storage.NewExtensionFileFilter([]string{".md", ".markdown", ".txt"}))
+	openDialog.SetFilter(storage.NewExtensionFileFilter(markdownExtensions))
 	openDialog.Show()
 }
 
-// Save saves the current file
-func (c *AppController) Save() {
-	if c.currentFile != nil {
-		c.saveToFile(c.currentFile)
-	} else {
-		c.SaveAs()
+// OpenFolder asks for a folder and shows its files in the workspace panel
+func (c *AppController) OpenFolder() {
+	if c.workspace == nil {
+		return
 	}
-}
-
-// SaveAs saves the file with a new name
-func (c *AppController) SaveAs() {
-	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+	folderDialog := dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
 		if err != nil {
 			dialog.ShowError(err, c.window)
 			return
 		}
-		if writer == nil {
+		if uri == nil {
 			return
 		}
-		
-		c.currentFile = writer.URI()
-		writer.Close()
-		c.saveToFile(c.currentFile)
+		c.workspace.SetRoot(uri.Path())
+		c.workspace.Show()
 	}, c.window)
 
-	saveDialog.SetFileName("untitled.md")
-	saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".md", ".markdown"}))
-	saveDialog.Show()
+	start := c.workspace.Root()
+	if start == "" && c.current != nil {
+		start = c.current.Dir()
+	}
+	if start != "" {
+		if location, err := storage.ListerForURI(storage.NewFileURI(start)); err == nil {
+			folderDialog.SetLocation(location)
+		}
+	}
+	folderDialog.Show()
 }
 
-func (c *AppController) saveToFile(uri fyne.URI) {
-	writer, err := storage.Writer(uri)
-	if err != nil {
-		dialog.ShowError(err, c.window)
+// MovedPath points documents open from a file, or from files in a folder,
+// at where the file or folder was moved to
+func (c *AppController) MovedPath(from, to string) {
+	for _, doc := range c.documents {
+		path := doc.Path()
+		if path != from && !strings.HasPrefix(path, from+string(filepath.Separator)) {
+			continue
+		}
+		moved := to + path[len(from):]
+		doc.uri = storage.NewFileURI(moved)
+		if doc.watched != "" {
+			c.watcher.Remove(doc.watched)
+			c.watcher.Add(moved)
+			doc.watched = moved
+		}
+		doc.preview.SetDir(doc.Dir())
+		c.updateTabTitle(doc)
+	}
+}
+
+// openDocument shows file content in a tab, reusing the active tab when it
+// is an untouched untitled buffer. exists is false for a file that will be
+// created by the first save.
+func (c *AppController) openDocument(uri fyne.URI, data []byte, exists bool) *Document {
+	doc := c.current
+	if doc == nil || !doc.IsEmpty() {
+		doc = c.addDocument()
+	}
+
+	c.loadDocument(doc, string(data), uri)
+	if exists {
+		c.trackFile(doc, data)
+	}
+	c.addRecent(uri)
+	return doc
+}
+
+// OpenRecent opens a file from the recent files list, dropping it from the
+// list if it can no longer be read
+func (c *AppController) OpenRecent(recent string) {
+	uri, err := storage.ParseURI(recent)
+	if err == nil && uri.Scheme() == "file" {
+		if _, err = os.Stat(uri.Path()); err == nil {
+			c.OpenPath(uri.Path(), 0, 0)
+			return
+		}
+	}
+
+	if err == nil {
+		if doc := c.documentForURI(uri); doc != nil {
+			c.tabs.Select(doc.tab)
+			return
+		}
+
+		var content string
+		if content, err = readURI(uri); err == nil {
+			c.openDocument(uri, []byte(content), true)
+			return
+		}
+	}
+
+	dialog.ShowError(err, c.window)
+	if prefs := c.preferences(); prefs != nil {
+		removeRecentFile(prefs, recent)
+		c.updateRecentMenu()
+	}
+}
+
+// ClearRecent empties the recent files list
+func (c *AppController) ClearRecent() {
+	if prefs := c.preferences(); prefs != nil {
+		prefs.SetStringList(preferenceRecentFiles, nil)
+		c.updateRecentMenu()
+	}
+}
+
+func (c *AppController) addRecent(uri fyne.URI) {
+	prefs := c.preferences()
+	if prefs == nil || uri == nil {
 		return
 	}
-	defer writer.Close()
+	addRecentFile(prefs, uri)
+	c.updateRecentMenu()
+}
 
-	_, err = writer.Write([]byte(c.editor.GetContent()))
-	if err != nil {
-		dialog.ShowError(err, c.window)
+func (c *AppController) updateRecentMenu() {
+	prefs := c.preferences()
+	if c.recentMenu == nil || prefs == nil {
 		return
 	}
 
-	c.modified = false
-	c.updateTitle()
-	c.updateStatus()
-	
-	if c.saveMenuItem != nil {
-		c.saveMenuItem.Disabled = true
+	var items []*fyne.MenuItem
+	for _, recent := range recentFiles(prefs) {
+		label := recent
+		if uri, err := storage.ParseURI(recent); err == nil && uri.Scheme() == "file" {
+			label = uri.Path()
+		}
+		items = append(items, fyne.NewMenuItem(label, func() {
+			c.OpenRecent(recent)
+		}))
 	}
-	
-	if c.statusBar != nil {
-		c.statusBar.SetText(fmt.Sprintf("Saved: %s", uri.Name()))
+
+	if len(items) == 0 {
+		empty := fyne.NewMenuItem("No Recent Files", nil)
+		empty.Disabled = true
+		items = append(items, empty)
+	} else {
+		items = append(items, fyne.NewMenuItemSeparator(), fyne.NewMenuItem("Clear Recent Files", c.ClearRecent))
+	}
+
+	c.recentMenu.Items = items
+	c.recentMenu.Refresh()
+	if mainMenu := c.window.MainMenu(); mainMenu != nil {
+		mainMenu.Refresh()
 	}
 }
 
-// ExportHTML exports the markdown to HTML
-func (c *AppController) ExportHTML() {
-	saveDialog := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
-		if err != nil {
-			dialog.ShowError(err, c.window)
-			return
+// SaveSession remembers the open files, cursor positions, layout and window
+// size so that the next run can carry on where this one stopped
+func (c *AppController) SaveSession() {
+	prefs := c.preferences()
+	if prefs == nil {
+		return
+	}
+
+	size := c.window.Canvas().Size()
+	state := &sessionState{Width: size.Width, Height: size.Height}
+	for _, doc := range c.documents {
+		// Untitled buffers are left to the recovery journal
+		if doc.uri == nil {
+			continue
 		}
-		if writer == nil {
-			return
+		if doc == c.current {
+			state.Active = len(state.Documents)
 		}
-		defer writer.Close()
 
-		html := c.preview.GetHTML()
-		_, err = writer.Write([]byte(html))
+		line, column := doc.editor.Cursor()
+		state.Documents = append(state.Documents, sessionDocument{
+			URI:            doc.uri.String(),
+			Line:           line,
+			Column:         column,
+			Split:          doc.split.Offset,
+			PreviewVisible: doc.preview.IsVisible(),
+		})
+	}
+	saveSession(prefs, state)
+}
+
+// RestoreSession reopens the files and layout remembered by SaveSession
+func (c *AppController) RestoreSession() {
+	prefs := c.preferences()
+	if prefs == nil {
+		return
+	}
+	state, ok := loadSession(prefs)
+	if !ok {
+		return
+	}
+
+	if state.Width > 0 && state.Height > 0 {
+		c.window.Resize(fyne.NewSize(state.Width, state.Height))
+	}
+
+	var active *Document
+	for i, saved := range state.Documents {
+		uri, err := storage.ParseURI(saved.URI)
 		if err != nil {
-			dialog.ShowError(err, c.window)
-			return
+			continue
 		}
-		
-		if c.statusBar != nil {
-			c.statusBar.SetText(fmt.Sprintf("Exported to: %s", writer.URI().Name()))
+		content, err := readURI(uri)
+		if err != nil {
+			// Files deleted or moved since the last run are skipped
+			continue
 		}
-	}, c.window)
 
-	saveDialog.SetFileName("export.html")
-	saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".html", ".htm"}))
-	saveDialog.Show()
+		doc := c.documentForURI(uri)
+		if doc == nil {
+			doc = c.openDocument(uri, []byte(content), true)
+		}
+		doc.editor.GoTo(saved.Line, saved.Column)
+		if saved.Split > 0 {
+			doc.split.SetOffset(saved.Split)
+		}
+		doc.preview.SetVisible(saved.PreviewVisible)
+		if i == state.Active {
+			active = doc
+		}
+	}
+
+	if active != nil {
+		c.tabs.Select(active.tab)
+	}
 }
 
-// HandleClose handles window close event
-func (c *AppController) HandleClose() {
-	if c.modified {
-		dialog.ShowConfirm("Unsaved Changes",
-			"Do you want to save your changes before closing?",
-			func(save bool) {
-				if save {
-					c.Save()
-				}
-				c.window.Close()
-			}, c.window)
-	} else {
-		c.window.Close()
+func (c *AppController) preferences() fyne.Preferences {
+	if a := fyne.CurrentApp(); a != nil {
+		return a.Preferences()
 	}
+	return nil
 }
 
-// InsertMarkdown inserts markdown syntax
-func (c *AppController) InsertMarkdown(before, after string, placeholder string) {
-	if c.editor != nil {
-		c.editor.InsertMarkdown(before, after, placeholder)
+// OpenTargets opens files named on the command line or forwarded by another
+// launch of the editor
+func (c *AppController) OpenTargets(targets []openTarget) {
+	for _, target := range targets {
+		c.OpenPath(target.Path, target.Line, target.Column)
+	}
+	if len(targets) > 0 {
+		c.window.RequestFocus()
 	}
 }
 
-// InsertAtLineStart inserts text at the beginning of the current line
-func (c *AppController) InsertAtLineStart(prefix string) {
-	if c.editor != nil {
-		c.editor.InsertAtLineStart(prefix)
+// OpenLaunch handles a later launch of the editor that was forwarded to this
+// one: it opens the files named, or a new untitled tab when there are none,
+// and raises the window either way
+func (c *AppController) OpenLaunch(targets []openTarget) {
+	if len(targets) == 0 {
+		if c.current == nil || !c.current.IsEmpty() {
+			c.NewFile()
+		}
+		c.window.Canvas().Focus(c.current.editor.entry)
+		c.window.RequestFocus()
+		return
 	}
+	c.OpenTargets(targets)
 }
 
-// TogglePreview toggles the preview pane visibility
-func (c *AppController) TogglePreview() {
-	if c.preview != nil {
-		c.preview.ToggleVisibility()
+// OpenPath opens a local file, or selects its tab if it is already open,
+// and moves the cursor to the 1-based line and column when given
+func (c *AppController) OpenPath(path string, line, column int) {
+	uri := storage.NewFileURI(path)
+	doc := c.documentForURI(uri)
+	if doc == nil {
+		data, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			dialog.ShowError(err, c.window)
+			return
+		}
+		doc = c.openDocument(uri, data, err == nil)
 	}
+
+	c.tabs.Select(doc.tab)
+	if line > 0 {
+		doc.editor.GoTo(line, column)
+	}
+	c.window.Canvas().Focus(doc.editor.entry)
 }
 
-// ShowFind shows the find dialog
-func (c *AppController) ShowFind() {
-	if c.editor != nil {
-		c.editor.ShowFindDialog()
+// Save saves the active document
+func (c *AppController) Save() {
+	c.saveDocument(c.current, nil)
+}
+
+// SaveAs saves the active document with a new name
+func (c *AppController) SaveAs() {
+	c.saveDocumentAs(c.current, nil)
+}
+
+// saveDocument saves the document to its file, asking for a name if it has
+// none yet. onSaved is only called once the content has been written.
+func (c *AppController) saveDocument(doc *Document, onSaved func()) {
+	if doc.uri == nil {
+		c.saveDocumentAs(doc, onSaved)
+		return
+	}
+
+	if c.saveToFile(doc, doc.uri) && onSaved != nil {
+		onSaved()
 	}
 }
 
-// ShowReplace shows the replace dialog
-func (c *AppController) ShowReplace() {
-	if c.editor != nil {
-		c.editor.ShowReplaceDialog()
+// saveDocumentAs asks for a folder and file name to save the document as
+func (c *AppController) saveDocumentAs(doc *Document, onSaved func()) {
+	name := "untitled.md"
+	if doc.uri != nil {
+		name = doc.Name()
+	}
+	withExtension := func(name string) string {
+		if !isMarkdownFile(name) {
+			name += ".md"
+		}
+		return name
 	}
+
+	c.askSavePath(doc, "Save As", "Save", name, withExtension, true, func(path string) {
+		// The user picked this destination, so whatever is there may be replaced
+		c.untrackFile(doc)
+		doc.uri = storage.NewFileURI(path)
+		doc.preview.SetDir(doc.Dir())
+		if c.saveToFile(doc, doc.uri) && onSaved != nil {
+			onSaved()
+		}
+	})
 }
 
-func (c *AppController) updateTitle() {
-	title := "Markdown Editor"
-	if c.currentFile != nil {
-		title = fmt.Sprintf("%s - %s", title, c.currentFile.Name())
-	} else {
-		title = fmt.Sprintf("%s - Untitled", title)
+// askSavePath asks for a folder and file name to write a document to, and
+// calls save with the path once the user agrees to replace any file there,
+// which is not asked for the document's own file if replaceOwn is set.
+// Fyne's save dialog opens the file it returns for writing, which
+// empties an existing file before the atomic write and its backup could
+// run, so only the folder is chosen with a dialog.
+func (c *AppController) askSavePath(doc *Document, title, confirm, name string, withExtension func(string) string, replaceOwn bool, save func(path string)) {
+	dir := doc.Dir()
+	if dir == "" && c.workspace != nil {
+		dir = c.workspace.Root()
 	}
-	if c.modified {
-		title = fmt.Sprintf("%s *", title)
+	if dir == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = home
+		}
+	}
+
+	folder := widget.NewLabel(dir)
+	folder.Truncation = fyne.TextTruncateEllipsis
+	choose := widget.NewButtonWithIcon("", theme.FolderOpenIcon(), func() {
+		folderDialog := dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
+			if err != nil {
+				dialog.ShowError(err, c.window)
+				return
+			}
+			if uri != nil {
+				dir = uri.Path()
+				folder.SetText(dir)
+			}
+		}, c.window)
+		if location, err := storage.ListerForURI(storage.NewFileURI(dir)); err == nil {
+			folderDialog.SetLocation(location)
+		}
+		folderDialog.Show()
+	})
+	entry := widget.NewEntry()
+	entry.SetText(name)
+	entry.Validator = func(name string) error {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "" || name == "." || name == "..":
+			return errors.New("enter a name")
+		case strings.ContainsAny(name, `/\`):
+			return errors.New("a name cannot contain / or \\")
+		}
+		return nil
+	}
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Folder", container.NewBorder(nil, nil, nil, choose, folder)),
+		widget.NewFormItem("Name", entry),
+	}
+	form := dialog.NewForm(title, confirm, "Cancel", items, func(ok bool) {
+		if !ok || dir == "" {
+			return
+		}
+		name := withExtension(strings.TrimSpace(entry.Text))
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil && !(replaceOwn && doc.IsFile(storage.NewFileURI(path))) {
+			dialog.ShowConfirm("Replace File", fmt.Sprintf("%s already exists. Do you want to replace it?", name), func(replace bool) {
+				if replace {
+					save(path)
+				}
+			}, c.window)
+			return
+		}
+		save(path)
+	}, c.window)
+	form.Resize(fyne.NewSize(480, form.MinSize().Height))
+	form.Show()
+	c.window.Canvas().Focus(entry)
+}
+
+func (c *AppController) saveToFile(doc *Document, uri fyne.URI) bool {
+	// Refuse to overwrite changes another program made since the file was loaded
+	if doc.IsFile(uri) {
+		if disk, err := readURI(uri); err == nil && doc.ChangedOnDisk([]byte(disk)) {
+			if c.statusBar != nil {
+				c.statusBar.SetText(fmt.Sprintf("Not saved: %s was changed on disk", uri.Name()))
+			}
+			c.showConflict(doc, disk)
+			return false
+		}
+	}
+
+	content := []byte(doc.editor.FileContent())
+	if err := c.writeURI(uri, content); err != nil {
+		dialog.ShowError(err, c.window)
+		return false
+	}
+	c.trackFile(doc, content)
+	c.addRecent(uri)
+
+	doc.modified = false
+	doc.journaled = ""
+	c.recovery.Remove(doc.id)
+	c.updateTabTitle(doc)
+	if doc != c.current {
+		return true
+	}
+	c.updateStatus()
+	
+	if c.saveMenuItem != nil {
+		c.saveMenuItem.Disabled = true
+	}
+	
+	if c.statusBar != nil {
+		c.statusBar.SetText(fmt.Sprintf("Saved: %s", uri.Name()))
+	}
+	return true
+}
+
+// StartAutosave periodically writes unsaved buffers, including untitled ones,
+// to the recovery journal
+func (c *AppController) StartAutosave() {
+	go func() {
+		ticker := time.NewTicker(autosaveInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			c.recovery.Touch()
+			fyne.Do(c.autosave)
+		}
+	}()
+}
+
+func (c *AppController) autosave() {
+	for _, doc := range c.documents {
+		if !doc.modified {
+			continue
+		}
+
+		content := doc.editor.FileContent()
+		if content == doc.journaled {
+			continue
+		}
+		if err := c.recovery.Save(doc, content); err != nil {
+			fyne.LogError("Failed to autosave "+doc.Name(), err)
+			continue
+		}
+		doc.journaled = content
+	}
+}
+
+// RestoreRecovered offers to restore or discard buffers left in the recovery
+// journal by editors that did not shut down cleanly and are no longer running
+func (c *AppController) RestoreRecovered() {
+	entries, err := c.recovery.Entries()
+	if err != nil {
+		fyne.LogError("Failed to read recovery journal", err)
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	rows := container.NewVBox()
+	d := dialog.NewCustom("Recover Unsaved Changes", "Decide Later", container.NewVBox(
+		widget.NewLabel("These documents had unsaved changes when the editor last closed:"),
+		rows,
+	), c.window)
+
+	for _, entry := range entries {
+		var row *fyne.Container
+		settle := func() {
+			rows.Remove(row)
+			if len(rows.Objects) == 0 {
+				d.Hide()
+			}
+		}
+
+		label := widget.NewLabel(fmt.Sprintf("%s (autosaved %s)", entry.Name, entry.Saved.Format("Jan 2 15:04")))
+		buttons := container.NewHBox(
+			widget.NewButton("Restore", func() {
+				c.restoreEntry(entry)
+				settle()
+			}),
+			widget.NewButton("Discard", func() {
+				c.recovery.Discard(entry)
+				settle()
+			}),
+		)
+		if uri, err := storage.ParseURI(entry.URI); err == nil && entry.URI != "" {
+			if disk, err := readURI(uri); err == nil {
+				buttons.Add(widget.NewButton("Show Diff", func() {
+					showDiffDialog("Changes in "+entry.Name, disk, entry.Content, c.window)
+				}))
+			}
+		}
+
+		row = container.NewBorder(nil, nil, nil, buttons, label)
+		rows.Add(row)
+	}
+
+	d.Show()
+}
+
+func (c *AppController) restoreEntry(entry *RecoveryEntry) {
+	var uri fyne.URI
+	if entry.URI != "" {
+		uri, _ = storage.ParseURI(entry.URI)
+	}
+
+	// The file may already be open, for example from the restored session
+	doc := c.documentForURI(uri)
+	if doc == nil {
+		doc = c.current
+		if doc == nil || !doc.IsEmpty() {
+			doc = c.addDocument()
+		}
+	}
+
+	// Keep the journal entry under its old ID until the buffer is saved or
+	// closed, moved into the journal of this editor
+	if err := c.recovery.Adopt(entry); err != nil {
+		fyne.LogError("Failed to move "+entry.Name+" into the recovery journal", err)
+	}
+	c.loadDocument(doc, entry.Content, uri)
+	if uri != nil {
+		if disk, err := readURI(uri); err == nil {
+			c.trackFile(doc, []byte(disk))
+		}
+	}
+	doc.id = entry.ID
+	doc.journaled = entry.Content
+	doc.modified = true
+	c.updateTabTitle(doc)
+	c.activate(doc)
+}
+
+// writeURI saves content to a URI, atomically and with backups for local files
+func (c *AppController) writeURI(uri fyne.URI, content []byte) error {
+	if uri.Scheme() == "file" {
+		return writeFileAtomic(uri.Path(), content, c.BackupPolicy())
+	}
+
+	writer, err := storage.Writer(uri)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	_, err = writer.Write(content)
+	return err
+}
+
+// BackupPolicy returns which previous versions are kept when saving
+func (c *AppController) BackupPolicy() BackupPolicy {
+	prefs := c.preferences()
+	if prefs == nil {
+		return BackupNone
+	}
+	return BackupPolicy(prefs.IntWithFallback(preferenceBackupPolicy, int(BackupNone)))
+}
+
+// SetBackupPolicy changes which previous versions are kept when saving
+func (c *AppController) SetBackupPolicy(policy BackupPolicy) {
+	if prefs := c.preferences(); prefs != nil {
+		prefs.SetInt(preferenceBackupPolicy, int(policy))
+	}
+}
+
+// CodeHighlight returns how fenced code blocks are highlighted
+func (c *AppController) CodeHighlight() codeHighlight {
+	prefs := c.preferences()
+	if prefs == nil {
+		return codeHighlight{}
+	}
+
+	code := codeHighlight{
+		style:   prefs.StringWithFallback(preferenceCodeStyle, codeStyleAuto),
+		classes: prefs.Bool(preferenceCodeClasses),
+	}
+	if !codeStyleExists(code.style) {
+		code.style = codeStyleAuto
+	}
+	return code
+}
+
+// SetCodeHighlight changes how fenced code blocks are highlighted in the
+// previews and in HTML exports
+func (c *AppController) SetCodeHighlight(code codeHighlight) {
+	if prefs := c.preferences(); prefs != nil {
+		prefs.SetString(preferenceCodeStyle, code.style)
+		prefs.SetBool(preferenceCodeClasses, code.classes)
+	}
+	for _, doc := range c.documents {
+		doc.preview.SetCodeHighlight(code)
+	}
+}
+
+// MathOptions returns how formulas are written in HTML exports
+func (c *AppController) MathOptions() mathOptions {
+	prefs := c.preferences()
+	if prefs == nil {
+		return mathOptions{}
+	}
+	return mathOptions{
+		katex:         prefs.Bool(preferenceMathKaTeX),
+		katexLocation: prefs.String(preferenceKaTeXLocation),
+	}
+}
+
+// SetMathOptions changes how formulas are written in HTML exports
+func (c *AppController) SetMathOptions(opts mathOptions) {
+	if prefs := c.preferences(); prefs != nil {
+		prefs.SetBool(preferenceMathKaTeX, opts.katex)
+		prefs.SetString(preferenceKaTeXLocation, opts.katexLocation)
+	}
+}
+
+// ChooseKaTeXFolder asks for the folder of a downloaded KaTeX release to
+// use in HTML exports, calling chosen once it has been set
+func (c *AppController) ChooseKaTeXFolder(chosen func()) {
+	dialog.ShowFolderOpen(func(folder fyne.ListableURI, err error) {
+		if err != nil {
+			dialog.ShowError(err, c.window)
+			return
+		}
+		if folder == nil {
+			return
+		}
+
+		dir := folder.Path()
+		if _, err := os.Stat(filepath.Join(dir, "katex.min.css")); err != nil {
+			dialog.ShowError(fmt.Errorf("%s does not contain katex.min.css; choose the dist folder of a KaTeX release", dir), c.window)
+			return
+		}
+		c.SetMathOptions(mathOptions{katex: true, katexLocation: dir})
+		chosen()
+	}, c.window)
+}
+
+// ExportHTML exports the markdown to HTML
+func (c *AppController) ExportHTML() {
+	if c.current != nil {
+		c.exportDocument(c.current, ".html", func(w io.Writer, source []byte, parsed ast.Node, dir, title string) error {
+			page, err := c.renderHTMLExport(source, parsed, title)
+			if err != nil {
+				return err
+			}
+			_, err = io.WriteString(w, page)
+			return err
+		}, nil)
+	}
+}
+
+// renderHTMLExport renders a document as a page with the chosen template
+func (c *AppController) renderHTMLExport(source []byte, parsed ast.Node, title string) (string, error) {
+	page, err := loadPageTemplate(c.HTMLTemplate())
+	if err != nil {
+		return "", err
+	}
+	return renderHTMLPage(source, parsed, htmlPageOptions{code: c.CodeHighlight(), math: c.MathOptions(), page: page, title: title})
+}
+
+// HTMLTemplate returns the template for HTML exports, a built-in name or
+// the path of a template file
+func (c *AppController) HTMLTemplate() string {
+	prefs := c.preferences()
+	if prefs == nil {
+		return pageTemplateDefault
+	}
+	return prefs.StringWithFallback(preferenceHTMLTemplate, pageTemplateDefault)
+}
+
+// SetHTMLTemplate chooses the template for HTML exports
+func (c *AppController) SetHTMLTemplate(choice string) {
+	if prefs := c.preferences(); prefs != nil {
+		prefs.SetString(preferenceHTMLTemplate, choice)
+	}
+}
+
+// ChooseHTMLTemplate asks for an html/template file to export HTML with,
+// calling chosen once it has been set
+func (c *AppController) ChooseHTMLTemplate(chosen func()) {
+	openDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil {
+			dialog.ShowError(err, c.window)
+			return
+		}
+		if reader == nil {
+			return
+		}
+		reader.Close()
+
+		path := reader.URI().Path()
+		if _, err := loadPageTemplate(path); err != nil {
+			dialog.ShowError(err, c.window)
+			return
+		}
+		c.SetHTMLTemplate(path)
+		chosen()
+	}, c.window)
+	openDialog.SetFilter(storage.NewExtensionFileFilter([]string{".html", ".htm", ".tmpl", ".gohtml"}))
+	openDialog.Show()
+}
+
+// EmbedOptions returns what the last self-contained HTML export embedded
+func (c *AppController) EmbedOptions() embedOptions {
+	prefs := c.preferences()
+	if prefs == nil {
+		return embedOptions{stylesheets: true}
+	}
+	return embedOptions{
+		stylesheets: prefs.BoolWithFallback(preferenceEmbedStylesheets, true),
+		fonts:       prefs.Bool(preferenceEmbedFonts),
+	}
+}
+
+// SetEmbedOptions remembers what to embed in self-contained HTML exports
+func (c *AppController) SetEmbedOptions(opts embedOptions) {
+	if prefs := c.preferences(); prefs != nil {
+		prefs.SetBool(preferenceEmbedStylesheets, opts.stylesheets)
+		prefs.SetBool(preferenceEmbedFonts, opts.fonts)
+	}
+}
+
+// ExportSelfContainedHTML exports the markdown to a single HTML file with
+// its local images, and optionally stylesheets and fonts, embedded
+func (c *AppController) ExportSelfContainedHTML() {
+	doc := c.current
+	if doc == nil {
+		return
+	}
+	opts := c.EmbedOptions()
+
+	stylesheets := widget.NewCheck("Inline local stylesheets and scripts", nil)
+	stylesheets.SetChecked(opts.stylesheets)
+	fonts := widget.NewCheck("Embed fonts", nil)
+	fonts.SetChecked(opts.fonts)
+
+	items := []*widget.FormItem{
+		{Text: "Stylesheets", Widget: stylesheets, HintText: "Images are always embedded"},
+		{Text: "Fonts", Widget: fonts, HintText: "Adds about 3 MB, but the page looks the same everywhere"},
+	}
+	d := dialog.NewForm("Export as Self-Contained HTML", "Export", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		opts.stylesheets = stylesheets.Checked
+		opts.fonts = fonts.Checked
+		c.SetEmbedOptions(opts)
+		c.saveSelfContainedHTML(doc, opts)
+	}, c.window)
+	d.Resize(fyne.NewSize(480, d.MinSize().Height))
+	d.Show()
+}
+
+// saveSelfContainedHTML asks where to save the portable HTML page of a
+// document and writes it, then lists any assets that could not be embedded
+func (c *AppController) saveSelfContainedHTML(doc *Document, opts embedOptions) {
+	var missing []missingAsset
+	c.exportDocument(doc, ".html", func(w io.Writer, source []byte, parsed ast.Node, dir, title string) error {
+		page, err := c.renderHTMLExport(source, parsed, title)
+		if err != nil {
+			return err
+		}
+		page, missing = embedAssets(page, dir, opts)
+		_, err = io.WriteString(w, page)
+		return err
+	}, func() {
+		if len(missing) > 0 {
+			c.showMissingAssets(missing)
+		}
+	})
+}
+
+// showMissingAssets lists the references that an export could not embed
+func (c *AppController) showMissingAssets(missing []missingAsset) {
+	lines := make([]string, len(missing))
+	for i, asset := range missing {
+		lines[i] = asset.String()
+	}
+	message := widget.NewLabel(fmt.Sprintf("%d assets could not be embedded and still point to their original location:", len(missing)))
+	if len(missing) == 1 {
+		message.SetText("1 asset could not be embedded and still points to its original location:")
+	}
+	message.Wrapping = fyne.TextWrapWord
+	list := widget.NewLabel(strings.Join(lines, "\n"))
+	list.TextStyle = fyne.TextStyle{Monospace: true}
+
+	scroll := container.NewScroll(list)
+	scroll.SetMinSize(fyne.NewSize(480, 160))
+	d := dialog.NewCustom("Missing Assets", "OK", container.NewBorder(message, nil, nil, nil, scroll), c.window)
+	d.Show()
+}
+
+// PDFOptions returns the page setup last used for PDF export
+func (c *AppController) PDFOptions() pdfOptions {
+	opts := defaultPDFOptions()
+	prefs := c.preferences()
+	if prefs == nil {
+		return opts
+	}
+
+	opts.pageSize = prefs.StringWithFallback(preferencePDFPageSize, opts.pageSize)
+	opts.margin = prefs.FloatWithFallback(preferencePDFMargin, opts.margin)
+	opts.header = prefs.StringWithFallback(preferencePDFHeader, opts.header)
+	opts.footer = prefs.StringWithFallback(preferencePDFFooter, opts.footer)
+	return opts
+}
+
+// SetPDFOptions stores the page setup for the next PDF export
+func (c *AppController) SetPDFOptions(opts pdfOptions) {
+	if prefs := c.preferences(); prefs != nil {
+		prefs.SetString(preferencePDFPageSize, opts.pageSize)
+		prefs.SetFloat(preferencePDFMargin, opts.margin)
+		prefs.SetString(preferencePDFHeader, opts.header)
+		prefs.SetString(preferencePDFFooter, opts.footer)
+	}
+}
+
+// ExportPDF asks for the page setup and exports the markdown to PDF
+func (c *AppController) ExportPDF() {
+	doc := c.current
+	if doc == nil {
+		return
+	}
+	opts := c.PDFOptions()
+
+	pageSize := widget.NewSelect(pdfPageSizes, nil)
+	pageSize.SetSelected(opts.pageSize)
+	margin := widget.NewEntry()
+	margin.SetText(strconv.FormatFloat(opts.margin, 'f', -1, 64))
+	margin.Validator = func(text string) error {
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil || value < pdfMinMargin || value > pdfMaxMargin {
+			return fmt.Errorf("enter a margin from %d to %d mm", pdfMinMargin, pdfMaxMargin)
+		}
+		return nil
+	}
+	header := widget.NewEntry()
+	header.SetText(opts.header)
+	footer := widget.NewEntry()
+	footer.SetText(opts.footer)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Page Size", pageSize),
+		widget.NewFormItem("Margin (mm)", margin),
+		widget.NewFormItem("Header", header),
+		{Text: "Footer", Widget: footer, HintText: "{title}, {page}, {pages} and {date} are filled in"},
+	}
+	d := dialog.NewForm("Export as PDF", "Export", "Cancel", items, func(confirmed bool) {
+		if !confirmed {
+			return
+		}
+		opts.pageSize = pageSize.Selected
+		opts.margin, _ = strconv.ParseFloat(margin.Text, 64)
+		opts.header = header.Text
+		opts.footer = footer.Text
+		c.SetPDFOptions(opts)
+		c.savePDF(doc, opts)
+	}, c.window)
+	d.Resize(fyne.NewSize(480, d.MinSize().Height))
+	d.Show()
+}
+
+// savePDF asks where to save the PDF of a document and writes it
+func (c *AppController) savePDF(doc *Document, opts pdfOptions) {
+	c.exportDocument(doc, ".pdf", func(w io.Writer, source []byte, parsed ast.Node, dir, title string) error {
+		opts.title = title
+		return renderPDF(w, source, parsed, dir, opts, c.CodeHighlight())
+	}, nil)
+}
+
+// ExportDOCX exports the markdown to a Word document
+func (c *AppController) ExportDOCX() {
+	if c.current != nil {
+		c.exportDocument(c.current, ".docx", func(w io.Writer, source []byte, parsed ast.Node, dir, title string) error {
+			return renderDOCX(w, source, parsed, dir, title, c.CodeHighlight())
+		}, nil)
+	}
+}
+
+// ExportODT exports the markdown to an OpenDocument text file
+func (c *AppController) ExportODT() {
+	if c.current != nil {
+		c.exportDocument(c.current, ".odt", func(w io.Writer, source []byte, parsed ast.Node, dir, title string) error {
+			return renderODT(w, source, parsed, dir, title, c.CodeHighlight())
+		}, nil)
+	}
+}
+
+// exportDocument asks where to save an export of a document and writes it
+// with render, which is given the folder that images are relative to and
+// the document title. done, if not nil, runs once the export is written.
+func (c *AppController) exportDocument(doc *Document, extension string, render func(w io.Writer, source []byte, parsed ast.Node, dir, title string) error, done func()) {
+	c.refreshPreview(doc)
+	source, parsed := doc.preview.Parsed()
+	name := strings.TrimSuffix(doc.Name(), filepath.Ext(doc.Name()))
+	title := documentTitle(source, parsed, name)
+
+	// Images are found relative to the document, as in the preview
+	dir := doc.Dir()
+
+	withExtension := func(name string) string {
+		if !strings.EqualFold(filepath.Ext(name), extension) {
+			name += extension
+		}
+		return name
+	}
+
+	// The page is rendered in full before the file is replaced, so a failed
+	// export leaves an earlier one as it was
+	c.askSavePath(doc, "Export", "Export", name+extension, withExtension, false, func(path string) {
+		var buf bytes.Buffer
+		if err := render(&buf, source, parsed, dir, title); err != nil {
+			dialog.ShowError(err, c.window)
+			return
+		}
+		if err := c.writeURI(storage.NewFileURI(path), buf.Bytes()); err != nil {
+			dialog.ShowError(err, c.window)
+			return
+		}
+
+		if c.statusBar != nil {
+			c.statusBar.SetText(fmt.Sprintf("Exported to: %s", filepath.Base(path)))
+		}
+		if done != nil {
+			done()
+		}
+	})
+}
+
+// HandleClose handles window close event
+func (c *AppController) HandleClose() {
+	c.SaveSession()
+	c.closeDocuments(append([]*Document(nil), c.documents...), c.window.Close)
+}
+
+// InsertMarkdown inserts markdown syntax
+func (c *AppController) InsertMarkdown(before, after string, placeholder string) {
+	if c.editor != nil {
+		c.editor.InsertMarkdown(before, after, placeholder)
+	}
+}
+
+// InsertAtLineStart inserts text at the beginning of the current line
+func (c *AppController) InsertAtLineStart(prefix string) {
+	if c.editor != nil {
+		c.editor.InsertAtLineStart(prefix)
+	}
+}
+
+// TogglePreview toggles the preview pane visibility
+func (c *AppController) TogglePreview() {
+	if c.preview != nil {
+		c.preview.ToggleVisibility()
+	}
+}
+
+// ToggleWorkspace shows or hides the workspace panel
+func (c *AppController) ToggleWorkspace() {
+	if c.workspace != nil {
+		c.workspace.ToggleVisibility()
+	}
+}
+
+// ToggleOutline shows or hides the outline panel
+func (c *AppController) ToggleOutline() {
+	if c.outline != nil {
+		c.outline.ToggleVisibility()
+	}
+}
+
+// GoToLine moves the cursor to the start of a 1-based line and focuses the editor
+func (c *AppController) GoToLine(line int) {
+	if c.editor == nil {
+		return
+	}
+	c.editor.GoTo(line, 1)
+	c.window.Canvas().Focus(c.editor.entry)
+}
+
+// MoveSection moves the section of headings[from] before or after the
+// section of headings[to], as one step that can be undone
+func (c *AppController) MoveSection(headings []outlineHeading, from, to int, after bool) {
+	if c.editor == nil {
+		return
+	}
+
+	// The headings are only as recent as the last preview render
+	if source, _ := c.preview.Parsed(); string(source) != c.editor.GetContent() {
+		c.refreshPreview(c.current)
+		return
+	}
+
+	text, offset, ok := moveSection(c.editor.GetContent(), headings, from, to, after)
+	if !ok {
+		return
+	}
+	c.editor.ReplaceText(text)
+	c.GoToLine(strings.Count(text[:offset], "\n") + 1)
+}
+
+// SyncScroll reports whether the editor and preview scroll together
+func (c *AppController) SyncScroll() bool {
+	prefs := c.preferences()
+	if prefs == nil {
+		return true
+	}
+	return prefs.BoolWithFallback(preferenceSyncScroll, true)
+}
+
+// SetSyncScroll turns synchronized scrolling on or off
+func (c *AppController) SetSyncScroll(enabled bool) {
+	if prefs := c.preferences(); prefs != nil {
+		prefs.SetBool(preferenceSyncScroll, enabled)
+	}
+	if enabled && c.current != nil {
+		c.OnEditorScrolled(c.current.editor)
+	}
+}
+
+// WordWrap reports whether long lines wrap in the editor
+func (c *AppController) WordWrap() bool {
+	prefs := c.preferences()
+	if prefs == nil {
+		return true
+	}
+	return prefs.BoolWithFallback(preferenceWordWrap, true)
+}
+
+// SetWordWrap turns wrapping long lines on or off in every editor
+func (c *AppController) SetWordWrap(enabled bool) {
+	if prefs := c.preferences(); prefs != nil {
+		prefs.SetBool(preferenceWordWrap, enabled)
+	}
+	for _, doc := range c.documents {
+		doc.editor.SetWrap(enabled)
+	}
+}
+
+// OnEditorScrolled scrolls the preview to the lines at the top of the editor
+func (c *AppController) OnEditorScrolled(editor *Editor) {
+	doc := c.documentForEditor(editor)
+	if !c.canSync(doc) {
+		return
+	}
+
+	c.syncing = true
+	doc.preview.ScrollToLine(editor.TopLine(), 0)
+	c.syncing = false
+}
+
+// OnCursorMoved scrolls the preview so that the block being edited is level
+// with the cursor
+func (c *AppController) OnCursorMoved(editor *Editor) {
+	doc := c.documentForEditor(editor)
+	if !c.canSync(doc) {
+		return
+	}
+
+	line, _ := editor.Cursor()
+	c.syncing = true
+	doc.preview.ScrollToLine(float32(line-1), editor.CursorOffset())
+	c.syncing = false
+}
+
+// OnPreviewScrolled scrolls the editor to the lines at the top of the preview
+func (c *AppController) OnPreviewScrolled(doc *Document) {
+	if !c.canSync(doc) {
+		return
+	}
+
+	c.syncing = true
+	doc.editor.ScrollToLine(doc.preview.TopLine())
+	c.syncing = false
+}
+
+// canSync reports whether the panes of a document should follow each other
+func (c *AppController) canSync(doc *Document) bool {
+	return doc != nil && !c.syncing && doc.preview.IsVisible() && c.SyncScroll()
+}
+
+// ShowFind shows the find dialog
+func (c *AppController) ShowFind() {
+	if c.editor != nil {
+		c.editor.ShowFindDialog()
+	}
+}
+
+// ShowReplace shows the replace dialog
+func (c *AppController) ShowReplace() {
+	if c.editor != nil {
+		c.editor.ShowReplaceDialog()
+	}
+}
+
+// FindNext selects the next match of the last search, asking for one if
+// there is none yet
+func (c *AppController) FindNext() {
+	if c.editor != nil && !c.editor.FindNext(false) {
+		c.editor.ShowFindDialog()
+	}
+}
+
+// FindPrevious selects the previous match of the last search, asking for
+// one if there is none yet
+func (c *AppController) FindPrevious() {
+	if c.editor != nil && !c.editor.FindNext(true) {
+		c.editor.ShowFindDialog()
+	}
+}
+
+// ShowFindInFolder shows the folder search panel, filled in with the
+// selection if it is on one line
+func (c *AppController) ShowFindInFolder() {
+	if c.searchPanel == nil {
+		return
+	}
+	query, folder := "", ""
+	if c.current != nil {
+		if selected := c.editor.entry.SelectedText(); !strings.Contains(selected, "\n") {
+			query = selected
+		}
+		folder = c.current.Dir()
+	}
+	if c.workspace != nil && c.workspace.Root() != "" {
+		folder = c.workspace.Root()
+	}
+	c.searchPanel.Show(query, folder)
+}
+
+// OpenFolderMatch opens the file of a folder search match at its line,
+// selecting the match if the file is as it was searched
+func (c *AppController) OpenFolderMatch(file folderFile, m folderMatch) {
+	c.OpenPath(file.path, m.line, m.column)
+	if doc := c.documentForURI(storage.NewFileURI(file.path)); doc != nil && doc.editor.GetContent() == file.text {
+		doc.editor.Select(m.match.start, m.match.end)
+	}
+}
+
+// applyFolderEdits changes files from their before to their after text.
+// Open documents are changed in the editor, as one step to undo, and left to
+// be saved, and other files are saved straight away. Files whose content is
+// no longer the before text are skipped and returned.
+func (c *AppController) applyFolderEdits(edits []folderEdit) (applied []folderEdit, skipped []string) {
+	for _, edit := range edits {
+		if doc := c.documentForURI(storage.NewFileURI(edit.path)); doc != nil {
+			if doc.editor.GetContent() != edit.before {
+				skipped = append(skipped, edit.path)
+				continue
+			}
+			doc.editor.ReplaceText(edit.after)
+			applied = append(applied, edit)
+			continue
+		}
+
+		data, err := os.ReadFile(edit.path)
+		if err != nil || string(data) != edit.before {
+			skipped = append(skipped, edit.path)
+			continue
+		}
+		if err := writeFileAtomic(edit.path, []byte(edit.after), c.BackupPolicy()); err != nil {
+			fyne.LogError("Failed to replace in "+edit.path, err)
+			skipped = append(skipped, edit.path)
+			continue
+		}
+		applied = append(applied, edit)
+	}
+	return applied, skipped
+}
+
+// readURI returns the full text content of a URI
+func readURI(uri fyne.URI) (string, error) {
+	reader, err := storage.Reader(uri)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	return string(data), err
+}
+
+func (c *AppController) updateTitle() {
+	if c.current == nil {
+		return
+	}
+
+	title := fmt.Sprintf("Markdown Editor - %s", c.current.Name())
+	if meta := metaTitle(c.current.preview.Parsed()); meta != "" {
+		title = fmt.Sprintf("Markdown Editor - %s (%s)", meta, c.current.Name())
+	}
+	if c.current.modified {
+		title = fmt.Sprintf("%s *", title)
+	}
+	c.window.SetTitle(title)
+}
+
+// updateOutline shows the headings of the active document in the outline
+func (c *AppController) updateOutline() {
+	if c.outline != nil && c.preview != nil {
+		c.outline.Update(c.preview.Parsed())
+	}
+}
+
+// schedulePreview renders the preview and outline of a document again once
+// typing pauses, so that long documents do not slow the editor down
+func (c *AppController) schedulePreview(doc *Document) {
+	if doc.previewTimer != nil {
+		doc.previewTimer.Stop()
+	}
+	doc.previewTimer = time.AfterFunc(previewDelay, func() {
+		fyne.Do(func() {
+			c.refreshPreview(doc)
+		})
+	})
+}
+
+// refreshPreview renders the preview and outline of a document straight away
+func (c *AppController) refreshPreview(doc *Document) {
+	if doc.previewTimer != nil {
+		doc.previewTimer.Stop()
+		doc.previewTimer = nil
+	}
+
+	doc.preview.UpdateContent(doc.editor.GetContent())
+	if doc == c.current {
+		// The title may come from the front matter
+		c.updateTitle()
+		c.updateOutline()
+		c.OnCursorMoved(doc.editor)
 	}
-	c.window.SetTitle(title)
 }
 
 func (c *AppController) updateStatus() {
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"image/color"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// diagramLanguages maps the info strings of fenced code blocks that hold
+// diagrams to the syntax they are written in
+var diagramLanguages = map[string]string{
+	"mermaid":  "mermaid",
+	"dot":      "dot",
+	"graphviz": "dot",
+	"gv":       "dot",
+	"plantuml": "plantuml",
+	"puml":     "plantuml",
+}
+
+// kindDiagram is the node kind of diagrams
+var kindDiagram = ast.NewNodeKind("Diagram")
+
+// diagramNode is a fenced code block that holds a diagram
+type diagramNode struct {
+	ast.BaseBlock
+	// syntax is mermaid, dot or plantuml
+	syntax string
+	// info is the info string on the opening fence
+	info *ast.Text
+}
+
+// Kind returns kindDiagram
+func (n *diagramNode) Kind() ast.NodeKind {
+	return kindDiagram
+}
+
+// IsRaw returns true as the lines are diagram source rather than markdown
+func (n *diagramNode) IsRaw() bool {
+	return true
+}
+
+// Dump prints the node for debugging
+func (n *diagramNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Syntax": n.syntax}, nil)
+}
+
+// code returns the source of the diagram
+func (n *diagramNode) code(source []byte) string {
+	return nodeLines(source, n)
+}
+
+// diagramExtension turns fenced code blocks in a diagram language into
+// diagrams, drawn as SVG in HTML
+type diagramExtension struct{}
+
+// Extend adds the transformer and the SVG renderer
+func (diagramExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(diagramTransformer{}, 500)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(diagramHTMLRenderer{palette: diagramLight}, 500),
+	))
+}
+
+// diagramHTMLExtension returns the goldmark extension that draws diagrams
+// in exported HTML in the colors of a light or dark page
+func diagramHTMLExtension(dark bool) goldmark.Extender {
+	palette := diagramLight
+	if dark {
+		palette = diagramDark
+	}
+	return diagramRendererExtension{palette}
+}
+
+// diagramRendererExtension replaces the renderer of diagram nodes
+type diagramRendererExtension struct {
+	palette diagramPalette
+}
+
+// Extend adds the renderer ahead of the one added by diagramExtension
+func (e diagramRendererExtension) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(diagramHTMLRenderer{palette: e.palette}, 100),
+	))
+}
+
+// diagramTransformer replaces fenced code blocks in a diagram language with
+// diagram nodes
+type diagramTransformer struct{}
+
+// Transform walks the document for fenced code in a diagram language
+func (diagramTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var fenced []*ast.FencedCodeBlock
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := n.(*ast.FencedCodeBlock); ok && entering {
+			if _, ok := diagramLanguages[strings.ToLower(string(block.Language(source)))]; ok {
+				fenced = append(fenced, block)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, block := range fenced {
+		node := &diagramNode{syntax: diagramLanguages[strings.ToLower(string(block.Language(source)))], info: block.Info}
+		node.SetLines(block.Lines())
+		node.SetBlankPreviousLines(block.HasBlankPreviousLines())
+		block.Parent().ReplaceChild(block.Parent(), block, node)
+	}
+}
+
+// diagramHTMLRenderer writes diagrams as inline SVG, and those that cannot
+// be parsed as their source under the error
+type diagramHTMLRenderer struct {
+	palette diagramPalette
+}
+
+// RegisterFuncs registers the renderer for diagram nodes
+func (r diagramHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindDiagram, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkSkipChildren, nil
+		}
+		node := n.(*diagramNode)
+		code := node.code(source)
+		d, err := renderDiagram(node.syntax, code)
+		if err != nil {
+			fmt.Fprintf(w, "<div class=\"diagram-error\"><p>%s</p><pre><code>%s</code></pre></div>\n",
+				html.EscapeString(err.Error()), html.EscapeString(code))
+			return ast.WalkSkipChildren, nil
+		}
+		w.WriteString(`<figure class="diagram">`)
+		w.WriteString(d.svg(r.palette))
+		w.WriteString("</figure>\n")
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// diagramCSS centers diagrams and marks those that failed
+const diagramCSS = `<style>
+figure.diagram { margin: 1em 0; overflow-x: auto; text-align: center; }
+figure.diagram svg { max-width: 100%; height: auto; }
+.diagram-error p { color: #cb2431; margin-bottom: 0.25em; }
+</style>`
+
+// documentHasDiagrams reports whether a parsed document has any diagrams
+func documentHasDiagrams(doc ast.Node) bool {
+	found := false
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if n.Kind() == kindDiagram {
+			found = true
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return found
+}
+
+// diagramError is a mistake in the source of a diagram, on a 1-based line
+// or 0 if it is about the whole diagram
+type diagramError struct {
+	line    int
+	message string
+}
+
+func (e *diagramError) Error() string {
+	if e.line == 0 {
+		return e.message
+	}
+	return fmt.Sprintf("line %d: %s", e.line, e.message)
+}
+
+func diagramErrorf(line int, format string, args ...any) error {
+	return &diagramError{line: line, message: fmt.Sprintf(format, args...)}
+}
+
+// renderDiagram parses and lays out a diagram written in a syntax
+func renderDiagram(syntax, code string) (*diagram, error) {
+	var graph *graphDiagram
+	var sequence *sequenceDiagram
+	var err error
+	switch syntax {
+	case "dot":
+		graph, err = parseDot(code)
+	case "mermaid":
+		graph, sequence, err = parseMermaid(code)
+	case "plantuml":
+		graph, sequence, err = parsePlantUML(code)
+	default:
+		return nil, fmt.Errorf("unknown diagram language %s", syntax)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	measure, err := newDiagramMeasure()
+	if err != nil {
+		return nil, err
+	}
+	if sequence != nil {
+		return layoutSequence(sequence, measure), nil
+	}
+	if len(graph.nodes) == 0 {
+		return nil, diagramErrorf(0, "the diagram is empty")
+	}
+	return layoutGraph(graph, measure), nil
+}
+
+// graphDiagram is a diagram of nodes joined by edges, from Graphviz,
+// Mermaid flowcharts and PlantUML class, use case and component diagrams
+type graphDiagram struct {
+	// direction is the way edges run: TB, BT, LR or RL
+	direction string
+	nodes     []*graphNode
+	edges     []*graphEdge
+	byID      map[string]*graphNode
+}
+
+func newGraphDiagram() *graphDiagram {
+	return &graphDiagram{direction: "TB", byID: make(map[string]*graphNode)}
+}
+
+// node returns the node with an ID, adding it with the ID as its label
+// the first time
+func (g *graphDiagram) node(id string) *graphNode {
+	if n, ok := g.byID[id]; ok {
+		return n
+	}
+	n := &graphNode{id: id, label: id, shape: "box"}
+	g.byID[id] = n
+	g.nodes = append(g.nodes, n)
+	return n
+}
+
+// edge adds an edge between the nodes with two IDs
+func (g *graphDiagram) edge(from, to string) *graphEdge {
+	e := &graphEdge{from: g.node(from), to: g.node(to), head: arrowFilled}
+	g.edges = append(g.edges, e)
+	return e
+}
+
+// graphNode is a node of a graph diagram
+type graphNode struct {
+	id, label string
+	// shape is box, rounded, stadium, circle, doublecircle, ellipse,
+	// diamond, hexagon, point, cylinder or plain
+	shape  string
+	dashed bool
+	// fill is a color from the source, or nil for the palette's
+	fill color.Color
+	// members are the attributes and operations of a class
+	members []string
+}
+
+// graphEdge is an edge of a graph diagram
+type graphEdge struct {
+	from, to   *graphNode
+	label      string
+	dashed     bool
+	bold       bool
+	head, tail arrowKind
+}
+
+// sequenceDiagram is a diagram of messages between participants, from
+// Mermaid and PlantUML
+type sequenceDiagram struct {
+	title        string
+	participants []*participant
+	byID         map[string]*participant
+	events       []sequenceEvent
+}
+
+func newSequenceDiagram() *sequenceDiagram {
+	return &sequenceDiagram{byID: make(map[string]*participant)}
+}
+
+// participant returns the participant with an ID, adding it the first time
+func (s *sequenceDiagram) participant(id string) *participant {
+	if p, ok := s.byID[id]; ok {
+		return p
+	}
+	p := &participant{id: id, label: id}
+	s.byID[id] = p
+	s.participants = append(s.participants, p)
+	return p
+}
+
+// participant is a lifeline of a sequence diagram
+type participant struct {
+	id, label string
+	actor     bool
+}
+
+// sequenceEventKind is what happens on a row of a sequence diagram
+type sequenceEventKind int
+
+const (
+	eventMessage sequenceEventKind = iota
+	eventNote
+	// eventFrameStart opens a frame such as loop or alt, eventFrameElse
+	// divides it and eventFrameEnd closes it
+	eventFrameStart
+	eventFrameElse
+	eventFrameEnd
+	// eventDivider is a labelled line across every lifeline
+	eventDivider
+)
+
+// noteSide is where a note is put beside its participants
+type noteSide int
+
+const (
+	noteOver noteSide = iota
+	noteLeft
+	noteRight
+)
+
+// sequenceEvent is a message, note or frame boundary of a sequence diagram
+type sequenceEvent struct {
+	kind sequenceEventKind
+	// from and to are the participants of a message, or those a note is
+	// beside or over
+	from, to *participant
+	text     string
+	dashed   bool
+	head     arrowKind
+	tail     arrowKind
+	side     noteSide
+	// frame is the keyword of a frame, such as loop or alt
+	frame string
+	// line is where the event was written, to report unclosed frames
+	line int
+}
+
+// arrowKind is how the end of a line is drawn
+type arrowKind int
+
+const (
+	arrowNone arrowKind = iota
+	arrowFilled
+	arrowOpen
+	arrowCross
+	// arrowHollow is the outlined triangle of inheritance
+	arrowHollow
+	// arrowDiamond and arrowHollowDiamond are composition and aggregation
+	arrowDiamond
+	arrowHollowDiamond
+	arrowCircle
+)
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// dotToken is a word or punctuation mark of the Graphviz DOT language
+type dotToken struct {
+	text string
+	// quoted is set for strings, which are never punctuation or keywords
+	quoted bool
+	line   int
+}
+
+// tokenizeDot splits DOT source into tokens, dropping comments
+func tokenizeDot(code string) ([]dotToken, error) {
+	var tokens []dotToken
+	runes := []rune(code)
+	line, lineStart := 1, true
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+			lineStart = true
+			i++
+			continue
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '#' && lineStart, r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			continue
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start := line
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/') {
+				if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, diagramErrorf(start, "the comment is not closed")
+			}
+			i += 2
+			continue
+		}
+		lineStart = false
+
+		switch {
+		case r == '"':
+			start := line
+			var text strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					switch runes[i+1] {
+					case '"':
+						text.WriteRune('"')
+						i++
+						continue
+					case '\n':
+						line++
+						i++
+						continue
+					}
+				}
+				if runes[i] == '\n' {
+					line++
+				}
+				text.WriteRune(runes[i])
+			}
+			if i >= len(runes) {
+				return nil, diagramErrorf(start, "the string is not closed")
+			}
+			i++
+			tokens = append(tokens, dotToken{text: text.String(), quoted: true, line: start})
+		case r == '<':
+			// HTML-like labels are shown as their text
+			start, depth := i, 0
+			for ; i < len(runes); i++ {
+				if runes[i] == '<' {
+					depth++
+				} else if runes[i] == '>' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				} else if runes[i] == '\n' {
+					line++
+				}
+			}
+			if i >= len(runes) {
+				return nil, diagramErrorf(line, "the HTML label is not closed")
+			}
+			i++
+			tokens = append(tokens, dotToken{text: dotHTMLText(string(runes[start+1 : i-1])), quoted: true, line: line})
+		case r == '-' && i+1 < len(runes) && (runes[i+1] == '>' || runes[i+1] == '-'):
+			tokens = append(tokens, dotToken{text: string(runes[i : i+2]), line: line})
+			i += 2
+		case strings.ContainsRune("{}[];,=:", r):
+			tokens = append(tokens, dotToken{text: string(r), line: line})
+			i++
+		case r == '-' || r == '.' || unicode.IsDigit(r):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, dotToken{text: string(runes[start:i]), line: line})
+		case r == '_' || unicode.IsLetter(r) || r >= 0x80:
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] >= 0x80) {
+				i++
+			}
+			tokens = append(tokens, dotToken{text: string(runes[start:i]), line: line})
+		default:
+			return nil, diagramErrorf(line, "unexpected %q", r)
+		}
+	}
+	return tokens, nil
+}
+
+var (
+	dotBreakTag = regexp.MustCompile(`(?i)<br\s*/?>`)
+	dotTag      = regexp.MustCompile(`<[^>]*>`)
+)
+
+// dotHTMLText returns the text of an HTML-like label, keeping line breaks
+func dotHTMLText(label string) string {
+	label = dotBreakTag.ReplaceAllString(label, `\n`)
+	return html.UnescapeString(strings.TrimSpace(dotTag.ReplaceAllString(label, "")))
+}
+
+// dotParser reads the statements of a DOT graph
+type dotParser struct {
+	tokens   []dotToken
+	pos      int
+	graph    *graphDiagram
+	directed bool
+}
+
+// dotScope holds the default node and edge attributes of a graph or subgraph
+type dotScope struct {
+	node, edge map[string]string
+}
+
+// nested returns a copy of the scope for a subgraph, whose defaults end
+// with it
+func (s dotScope) nested() dotScope {
+	nested := dotScope{node: make(map[string]string), edge: make(map[string]string)}
+	for k, v := range s.node {
+		nested.node[k] = v
+	}
+	for k, v := range s.edge {
+		nested.edge[k] = v
+	}
+	return nested
+}
+
+// parseDot reads a Graphviz graph or digraph. Subgraphs are flattened, so
+// clusters are not drawn.
+func parseDot(code string) (*graphDiagram, error) {
+	tokens, err := tokenizeDot(code)
+	if err != nil {
+		return nil, err
+	}
+	p := &dotParser{tokens: tokens, graph: newGraphDiagram()}
+	p.keyword("strict")
+	switch {
+	case p.keyword("graph"):
+	case p.keyword("digraph"):
+		p.directed = true
+	default:
+		return nil, p.errorf("expected graph or digraph")
+	}
+	if !p.is("{") {
+		p.pos++
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	if _, err := p.statements(dotScope{node: make(map[string]string), edge: make(map[string]string)}, true); err != nil {
+		return nil, err
+	}
+	if err := p.expect("}"); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.errorf("unexpected %q after the graph", p.tokens[p.pos].text)
+	}
+	return p.graph, nil
+}
+
+func (p *dotParser) peek(ahead int) dotToken {
+	if p.pos+ahead < len(p.tokens) {
+		return p.tokens[p.pos+ahead]
+	}
+	return dotToken{}
+}
+
+// is reports whether the next token is a punctuation mark
+func (p *dotParser) is(punctuation string) bool {
+	t := p.peek(0)
+	return !t.quoted && t.text == punctuation
+}
+
+// keyword consumes the next token if it is a keyword, which DOT matches
+// in any case
+func (p *dotParser) keyword(word string) bool {
+	t := p.peek(0)
+	if !t.quoted && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *dotParser) expect(punctuation string) error {
+	if p.pos >= len(p.tokens) {
+		return p.errorf("expected %q before the end", punctuation)
+	}
+	if !p.is(punctuation) {
+		return p.errorf("expected %q", punctuation)
+	}
+	p.pos++
+	return nil
+}
+
+// errorf reports a mistake at the next token, or the last line at the end
+func (p *dotParser) errorf(format string, args ...any) error {
+	line := 1
+	if p.pos < len(p.tokens) {
+		line = p.tokens[p.pos].line
+	} else if len(p.tokens) > 0 {
+		line = p.tokens[len(p.tokens)-1].line
+	}
+	return diagramErrorf(line, format, args...)
+}
+
+// identifier reads an ID, which may be a name, number or string
+func (p *dotParser) identifier() (string, error) {
+	t := p.peek(0)
+	if p.pos >= len(p.tokens) {
+		return "", p.errorf("the graph is not closed with }")
+	}
+	if !t.quoted && (strings.ContainsAny(t.text, "{}[];,=:") || t.text == "->" || t.text == "--") {
+		return "", p.errorf("unexpected %q", t.text)
+	}
+	p.pos++
+	return t.text, nil
+}
+
+// statements reads statements up to the closing brace, returning the
+// nodes they mention
+func (p *dotParser) statements(scope dotScope, top bool) ([]string, error) {
+	var ids []string
+	for p.pos < len(p.tokens) && !p.is("}") {
+		mentioned, err := p.statement(scope, top)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, mentioned...)
+		if p.is(";") || p.is(",") {
+			p.pos++
+		}
+	}
+	return ids, nil
+}
+
+func (p *dotParser) statement(scope dotScope, top bool) ([]string, error) {
+	t := p.peek(0)
+	if !t.quoted && p.peek(1).text == "[" && !p.peek(1).quoted {
+		var defaults map[string]string
+		switch strings.ToLower(t.text) {
+		case "graph":
+		case "node":
+			defaults = scope.node
+		case "edge":
+			defaults = scope.edge
+		}
+		if defaults != nil || strings.EqualFold(t.text, "graph") {
+			p.pos++
+			attrs, err := p.attributes()
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range attrs {
+				if defaults != nil {
+					defaults[k] = v
+				} else if top {
+					p.graphAttribute(k, v)
+				}
+			}
+			return nil, nil
+		}
+	}
+	if p.peek(1).text == "=" && !p.peek(1).quoted {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		p.pos++
+		value, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if top {
+			p.graphAttribute(name, value)
+		}
+		return nil, nil
+	}
+
+	// A node statement or a chain of edges
+	first, node, err := p.operand(scope)
+	if err != nil {
+		return nil, err
+	}
+	ids := first
+	operands := [][]string{first}
+	for p.is("->") || p.is("--") {
+		p.pos++
+		next, _, err := p.operand(scope)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, next)
+		ids = append(ids, next...)
+	}
+	attrs, err := p.attributes()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(operands) == 1 {
+		if node {
+			applyDotNode(p.graph.node(first[0]), attrs)
+		}
+		return ids, nil
+	}
+	edgeAttrs := make(map[string]string, len(scope.edge)+len(attrs))
+	for k, v := range scope.edge {
+		edgeAttrs[k] = v
+	}
+	for k, v := range attrs {
+		edgeAttrs[k] = v
+	}
+	for i := 0; i+1 < len(operands); i++ {
+		for _, from := range operands[i] {
+			for _, to := range operands[i+1] {
+				p.applyEdge(p.graph.edge(from, to), edgeAttrs)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// operand reads a node ID or a subgraph, returning the nodes it holds and
+// whether it was a single node
+func (p *dotParser) operand(scope dotScope) ([]string, bool, error) {
+	if p.keyword("subgraph") {
+		if !p.is("{") {
+			if _, err := p.identifier(); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+	if p.is("{") {
+		p.pos++
+		ids, err := p.statements(scope.nested(), false)
+		if err != nil {
+			return nil, false, err
+		}
+		if err := p.expect("}"); err != nil {
+			return nil, false, err
+		}
+		return ids, false, nil
+	}
+
+	id, err := p.identifier()
+	if err != nil {
+		return nil, false, err
+	}
+	// Ports name a place on the node and are left out
+	for i := 0; i < 2 && p.is(":"); i++ {
+		p.pos++
+		if _, err := p.identifier(); err != nil {
+			return nil, false, err
+		}
+	}
+	if _, ok := p.graph.byID[id]; !ok {
+		n := p.graph.node(id)
+		n.shape = "ellipse"
+		applyDotNode(n, scope.node)
+	}
+	return []string{id}, true, nil
+}
+
+// attributes reads any number of bracketed attribute lists
+func (p *dotParser) attributes() (map[string]string, error) {
+	attrs := make(map[string]string)
+	for p.is("[") {
+		p.pos++
+		for !p.is("]") {
+			name, err := p.identifier()
+			if err != nil {
+				return nil, err
+			}
+			value := "true"
+			if p.is("=") {
+				p.pos++
+				if value, err = p.identifier(); err != nil {
+					return nil, err
+				}
+			}
+			attrs[strings.ToLower(name)] = value
+			if p.is(",") || p.is(";") {
+				p.pos++
+			}
+		}
+		p.pos++
+	}
+	return attrs, nil
+}
+
+func (p *dotParser) graphAttribute(name, value string) {
+	if strings.EqualFold(name, "rankdir") {
+		switch dir := strings.ToUpper(value); dir {
+		case "TB", "BT", "LR", "RL":
+			p.graph.direction = dir
+		}
+	}
+}
+
+// dotShapes maps Graphviz node shapes to the ones drawn
+var dotShapes = map[string]string{
+	"box": "box", "rect": "box", "rectangle": "box", "square": "box",
+	"record": "box", "mrecord": "rounded", "msquare": "box",
+	"component": "box", "note": "box", "tab": "box", "folder": "box", "box3d": "box",
+	"ellipse": "ellipse", "oval": "ellipse", "egg": "ellipse",
+	"circle": "circle", "doublecircle": "doublecircle",
+	"diamond": "diamond", "mdiamond": "diamond",
+	"hexagon": "hexagon", "octagon": "hexagon",
+	"parallelogram": "parallelogram", "trapezium": "trapezoid",
+	"cylinder": "cylinder", "point": "point",
+	"plaintext": "plain", "plain": "plain", "none": "plain", "underline": "plain",
+}
+
+var (
+	dotRecordPort   = regexp.MustCompile(`<[^>]*>`)
+	dotRecordFields = strings.NewReplacer("{", "", "}", "", "|", `\n`)
+)
+
+// applyDotNode sets the attributes of a node that are drawn
+func applyDotNode(n *graphNode, attrs map[string]string) {
+	record := false
+	if shape, ok := attrs["shape"]; ok {
+		lower := strings.ToLower(shape)
+		record = lower == "record" || lower == "mrecord"
+		n.shape = dotShapes[lower]
+		if n.shape == "" {
+			n.shape = "box"
+		}
+	}
+	if label, ok := attrs["label"]; ok {
+		if record {
+			label = dotRecordFields.Replace(dotRecordPort.ReplaceAllString(label, ""))
+		}
+		n.label = dotLabel(label, n.id)
+	}
+
+	filled := false
+	for _, style := range strings.Split(attrs["style"], ",") {
+		switch strings.TrimSpace(style) {
+		case "filled":
+			filled = true
+		case "dashed", "dotted":
+			n.dashed = true
+		case "rounded":
+			if n.shape == "box" {
+				n.shape = "rounded"
+			}
+		}
+	}
+	if filled {
+		fill := attrs["fillcolor"]
+		if fill == "" {
+			fill = attrs["color"]
+		}
+		if fill == "" {
+			fill = "lightgray"
+		}
+		if c, ok := parseDiagramColor(fill); ok {
+			n.fill = c
+		}
+	}
+}
+
+// dotArrows maps Graphviz arrow shapes to the ones drawn
+var dotArrows = map[string]arrowKind{
+	"normal": arrowFilled, "inv": arrowFilled, "none": arrowNone,
+	"empty": arrowHollow, "onormal": arrowHollow,
+	"vee": arrowOpen, "open": arrowOpen, "tee": arrowOpen, "crow": arrowOpen,
+	"diamond": arrowDiamond, "odiamond": arrowHollowDiamond, "ediamond": arrowHollowDiamond,
+	"dot": arrowCircle, "odot": arrowCircle, "box": arrowFilled,
+}
+
+func (p *dotParser) applyEdge(e *graphEdge, attrs map[string]string) {
+	if label, ok := attrs["label"]; ok {
+		e.label = dotLabel(label, "")
+	}
+	for _, style := range strings.Split(attrs["style"], ",") {
+		switch strings.TrimSpace(style) {
+		case "dashed", "dotted":
+			e.dashed = true
+		case "bold":
+			e.bold = true
+		}
+	}
+
+	head, tail := arrowFilled, arrowFilled
+	if kind, ok := dotArrows[strings.ToLower(attrs["arrowhead"])]; ok {
+		head = kind
+	}
+	if kind, ok := dotArrows[strings.ToLower(attrs["arrowtail"])]; ok {
+		tail = kind
+	}
+	dir := strings.ToLower(attrs["dir"])
+	if dir == "" {
+		dir = "none"
+		if p.directed {
+			dir = "forward"
+		}
+	}
+	e.head, e.tail = arrowNone, arrowNone
+	if dir == "forward" || dir == "both" {
+		e.head = head
+	}
+	if dir == "back" || dir == "both" {
+		e.tail = tail
+	}
+}
+
+var dotEscapes = regexp.MustCompile(`\\[nlrNGE\\]`)
+
+// dotLabel expands the escapes of a label, where \N is the node's ID
+func dotLabel(label, id string) string {
+	label = dotEscapes.ReplaceAllStringFunc(label, func(escape string) string {
+		switch escape[1] {
+		case 'n', 'l', 'r':
+			return "\n"
+		case 'N':
+			return id
+		case '\\':
+			return `\`
+		}
+		return ""
+	})
+	return strings.TrimSuffix(label, "\n")
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// diagramTextSize is the size of diagram text in pixels at scale 1
+const diagramTextSize = 14
+
+// diagramFonts are the regular and bold fonts of the default theme, which
+// diagrams are measured and drawn with
+var diagramFonts = sync.OnceValues(func() ([2]*sfnt.Font, error) {
+	var fonts [2]*sfnt.Font
+	for i, style := range []fyne.TextStyle{{}, {Bold: true}} {
+		f, err := opentype.Parse(theme.DefaultTheme().Font(style).Content())
+		if err != nil {
+			return fonts, err
+		}
+		fonts[i] = f
+	}
+	return fonts, nil
+})
+
+// diagramMeasure sizes diagram text at scale 1
+type diagramMeasure struct {
+	faces      [2]font.Face
+	lineHeight float64
+	ascent     float64
+}
+
+func newDiagramMeasure() (*diagramMeasure, error) {
+	fonts, err := diagramFonts()
+	if err != nil {
+		return nil, err
+	}
+	m := &diagramMeasure{}
+	for i, f := range fonts {
+		if m.faces[i], err = opentype.NewFace(f, &opentype.FaceOptions{Size: diagramTextSize, DPI: 72, Hinting: font.HintingNone}); err != nil {
+			return nil, err
+		}
+	}
+	metrics := m.faces[0].Metrics()
+	m.lineHeight = math.Ceil(fixedFloat(metrics.Height) * 1.1)
+	m.ascent = fixedFloat(metrics.Ascent)
+	return m, nil
+}
+
+// size returns the width and height of text that may have several lines
+func (m *diagramMeasure) size(text string, bold bool) (float64, float64) {
+	if text == "" {
+		return 0, 0
+	}
+	face := m.faces[0]
+	if bold {
+		face = m.faces[1]
+	}
+	width := 0.0
+	lines := strings.Split(text, "\n")
+	for _, line := range lines {
+		width = max(width, fixedFloat(font.MeasureString(face, line)))
+	}
+	return math.Ceil(width), float64(len(lines)) * m.lineHeight
+}
+
+// diagramPoint is a position in a diagram, with y growing downwards
+type diagramPoint struct {
+	x, y float64
+}
+
+func (p diagramPoint) add(q diagramPoint) diagramPoint {
+	return diagramPoint{p.x + q.x, p.y + q.y}
+}
+
+func (p diagramPoint) sub(q diagramPoint) diagramPoint {
+	return diagramPoint{p.x - q.x, p.y - q.y}
+}
+
+func (p diagramPoint) scale(s float64) diagramPoint {
+	return diagramPoint{p.x * s, p.y * s}
+}
+
+// unit returns the direction from q to p and the distance between them
+func (p diagramPoint) unit(q diagramPoint) (diagramPoint, float64) {
+	d := p.sub(q)
+	length := math.Hypot(d.x, d.y)
+	if length == 0 {
+		return diagramPoint{0, 1}, 0
+	}
+	return d.scale(1 / length), length
+}
+
+// diagramRole is the part a shape or text plays, which the palette colors
+type diagramRole int
+
+const (
+	roleNone diagramRole = iota
+	roleLine
+	roleText
+	roleNode
+	roleBorder
+	roleLabel
+	roleNote
+	roleNoteBorder
+	roleFrame
+)
+
+// diagramPalette holds the colors diagrams are drawn in
+type diagramPalette struct {
+	line, text, node, border, label, note, noteBorder, frame color.NRGBA
+}
+
+var (
+	diagramLight = diagramPalette{
+		line:       color.NRGBA{0x33, 0x33, 0x33, 0xff},
+		text:       color.NRGBA{0x1f, 0x23, 0x28, 0xff},
+		node:       color.NRGBA{0xec, 0xec, 0xff, 0xff},
+		border:     color.NRGBA{0x93, 0x70, 0xdb, 0xff},
+		label:      color.NRGBA{0xf4, 0xf4, 0xf4, 0xff},
+		note:       color.NRGBA{0xff, 0xf5, 0xad, 0xff},
+		noteBorder: color.NRGBA{0xaa, 0xaa, 0x33, 0xff},
+		frame:      color.NRGBA{0x88, 0x88, 0x88, 0xff},
+	}
+	diagramDark = diagramPalette{
+		line:       color.NRGBA{0xc9, 0xd1, 0xd9, 0xff},
+		text:       color.NRGBA{0xe6, 0xed, 0xf3, 0xff},
+		node:       color.NRGBA{0x2b, 0x2f, 0x4a, 0xff},
+		border:     color.NRGBA{0x9d, 0x8c, 0xe8, 0xff},
+		label:      color.NRGBA{0x30, 0x36, 0x3d, 0xff},
+		note:       color.NRGBA{0x4d, 0x47, 0x22, 0xff},
+		noteBorder: color.NRGBA{0xbb, 0xaa, 0x55, 0xff},
+		frame:      color.NRGBA{0x8b, 0x94, 0x9e, 0xff},
+	}
+)
+
+func (p diagramPalette) color(role diagramRole) color.NRGBA {
+	switch role {
+	case roleLine:
+		return p.line
+	case roleText:
+		return p.text
+	case roleNode:
+		return p.node
+	case roleBorder:
+		return p.border
+	case roleLabel:
+		return p.label
+	case roleNote:
+		return p.note
+	case roleNoteBorder:
+		return p.noteBorder
+	case roleFrame:
+		return p.frame
+	}
+	return color.NRGBA{}
+}
+
+// diagramColors are the color names that diagram sources may use
+var diagramColors = map[string]color.NRGBA{
+	"black": {0, 0, 0, 0xff}, "white": {0xff, 0xff, 0xff, 0xff},
+	"red": {0xff, 0, 0, 0xff}, "green": {0, 0x80, 0, 0xff}, "blue": {0, 0, 0xff, 0xff},
+	"yellow": {0xff, 0xff, 0, 0xff}, "orange": {0xff, 0xa5, 0, 0xff}, "purple": {0x80, 0, 0x80, 0xff},
+	"pink": {0xff, 0xc0, 0xcb, 0xff}, "brown": {0xa5, 0x2a, 0x2a, 0xff}, "cyan": {0, 0xff, 0xff, 0xff},
+	"magenta": {0xff, 0, 0xff, 0xff}, "gray": {0x80, 0x80, 0x80, 0xff}, "grey": {0x80, 0x80, 0x80, 0xff},
+	"lightgray": {0xd3, 0xd3, 0xd3, 0xff}, "lightgrey": {0xd3, 0xd3, 0xd3, 0xff},
+	"lightblue": {0xad, 0xd8, 0xe6, 0xff}, "lightgreen": {0x90, 0xee, 0x90, 0xff},
+	"lightyellow": {0xff, 0xff, 0xe0, 0xff}, "lightpink": {0xff, 0xb6, 0xc1, 0xff},
+	"gold": {0xff, 0xd7, 0, 0xff}, "navy": {0, 0, 0x80, 0xff}, "teal": {0, 0x80, 0x80, 0xff},
+	"salmon": {0xfa, 0x80, 0x72, 0xff}, "khaki": {0xf0, 0xe6, 0x8c, 0xff}, "lavender": {0xe6, 0xe6, 0xfa, 0xff},
+	"beige": {0xf5, 0xf5, 0xdc, 0xff}, "tomato": {0xff, 0x63, 0x47, 0xff}, "orchid": {0xda, 0x70, 0xd6, 0xff},
+	"palegreen": {0x98, 0xfb, 0x98, 0xff}, "skyblue": {0x87, 0xce, 0xeb, 0xff}, "wheat": {0xf5, 0xde, 0xb3, 0xff},
+}
+
+// parseDiagramColor reads a color name or #rgb, #rrggbb or #rrggbbaa
+// value. Of a Graphviz color list, the first color is used.
+func parseDiagramColor(value string) (color.NRGBA, bool) {
+	value, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(value)), ":")
+	if c, ok := diagramColors[value]; ok {
+		return c, true
+	}
+	hex, ok := strings.CutPrefix(value, "#")
+	if !ok {
+		return color.NRGBA{}, false
+	}
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 8 || err != nil {
+		return color.NRGBA{}, false
+	}
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, true
+}
+
+// textOn returns black or white, whichever reads better on a fill
+func textOn(fill color.Color) color.Color {
+	r, g, b, _ := fill.RGBA()
+	if 0.299*float64(r)+0.587*float64(g)+0.114*float64(b) > 0x8000 {
+		return color.Black
+	}
+	return color.White
+}
+
+// textAnchor is the part of a text that its position gives
+type textAnchor int
+
+const (
+	anchorMiddle textAnchor = iota
+	anchorStart
+)
+
+// diagramItem is a shape or a line of text in a diagram
+type diagramItem struct {
+	// points outline a shape, which is closed or an open line
+	points       []diagramPoint
+	closed       bool
+	fill, stroke diagramRole
+	width        float64
+	dashed       bool
+
+	// text is drawn with its baseline at y
+	text   string
+	x, y   float64
+	anchor textAnchor
+	bold   bool
+	role   diagramRole
+
+	// color, if set, is used in place of the fill, or of a text's role
+	color color.Color
+}
+
+// diagram is a laid out diagram, ready to be drawn as SVG or an image
+type diagram struct {
+	width, height float64
+	items         []diagramItem
+}
+
+// shape adds a closed outline
+func (d *diagram) shape(points []diagramPoint, fill, stroke diagramRole) *diagramItem {
+	d.items = append(d.items, diagramItem{points: points, closed: true, fill: fill, stroke: stroke, width: 1})
+	return &d.items[len(d.items)-1]
+}
+
+// line adds an open line
+func (d *diagram) line(points []diagramPoint, stroke diagramRole, width float64, dashed bool) {
+	d.items = append(d.items, diagramItem{points: points, stroke: stroke, width: width, dashed: dashed})
+}
+
+// text adds text that may have several lines, with the top of the first
+// line at top
+func (d *diagram) text(m *diagramMeasure, text string, x, top float64, anchor textAnchor, role diagramRole, bold bool) {
+	for i, line := range strings.Split(text, "\n") {
+		if line == "" {
+			continue
+		}
+		d.items = append(d.items, diagramItem{text: line, x: x, y: top + m.ascent + float64(i)*m.lineHeight,
+			anchor: anchor, role: role, bold: bold})
+	}
+}
+
+// rectPoints returns the corners of a rectangle
+func rectPoints(x, y, width, height float64) []diagramPoint {
+	return []diagramPoint{{x, y}, {x + width, y}, {x + width, y + height}, {x, y + height}}
+}
+
+// ellipsePoints returns points around an ellipse, clockwise from the right
+func ellipsePoints(center diagramPoint, rx, ry float64) []diagramPoint {
+	const steps = 48
+	points := make([]diagramPoint, steps)
+	for i := range points {
+		angle := 2 * math.Pi * float64(i) / steps
+		points[i] = diagramPoint{center.x + rx*math.Cos(angle), center.y + ry*math.Sin(angle)}
+	}
+	return points
+}
+
+// roundedPoints returns the outline of a rectangle with rounded corners
+func roundedPoints(x, y, width, height, radius float64) []diagramPoint {
+	radius = min(radius, width/2, height/2)
+	corners := []diagramPoint{
+		{x + width - radius, y + radius}, {x + width - radius, y + height - radius},
+		{x + radius, y + height - radius}, {x + radius, y + radius},
+	}
+	var points []diagramPoint
+	for i, c := range corners {
+		start := -math.Pi/2 + float64(i)*math.Pi/2
+		for k := 0; k <= 6; k++ {
+			angle := start + float64(k)*math.Pi/12
+			points = append(points, diagramPoint{c.x + radius*math.Cos(angle), c.y + radius*math.Sin(angle)})
+		}
+	}
+	return points
+}
+
+// translate moves every item of the diagram
+func (d *diagram) translate(dx, dy float64) {
+	for i := range d.items {
+		item := &d.items[i]
+		for j := range item.points {
+			item.points[j].x += dx
+			item.points[j].y += dy
+		}
+		item.x += dx
+		item.y += dy
+	}
+}
+
+// fit moves the items to leave a margin around them and sizes the diagram
+func (d *diagram) fit(m *diagramMeasure, margin float64) {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, item := range d.items {
+		for _, p := range item.points {
+			minX, maxX = min(minX, p.x), max(maxX, p.x)
+			minY, maxY = min(minY, p.y), max(maxY, p.y)
+		}
+		if item.text != "" {
+			width, _ := m.size(item.text, item.bold)
+			left := item.x
+			if item.anchor == anchorMiddle {
+				left -= width / 2
+			}
+			minX, maxX = min(minX, left), max(maxX, left+width)
+			minY, maxY = min(minY, item.y-m.ascent), max(maxY, item.y-m.ascent+m.lineHeight)
+		}
+	}
+	if math.IsInf(minX, 1) {
+		return
+	}
+	d.translate(margin-minX, margin-minY)
+	d.width = math.Ceil(maxX - minX + 2*margin)
+	d.height = math.Ceil(maxY - minY + 2*margin)
+}
+
+// svgColor writes a color as an SVG value
+func svgColor(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if n.A == 0 {
+		return "none"
+	}
+	if n.A != 0xff {
+		return fmt.Sprintf("rgba(%d,%d,%d,%.2f)", n.R, n.G, n.B, float64(n.A)/0xff)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", n.R, n.G, n.B)
+}
+
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// svg writes the diagram as an SVG element
+func (d *diagram) svg(p diagramPalette) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%s" height="%s" viewBox="0 0 %[1]s %[2]s" font-family="'Noto Sans', 'Segoe UI', Helvetica, Arial, sans-serif" font-size="%d">`,
+		svgNumber(d.width), svgNumber(d.height), diagramTextSize)
+	for _, item := range d.items {
+		if item.text != "" {
+			fill := color.Color(p.color(item.role))
+			if item.color != nil {
+				fill = item.color
+			}
+			anchor := "middle"
+			if item.anchor == anchorStart {
+				anchor = "start"
+			}
+			weight := ""
+			if item.bold {
+				weight = ` font-weight="bold"`
+			}
+			fmt.Fprintf(&b, `<text x="%s" y="%s" text-anchor="%s" fill="%s"%s>%s</text>`,
+				svgNumber(item.x), svgNumber(item.y), anchor, svgColor(fill), weight, html.EscapeString(item.text))
+			continue
+		}
+
+		var points []string
+		for _, pt := range item.points {
+			points = append(points, svgNumber(pt.x)+","+svgNumber(pt.y))
+		}
+		element, fill := "polyline", "none"
+		if item.closed {
+			element = "polygon"
+			if item.color != nil {
+				fill = svgColor(item.color)
+			} else if item.fill != roleNone {
+				fill = svgColor(p.color(item.fill))
+			}
+		}
+		stroke := ""
+		if item.stroke != roleNone {
+			stroke = fmt.Sprintf(` stroke="%s" stroke-width="%s" stroke-linejoin="round"`, svgColor(p.color(item.stroke)), svgNumber(item.width))
+			if item.dashed {
+				stroke += ` stroke-dasharray="5 4"`
+			}
+		}
+		fmt.Fprintf(&b, `<%s points="%s" fill="%s"%s/>`, element, strings.Join(points, " "), fill, stroke)
+	}
+	b.WriteString("</svg>")
+	return b.String()
+}
+
+// dashes splits a line into the dashes drawn of it
+func dashes(points []diagramPoint, dash, gap float64) [][]diagramPoint {
+	var parts [][]diagramPoint
+	var current []diagramPoint
+	on, left := true, dash
+	for i := 0; i+1 < len(points); i++ {
+		a, b := points[i], points[i+1]
+		dir, length := b.unit(a)
+		for length > 0 {
+			step := min(left, length)
+			next := a.add(dir.scale(step))
+			if on {
+				if len(current) == 0 {
+					current = append(current, a)
+				}
+				current = append(current, next)
+			}
+			a, length, left = next, length-step, left-step
+			if left <= 0 {
+				if on && len(current) > 1 {
+					parts = append(parts, current)
+				}
+				current = nil
+				on = !on
+				left = dash
+				if !on {
+					left = gap
+				}
+			}
+		}
+	}
+	if len(current) > 1 {
+		parts = append(parts, current)
+	}
+	return parts
+}
+
+// strokePolygons returns polygons covering a line drawn with a width,
+// wound the same way so that their overlaps are not cut out
+func strokePolygons(points []diagramPoint, width float64) [][]diagramPoint {
+	var polygons [][]diagramPoint
+	half := width / 2
+	for i := 0; i+1 < len(points); i++ {
+		a, c := points[i], points[i+1]
+		dir, length := c.unit(a)
+		if length == 0 {
+			continue
+		}
+		n := diagramPoint{-dir.y * half, dir.x * half}
+		polygons = append(polygons, []diagramPoint{a.add(n), c.add(n), c.sub(n), a.sub(n)})
+	}
+	if width > 1.5 {
+		for _, p := range points[1 : len(points)-1] {
+			var join []diagramPoint
+			for k := 8; k > 0; k-- {
+				angle := float64(k) * math.Pi / 4
+				join = append(join, diagramPoint{p.x + half*math.Cos(angle), p.y + half*math.Sin(angle)})
+			}
+			polygons = append(polygons, join)
+		}
+	}
+	return polygons
+}
+
+// image draws the diagram at a scale, on a transparent background
+func (d *diagram) image(p diagramPalette, scale float64) (*image.RGBA, error) {
+	fonts, err := diagramFonts()
+	if err != nil {
+		return nil, err
+	}
+	var faces [2]font.Face
+	for i, f := range fonts {
+		if faces[i], err = opentype.NewFace(f, &opentype.FaceOptions{Size: diagramTextSize * scale, DPI: 72, Hinting: font.HintingNone}); err != nil {
+			return nil, err
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, max(int(math.Ceil(d.width*scale)), 1), max(int(math.Ceil(d.height*scale)), 1)))
+	fillPolygons := func(polygons [][]diagramPoint, c color.Color) {
+		r := vector.NewRasterizer(img.Bounds().Dx(), img.Bounds().Dy())
+		r.DrawOp = draw.Over
+		for _, polygon := range polygons {
+			for i, pt := range polygon {
+				x, y := float32(pt.x*scale), float32(pt.y*scale)
+				if i == 0 {
+					r.MoveTo(x, y)
+				} else {
+					r.LineTo(x, y)
+				}
+			}
+			r.ClosePath()
+		}
+		r.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{})
+	}
+
+	for _, item := range d.items {
+		if item.text != "" {
+			c := color.Color(p.color(item.role))
+			if item.color != nil {
+				c = item.color
+			}
+			face := faces[0]
+			if item.bold {
+				face = faces[1]
+			}
+			x := item.x * scale
+			if item.anchor == anchorMiddle {
+				x -= fixedFloat(font.MeasureString(face, item.text)) / 2
+			}
+			dr := font.Drawer{Dst: img, Src: image.NewUniform(c), Face: face,
+				Dot: fixed.Point26_6{X: floatFixed(x), Y: floatFixed(item.y * scale)}}
+			dr.DrawString(item.text)
+			continue
+		}
+
+		if item.closed && (item.fill != roleNone || item.color != nil) {
+			fill := color.Color(p.color(item.fill))
+			if item.color != nil {
+				fill = item.color
+			}
+			fillPolygons([][]diagramPoint{item.points}, fill)
+		}
+		if item.stroke == roleNone {
+			continue
+		}
+		line := item.points
+		if item.closed {
+			line = append(append([]diagramPoint(nil), line...), line[0])
+		}
+		parts := [][]diagramPoint{line}
+		if item.dashed {
+			parts = dashes(line, 5, 4)
+		}
+		var polygons [][]diagramPoint
+		for _, part := range parts {
+			polygons = append(polygons, strokePolygons(part, item.width)...)
+		}
+		fillPolygons(polygons, p.color(item.stroke))
+	}
+	return img, nil
+}
+
+// diagramPicture is a diagram drawn for a document export
+type diagramPicture struct {
+	png []byte
+	// width and height are in points
+	width, height float64
+}
+
+// diagramPictureScale draws exported diagrams at three times 72 DPI
+const diagramPictureScale = 3
+
+// renderDiagramPicture draws a diagram as a PNG in the light palette for
+// the exports that cannot show SVG
+func renderDiagramPicture(syntax, code string) (*diagramPicture, error) {
+	d, err := renderDiagram(syntax, code)
+	if err != nil {
+		return nil, err
+	}
+	img, err := d.image(diagramLight, diagramPictureScale)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	// Diagrams are sized in CSS pixels, which are three quarters of a point
+	return &diagramPicture{png: buf.Bytes(), width: d.width * 0.75, height: d.height * 0.75}, nil
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Spacing of graph layouts, in pixels
+const (
+	diagramMargin = 8
+	graphPadX     = 14
+	graphPadY     = 9
+	graphNodeGap  = 15
+	graphDummyGap = 5
+	graphRankGap  = 45
+	// graphLabelRankGap is the gap between ranks when edge labels have
+	// ranks of their own
+	graphLabelRankGap = 18
+)
+
+// layoutNode is a node, or a point that a long edge passes through, placed
+// in a rank. Sizes and positions are across and along the ranks, so they
+// are swapped for graphs drawn left to right.
+type layoutNode struct {
+	node *graphNode
+	// label is the text of an edge label held by a point
+	label       string
+	across      float64
+	along       float64
+	rank        int
+	order       int
+	x, y        float64
+	up, down    []int
+	width, high float64
+}
+
+// layoutEdge is an edge and the points it passes through, from the node
+// in the lower rank
+type layoutEdge struct {
+	edge     *graphEdge
+	chain    []int
+	reversed bool
+}
+
+// layoutGraph places the nodes of a graph in ranks so that edges point
+// one way, orders the ranks to reduce crossings and draws it
+func layoutGraph(g *graphDiagram, m *diagramMeasure) *diagram {
+	transposed := g.direction == "LR" || g.direction == "RL"
+	index := make(map[*graphNode]int, len(g.nodes))
+	nodes := make([]*layoutNode, len(g.nodes))
+	for i, n := range g.nodes {
+		index[n] = i
+		width, height := graphNodeSize(n, m)
+		nodes[i] = &layoutNode{node: n, width: width, high: height}
+	}
+
+	var edges []*layoutEdge
+	var loops []*graphEdge
+	labelled := false
+	for _, e := range g.edges {
+		if e.from == e.to {
+			loops = append(loops, e)
+			continue
+		}
+		edges = append(edges, &layoutEdge{edge: e})
+		labelled = labelled || e.label != ""
+	}
+	reverseCycles(nodes, edges, index)
+
+	span := 1
+	if labelled {
+		span = 2
+	}
+	ranks := rankNodes(len(nodes), edges, index, span)
+
+	// Long edges pass through points in each rank they cross
+	for _, le := range edges {
+		from, to := index[le.edge.from], index[le.edge.to]
+		if le.reversed {
+			from, to = to, from
+		}
+		middle := (ranks[from] + ranks[to]) / 2
+		le.chain = []int{from}
+		for r := ranks[from] + 1; r < ranks[to]; r++ {
+			point := &layoutNode{}
+			if r == middle && le.edge.label != "" {
+				width, height := m.size(le.edge.label, false)
+				point.label, point.width, point.high = le.edge.label, width+8, height+4
+			}
+			nodes = append(nodes, point)
+			ranks = append(ranks, r)
+			le.chain = append(le.chain, len(nodes)-1)
+		}
+		le.chain = append(le.chain, to)
+		for i := 0; i+1 < len(le.chain); i++ {
+			a, b := le.chain[i], le.chain[i+1]
+			nodes[a].down = append(nodes[a].down, b)
+			nodes[b].up = append(nodes[b].up, a)
+		}
+	}
+
+	layers := make([][]int, slices.Max(ranks)+1)
+	for i, n := range nodes {
+		n.rank = ranks[i]
+		n.across, n.along = n.width, n.high
+		if transposed {
+			n.across, n.along = n.high, n.width
+		}
+		n.order = len(layers[n.rank])
+		layers[n.rank] = append(layers[n.rank], i)
+	}
+	orderLayers(nodes, layers)
+	placeLayers(nodes, layers)
+
+	rankGap := float64(graphRankGap)
+	if labelled {
+		rankGap = graphLabelRankGap
+	}
+	top := 0.0
+	for _, layer := range layers {
+		extent := 0.0
+		for _, i := range layer {
+			extent = max(extent, nodes[i].along)
+		}
+		for _, i := range layer {
+			nodes[i].y = top + extent/2
+		}
+		top += extent + rankGap
+	}
+
+	// Positions turn from across and along the ranks into x and y
+	position := func(n *layoutNode) diagramPoint {
+		switch g.direction {
+		case "BT":
+			return diagramPoint{n.x, -n.y}
+		case "LR":
+			return diagramPoint{n.y, n.x}
+		case "RL":
+			return diagramPoint{-n.y, n.x}
+		}
+		return diagramPoint{n.x, n.y}
+	}
+
+	d := &diagram{}
+	for _, le := range edges {
+		points := make([]diagramPoint, len(le.chain))
+		for i, c := range le.chain {
+			points[i] = position(nodes[c])
+		}
+		if le.reversed {
+			slices.Reverse(points)
+		}
+		from, to := nodes[index[le.edge.from]], nodes[index[le.edge.to]]
+		points[0] = outlineCrossing(nodeOutline(from.node, points[0], from.width, from.high), points[0], points[1])
+		last := len(points) - 1
+		points[last] = outlineCrossing(nodeOutline(to.node, points[last], to.width, to.high), points[last], points[last-1])
+		d.edge(smoothLine(points), le.edge)
+	}
+	for _, e := range loops {
+		n := nodes[index[e.from]]
+		c := position(n)
+		right := c.x + n.width/2
+		points := smoothLine([]diagramPoint{{right, c.y - 6}, {right + 22, c.y - 16}, {right + 30, c.y}, {right + 22, c.y + 16}, {right, c.y + 6}})
+		d.edge(points, e)
+		if e.label != "" {
+			_, height := m.size(e.label, false)
+			d.text(m, e.label, right+34, c.y-height/2, anchorStart, roleText, false)
+		}
+	}
+	for _, n := range nodes {
+		if n.node != nil {
+			d.node(m, n.node, position(n), n.width, n.high)
+		} else if n.label != "" {
+			c := position(n)
+			d.shape(rectPoints(c.x-n.width/2, c.y-n.high/2, n.width, n.high), roleLabel, roleNone)
+			d.text(m, n.label, c.x, c.y-n.high/2+2, anchorMiddle, roleText, false)
+		}
+	}
+	d.fit(m, diagramMargin)
+	return d
+}
+
+// reverseCycles marks the edges that close a cycle, found by a depth
+// first search from the nodes nothing points to, to be laid out backwards
+func reverseCycles(nodes []*layoutNode, edges []*layoutEdge, index map[*graphNode]int) {
+	out := make([][]*layoutEdge, len(nodes))
+	incoming := make([]int, len(nodes))
+	for _, le := range edges {
+		out[index[le.edge.from]] = append(out[index[le.edge.from]], le)
+		incoming[index[le.edge.to]]++
+	}
+	state := make([]int, len(nodes))
+	var visit func(v int)
+	visit = func(v int) {
+		state[v] = 1
+		for _, le := range out[v] {
+			switch w := index[le.edge.to]; state[w] {
+			case 0:
+				visit(w)
+			case 1:
+				le.reversed = true
+			}
+		}
+		state[v] = 2
+	}
+	for v := range nodes {
+		if incoming[v] == 0 && state[v] == 0 {
+			visit(v)
+		}
+	}
+	for v := range nodes {
+		if state[v] == 0 {
+			visit(v)
+		}
+	}
+}
+
+// rankNodes gives each node the rank of the longest path to it, then moves
+// nodes that nothing points to down next to the nodes they point to
+func rankNodes(count int, edges []*layoutEdge, index map[*graphNode]int, span int) []int {
+	out := make([][]int, count)
+	incoming := make([]int, count)
+	for _, le := range edges {
+		from, to := index[le.edge.from], index[le.edge.to]
+		if le.reversed {
+			from, to = to, from
+		}
+		out[from] = append(out[from], to)
+		incoming[to]++
+	}
+
+	var order, queue []int
+	remaining := slices.Clone(incoming)
+	for v := 0; v < count; v++ {
+		if remaining[v] == 0 {
+			queue = append(queue, v)
+		}
+	}
+	ranks := make([]int, count)
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		order = append(order, v)
+		for _, w := range out[v] {
+			ranks[w] = max(ranks[w], ranks[v]+span)
+			if remaining[w]--; remaining[w] == 0 {
+				queue = append(queue, w)
+			}
+		}
+	}
+
+	for i := len(order) - 1; i >= 0; i-- {
+		v := order[i]
+		if incoming[v] > 0 || len(out[v]) == 0 {
+			continue
+		}
+		lowest := math.MaxInt
+		for _, w := range out[v] {
+			lowest = min(lowest, ranks[w])
+		}
+		ranks[v] = lowest - span
+	}
+	return ranks
+}
+
+// orderLayers sorts each rank by where its neighbours are, sweeping down
+// and up and keeping the order with the fewest crossings
+func orderLayers(nodes []*layoutNode, layers [][]int) {
+	best := cloneLayers(layers)
+	fewest := crossings(nodes, layers)
+	for sweep := 0; sweep < 12 && fewest > 0; sweep++ {
+		if sweep%2 == 0 {
+			for r := 1; r < len(layers); r++ {
+				sortByBarycenter(nodes, layers[r], func(n *layoutNode) []int { return n.up })
+			}
+		} else {
+			for r := len(layers) - 2; r >= 0; r-- {
+				sortByBarycenter(nodes, layers[r], func(n *layoutNode) []int { return n.down })
+			}
+		}
+		if c := crossings(nodes, layers); c < fewest {
+			best, fewest = cloneLayers(layers), c
+		}
+	}
+	for r := range layers {
+		layers[r] = best[r]
+		for i, v := range layers[r] {
+			nodes[v].order = i
+		}
+	}
+}
+
+func cloneLayers(layers [][]int) [][]int {
+	clone := make([][]int, len(layers))
+	for r, layer := range layers {
+		clone[r] = slices.Clone(layer)
+	}
+	return clone
+}
+
+func sortByBarycenter(nodes []*layoutNode, layer []int, neighbours func(*layoutNode) []int) {
+	centers := make(map[int]float64, len(layer))
+	for _, v := range layer {
+		n := nodes[v]
+		centers[v] = float64(n.order)
+		if others := neighbours(n); len(others) > 0 {
+			sum := 0.0
+			for _, w := range others {
+				sum += float64(nodes[w].order)
+			}
+			centers[v] = sum / float64(len(others))
+		}
+	}
+	sort.SliceStable(layer, func(i, j int) bool { return centers[layer[i]] < centers[layer[j]] })
+	for i, v := range layer {
+		nodes[v].order = i
+	}
+}
+
+// crossings counts the pairs of edges that cross between adjacent ranks
+func crossings(nodes []*layoutNode, layers [][]int) int {
+	count := 0
+	for r := 0; r+1 < len(layers); r++ {
+		var pairs [][2]int
+		for _, v := range layers[r] {
+			for _, w := range nodes[v].down {
+				pairs = append(pairs, [2]int{nodes[v].order, nodes[w].order})
+			}
+		}
+		for i := range pairs {
+			for j := i + 1; j < len(pairs); j++ {
+				if (pairs[i][0]-pairs[j][0])*(pairs[i][1]-pairs[j][1]) < 0 {
+					count++
+				}
+			}
+		}
+	}
+	return count
+}
+
+// placeLayers sets the positions across the ranks, moving each node toward
+// the middle of its neighbours while keeping the order and gaps
+func placeLayers(nodes []*layoutNode, layers [][]int) {
+	for _, layer := range layers {
+		x := 0.0
+		for i, v := range layer {
+			if i > 0 {
+				x += separation(nodes[layer[i-1]], nodes[v])
+			}
+			nodes[v].x = x
+		}
+	}
+
+	for pass := 0; pass < 10; pass++ {
+		neighbours := func(n *layoutNode) []int {
+			switch {
+			case pass >= 8:
+				return append(slices.Clone(n.up), n.down...)
+			case pass%2 == 0:
+				return n.up
+			}
+			return n.down
+		}
+		for k := range layers {
+			r := k
+			if pass%2 == 1 {
+				r = len(layers) - 1 - k
+			}
+			layer := layers[r]
+			wanted := make([]float64, len(layer))
+			for i, v := range layer {
+				wanted[i] = nodes[v].x
+				if others := neighbours(nodes[v]); len(others) > 0 {
+					xs := make([]float64, len(others))
+					for j, w := range others {
+						xs[j] = nodes[w].x
+					}
+					slices.Sort(xs)
+					wanted[i] = (xs[(len(xs)-1)/2] + xs[len(xs)/2]) / 2
+				}
+			}
+			placeLayer(nodes, layer, wanted)
+		}
+	}
+}
+
+// separation is the distance kept between the centers of neighbours in a
+// rank
+func separation(a, b *layoutNode) float64 {
+	gap := func(n *layoutNode) float64 {
+		if n.node == nil && n.label == "" {
+			return graphDummyGap
+		}
+		return graphNodeGap
+	}
+	return a.across/2 + b.across/2 + gap(a) + gap(b)
+}
+
+// placeLayer finds the positions nearest to those wanted that keep the
+// separations, by pooling adjacent violators. Points of long edges weigh
+// more so that the edges run straight.
+func placeLayer(nodes []*layoutNode, layer []int, wanted []float64) {
+	type block struct {
+		sum, weight float64
+		count       int
+	}
+	offsets := make([]float64, len(layer))
+	for i := 1; i < len(layer); i++ {
+		offsets[i] = offsets[i-1] + separation(nodes[layer[i-1]], nodes[layer[i]])
+	}
+	var blocks []block
+	for i, v := range layer {
+		weight := 1.0
+		if nodes[v].node == nil {
+			weight = 4
+		}
+		blocks = append(blocks, block{sum: weight * (wanted[i] - offsets[i]), weight: weight, count: 1})
+		for len(blocks) > 1 {
+			a, b := blocks[len(blocks)-2], blocks[len(blocks)-1]
+			if a.sum/a.weight < b.sum/b.weight {
+				break
+			}
+			blocks = append(blocks[:len(blocks)-2], block{a.sum + b.sum, a.weight + b.weight, a.count + b.count})
+		}
+	}
+	i := 0
+	for _, b := range blocks {
+		for k := 0; k < b.count; k++ {
+			nodes[layer[i]].x = b.sum/b.weight + offsets[i]
+			i++
+		}
+	}
+}
+
+// graphNodeSize returns the width and height of a node, fitting its label
+// in its shape
+func graphNodeSize(n *graphNode, m *diagramMeasure) (float64, float64) {
+	tw, th := m.size(n.label, false)
+	width, height := tw+2*graphPadX, th+2*graphPadY
+	switch n.shape {
+	case "point":
+		return 10, 10
+	case "start":
+		return 18, 18
+	case "end":
+		return 22, 22
+	case "bar":
+		return 70, 8
+	case "plain":
+		return tw + 8, th + 4
+	case "ellipse":
+		return max(tw*1.42+20, 50), th*1.42 + 10
+	case "circle", "doublecircle":
+		size := max(math.Hypot(tw+12, th+6), 40)
+		if n.shape == "doublecircle" {
+			size += 10
+		}
+		return size, size
+	case "diamond":
+		height = th + 30
+		return max(tw/(1-th/height)+8, height), height
+	case "hexagon", "stadium":
+		return width + height/2, height
+	case "cylinder":
+		return width, height + 14
+	case "parallelogram", "trapezoid", "flag":
+		return width + 24, height
+	case "subroutine":
+		return width + 16, height
+	case "actor":
+		return max(tw, 30), 44 + th
+	case "class":
+		name, stereotype := classHeader(n)
+		nw, nh := m.size(name, true)
+		sw, sh := m.size(stereotype, false)
+		attributes, operations := classMembers(n)
+		aw, ah := m.size(strings.Join(attributes, "\n"), false)
+		ow, oh := m.size(strings.Join(operations, "\n"), false)
+		return max(nw, sw, aw, ow, 60) + 2*graphPadX, nh + sh + ah + oh + 4*graphPadY
+	}
+	return max(width, 40), height
+}
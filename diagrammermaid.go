@@ -0,0 +1,584 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// diagramLine is a line of diagram source with its 1-based number
+type diagramLine struct {
+	text string
+	line int
+}
+
+// diagramLines returns the trimmed lines of a diagram that are neither
+// blank nor comments starting with a prefix
+func diagramLines(code, comment string) []diagramLine {
+	var lines []diagramLine
+	for i, text := range strings.Split(code, "\n") {
+		text = strings.TrimSpace(text)
+		if text == "" || strings.HasPrefix(text, comment) {
+			continue
+		}
+		lines = append(lines, diagramLine{text: text, line: i + 1})
+	}
+	return lines
+}
+
+// firstWord splits a line at its first space
+func firstWord(text string) (string, string) {
+	word, rest, _ := strings.Cut(text, " ")
+	return word, strings.TrimSpace(rest)
+}
+
+// diagramBreaks turns the line breaks written in labels into new lines
+var diagramBreaks = strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<br />", "\n", `\n`, "\n")
+
+// parseMermaid reads a Mermaid flowchart, sequence, state or class diagram
+func parseMermaid(code string) (*graphDiagram, *sequenceDiagram, error) {
+	lines := diagramLines(code, "%%")
+	// A configuration block may come before the diagram
+	if len(lines) > 0 && lines[0].text == "---" {
+		for i := 1; i < len(lines); i++ {
+			if lines[i].text == "---" {
+				lines = lines[i+1:]
+				break
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return nil, nil, diagramErrorf(0, "the diagram is empty")
+	}
+
+	kind, rest := firstWord(lines[0].text)
+	switch kind {
+	case "graph", "flowchart":
+		g := newGraphDiagram()
+		switch dir := strings.TrimSuffix(rest, ";"); dir {
+		case "", "TB", "TD":
+		case "BT", "LR", "RL":
+			g.direction = dir
+		default:
+			return nil, nil, diagramErrorf(lines[0].line, "unknown direction %q", dir)
+		}
+		return g, nil, parseFlowchart(g, lines[1:])
+	case "sequenceDiagram":
+		s, err := parseMermaidSequence(lines[1:])
+		return nil, s, err
+	case "stateDiagram", "stateDiagram-v2":
+		g, err := parseMermaidState(lines[1:])
+		return g, nil, err
+	case "classDiagram":
+		g, err := parseMermaidClass(lines[1:])
+		return g, nil, err
+	}
+	return nil, nil, diagramErrorf(lines[0].line, "%s diagrams are not supported; use flowchart, sequenceDiagram, stateDiagram or classDiagram", kind)
+}
+
+// flowShapes are the brackets around the text of a flowchart node, longest
+// first
+var flowShapes = []struct{ open, close, shape string }{
+	{"(((", ")))", "doublecircle"},
+	{"([", "])", "stadium"},
+	{"[[", "]]", "subroutine"},
+	{"[(", ")]", "cylinder"},
+	{"((", "))", "circle"},
+	{"{{", "}}", "hexagon"},
+	{"[/", "/]", "parallelogram"},
+	{`[\`, `\]`, "parallelogram"},
+	{"[/", `\]`, "trapezoid"},
+	{`[\`, "/]", "trapezoid"},
+	{"[", "]", "box"},
+	{"(", ")", "rounded"},
+	{"{", "}", "diamond"},
+	{">", "]", "flag"},
+}
+
+var (
+	// flowchartLinkText is a link with its text between the dashes, as in -- yes -->
+	flowchartLinkText = regexp.MustCompile(`^(<|[ox])?(--|==|-\.)\s+(.*?)\s*(-{2,}|={2,}|\.+-)(>|[ox]\b)?`)
+	// flowchartLink is a link with an optional |text| after it
+	flowchartLink = regexp.MustCompile(`^(<|[ox])?(-{2,}|={2,}|-\.+-|~~~)(>|[ox]\b)?\s*(?:\|([^|]*)\|)?`)
+)
+
+// flowParser reads the statements on a line of a flowchart
+type flowParser struct {
+	graph *graphDiagram
+	text  string
+	pos   int
+	line  int
+}
+
+// parseFlowchart reads the nodes and links of a flowchart. Subgraphs are
+// flattened, and classes, styles other than fill and clicks are left out.
+func parseFlowchart(g *graphDiagram, lines []diagramLine) error {
+	for _, l := range lines {
+		word, rest := firstWord(l.text)
+		switch word {
+		case "subgraph", "end", "direction", "classDef", "class", "click", "linkStyle":
+			continue
+		case "style":
+			id, props := firstWord(rest)
+			for _, prop := range strings.Split(props, ",") {
+				if key, value, _ := strings.Cut(prop, ":"); strings.TrimSpace(key) == "fill" {
+					if c, ok := parseDiagramColor(strings.TrimSpace(value)); ok {
+						g.node(id).fill = c
+					}
+				}
+			}
+			continue
+		}
+
+		p := &flowParser{graph: g, text: l.text, line: l.line}
+		for {
+			if err := p.chain(); err != nil {
+				return err
+			}
+			p.space()
+			if p.pos == len(p.text) {
+				break
+			}
+			if p.text[p.pos] != ';' {
+				return diagramErrorf(l.line, "unexpected %q", p.text[p.pos:])
+			}
+			p.pos++
+			if p.space(); p.pos == len(p.text) {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+func (p *flowParser) space() {
+	for p.pos < len(p.text) && (p.text[p.pos] == ' ' || p.text[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// chain reads groups of nodes joined by links, as in A & B --> C --> D
+func (p *flowParser) chain() error {
+	from, err := p.group()
+	if err != nil {
+		return err
+	}
+	for {
+		p.space()
+		rest := p.text[p.pos:]
+		var start, body, end, label string
+		if m := flowchartLinkText.FindStringSubmatch(rest); m != nil {
+			start, body, label, end = m[1], m[2]+m[4], m[3], m[5]
+			p.pos += len(m[0])
+		} else if m := flowchartLink.FindStringSubmatch(rest); m != nil {
+			start, body, end, label = m[1], m[2], m[3], m[4]
+			p.pos += len(m[0])
+		} else {
+			return nil
+		}
+
+		to, err := p.group()
+		if err != nil {
+			return err
+		}
+		// Invisible links only place nodes in Mermaid and are not drawn here
+		if body == "~~~" {
+			from = to
+			continue
+		}
+		for _, a := range from {
+			for _, b := range to {
+				e := p.graph.edge(a, b)
+				e.label = flowText(label)
+				e.dashed = strings.Contains(body, ".")
+				e.bold = strings.Contains(body, "=")
+				e.head, e.tail = flowArrow(end), flowArrow(start)
+			}
+		}
+		from = to
+	}
+}
+
+func flowArrow(mark string) arrowKind {
+	switch mark {
+	case ">", "<":
+		return arrowFilled
+	case "o":
+		return arrowCircle
+	case "x":
+		return arrowCross
+	}
+	return arrowNone
+}
+
+// group reads nodes joined by &
+func (p *flowParser) group() ([]string, error) {
+	var ids []string
+	for {
+		id, err := p.node()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+		p.space()
+		if p.pos == len(p.text) || p.text[p.pos] != '&' {
+			return ids, nil
+		}
+		p.pos++
+	}
+}
+
+// node reads a node ID and the shape and text it may be given
+func (p *flowParser) node() (string, error) {
+	p.space()
+	start := p.pos
+	for p.pos < len(p.text) {
+		r := rune(p.text[p.pos])
+		if r < 0x80 && !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			break
+		}
+		p.pos++
+	}
+	id := p.text[start:p.pos]
+	if id == "" {
+		if p.pos == len(p.text) {
+			return "", diagramErrorf(p.line, "expected a node at the end of the line")
+		}
+		return "", diagramErrorf(p.line, "expected a node at %q", p.text[p.pos:])
+	}
+	n := p.graph.node(id)
+
+	rest := p.text[p.pos:]
+	for _, s := range flowShapes {
+		if !strings.HasPrefix(rest, s.open) {
+			continue
+		}
+		body := rest[len(s.open):]
+		end := -1
+		if strings.HasPrefix(body, `"`) {
+			if q := strings.Index(body[1:], `"`); q >= 0 && strings.HasPrefix(body[q+2:], s.close) {
+				end = q + 2
+			}
+		} else {
+			end = strings.Index(body, s.close)
+		}
+		if end < 0 {
+			continue
+		}
+		n.label, n.shape = flowText(body[:end]), s.shape
+		p.pos += len(s.open) + end + len(s.close)
+		break
+	}
+	// Classes given with ::: only style the node
+	if strings.HasPrefix(p.text[p.pos:], ":::") {
+		p.pos += 3
+		for p.pos < len(p.text) && !strings.ContainsRune(" ;&-=.~<", rune(p.text[p.pos])) {
+			p.pos++
+		}
+	}
+	return id, nil
+}
+
+// flowText returns the text of a node or link without quotes and markdown
+// markers
+func flowText(text string) string {
+	text = strings.TrimSpace(text)
+	if len(text) >= 2 && text[0] == '"' && text[len(text)-1] == '"' {
+		text = text[1 : len(text)-1]
+	}
+	text = strings.Trim(text, "`")
+	return diagramBreaks.Replace(strings.ReplaceAll(text, "**", ""))
+}
+
+var (
+	mermaidMessage = regexp.MustCompile(`^(.+?)\s*(<<-->>|<<->>|-->>|->>|-->|->|--x|-x|--\)|-\))\s*([+-]?)\s*([^:]+?)\s*(?::\s*(.*))?$`)
+	mermaidNote    = regexp.MustCompile(`(?i)^note\s+(left of|right of|over)\s+([^:]+?)\s*:\s*(.*)$`)
+)
+
+// sequenceFrames are the keywords that open a frame in a sequence diagram
+var sequenceFrames = map[string]bool{
+	"loop": true, "alt": true, "opt": true, "par": true, "critical": true, "break": true, "group": true,
+}
+
+// sequenceFrame tracks an open frame while parsing, which may be one that
+// is not drawn such as a highlighted rect
+type sequenceFrame struct {
+	line  int
+	drawn bool
+}
+
+// parseMermaidSequence reads the participants, messages, notes and frames
+// of a sequence diagram
+func parseMermaidSequence(lines []diagramLine) (*sequenceDiagram, error) {
+	s := newSequenceDiagram()
+	var frames []sequenceFrame
+	for _, l := range lines {
+		word, rest := firstWord(l.text)
+		switch word {
+		case "participant", "actor":
+			id, label := rest, rest
+			if i := strings.Index(rest, " as "); i >= 0 {
+				id, label = strings.TrimSpace(rest[:i]), strings.TrimSpace(rest[i+4:])
+			}
+			p := s.participant(id)
+			p.label = diagramBreaks.Replace(label)
+			p.actor = word == "actor"
+			continue
+		case "title":
+			s.title = rest
+			continue
+		case "autonumber", "activate", "deactivate", "links", "link", "create", "destroy":
+			continue
+		case "rect", "box":
+			frames = append(frames, sequenceFrame{line: l.line})
+			continue
+		case "else", "and", "option":
+			if len(frames) == 0 || !frames[len(frames)-1].drawn {
+				return nil, diagramErrorf(l.line, "%s is outside a frame", word)
+			}
+			s.events = append(s.events, sequenceEvent{kind: eventFrameElse, text: rest, line: l.line})
+			continue
+		case "end":
+			if len(frames) == 0 {
+				return nil, diagramErrorf(l.line, "end without a frame to close")
+			}
+			if frames[len(frames)-1].drawn {
+				s.events = append(s.events, sequenceEvent{kind: eventFrameEnd, line: l.line})
+			}
+			frames = frames[:len(frames)-1]
+			continue
+		}
+		if sequenceFrames[word] {
+			frames = append(frames, sequenceFrame{line: l.line, drawn: true})
+			s.events = append(s.events, sequenceEvent{kind: eventFrameStart, frame: word, text: rest, line: l.line})
+			continue
+		}
+
+		if m := mermaidNote.FindStringSubmatch(l.text); m != nil {
+			s.events = append(s.events, noteEvent(s, strings.ToLower(m[1]), m[2], m[3], l.line))
+			continue
+		}
+		if m := mermaidMessage.FindStringSubmatch(l.text); m != nil {
+			e := sequenceEvent{kind: eventMessage, from: s.participant(strings.TrimSpace(m[1])), to: s.participant(m[4]),
+				text: diagramBreaks.Replace(m[5]), dashed: strings.HasPrefix(m[2], "--") || strings.HasPrefix(m[2], "<<--"), line: l.line}
+			switch {
+			case strings.HasSuffix(m[2], ">>"):
+				e.head = arrowFilled
+			case strings.HasSuffix(m[2], ">"):
+				e.head = arrowNone
+			case strings.HasSuffix(m[2], "x"):
+				e.head = arrowCross
+			case strings.HasSuffix(m[2], ")"):
+				e.head = arrowOpen
+			}
+			if strings.HasPrefix(m[2], "<<") {
+				e.tail = arrowFilled
+			}
+			s.events = append(s.events, e)
+			continue
+		}
+		return nil, diagramErrorf(l.line, "cannot read %q", l.text)
+	}
+	if len(frames) > 0 {
+		return nil, diagramErrorf(frames[len(frames)-1].line, "the frame is not closed with end")
+	}
+	if len(s.participants) == 0 {
+		return nil, diagramErrorf(0, "the diagram has no participants")
+	}
+	return s, nil
+}
+
+// noteEvent returns a note beside or over participants, given as
+// "left of", "right of" or "over" and a comma separated list
+func noteEvent(s *sequenceDiagram, place, participants, text string, line int) sequenceEvent {
+	e := sequenceEvent{kind: eventNote, text: diagramBreaks.Replace(strings.TrimSpace(text)), line: line}
+	ids := strings.Split(participants, ",")
+	e.from = s.participant(strings.TrimSpace(ids[0]))
+	e.to = s.participant(strings.TrimSpace(ids[len(ids)-1]))
+	switch strings.Fields(place)[0] {
+	case "left":
+		e.side = noteLeft
+	case "right":
+		e.side = noteRight
+	}
+	return e
+}
+
+var (
+	stateTransition = regexp.MustCompile(`^(\S+)\s*-->\s*(\S+)\s*(?::\s*(.*))?$`)
+	stateAlias      = regexp.MustCompile(`^state\s+"([^"]*)"\s+as\s+(\S+?)\s*\{?$`)
+	stateKind       = regexp.MustCompile(`^state\s+(\S+)\s+<<(\w+)>>$`)
+	stateDeclared   = regexp.MustCompile(`^state\s+(\S+?)\s*\{?$`)
+	stateDescribed  = regexp.MustCompile(`^(\S+)\s*:\s*(.+)$`)
+)
+
+// parseMermaidState reads the states and transitions of a state diagram,
+// flattening composite states and leaving out notes
+func parseMermaidState(lines []diagramLine) (*graphDiagram, error) {
+	g := newGraphDiagram()
+	state := func(id string, target bool) string {
+		if id == "[*]" {
+			id, shape := "[*]start", "start"
+			if target {
+				id, shape = "[*]end", "end"
+			}
+			n := g.node(id)
+			n.label, n.shape = "", shape
+			return id
+		}
+		if _, ok := g.byID[id]; !ok {
+			g.node(id).shape = "rounded"
+		}
+		return id
+	}
+
+	inNote := false
+	for _, l := range lines {
+		text := l.text
+		switch {
+		case inNote:
+			inNote = !strings.EqualFold(text, "end note")
+		case strings.HasPrefix(strings.ToLower(text), "note "):
+			inNote = !strings.Contains(text, ":")
+		case text == "}" || text == "--" || text == "{":
+		case strings.HasPrefix(text, "direction "):
+			if dir := strings.TrimSpace(text[len("direction "):]); dir == "TB" || dir == "BT" || dir == "LR" || dir == "RL" {
+				g.direction = dir
+			}
+		case strings.HasPrefix(text, "classDef ") || strings.HasPrefix(text, "class "):
+		case stateTransition.MatchString(text):
+			m := stateTransition.FindStringSubmatch(text)
+			e := g.edge(state(m[1], false), state(m[2], true))
+			e.label = diagramBreaks.Replace(m[3])
+		case stateAlias.MatchString(text):
+			m := stateAlias.FindStringSubmatch(text)
+			g.node(state(m[2], false)).label = diagramBreaks.Replace(m[1])
+		case stateKind.MatchString(text):
+			m := stateKind.FindStringSubmatch(text)
+			n := g.node(state(m[1], false))
+			switch m[2] {
+			case "fork", "join":
+				n.label, n.shape = "", "bar"
+			case "choice":
+				n.label, n.shape = "", "diamond"
+			}
+		case stateDeclared.MatchString(text):
+			state(stateDeclared.FindStringSubmatch(text)[1], false)
+		case stateDescribed.MatchString(text):
+			m := stateDescribed.FindStringSubmatch(text)
+			n := g.node(state(m[1], false))
+			if n.label == n.id {
+				n.label = ""
+			} else {
+				n.label += "\n"
+			}
+			n.label += diagramBreaks.Replace(m[2])
+		default:
+			return nil, diagramErrorf(l.line, "cannot read %q", text)
+		}
+	}
+	return g, nil
+}
+
+var (
+	classRelation   = regexp.MustCompile(`^([\w~.]+)\s*(?:"[^"]*"\s*)?(<\||\*|o|<)?(--|\.\.)(\|>|\*|o|>)?\s*(?:"[^"]*"\s*)?([\w~.]+)\s*(?::\s*(.*))?$`)
+	classDeclared   = regexp.MustCompile(`^class\s+([\w.]+)(~[^~]*~)?(?:\["([^"]*)"\])?\s*(\{)?\s*(?:\}\s*)?$`)
+	classMember     = regexp.MustCompile(`^([\w.]+)\s*:\s*(.+)$`)
+	classAnnotation = regexp.MustCompile(`^<<(.+)>>\s*([\w.]*)$`)
+)
+
+// parseMermaidClass reads the classes, members and relations of a class
+// diagram, leaving out notes and namespaces
+func parseMermaidClass(lines []diagramLine) (*graphDiagram, error) {
+	g := newGraphDiagram()
+	class := func(id string) *graphNode {
+		n, ok := g.byID[id]
+		if !ok {
+			n = g.node(id)
+			n.shape = "class"
+		}
+		return n
+	}
+
+	var open *graphNode
+	for _, l := range lines {
+		text := l.text
+		if open != nil {
+			if text == "}" {
+				open = nil
+			} else if m := classAnnotation.FindStringSubmatch(text); m != nil && m[2] == "" {
+				open.label = "«" + m[1] + "»\n" + open.label
+			} else {
+				open.members = append(open.members, text)
+			}
+			continue
+		}
+
+		switch {
+		case text == "}" || strings.HasPrefix(text, "namespace ") || strings.HasPrefix(text, "note ") ||
+			strings.HasPrefix(text, "note\t") || strings.HasPrefix(text, "classDef ") || strings.HasPrefix(text, "style "):
+		case strings.HasPrefix(text, "direction "):
+			if dir := strings.TrimSpace(text[len("direction "):]); dir == "TB" || dir == "BT" || dir == "LR" || dir == "RL" {
+				g.direction = dir
+			}
+		case classRelation.MatchString(text):
+			m := classRelation.FindStringSubmatch(text)
+			e := g.edge(class(classID(m[1])).id, class(classID(m[5])).id)
+			e.tail, e.head = umlArrow(m[2]), umlArrow(m[4])
+			e.dashed = m[3] == ".."
+			e.label = diagramBreaks.Replace(m[6])
+		case classDeclared.MatchString(text):
+			m := classDeclared.FindStringSubmatch(text)
+			n := class(m[1])
+			if m[3] != "" {
+				n.label = m[3]
+			} else if m[2] != "" {
+				n.label = m[1] + "<" + strings.Trim(m[2], "~") + ">"
+			}
+			if m[4] != "" && !strings.HasSuffix(text, "}") {
+				open = n
+			}
+		case classAnnotation.MatchString(text):
+			m := classAnnotation.FindStringSubmatch(text)
+			n := class(m[2])
+			n.label = "«" + m[1] + "»\n" + n.label
+		case classMember.MatchString(text):
+			m := classMember.FindStringSubmatch(text)
+			n := class(m[1])
+			n.members = append(n.members, m[2])
+		default:
+			return nil, diagramErrorf(l.line, "cannot read %q", text)
+		}
+	}
+	if open != nil {
+		return nil, diagramErrorf(0, "the members of %s are not closed with }", open.id)
+	}
+	return g, nil
+}
+
+// classID drops the generic type from a class name in a relation
+func classID(name string) string {
+	id, _, _ := strings.Cut(name, "~")
+	return id
+}
+
+// umlArrow returns the arrow drawn for the end of a UML relation
+func umlArrow(mark string) arrowKind {
+	switch mark {
+	case "<|", "|>", "^":
+		return arrowHollow
+	case "*":
+		return arrowDiamond
+	case "o":
+		return arrowHollowDiamond
+	case "<", ">":
+		return arrowOpen
+	case "<<", ">>":
+		return arrowOpen
+	case "x":
+		return arrowCross
+	case "#", "+":
+		return arrowCircle
+	}
+	return arrowNone
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// plantUMLGraphWords start the declarations of diagrams that are drawn as
+// graphs rather than sequences
+var plantUMLGraphWords = map[string]bool{
+	"class": true, "interface": true, "abstract": true, "enum": true, "annotation": true,
+	"usecase": true, "component": true, "state": true, "node": true, "package": true,
+	"rectangle": true, "object": true, "folder": true, "frame": true, "cloud": true,
+	"artifact": true, "storage": true, "card": true, "namespace": true,
+}
+
+// plantUMLParticipants are the words that declare a sequence participant
+var plantUMLParticipants = map[string]bool{
+	"participant": true, "actor": true, "boundary": true, "control": true, "entity": true,
+	"database": true, "collections": true, "queue": true,
+}
+
+// plantUMLSkipped are statements that only style or number a diagram
+var plantUMLSkipped = map[string]bool{
+	"skinparam": true, "hide": true, "show": true, "scale": true, "autonumber": true,
+	"activate": true, "deactivate": true, "destroy": true, "create": true, "return": true,
+	"newpage": true, "header": true, "footer": true, "caption": true, "remove": true,
+	"allowmixing": true, "set": true, "autoactivate": true, "...": true, "|||": true,
+}
+
+var plantUMLBlockComment = regexp.MustCompile(`(?s)/'.*?'/`)
+
+// parsePlantUML reads a PlantUML sequence diagram, or a class, use case,
+// component or state diagram drawn as a graph
+func parsePlantUML(code string) (*graphDiagram, *sequenceDiagram, error) {
+	// Block comments are blanked line by line so line numbers still match
+	code = plantUMLBlockComment.ReplaceAllStringFunc(code, func(comment string) string {
+		return strings.Repeat("\n", strings.Count(comment, "\n"))
+	})
+	var lines []diagramLine
+	var title string
+	direction := "TB"
+	skipping := ""
+	for _, l := range diagramLines(code, "'") {
+		word, rest := firstWord(l.text)
+		lower := strings.ToLower(l.text)
+		switch {
+		case skipping != "":
+			if strings.HasPrefix(lower, skipping) {
+				skipping = ""
+			}
+		case strings.HasPrefix(word, "@start"):
+			if word != "@startuml" {
+				return nil, nil, diagramErrorf(l.line, "PlantUML %s diagrams are not supported", strings.TrimPrefix(word, "@start"))
+			}
+		case strings.HasPrefix(word, "@end"), strings.HasPrefix(word, "!"):
+		case word == "skinparam" && strings.HasSuffix(l.text, "{"):
+			skipping = "}"
+		case word == "legend":
+			skipping = "endlegend"
+		case word == "title":
+			title = rest
+		case lower == "left to right direction":
+			direction = "LR"
+		case lower == "top to bottom direction":
+			direction = "TB"
+		case plantUMLSkipped[strings.ToLower(word)]:
+		case lower == "start" || lower == "stop" || strings.HasPrefix(l.text, ":") && strings.HasSuffix(l.text, ";"):
+			return nil, nil, diagramErrorf(l.line, "PlantUML activity diagrams are not supported; use a sequence, class, use case, component or state diagram")
+		default:
+			lines = append(lines, l)
+		}
+	}
+
+	graph := false
+	for _, l := range lines {
+		word, _ := firstWord(l.text)
+		if plantUMLGraphWords[strings.ToLower(word)] || strings.Contains(l.text, "[*]") ||
+			strings.HasPrefix(l.text, "(") || strings.HasPrefix(l.text, "[") ||
+			strings.Contains(l.text, "<|") || strings.Contains(l.text, "|>") {
+			graph = true
+			break
+		}
+	}
+	if graph {
+		g, err := parsePlantUMLGraph(lines)
+		if err == nil {
+			g.direction = direction
+			if len(g.nodes) == 0 {
+				err = diagramErrorf(0, "the diagram is empty")
+			}
+		}
+		return g, nil, err
+	}
+	s, err := parsePlantUMLSequence(lines)
+	if err == nil {
+		s.title = title
+	}
+	return nil, s, err
+}
+
+var (
+	plantUMLMessage = regexp.MustCompile(`^("[^"]+"|[^\s<>\-"]+)\s*(<<|<|x|o|\\\\|//|\\|/)?(-{1,2})(?:\[[^\]]*\])?(-?)(>>|>|x|o|\\\\|//|\\|/)?\s*("[^"]+"|[^\s<>\-":]+)\s*(?::\s*(.*))?$`)
+	plantUMLNote    = regexp.MustCompile(`(?i)^[hr]?note\s+(left of|right of|over)\s+([^:]+?)\s*(?::\s*(.*))?$`)
+	plantUMLRef     = regexp.MustCompile(`(?i)^ref\s+over\s+([^:]+?)\s*:\s*(.*)$`)
+	plantUMLDivider = regexp.MustCompile(`^==\s*(.*?)\s*==$`)
+	plantUMLAlias   = regexp.MustCompile(`^(?:"([^"]+)"|(\S+))(?:\s+as\s+(?:"([^"]+)"|(\S+)))?`)
+)
+
+// plantUMLName removes the quotes around a name
+func plantUMLName(name string) string {
+	return strings.Trim(name, `"`)
+}
+
+// parsePlantUMLSequence reads the participants, messages, notes and groups
+// of a sequence diagram
+func parsePlantUMLSequence(lines []diagramLine) (*sequenceDiagram, error) {
+	s := newSequenceDiagram()
+	var frames []sequenceFrame
+	var note *sequenceEvent
+	for _, l := range lines {
+		if note != nil {
+			if strings.HasPrefix(strings.ToLower(l.text), "end") {
+				s.events = append(s.events, *note)
+				note = nil
+			} else {
+				if note.text != "" {
+					note.text += "\n"
+				}
+				note.text += l.text
+			}
+			continue
+		}
+
+		word, rest := firstWord(l.text)
+		lower := strings.ToLower(word)
+		switch {
+		case plantUMLParticipants[lower]:
+			m := plantUMLAlias.FindStringSubmatch(rest)
+			if m == nil {
+				return nil, diagramErrorf(l.line, "expected the name of the %s", lower)
+			}
+			label, id := m[1]+m[2], m[3]+m[4]
+			if id == "" {
+				id = label
+			} else if m[2] != "" && m[3] != "" {
+				// As in participant L as "Long name"
+				label, id = id, label
+			}
+			p := s.participant(id)
+			p.label = diagramBreaks.Replace(label)
+			p.actor = lower == "actor"
+		case lower == "box":
+			frames = append(frames, sequenceFrame{line: l.line})
+		case lower == "else":
+			if len(frames) == 0 || !frames[len(frames)-1].drawn {
+				return nil, diagramErrorf(l.line, "else is outside a group")
+			}
+			s.events = append(s.events, sequenceEvent{kind: eventFrameElse, text: rest, line: l.line})
+		case lower == "end":
+			if len(frames) == 0 {
+				return nil, diagramErrorf(l.line, "end without a group to close")
+			}
+			if frames[len(frames)-1].drawn {
+				s.events = append(s.events, sequenceEvent{kind: eventFrameEnd, line: l.line})
+			}
+			frames = frames[:len(frames)-1]
+		case sequenceFrames[lower]:
+			frames = append(frames, sequenceFrame{line: l.line, drawn: true})
+			s.events = append(s.events, sequenceEvent{kind: eventFrameStart, frame: lower, text: rest, line: l.line})
+		case plantUMLDivider.MatchString(l.text):
+			s.events = append(s.events, sequenceEvent{kind: eventDivider, text: plantUMLDivider.FindStringSubmatch(l.text)[1], line: l.line})
+		case plantUMLRef.MatchString(l.text):
+			m := plantUMLRef.FindStringSubmatch(l.text)
+			s.events = append(s.events, noteEvent(s, "over", m[1], m[2], l.line))
+		case plantUMLNote.MatchString(l.text):
+			m := plantUMLNote.FindStringSubmatch(l.text)
+			e := noteEvent(s, strings.ToLower(m[1]), m[2], m[3], l.line)
+			if !strings.Contains(l.text, ":") {
+				note = &e
+				continue
+			}
+			s.events = append(s.events, e)
+		case plantUMLMessage.MatchString(l.text):
+			m := plantUMLMessage.FindStringSubmatch(l.text)
+			if m[2] == "" && m[5] == "" {
+				return nil, diagramErrorf(l.line, "the message %q has no arrow head", l.text)
+			}
+			from, to := s.participant(plantUMLName(m[1])), s.participant(plantUMLName(m[6]))
+			e := sequenceEvent{kind: eventMessage, from: from, to: to, text: diagramBreaks.Replace(m[7]),
+				dashed: len(m[3])+len(m[4]) > 1, head: plantUMLHead(m[5]), tail: plantUMLHead(m[2]), line: l.line}
+			if m[5] == "" {
+				// Written backwards, as in A <- B
+				e.from, e.to, e.head, e.tail = to, from, e.tail, arrowNone
+			}
+			s.events = append(s.events, e)
+		default:
+			return nil, diagramErrorf(l.line, "cannot read %q", l.text)
+		}
+	}
+	if note != nil {
+		return nil, diagramErrorf(note.line, "the note is not closed with end note")
+	}
+	if len(frames) > 0 {
+		return nil, diagramErrorf(frames[len(frames)-1].line, "the group is not closed with end")
+	}
+	if len(s.participants) == 0 {
+		return nil, diagramErrorf(0, "the diagram has no participants")
+	}
+	return s, nil
+}
+
+// plantUMLHead returns the arrow drawn for the end of a message
+func plantUMLHead(mark string) arrowKind {
+	switch mark {
+	case "":
+		return arrowNone
+	case ">", "<":
+		return arrowFilled
+	case "x":
+		return arrowCross
+	case "o":
+		return arrowCircle
+	}
+	return arrowOpen
+}
+
+const plantUMLEndpoint = `("[^"]*"|\([^)]*\)|\[[^\]]*\]|:[^:]+:|[\w.]+)`
+
+var (
+	plantUMLRelation  = regexp.MustCompile(`^` + plantUMLEndpoint + `\s*(?:"[^"]*"\s*)?(\S*[-.]\S*?)\s*(?:"[^"]*"\s*)?` + plantUMLEndpoint + `\s*(?::\s*(.*))?$`)
+	plantUMLArrowHint = regexp.MustCompile(`\[[^\]]*\]|(?i)(up|down|left|right|u|d|l|r)`)
+	plantUMLDeclared  = regexp.MustCompile(`(?i)^(abstract class|abstract|class|interface|enum|annotation|entity|usecase|actor|component|node|package|namespace|rectangle|folder|frame|cloud|database|state|object|storage|artifact|card|queue|boundary|control|collections)\s+(.*)$`)
+	plantUMLStereo    = regexp.MustCompile(`<<([^>]*)>>|#\S+`)
+	plantUMLMember    = regexp.MustCompile(`^("[^"]*"|[\w.]+)\s*:\s*(.+)$`)
+)
+
+// plantUMLGraph reads the declarations and relations of a graph diagram
+type plantUMLGraph struct {
+	graph *graphDiagram
+}
+
+// endpoint returns the node for a name as written in a relation, where
+// (name) is a use case, [name] a component, :name: an actor and [*] the
+// start or end of a state diagram
+func (p *plantUMLGraph) endpoint(name string, target bool) *graphNode {
+	label, shape := name, "box"
+	switch {
+	case name == "[*]":
+		id, shape := "[*]start", "start"
+		if target {
+			id, shape = "[*]end", "end"
+		}
+		n := p.graph.node(id)
+		n.label, n.shape = "", shape
+		return n
+	case strings.HasPrefix(name, "("):
+		label, shape = strings.Trim(name, "()"), "ellipse"
+	case strings.HasPrefix(name, "["):
+		label = strings.Trim(name, "[]")
+	case strings.HasPrefix(name, ":"):
+		label, shape = strings.Trim(name, ":"), "actor"
+	case strings.HasPrefix(name, `"`):
+		label = plantUMLName(name)
+	}
+	if existing, ok := p.graph.byID[name]; ok {
+		return existing
+	}
+	if existing, ok := p.graph.byID[label]; ok {
+		return existing
+	}
+	n := p.graph.node(label)
+	n.label, n.shape = diagramBreaks.Replace(label), shape
+	return n
+}
+
+// declare adds a node declared with a keyword such as class or usecase
+func (p *plantUMLGraph) declare(keyword, rest string) *graphNode {
+	keyword = strings.ToLower(keyword)
+	stereotype := ""
+	if m := plantUMLStereo.FindStringSubmatch(rest); m != nil && m[1] != "" {
+		stereotype = m[1]
+	}
+	rest = strings.TrimSpace(plantUMLStereo.ReplaceAllString(rest, ""))
+
+	name, alias := rest, ""
+	if i := strings.Index(rest, " as "); i >= 0 {
+		name, alias = strings.TrimSpace(rest[:i]), strings.TrimSpace(rest[i+4:])
+		if strings.HasPrefix(alias, `"`) {
+			name, alias = alias, name
+		}
+	}
+	label := strings.Trim(name, `"()[]:`)
+	id := alias
+	if id == "" {
+		id = label
+	}
+
+	n, ok := p.graph.byID[id]
+	if !ok {
+		n = p.graph.node(id)
+	}
+	n.label = diagramBreaks.Replace(label)
+	switch keyword {
+	case "class", "interface", "abstract", "abstract class", "enum", "annotation", "entity", "object":
+		n.shape = "class"
+		switch keyword {
+		case "interface", "enum", "annotation":
+			stereotype = keyword
+		case "abstract", "abstract class":
+			stereotype = "abstract"
+		}
+	case "usecase":
+		n.shape = "ellipse"
+	case "actor":
+		n.shape = "actor"
+	case "state":
+		n.shape = "rounded"
+	case "database", "queue", "storage":
+		n.shape = "cylinder"
+	case "cloud":
+		n.shape = "ellipse"
+	default:
+		n.shape = "box"
+	}
+	if stereotype != "" {
+		n.label = "«" + stereotype + "»\n" + n.label
+	}
+	return n
+}
+
+// parsePlantUMLGraph reads a class, use case, component or state diagram.
+// Packages and composite states are flattened and notes are left out.
+func parsePlantUMLGraph(lines []diagramLine) (*graphDiagram, error) {
+	p := &plantUMLGraph{graph: newGraphDiagram()}
+	var members *graphNode
+	inNote := false
+	for _, l := range lines {
+		text := l.text
+		if inNote {
+			inNote = !strings.HasPrefix(strings.ToLower(text), "end note")
+			continue
+		}
+		if members != nil {
+			switch {
+			case text == "}":
+				members = nil
+			case text == "--" || text == ".." || text == "==" || text == "__":
+			default:
+				members.members = append(members.members, text)
+			}
+			continue
+		}
+
+		lower := strings.ToLower(text)
+		switch {
+		case text == "}":
+		case strings.HasPrefix(lower, "note "):
+			inNote = !strings.Contains(text, ":") && !strings.HasPrefix(lower, `note "`)
+		case plantUMLRelation.MatchString(text) && !plantUMLDeclared.MatchString(text):
+			m := plantUMLRelation.FindStringSubmatch(text)
+			arrow := plantUMLArrowHint.ReplaceAllString(m[2], "")
+			first, last := strings.IndexAny(arrow, "-."), strings.LastIndexAny(arrow, "-.")
+			from, to := p.endpoint(m[1], false), p.endpoint(m[3], true)
+			e := p.graph.edge(from.id, to.id)
+			e.tail, e.head = umlArrow(arrow[:first]), umlArrow(arrow[last+1:])
+			e.dashed = strings.Contains(arrow, ".")
+			e.label = diagramBreaks.Replace(m[4])
+		case plantUMLDeclared.MatchString(text):
+			m := plantUMLDeclared.FindStringSubmatch(text)
+			rest := strings.TrimSpace(m[2])
+			open := strings.HasSuffix(rest, "{")
+			n := p.declare(m[1], strings.TrimSpace(strings.TrimSuffix(rest, "{")))
+			// Classes list members in braces while other blocks hold nodes
+			if open && n.shape == "class" {
+				members = n
+			}
+		case plantUMLMember.MatchString(text):
+			m := plantUMLMember.FindStringSubmatch(text)
+			n := p.endpoint(m[1], false)
+			if n.shape == "class" {
+				n.members = append(n.members, m[2])
+			} else {
+				n.label += "\n" + diagramBreaks.Replace(m[2])
+			}
+		case strings.HasPrefix(text, "(") || strings.HasPrefix(text, "[") || strings.HasPrefix(text, ":"):
+			// A use case, component or actor on its own
+			name, alias, _ := strings.Cut(text, " as ")
+			n := p.endpoint(strings.TrimSpace(name), false)
+			if alias = strings.TrimSpace(alias); alias != "" && n.id != alias {
+				p.graph.byID[alias] = n
+			}
+		default:
+			return nil, diagramErrorf(l.line, "cannot read %q", text)
+		}
+	}
+	if members != nil {
+		return nil, diagramErrorf(0, "the members of %s are not closed with }", members.id)
+	}
+	return p.graph, nil
+}
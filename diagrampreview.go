@@ -0,0 +1,138 @@
+package main
+
+import (
+	"image"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// diagramOversample draws diagrams at twice their size, so that they stay
+// sharp on high density screens
+const diagramOversample = 2
+
+// diagramImageKey identifies a drawn diagram in the cache
+type diagramImageKey struct {
+	syntax, code string
+	dark         bool
+}
+
+// diagramImage is a drawn diagram, or why it could not be drawn
+type diagramImage struct {
+	img *image.RGBA
+	err error
+}
+
+// diagramImages keeps drawn diagrams, as the preview renders every block
+// again whenever the document changes
+var diagramImages = struct {
+	sync.Mutex
+	images map[diagramImageKey]diagramImage
+}{images: make(map[diagramImageKey]diagramImage)}
+
+// cachedDiagramImage lays out and draws a diagram in the light or dark
+// palette, or returns the copy drawn before
+func cachedDiagramImage(syntax, code string, dark bool) (*image.RGBA, error) {
+	key := diagramImageKey{syntax, code, dark}
+	diagramImages.Lock()
+	defer diagramImages.Unlock()
+	if drawn, ok := diagramImages.images[key]; ok {
+		return drawn.img, drawn.err
+	}
+
+	var drawn diagramImage
+	d, err := renderDiagram(syntax, code)
+	if err == nil {
+		palette := diagramLight
+		if dark {
+			palette = diagramDark
+		}
+		drawn.img, err = d.image(palette, diagramOversample)
+	}
+	drawn.err = err
+	if len(diagramImages.images) >= 64 {
+		clear(diagramImages.images)
+	}
+	diagramImages.images[key] = drawn
+	return drawn.img, drawn.err
+}
+
+// darkVariant reports whether the preview is drawn on a dark background,
+// which follows the theme rather than the variant it was asked for
+func darkVariant() bool {
+	r, g, b, _ := theme.Color(theme.ColorNameBackground).RGBA()
+	return 299*r+587*g+114*b < 1000*0x8000
+}
+
+// renderDiagramBlock returns the segments for a diagram, or the error and
+// its source when it cannot be drawn
+func renderDiagramBlock(syntax, code string, style inlineStyle) []widget.RichTextSegment {
+	if _, err := cachedDiagramImage(syntax, code, darkVariant()); err != nil {
+		style.text.Monospace = true
+		style.color = theme.ColorNameError
+		message := style.segment(syntax + ": " + err.Error())
+		message.Style.Inline = false
+		return []widget.RichTextSegment{message, &widget.TextSegment{Style: widget.RichTextStyleCodeBlock, Text: code}}
+	}
+	return []widget.RichTextSegment{&diagramSegment{syntax: syntax, code: code}}
+}
+
+// diagramSegment is a diagram in the preview, drawn as a picture centered
+// in the width of the preview
+type diagramSegment struct {
+	syntax, code string
+}
+
+// image returns the diagram as a canvas image at its size on screen
+func (s *diagramSegment) image() *canvas.Image {
+	drawn, err := cachedDiagramImage(s.syntax, s.code, darkVariant())
+	if err != nil {
+		fyne.LogError("Failed to draw diagram", err)
+		return canvas.NewImageFromResource(nil)
+	}
+	img := canvas.NewImageFromImage(drawn)
+	img.FillMode = canvas.ImageFillContain
+	bounds := drawn.Bounds()
+	img.SetMinSize(fyne.NewSize(float32(bounds.Dx())/diagramOversample, float32(bounds.Dy())/diagramOversample))
+	return img
+}
+
+// Inline returns false as a diagram is a block of its own
+func (s *diagramSegment) Inline() bool {
+	return false
+}
+
+// Textual returns the source of the diagram
+func (s *diagramSegment) Textual() string {
+	return s.code
+}
+
+// Visual returns the diagram centered in the width of the preview
+func (s *diagramSegment) Visual() fyne.CanvasObject {
+	b := &imageBlock{image: s.image()}
+	b.ExtendBaseWidget(b)
+	return b
+}
+
+// Update draws the diagram again, as the theme may have changed
+func (s *diagramSegment) Update(o fyne.CanvasObject) {
+	b := o.(*imageBlock)
+	img := s.image()
+	b.image.Image = img.Image
+	b.image.SetMinSize(img.MinSize())
+	b.Refresh()
+}
+
+// Select does nothing as the preview text cannot be selected
+func (s *diagramSegment) Select(_, _ fyne.Position) {}
+
+// SelectedText returns an empty string as the preview text cannot be selected
+func (s *diagramSegment) SelectedText() string {
+	return ""
+}
+
+// Unselect does nothing as the preview text cannot be selected
+func (s *diagramSegment) Unselect() {}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"strings"
+)
+
+// Spacing of sequence diagrams, in pixels
+const (
+	sequencePadX = 12
+	sequencePadY = 8
+	sequenceGap  = 30
+	sequenceRow  = 16
+	// sequenceLoop is the width of a message a participant sends itself
+	sequenceLoop = 30
+	sequenceNote = 8
+)
+
+// sequenceFrameBox is a frame being laid out, which grows to hold the
+// messages and notes inside it
+type sequenceFrameBox struct {
+	top        float64
+	keyword    string
+	label      string
+	left       float64
+	right      float64
+	dividers   []float64
+	conditions []string
+}
+
+// layoutSequence places the participants of a sequence diagram in columns
+// wide enough for the messages between them, and its events in rows
+func layoutSequence(s *sequenceDiagram, m *diagramMeasure) *diagram {
+	count := len(s.participants)
+	column := make(map[*participant]int, count)
+	widths := make([]float64, count)
+	header := 0.0
+	for i, p := range s.participants {
+		column[p] = i
+		tw, th := m.size(p.label, false)
+		widths[i], header = max(tw+2*sequencePadX, 60), max(header, th+2*sequencePadY)
+		if p.actor {
+			widths[i], header = max(tw, 40), max(header, 44+th)
+		}
+	}
+
+	// Gaps between columns grow to fit what is written between them,
+	// narrowest spans first
+	gaps := make([]float64, max(count-1, 0))
+	for i := range gaps {
+		gaps[i] = widths[i]/2 + widths[i+1]/2 + sequenceGap
+	}
+	events := slices.Clone(s.events)
+	slices.SortStableFunc(events, func(a, b sequenceEvent) int {
+		return abs(column[a.to]-column[a.from]) - abs(column[b.to]-column[b.from])
+	})
+	for _, e := range events {
+		tw, _ := m.size(e.text, false)
+		switch {
+		case e.kind == eventMessage && e.from != e.to:
+			from, to := min(column[e.from], column[e.to]), max(column[e.from], column[e.to])
+			need, have := tw+2*sequencePadX, 0.0
+			for i := from; i < to; i++ {
+				have += gaps[i]
+			}
+			for i := from; i < to && need > have; i++ {
+				gaps[i] += (need - have) / float64(to-from)
+			}
+		case e.kind == eventMessage && column[e.from] < count-1:
+			gaps[column[e.from]] = max(gaps[column[e.from]], sequenceLoop+tw+2*sequencePadX)
+		case e.kind == eventNote && e.side == noteRight && column[e.from] < count-1:
+			gaps[column[e.from]] = max(gaps[column[e.from]], tw+2*sequenceNote+20)
+		case e.kind == eventNote && e.side == noteLeft && column[e.from] > 0:
+			gaps[column[e.from]-1] = max(gaps[column[e.from]-1], tw+2*sequenceNote+20)
+		}
+	}
+	xs := make([]float64, count)
+	for i := 1; i < count; i++ {
+		xs[i] = xs[i-1] + gaps[i-1]
+	}
+	left, right := xs[0]-widths[0]/2, xs[count-1]+widths[count-1]/2
+
+	d := &diagram{}
+	var frames []*sequenceFrameBox
+	mark := func(from, to float64) {
+		for _, f := range frames {
+			f.left, f.right = min(f.left, from), max(f.right, to)
+		}
+	}
+	y := header + 20
+	for _, e := range s.events {
+		tw, th := m.size(e.text, false)
+		switch e.kind {
+		case eventMessage:
+			x1, x2 := xs[column[e.from]], xs[column[e.to]]
+			if e.from == e.to {
+				d.text(m, e.text, x1+8, y, anchorStart, roleText, false)
+				y += th + 2
+				loop := []diagramPoint{{x1, y}, {x1 + sequenceLoop, y}, {x1 + sequenceLoop, y + 18}, {x1, y + 18}}
+				d.connector(loop, e.head, e.tail, 1.2, e.dashed)
+				y += 18 + sequenceRow
+				mark(x1, x1+max(sequenceLoop, tw+8))
+				continue
+			}
+			d.text(m, e.text, (x1+x2)/2, y, anchorMiddle, roleText, false)
+			y += th + 3
+			d.connector([]diagramPoint{{x1, y}, {x2, y}}, e.head, e.tail, 1.2, e.dashed)
+			y += sequenceRow
+			mark(min(x1, x2), max(x1, x2))
+		case eventNote:
+			width, height := tw+2*sequenceNote, th+2*sequenceNote*3/4
+			x1, x2 := xs[column[e.from]], xs[column[e.to]]
+			var x float64
+			switch e.side {
+			case noteRight:
+				x = x1 + 10
+			case noteLeft:
+				x = x1 - 10 - width
+			default:
+				width = max(width, math.Abs(x2-x1)+30)
+				x = (x1+x2)/2 - width/2
+			}
+			d.shape(rectPoints(x, y, width, height), roleNote, roleNoteBorder)
+			d.text(m, e.text, x+width/2, y+sequenceNote*3/4, anchorMiddle, roleText, false)
+			y += height + 12
+			mark(x, x+width)
+		case eventFrameStart:
+			frames = append(frames, &sequenceFrameBox{top: y, keyword: e.frame, label: e.text,
+				left: math.Inf(1), right: math.Inf(-1)})
+			y += m.lineHeight + 16
+		case eventFrameElse:
+			f := frames[len(frames)-1]
+			f.dividers = append(f.dividers, y)
+			f.conditions = append(f.conditions, e.text)
+			y += m.lineHeight + 12
+		case eventFrameEnd:
+			f := frames[len(frames)-1]
+			frames = frames[:len(frames)-1]
+			if math.IsInf(f.left, 1) {
+				f.left, f.right = xs[0], xs[count-1]
+			}
+			f.left -= sequencePadX
+			f.right += sequencePadX
+			d.frame(m, f, y+4)
+			mark(f.left, f.right)
+			y += 16
+		case eventDivider:
+			y += 6
+			d.line([]diagramPoint{{left - 10, y}, {right + 10, y}}, roleFrame, 1, false)
+			d.line([]diagramPoint{{left - 10, y + 3}, {right + 10, y + 3}}, roleFrame, 1, false)
+			if e.text != "" {
+				cx := (left + right) / 2
+				d.shape(rectPoints(cx-tw/2-8, y-th/2-2, tw+16, th+4), roleLabel, roleFrame)
+				d.text(m, e.text, cx, y-th/2, anchorMiddle, roleText, true)
+			}
+			y += th/2 + sequenceRow + 6
+		}
+	}
+	y += 8
+
+	// Lifelines go behind the rows, and the boxes repeat below them
+	body := d.items
+	d.items = nil
+	for i := range s.participants {
+		d.line([]diagramPoint{{xs[i], header}, {xs[i], y}}, roleFrame, 1, true)
+	}
+	d.items = append(d.items, body...)
+	for i, p := range s.participants {
+		d.participant(m, p, xs[i], 0, widths[i], header)
+		d.participant(m, p, xs[i], y, widths[i], header)
+	}
+	if s.title != "" {
+		_, th := m.size(s.title, true)
+		d.text(m, s.title, (left+right)/2, -th-12, anchorMiddle, roleText, true)
+	}
+	d.fit(m, diagramMargin)
+	return d
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// participant draws the box or figure of a participant
+func (d *diagram) participant(m *diagramMeasure, p *participant, x, top, width, height float64) {
+	if p.actor {
+		_, th := m.size(p.label, false)
+		figure := top + height - th - 44
+		d.shape(ellipsePoints(diagramPoint{x, figure + 7}, 7, 7), roleNone, roleLine).width = 1.5
+		d.line([]diagramPoint{{x, figure + 14}, {x, figure + 28}}, roleLine, 1.5, false)
+		d.line([]diagramPoint{{x - 11, figure + 19}, {x + 11, figure + 19}}, roleLine, 1.5, false)
+		d.line([]diagramPoint{{x - 9, figure + 40}, {x, figure + 28}, {x + 9, figure + 40}}, roleLine, 1.5, false)
+		d.text(m, p.label, x, top+height-th, anchorMiddle, roleText, false)
+		return
+	}
+	d.shape(rectPoints(x-width/2, top, width, height), roleNode, roleBorder)
+	_, th := m.size(p.label, false)
+	d.text(m, p.label, x, top+(height-th)/2, anchorMiddle, roleText, false)
+}
+
+// frame draws the outline of a frame, its keyword in a tab and its
+// conditions
+func (d *diagram) frame(m *diagramMeasure, f *sequenceFrameBox, bottom float64) {
+	kw, _ := m.size(f.keyword, true)
+	tab := kw + 16
+	height := m.lineHeight + 6
+	condition := func(text string) string {
+		if text == "" {
+			return ""
+		}
+		return "[" + text + "]"
+	}
+	lw, _ := m.size(condition(f.label), false)
+	f.right = max(f.right, f.left+tab+lw+24)
+
+	d.shape(rectPoints(f.left, f.top, f.right-f.left, bottom-f.top), roleNone, roleFrame)
+	d.shape([]diagramPoint{{f.left, f.top}, {f.left + tab, f.top}, {f.left + tab, f.top + height - 6},
+		{f.left + tab - 6, f.top + height}, {f.left, f.top + height}}, roleLabel, roleFrame)
+	d.text(m, f.keyword, f.left+tab/2, f.top+3, anchorMiddle, roleText, true)
+	d.text(m, condition(f.label), f.left+tab+8, f.top+3, anchorStart, roleText, false)
+	for i, y := range f.dividers {
+		d.line([]diagramPoint{{f.left, y}, {f.right, y}}, roleFrame, 1, true)
+		d.text(m, condition(strings.TrimSpace(f.conditions[i])), f.left+8, y+3, anchorStart, roleText, false)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"math"
+	"strings"
+)
+
+// nodeOutline returns the outline of a node's shape around its center
+func nodeOutline(n *graphNode, c diagramPoint, width, height float64) []diagramPoint {
+	x, y := c.x-width/2, c.y-height/2
+	switch n.shape {
+	case "ellipse", "circle", "doublecircle", "point", "start", "end":
+		return ellipsePoints(c, width/2, height/2)
+	case "rounded":
+		return roundedPoints(x, y, width, height, 6)
+	case "stadium":
+		return roundedPoints(x, y, width, height, height/2)
+	case "diamond":
+		return []diagramPoint{{c.x, y}, {x + width, c.y}, {c.x, y + height}, {x, c.y}}
+	case "hexagon":
+		inset := height / 4
+		return []diagramPoint{{x + inset, y}, {x + width - inset, y}, {x + width, c.y}, {x + width - inset, y + height}, {x + inset, y + height}, {x, c.y}}
+	case "parallelogram":
+		return []diagramPoint{{x + 12, y}, {x + width, y}, {x + width - 12, y + height}, {x, y + height}}
+	case "trapezoid":
+		return []diagramPoint{{x + 12, y}, {x + width - 12, y}, {x + width, y + height}, {x, y + height}}
+	case "flag":
+		return []diagramPoint{{x, y}, {x + width, y}, {x + width, y + height}, {x, y + height}, {x + 12, c.y}}
+	}
+	return rectPoints(x, y, width, height)
+}
+
+// outlineCrossing returns where the line from the center of a shape to a
+// point leaves its outline, or the center if it does not
+func outlineCrossing(outline []diagramPoint, center, toward diagramPoint) diagramPoint {
+	dir := toward.sub(center)
+	best := math.Inf(1)
+	for i := range outline {
+		a, b := outline[i], outline[(i+1)%len(outline)]
+		edge := b.sub(a)
+		denominator := dir.x*edge.y - dir.y*edge.x
+		if denominator == 0 {
+			continue
+		}
+		offset := a.sub(center)
+		t := (offset.x*edge.y - offset.y*edge.x) / denominator
+		u := (offset.x*dir.y - offset.y*dir.x) / denominator
+		if t > 0 && u >= 0 && u <= 1 {
+			best = min(best, t)
+		}
+	}
+	if math.IsInf(best, 1) || best > 1 {
+		return center
+	}
+	return center.add(dir.scale(best))
+}
+
+// smoothLine rounds the corners of a line with quadratic curves through
+// the middles of its segments
+func smoothLine(points []diagramPoint) []diagramPoint {
+	if len(points) < 3 {
+		return points
+	}
+	line := []diagramPoint{points[0]}
+	current := points[0]
+	for i := 1; i < len(points)-1; i++ {
+		next := points[i].add(points[i+1]).scale(0.5)
+		if i == len(points)-2 {
+			next = points[i+1]
+		}
+		const steps = 10
+		for k := 1; k <= steps; k++ {
+			t := float64(k) / steps
+			u := 1 - t
+			line = append(line, diagramPoint{
+				u*u*current.x + 2*u*t*points[i].x + t*t*next.x,
+				u*u*current.y + 2*u*t*points[i].y + t*t*next.y,
+			})
+		}
+		current = next
+	}
+	return line
+}
+
+// trimLine shortens a line by a length at its end
+func trimLine(points []diagramPoint, length float64) []diagramPoint {
+	for len(points) > 1 {
+		last, before := points[len(points)-1], points[len(points)-2]
+		dir, segment := last.unit(before)
+		if segment > length {
+			trimmed := append([]diagramPoint(nil), points[:len(points)-1]...)
+			return append(trimmed, last.sub(dir.scale(length)))
+		}
+		length -= segment
+		points = points[:len(points)-1]
+	}
+	return points
+}
+
+// arrowSize returns the length of an arrow head and how much of the line
+// it replaces
+func arrowSize(kind arrowKind) (float64, float64) {
+	switch kind {
+	case arrowFilled, arrowHollow:
+		return 10, 10
+	case arrowOpen:
+		return 9, 1
+	case arrowDiamond, arrowHollowDiamond:
+		return 14, 14
+	case arrowCircle:
+		return 8, 8
+	case arrowCross:
+		return 8, 0
+	}
+	return 0, 0
+}
+
+// arrow draws an arrow head with its tip at the end of a line and returns
+// the line shortened to meet it
+func (d *diagram) arrow(points []diagramPoint, kind arrowKind) []diagramPoint {
+	length, replaced := arrowSize(kind)
+	if length == 0 || len(points) < 2 {
+		return points
+	}
+	tip := points[len(points)-1]
+	back := trimLine(points, length)
+	dir, _ := tip.unit(back[len(back)-1])
+	normal := diagramPoint{-dir.y, dir.x}
+	base := tip.sub(dir.scale(length))
+
+	switch kind {
+	case arrowFilled:
+		d.shape([]diagramPoint{tip, base.add(normal.scale(4.5)), base.sub(normal.scale(4.5))}, roleLine, roleLine)
+	case arrowHollow:
+		d.shape([]diagramPoint{tip, base.add(normal.scale(6)), base.sub(normal.scale(6))}, roleNone, roleLine)
+	case arrowOpen:
+		d.line([]diagramPoint{base.add(normal.scale(5)), tip, base.sub(normal.scale(5))}, roleLine, 1.2, false)
+	case arrowDiamond, arrowHollowDiamond:
+		middle := tip.sub(dir.scale(length / 2))
+		fill := roleLine
+		if kind == arrowHollowDiamond {
+			fill = roleNone
+		}
+		d.shape([]diagramPoint{tip, middle.add(normal.scale(5)), base, middle.sub(normal.scale(5))}, fill, roleLine)
+	case arrowCircle:
+		d.shape(ellipsePoints(tip.sub(dir.scale(length/2)), length/2, length/2), roleNone, roleLine)
+	case arrowCross:
+		middle := tip.sub(dir.scale(length / 2))
+		d.line([]diagramPoint{middle.add(dir.add(normal).scale(4)), middle.sub(dir.add(normal).scale(4))}, roleLine, 1.5, false)
+		d.line([]diagramPoint{middle.add(dir.sub(normal).scale(4)), middle.sub(dir.sub(normal).scale(4))}, roleLine, 1.5, false)
+	}
+	return trimLine(points, replaced)
+}
+
+// edge draws the line of a graph edge with its arrow heads
+func (d *diagram) edge(points []diagramPoint, e *graphEdge) {
+	width := 1.2
+	if e.bold {
+		width = 2.5
+	}
+	d.connector(points, e.head, e.tail, width, e.dashed)
+}
+
+// connector draws a line with arrow heads at its end and start
+func (d *diagram) connector(points []diagramPoint, head, tail arrowKind, width float64, dashed bool) {
+	points = d.arrow(points, head)
+	reversed := make([]diagramPoint, len(points))
+	for i, p := range points {
+		reversed[len(points)-1-i] = p
+	}
+	d.line(d.arrow(reversed, tail), roleLine, width, dashed)
+}
+
+// classHeader returns the name of a class and the stereotype above it
+func classHeader(n *graphNode) (string, string) {
+	if i := strings.LastIndex(n.label, "»\n"); i >= 0 {
+		return n.label[i+len("»\n"):], n.label[:i+len("»")]
+	}
+	return n.label, ""
+}
+
+// classMembers splits the members of a class into attributes and
+// operations, which have parentheses
+func classMembers(n *graphNode) ([]string, []string) {
+	var attributes, operations []string
+	for _, member := range n.members {
+		if strings.Contains(member, "(") {
+			operations = append(operations, member)
+		} else {
+			attributes = append(attributes, member)
+		}
+	}
+	return attributes, operations
+}
+
+// node draws a graph node centered on a point
+func (d *diagram) node(m *diagramMeasure, n *graphNode, c diagramPoint, width, height float64) {
+	x, y := c.x-width/2, c.y-height/2
+	_, th := m.size(n.label, false)
+	textTop := c.y - th/2
+	fill := func(item *diagramItem) {
+		item.dashed = n.dashed
+		if n.fill != nil {
+			item.color = n.fill
+		}
+	}
+
+	switch n.shape {
+	case "plain":
+	case "point", "start", "bar":
+		d.shape(nodeOutline(n, c, width, height), roleLine, roleNone)
+		return
+	case "end":
+		d.shape(ellipsePoints(c, width/2, height/2), roleNone, roleLine)
+		d.shape(ellipsePoints(c, width/2-4, height/2-4), roleLine, roleNone)
+		return
+	case "doublecircle":
+		fill(d.shape(ellipsePoints(c, width/2, height/2), roleNode, roleBorder))
+		d.shape(ellipsePoints(c, width/2-4, height/2-4), roleNone, roleBorder)
+	case "cylinder":
+		const ry = 7
+		outline := append(arcPoints(diagramPoint{c.x, y + ry}, width/2, ry, math.Pi, 2*math.Pi),
+			arcPoints(diagramPoint{c.x, y + height - ry}, width/2, ry, 0, math.Pi)...)
+		fill(d.shape(outline, roleNode, roleBorder))
+		d.line(arcPoints(diagramPoint{c.x, y + ry}, width/2, ry, 0, math.Pi), roleBorder, 1, false)
+		textTop += ry / 2
+	case "subroutine":
+		fill(d.shape(nodeOutline(n, c, width, height), roleNode, roleBorder))
+		d.line([]diagramPoint{{x + 8, y}, {x + 8, y + height}}, roleBorder, 1, false)
+		d.line([]diagramPoint{{x + width - 8, y}, {x + width - 8, y + height}}, roleBorder, 1, false)
+	case "actor":
+		top := y + 2
+		d.shape(ellipsePoints(diagramPoint{c.x, top + 7}, 7, 7), roleNone, roleLine).width = 1.5
+		d.line([]diagramPoint{{c.x, top + 14}, {c.x, top + 28}}, roleLine, 1.5, false)
+		d.line([]diagramPoint{{c.x - 11, top + 19}, {c.x + 11, top + 19}}, roleLine, 1.5, false)
+		d.line([]diagramPoint{{c.x - 9, top + 40}, {c.x, top + 28}, {c.x + 9, top + 40}}, roleLine, 1.5, false)
+		d.text(m, n.label, c.x, top+42, anchorMiddle, roleText, false)
+		return
+	case "class":
+		d.class(m, n, x, y, width, height, fill)
+		return
+	default:
+		fill(d.shape(nodeOutline(n, c, width, height), roleNode, roleBorder))
+	}
+
+	before := len(d.items)
+	d.text(m, n.label, c.x, textTop, anchorMiddle, roleText, false)
+	if n.fill != nil {
+		for i := before; i < len(d.items); i++ {
+			d.items[i].color = textOn(n.fill)
+		}
+	}
+}
+
+// arcPoints returns points along part of an ellipse, between two angles
+// measured clockwise from the right
+func arcPoints(center diagramPoint, rx, ry, from, to float64) []diagramPoint {
+	const steps = 16
+	points := make([]diagramPoint, steps+1)
+	for i := range points {
+		angle := from + (to-from)*float64(i)/steps
+		points[i] = diagramPoint{center.x + rx*math.Cos(angle), center.y + ry*math.Sin(angle)}
+	}
+	return points
+}
+
+// class draws a class box with its name, attributes and operations
+func (d *diagram) class(m *diagramMeasure, n *graphNode, x, y, width, height float64, fill func(*diagramItem)) {
+	fill(d.shape(rectPoints(x, y, width, height), roleNode, roleBorder))
+	name, stereotype := classHeader(n)
+	top := y + graphPadY
+	if stereotype != "" {
+		d.text(m, stereotype, x+width/2, top, anchorMiddle, roleText, false)
+		_, sh := m.size(stereotype, false)
+		top += sh
+	}
+	d.text(m, name, x+width/2, top, anchorMiddle, roleText, true)
+	_, nh := m.size(name, true)
+	top += nh + graphPadY
+
+	attributes, operations := classMembers(n)
+	for _, members := range [][]string{attributes, operations} {
+		d.line([]diagramPoint{{x, top}, {x + width, top}}, roleBorder, 1, false)
+		text := strings.Join(members, "\n")
+		d.text(m, text, x+graphPadX, top+graphPadY/2, anchorStart, roleText, false)
+		_, h := m.size(text, false)
+		top += h + graphPadY
+	}
+}
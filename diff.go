@@ -0,0 +1,212 @@
+package main
+
+import (
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// diffOp identifies how a line differs between two texts
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+// diffLine is a single line of a line-based diff
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// diffLines compares two texts line by line using the Myers algorithm
+func diffLines(a, b string) []diffLine {
+	oldLines := strings.Split(a, "\n")
+	newLines := strings.Split(b, "\n")
+
+	// Common prefix and suffix are cheap to strip and keep the search small
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+
+	var out []diffLine
+	for _, line := range oldLines[:prefix] {
+		out = append(out, diffLine{op: diffEqual, text: line})
+	}
+	out = append(out, myersDiff(oldLines[prefix:len(oldLines)-suffix], newLines[prefix:len(newLines)-suffix])...)
+	for _, line := range oldLines[len(oldLines)-suffix:] {
+		out = append(out, diffLine{op: diffEqual, text: line})
+	}
+	return out
+}
+
+// diffBudget bounds how many diagonals the diff searches, so that comparing
+// large texts that share little stays quick. Past it, what is left to
+// compare is shown as removed and then added.
+const diffBudget = 20_000_000
+
+// myersDiff finds the shortest edit script between two lists of lines with
+// the linear space variant of the Myers algorithm, which splits the lists
+// at the middle of the script and diffs each half
+func myersDiff(a, b []string) []diffLine {
+	var out []diffLine
+	budget := diffBudget
+	var diff func(a, b []string)
+	diff = func(a, b []string) {
+		prefix := 0
+		for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+			prefix++
+		}
+		for _, line := range a[:prefix] {
+			out = append(out, diffLine{op: diffEqual, text: line})
+		}
+		a, b = a[prefix:], b[prefix:]
+		suffix := 0
+		for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+			suffix++
+		}
+		common := a[len(a)-suffix:]
+		a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+		if x, y, ok := middleSnake(a, b, &budget); ok {
+			diff(a[:x], b[:y])
+			diff(a[x:], b[y:])
+		} else {
+			for _, line := range a {
+				out = append(out, diffLine{op: diffDelete, text: line})
+			}
+			for _, line := range b {
+				out = append(out, diffLine{op: diffInsert, text: line})
+			}
+		}
+		for _, line := range common {
+			out = append(out, diffLine{op: diffEqual, text: line})
+		}
+	}
+	diff(a, b)
+	return out
+}
+
+// middleSnake searches from both ends of two lists of lines that differ at
+// their first and last lines until the paths meet, and returns where to
+// split them. It reports false when the lists have nothing in common to
+// split at, so one can only be replaced by the other, or the search used up
+// the budget.
+func middleSnake(a, b []string, budget *int) (x, y int, ok bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+	maxD := (n + m + 1) / 2
+	offset := maxD
+	forward := make([]int, 2*maxD+2)
+	backward := make([]int, 2*maxD+2)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	delta := n - m
+	// With an odd delta the paths meet on a forward step, otherwise on a
+	// backward one
+	odd := delta%2 != 0
+	// Diagonals that have run off the edge of the grid are no longer searched
+	forwardStart, forwardEnd, backwardStart, backwardEnd := 0, 0, 0, 0
+	// A split at either corner would not make the problem any smaller
+	split := func(x, y int) (int, int, bool) {
+		return x, y, (x > 0 || y > 0) && (x < n || y < m)
+	}
+
+	for d := range maxD {
+		// Each step searches up to d diagonals both ways
+		if *budget -= 2*d + 2; *budget < 0 {
+			return 0, 0, false
+		}
+		for k := -d + forwardStart; k <= d-forwardEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				forwardEnd += 2
+			case y > m:
+				forwardStart += 2
+			case odd:
+				if i := offset + delta - k; i >= 0 && i < len(backward) && backward[i] != -1 && x >= n-backward[i] {
+					return split(x, y)
+				}
+			}
+		}
+
+		for k := -d + backwardStart; k <= d-backwardEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				backwardEnd += 2
+			case y > m:
+				backwardStart += 2
+			case !odd:
+				if i := offset + delta - k; i >= 0 && i < len(forward) && forward[i] != -1 && forward[i] >= n-x {
+					fx := forward[i]
+					return split(fx, fx-(i-offset))
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// showDiffDialog displays the line differences between two versions of a document
+func showDiffDialog(title, oldText, newText string, parent fyne.Window) {
+	var segs []widget.RichTextSegment
+	for _, line := range diffLines(oldText, newText) {
+		style := widget.RichTextStyleCodeBlock
+		prefix := "  "
+		switch line.op {
+		case diffDelete:
+			style.ColorName = theme.ColorNameError
+			prefix = "- "
+		case diffInsert:
+			style.ColorName = theme.ColorNameSuccess
+			prefix = "+ "
+		}
+		segs = append(segs, &widget.TextSegment{Style: style, Text: prefix + line.text})
+	}
+
+	content := container.NewScroll(widget.NewRichText(segs...))
+	d := dialog.NewCustom(title, "Close", content, parent)
+	d.Resize(fyne.NewSize(700, 500))
+	d.Show()
+}
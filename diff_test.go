@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		want     string
+	}{
+		{name: "equal", old: "a\nb", new: "a\nb", want: " a  b"},
+		{name: "insert", old: "a\nc", new: "a\nb\nc", want: " a +b  c"},
+		{name: "delete", old: "a\nb\nc", new: "a\nc", want: " a -b  c"},
+		{name: "replace", old: "a\nb\nc", new: "a\nx\nc", want: " a -b +x  c"},
+		{name: "nothing in common", old: "a\nb", new: "c", want: "-a -b +c"},
+		{name: "moved line", old: "a\nb\nc\nd", new: "b\nc\na\nd", want: "-a  b  c +a  d"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, line := range diffLines(test.old, test.new) {
+				got = append(got, string(" -+"[line.op])+line.text)
+			}
+			if strings.Join(got, " ") != test.want {
+				t.Errorf("diffLines = %q, want %q", strings.Join(got, " "), test.want)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	// Texts that share nothing used to keep a copy of the search state for
+	// every edit, and must still come back as a valid diff
+	var a, b []string
+	for i := range 20000 {
+		a = append(a, "old "+strings.Repeat("x", i%7))
+		b = append(b, "new "+strings.Repeat("y", i%5))
+	}
+	var removed, added []string
+	for _, line := range diffLines(strings.Join(a, "\n"), strings.Join(b, "\n")) {
+		if line.op != diffInsert {
+			removed = append(removed, line.text)
+		}
+		if line.op != diffDelete {
+			added = append(added, line.text)
+		}
+	}
+	if strings.Join(removed, "\n") != strings.Join(a, "\n") || strings.Join(added, "\n") != strings.Join(b, "\n") {
+		t.Error("diff does not turn the old text into the new one")
+	}
+}
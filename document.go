@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+)
+
+var documentCount atomic.Int64
+
+// Document represents a single open markdown buffer shown in its own tab
+type Document struct {
+	id        string
+	editor    *Editor
+	preview   *Preview
+	uri       fyne.URI
+	modified  bool
+	journaled string
+	split     *container.Split
+	tab       *container.TabItem
+
+	// diskHash is the checksum of the file content the buffer was last in sync with
+	diskHash     []byte
+	watched      string
+	conflictOpen bool
+
+	// previewTimer renders the preview once typing pauses
+	previewTimer *time.Timer
+}
+
+// NewDocument creates a document with its own editor and preview
+func NewDocument(controller *AppController) *Document {
+	d := &Document{
+		id:      newDocumentID(),
+		editor:  NewEditor(controller),
+		preview: NewPreview(),
+	}
+	d.preview.OnScrolled = func() {
+		controller.OnPreviewScrolled(d)
+	}
+	d.preview.SetCodeHighlight(controller.CodeHighlight())
+
+	d.split = container.NewHSplit(
+		d.editor.Create(),
+		d.preview.Create(),
+	)
+	d.tab = container.NewTabItem(d.Title(), d.split)
+	return d
+}
+
+// Name returns the file name of the document, or Untitled if it has not been saved
+func (d *Document) Name() string {
+	if d.uri == nil {
+		return "Untitled"
+	}
+	return d.uri.Name()
+}
+
+// Dir returns the folder of the document, or an empty string if it has not
+// been saved to a local file
+func (d *Document) Dir() string {
+	if d.uri == nil || d.uri.Scheme() != "file" {
+		return ""
+	}
+	return filepath.Dir(d.uri.Path())
+}
+
+// Title returns the tab title, marking documents with unsaved changes
+func (d *Document) Title() string {
+	if d.modified {
+		return d.Name() + " *"
+	}
+	return d.Name()
+}
+
+// IsEmpty reports whether the document is an untouched untitled buffer
+func (d *Document) IsEmpty() bool {
+	return d.uri == nil && !d.modified && d.editor.GetContent() == ""
+}
+
+// newDocumentID returns an identifier that stays unique across application runs
+func newDocumentID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatInt(documentCount.Add(1), 36)
+}
+
+// Path returns the local file system path of the document, if it has one
+func (d *Document) Path() string {
+	if d.uri == nil || d.uri.Scheme() != "file" {
+		return ""
+	}
+	return d.uri.Path()
+}
+
+// ChangedOnDisk reports whether the given file content differs from the
+// version the document was loaded from or last saved as
+func (d *Document) ChangedOnDisk(data []byte) bool {
+	if d.diskHash == nil {
+		return false
+	}
+	sum := sha256.Sum256(data)
+	return !bytes.Equal(sum[:], d.diskHash)
+}
+
+// IsFile reports whether the document was loaded from or saved to the given URI
+func (d *Document) IsFile(uri fyne.URI) bool {
+	return d.uri != nil && uri != nil && d.uri.String() == uri.String()
+}
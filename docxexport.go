@@ -0,0 +1,666 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+// Page layout of exported Word documents, in twentieths of a point: A4
+// with one inch margins
+const (
+	docxPageWidth  = 11906
+	docxPageHeight = 16838
+	docxMargin     = 1440
+	docxIndent     = 720
+)
+
+// docxEMUPerPixel converts image pixels at 96 DPI to English Metric Units
+const docxEMUPerPixel = 9525
+
+// docxEMUPerPoint converts points to English Metric Units
+const docxEMUPerPoint = 12700
+
+// docxTextSize is the size of body text in points
+const docxTextSize = 11
+
+// docxTextWidth is the width of the text area in English Metric Units
+const docxTextWidth = (docxPageWidth - 2*docxMargin) * 635
+
+// docxStyle tracks the formatting that applies to a run of inline text
+type docxStyle struct {
+	bold, italic, strike, code, link bool
+}
+
+// docxParagraph holds the properties of a paragraph
+type docxParagraph struct {
+	style string
+	// border draws a rule below the paragraph
+	border bool
+	// shading is the background color as RRGGBB
+	shading string
+	align   string
+}
+
+// docxList is a list instance in the numbering part
+type docxList struct {
+	ordered bool
+	start   int
+}
+
+// docxRenderer converts a goldmark AST into a WordprocessingML package
+type docxRenderer struct {
+	source []byte
+	// dir resolves relative image paths, and is empty for unsaved documents
+	dir   string
+	style *chroma.Style
+	body  strings.Builder
+
+	bookmarks bookmarkNames
+	bookmark  int
+	// rels are the relationships of the document part, after styles and
+	// numbering
+	rels   []string
+	media  []packageFile
+	images map[string]string
+	lists  []docxList
+
+	// listDepth and quoteDepth count the enclosing lists and block quotes,
+	// and number is the list of an item whose first paragraph is to come
+	listDepth  int
+	quoteDepth int
+	number     int
+	drawings   int
+}
+
+// renderDOCX writes a parsed document as a Word document, resolving local
+// images against dir and coloring fenced code as given
+func renderDOCX(w io.Writer, source []byte, doc ast.Node, dir, title string, code codeHighlight) error {
+	r := &docxRenderer{
+		source:    source,
+		dir:       dir,
+		style:     code.chromaStyle(false),
+		bookmarks: make(bookmarkNames),
+		images:    make(map[string]string),
+	}
+	r.addBookmarks(doc)
+	r.renderBlocks(doc)
+
+	files := []packageFile{
+		{name: "[Content_Types].xml", data: []byte(docxContentTypes)},
+		{name: "_rels/.rels", data: []byte(docxPackageRels)},
+		{name: "docProps/core.xml", data: []byte(fmt.Sprintf(docxCoreProperties,
+			escapeXML(title), time.Now().UTC().Format(time.RFC3339)))},
+		{name: "word/document.xml", data: []byte(fmt.Sprintf(docxDocument, r.body.String(),
+			docxPageWidth, docxPageHeight, docxMargin, docxMargin, docxMargin, docxMargin))},
+		{name: "word/styles.xml", data: []byte(docxStyles)},
+		{name: "word/numbering.xml", data: []byte(r.numbering())},
+		{name: "word/_rels/document.xml.rels", data: []byte(fmt.Sprintf(docxDocumentRels, strings.Join(r.rels, "")))},
+	}
+	return writePackage(w, append(files, r.media...))
+}
+
+// addBookmarks names the headings up front, as links may point forwards
+func (r *docxRenderer) addBookmarks(doc ast.Node) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			if id, ok := heading.AttributeString("id"); ok {
+				r.bookmarks.add(string(id.([]byte)))
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func (r *docxRenderer) renderBlocks(parent ast.Node) {
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		r.renderBlock(child)
+	}
+}
+
+func (r *docxRenderer) renderBlock(n ast.Node) {
+	switch t := n.(type) {
+	case *ast.Paragraph, *ast.TextBlock:
+		r.openParagraph(docxParagraph{})
+		r.renderInlines(n, docxStyle{})
+		r.closeParagraph()
+	case *ast.Heading:
+		r.openParagraph(docxParagraph{style: fmt.Sprintf("Heading%d", t.Level)})
+		name := ""
+		if id, ok := t.AttributeString("id"); ok {
+			name = r.bookmarks.add(string(id.([]byte)))
+			r.bookmark++
+			fmt.Fprintf(&r.body, `<w:bookmarkStart w:id="%d" w:name="%s"/>`, r.bookmark, name)
+		}
+		r.renderInlines(n, docxStyle{})
+		if name != "" {
+			fmt.Fprintf(&r.body, `<w:bookmarkEnd w:id="%d"/>`, r.bookmark)
+		}
+		r.closeParagraph()
+	case *ast.Blockquote:
+		r.quoteDepth++
+		r.renderBlocks(n)
+		r.quoteDepth--
+	case *ast.List:
+		r.renderList(t)
+	case *ast.CodeBlock, *ast.FencedCodeBlock:
+		language := ""
+		if fenced, ok := n.(*ast.FencedCodeBlock); ok {
+			language = string(fenced.Language(r.source))
+		}
+		r.renderCode(nodeLines(r.source, n), language)
+	case *ast.HTMLBlock:
+		r.renderCode(nodeLines(r.source, n), "")
+	case *ast.ThematicBreak:
+		r.openParagraph(docxParagraph{border: true})
+		r.closeParagraph()
+	case *east.Table:
+		r.renderTable(t)
+	case *mathBlockNode:
+		r.openParagraph(docxParagraph{align: "center"})
+		r.renderMath(t.tex(r.source), true, docxStyle{})
+		r.closeParagraph()
+	case *diagramNode:
+		r.renderDiagram(t.syntax, t.code(r.source))
+	default:
+		// Unknown blocks still show their inline content rather than vanishing
+		if n.Type() == ast.TypeBlock && n.HasChildren() {
+			r.renderBlocks(n)
+		}
+	}
+}
+
+// renderList adds a numbering instance for the list, so that every ordered
+// list counts from its own start
+func (r *docxRenderer) renderList(list *ast.List) {
+	r.lists = append(r.lists, docxList{ordered: list.IsOrdered(), start: list.Start})
+	id := len(r.lists)
+
+	r.listDepth++
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		r.number = id
+		r.renderBlocks(item)
+	}
+	r.listDepth--
+	r.number = 0
+}
+
+// renderCode writes code as one shaded paragraph colored by the scheme
+func (r *docxRenderer) renderCode(code, language string) {
+	code = strings.TrimSuffix(code, "\n")
+	if code == "" {
+		return
+	}
+
+	background := r.style.Get(chroma.Background).Background
+	if !background.IsSet() {
+		background = chroma.ParseColour("#f6f8fa")
+	}
+	fallback := codeTextColor(r.style)
+	r.openParagraph(docxParagraph{style: "SourceCode", shading: hexColor(background)})
+	for i, line := range codeLines(codeTokens(code, language), 0) {
+		if i > 0 {
+			r.body.WriteString("<w:r><w:br/></w:r>")
+		}
+		for _, token := range line {
+			entry := r.style.Get(token.Type)
+			colour := entry.Colour
+			if !colour.IsSet() {
+				colour = fallback
+			}
+
+			r.body.WriteString("<w:r><w:rPr>")
+			if entry.Bold == chroma.Yes {
+				r.body.WriteString("<w:b/>")
+			}
+			if entry.Italic == chroma.Yes {
+				r.body.WriteString("<w:i/>")
+			}
+			if colour.IsSet() {
+				fmt.Fprintf(&r.body, `<w:color w:val="%s"/>`, hexColor(colour))
+			}
+			r.body.WriteString("</w:rPr>")
+			r.writeText(token.Value)
+			r.body.WriteString("</w:r>")
+		}
+	}
+	r.closeParagraph()
+}
+
+// renderTable writes a table with a repeated header row
+func (r *docxRenderer) renderTable(table *east.Table) {
+	columns := len(table.Alignments)
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		columns = max(columns, row.ChildCount())
+	}
+	if columns == 0 {
+		return
+	}
+
+	width := (docxPageWidth - 2*docxMargin - docxIndent*(r.listDepth+r.quoteDepth)) / columns
+	r.body.WriteString(`<w:tbl><w:tblPr><w:tblStyle w:val="Table"/><w:tblW w:w="0" w:type="auto"/>`)
+	if indent := docxIndent * (r.listDepth + r.quoteDepth); indent > 0 {
+		fmt.Fprintf(&r.body, `<w:tblInd w:w="%d" w:type="dxa"/>`, indent)
+	}
+	r.body.WriteString(`</w:tblPr><w:tblGrid>`)
+	for c := 0; c < columns; c++ {
+		fmt.Fprintf(&r.body, `<w:gridCol w:w="%d"/>`, width)
+	}
+	r.body.WriteString(`</w:tblGrid>`)
+
+	number := r.number
+	r.number = 0
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		_, header := row.(*east.TableHeader)
+		r.body.WriteString("<w:tr>")
+		if header {
+			r.body.WriteString("<w:trPr><w:tblHeader/></w:trPr>")
+		}
+
+		cell := row.FirstChild()
+		for c := 0; c < columns; c++ {
+			fmt.Fprintf(&r.body, `<w:tc><w:tcPr><w:tcW w:w="%d" w:type="dxa"/></w:tcPr>`, width)
+			paragraph := docxParagraph{style: "Compact"}
+			if c < len(table.Alignments) {
+				switch table.Alignments[c] {
+				case east.AlignRight:
+					paragraph.align = "right"
+				case east.AlignCenter:
+					paragraph.align = "center"
+				}
+			}
+
+			// Cells are not indented, as the table is
+			depths := [2]int{r.listDepth, r.quoteDepth}
+			r.listDepth, r.quoteDepth = 0, 0
+			r.openParagraph(paragraph)
+			if cell != nil {
+				r.renderInlines(cell, docxStyle{bold: header})
+				cell = cell.NextSibling()
+			}
+			r.closeParagraph()
+			r.listDepth, r.quoteDepth = depths[0], depths[1]
+			r.body.WriteString("</w:tc>")
+		}
+		r.body.WriteString("</w:tr>")
+	}
+	r.body.WriteString("</w:tbl>")
+	r.number = number
+}
+
+// openParagraph starts a paragraph, numbering it if it is the first of a
+// list item and indenting it to the enclosing lists and quotes otherwise
+func (r *docxRenderer) openParagraph(p docxParagraph) {
+	if p.style == "" && r.quoteDepth > 0 {
+		p.style = "BlockText"
+	}
+
+	// The properties must come in the order of the schema
+	var props strings.Builder
+	if p.style != "" {
+		fmt.Fprintf(&props, `<w:pStyle w:val="%s"/>`, p.style)
+	}
+	numbered := r.number != 0
+	if numbered {
+		fmt.Fprintf(&props, `<w:numPr><w:ilvl w:val="%d"/><w:numId w:val="%d"/></w:numPr>`, r.listDepth-1, r.number)
+		r.number = 0
+	}
+	if p.border {
+		props.WriteString(`<w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="DFE2E5"/></w:pBdr>`)
+	}
+	if p.shading != "" {
+		fmt.Fprintf(&props, `<w:shd w:val="clear" w:color="auto" w:fill="%s"/>`, p.shading)
+	}
+	if indent := docxIndent * (r.listDepth + r.quoteDepth); indent > 0 {
+		if numbered {
+			fmt.Fprintf(&props, `<w:ind w:left="%d" w:hanging="360"/>`, indent)
+		} else {
+			fmt.Fprintf(&props, `<w:ind w:left="%d"/>`, indent)
+		}
+	}
+	if p.align != "" {
+		fmt.Fprintf(&props, `<w:jc w:val="%s"/>`, p.align)
+	}
+
+	r.body.WriteString("<w:p>")
+	if props.Len() > 0 {
+		fmt.Fprintf(&r.body, "<w:pPr>%s</w:pPr>", props.String())
+	}
+}
+
+func (r *docxRenderer) closeParagraph() {
+	r.body.WriteString("</w:p>")
+}
+
+func (r *docxRenderer) renderInlines(parent ast.Node, style docxStyle) {
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		r.renderInline(child, style)
+	}
+}
+
+func (r *docxRenderer) renderInline(n ast.Node, style docxStyle) {
+	switch t := n.(type) {
+	case *ast.Text:
+		text := string(t.Value(r.source))
+		if t.SoftLineBreak() {
+			text += " "
+		}
+		r.run(text, style)
+		if t.HardLineBreak() {
+			r.body.WriteString("<w:r><w:br/></w:r>")
+		}
+	case *ast.String:
+		r.run(html.UnescapeString(string(t.Value)), style)
+	case *ast.Emphasis:
+		if t.Level >= 2 {
+			style.bold = true
+		} else {
+			style.italic = true
+		}
+		r.renderInlines(n, style)
+	case *east.Strikethrough:
+		style.strike = true
+		r.renderInlines(n, style)
+	case *ast.CodeSpan:
+		style.code = true
+		r.run((&richTextRenderer{source: r.source}).plainText(n), style)
+	case *ast.Link:
+		r.openLink(string(t.Destination))
+		style.link = true
+		r.renderInlines(n, style)
+		r.body.WriteString("</w:hyperlink>")
+	case *ast.AutoLink:
+		r.openLink(string(t.URL(r.source)))
+		style.link = true
+		r.run(string(t.Label(r.source)), style)
+		r.body.WriteString("</w:hyperlink>")
+	case *ast.Image:
+		r.renderImage(t, style)
+	case *ast.RawHTML:
+		var raw strings.Builder
+		for i := 0; i < t.Segments.Len(); i++ {
+			segment := t.Segments.At(i)
+			raw.Write(segment.Value(r.source))
+		}
+		style.code = true
+		r.run(raw.String(), style)
+	case *east.TaskCheckBox:
+		if t.IsChecked {
+			r.run("☒ ", style)
+		} else {
+			r.run("☐ ", style)
+		}
+	case *mathInlineNode:
+		r.renderMath(t.tex, t.display, style)
+	default:
+		r.renderInlines(n, style)
+	}
+}
+
+// openLink starts a hyperlink to a heading of the document or to a URL
+func (r *docxRenderer) openLink(destination string) {
+	if id, ok := strings.CutPrefix(destination, "#"); ok {
+		if name, ok := r.bookmarks[id]; ok {
+			fmt.Fprintf(&r.body, `<w:hyperlink w:anchor="%s">`, name)
+			return
+		}
+	}
+
+	id := r.addRel(`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="%s" TargetMode="External"`, escapeXML(destination))
+	fmt.Fprintf(&r.body, `<w:hyperlink r:id="%s">`, id)
+}
+
+// renderImage embeds a local image, scaled down to the text width. Other
+// images show their description.
+func (r *docxRenderer) renderImage(n *ast.Image, style docxStyle) {
+	alt := (&richTextRenderer{source: r.source}).plainText(n)
+	img, err := readLocalImage(string(n.Destination), r.dir)
+	if err != nil {
+		style.italic = true
+		r.run("["+alt+"]", style)
+		return
+	}
+
+	id, ok := r.images[img.path]
+	if !ok {
+		name := fmt.Sprintf("media/image%d.%s", len(r.media)+1, img.format)
+		r.media = append(r.media, packageFile{name: "word/" + name, data: img.data})
+		id = r.addRel(`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="%s"`, name)
+		r.images[img.path] = id
+	}
+
+	width, height := img.width*docxEMUPerPixel, img.height*docxEMUPerPixel
+	if width > docxTextWidth {
+		height = height * docxTextWidth / width
+		width = docxTextWidth
+	}
+	r.drawings++
+	fmt.Fprintf(&r.body, docxDrawing, "", width, height, r.drawings, r.drawings, escapeXML(alt),
+		escapeXML(path.Base(img.path)), id, width, height)
+}
+
+// renderMath embeds a formula as a picture lowered onto the baseline. One
+// that cannot be parsed shows its source.
+func (r *docxRenderer) renderMath(tex string, display bool, style docxStyle) {
+	picture, err := renderMathPicture(tex, display, docxTextSize)
+	if err != nil {
+		style.code = true
+		r.run(mathSource(tex, display), style)
+		return
+	}
+
+	name := fmt.Sprintf("media/image%d.png", len(r.media)+1)
+	r.media = append(r.media, packageFile{name: "word/" + name, data: picture.png})
+	id := r.addRel(`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="%s"`, name)
+
+	// Pictures are measured in points, and runs are lowered in half points
+	width, height := int(picture.width*docxEMUPerPoint), int(picture.height*docxEMUPerPoint)
+	if width > docxTextWidth {
+		height = height * docxTextWidth / width
+		width = docxTextWidth
+	}
+	lower := fmt.Sprintf(`<w:rPr><w:position w:val="%d"/></w:rPr>`, -int(2*(picture.height-picture.baseline)+0.5))
+	r.drawings++
+	fmt.Fprintf(&r.body, docxDrawing, lower, width, height, r.drawings, r.drawings, escapeXML(tex),
+		path.Base(name), id, width, height)
+}
+
+// renderDiagram embeds a diagram as a centered picture. One that cannot be
+// drawn shows why, followed by its source.
+func (r *docxRenderer) renderDiagram(syntax, code string) {
+	picture, err := renderDiagramPicture(syntax, code)
+	if err != nil {
+		r.openParagraph(docxParagraph{})
+		r.run(syntax+": "+err.Error(), docxStyle{italic: true})
+		r.closeParagraph()
+		r.renderCode(code, syntax)
+		return
+	}
+
+	name := fmt.Sprintf("media/image%d.png", len(r.media)+1)
+	r.media = append(r.media, packageFile{name: "word/" + name, data: picture.png})
+	id := r.addRel(`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="%s"`, name)
+
+	width, height := int(picture.width*docxEMUPerPoint), int(picture.height*docxEMUPerPoint)
+	if width > docxTextWidth {
+		height = height * docxTextWidth / width
+		width = docxTextWidth
+	}
+	r.openParagraph(docxParagraph{align: "center"})
+	r.drawings++
+	fmt.Fprintf(&r.body, docxDrawing, "", width, height, r.drawings, r.drawings, escapeXML(syntax+" diagram"),
+		path.Base(name), id, width, height)
+	r.closeParagraph()
+}
+
+// addRel adds a relationship of the document part and returns its ID
+func (r *docxRenderer) addRel(format string, args ...any) string {
+	id := fmt.Sprintf("rId%d", len(r.rels)+3)
+	r.rels = append(r.rels, fmt.Sprintf(`<Relationship Id="%s" `+format+`/>`, append([]any{id}, args...)...))
+	return id
+}
+
+// run writes text with the formatting of a style
+func (r *docxRenderer) run(text string, style docxStyle) {
+	if text == "" {
+		return
+	}
+
+	var props strings.Builder
+	switch {
+	case style.link:
+		props.WriteString(`<w:rStyle w:val="Hyperlink"/>`)
+	case style.code:
+		props.WriteString(`<w:rStyle w:val="VerbatimChar"/>`)
+	}
+	if style.bold {
+		props.WriteString("<w:b/>")
+	}
+	if style.italic {
+		props.WriteString("<w:i/>")
+	}
+	if style.strike {
+		props.WriteString("<w:strike/>")
+	}
+
+	r.body.WriteString("<w:r>")
+	if props.Len() > 0 {
+		fmt.Fprintf(&r.body, "<w:rPr>%s</w:rPr>", props.String())
+	}
+	r.writeText(text)
+	r.body.WriteString("</w:r>")
+}
+
+// writeText writes the text of a run, keeping its spaces and tabs
+func (r *docxRenderer) writeText(text string) {
+	for i, part := range strings.Split(text, "\t") {
+		if i > 0 {
+			r.body.WriteString("<w:tab/>")
+		}
+		if part != "" {
+			fmt.Fprintf(&r.body, `<w:t xml:space="preserve">%s</w:t>`, escapeXML(part))
+		}
+	}
+}
+
+// numbering returns the numbering part with an instance for every list
+func (r *docxRenderer) numbering() string {
+	var buf strings.Builder
+	buf.WriteString(docxNumberingStart)
+	bullets := []string{"•", "◦", "▪"}
+	for abstract, ordered := range []bool{false, true} {
+		fmt.Fprintf(&buf, `<w:abstractNum w:abstractNumId="%d"><w:multiLevelType w:val="hybridMultilevel"/>`, abstract)
+		for level := 0; level < 9; level++ {
+			format, text := "bullet", bullets[level%len(bullets)]
+			if ordered {
+				format, text = "decimal", fmt.Sprintf("%%%d.", level+1)
+			}
+			fmt.Fprintf(&buf, `<w:lvl w:ilvl="%d"><w:start w:val="1"/><w:numFmt w:val="%s"/><w:lvlText w:val="%s"/>`+
+				`<w:lvlJc w:val="left"/><w:pPr><w:ind w:left="%d" w:hanging="360"/></w:pPr></w:lvl>`,
+				level, format, text, docxIndent*(level+1))
+		}
+		buf.WriteString("</w:abstractNum>")
+	}
+
+	for i, list := range r.lists {
+		abstract := 0
+		if list.ordered {
+			abstract = 1
+		}
+		fmt.Fprintf(&buf, `<w:num w:numId="%d"><w:abstractNumId w:val="%d"/>`, i+1, abstract)
+		if list.ordered {
+			for level := 0; level < 9; level++ {
+				fmt.Fprintf(&buf, `<w:lvlOverride w:ilvl="%d"><w:startOverride w:val="%d"/></w:lvlOverride>`, level, list.start)
+			}
+		}
+		buf.WriteString("</w:num>")
+	}
+	buf.WriteString("</w:numbering>")
+	return buf.String()
+}
+
+// hexColor formats a scheme color as RRGGBB
+func hexColor(c chroma.Colour) string {
+	return strings.ToUpper(strings.TrimPrefix(c.String(), "#"))
+}
+
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Default Extension="png" ContentType="image/png"/>
+<Default Extension="jpeg" ContentType="image/jpeg"/>
+<Default Extension="gif" ContentType="image/gif"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>
+<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>
+<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
+</Types>`
+
+const docxPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>
+</Relationships>`
+
+const docxCoreProperties = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<dc:title>%s</dc:title>
+<dcterms:created xsi:type="dcterms:W3CDTF">%s</dcterms:created>
+</cp:coreProperties>`
+
+const docxDocumentRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>
+%s</Relationships>`
+
+const docxDocument = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture">
+<w:body>%s<w:sectPr><w:pgSz w:w="%d" w:h="%d"/><w:pgMar w:top="%d" w:right="%d" w:bottom="%d" w:left="%d" w:header="720" w:footer="720" w:gutter="0"/></w:sectPr></w:body>
+</w:document>`
+
+const docxDrawing = `<w:r>%s<w:drawing><wp:inline distT="0" distB="0" distL="0" distR="0">` +
+	`<wp:extent cx="%d" cy="%d"/><wp:docPr id="%d" name="Picture %d" descr="%s"/>` +
+	`<wp:cNvGraphicFramePr><a:graphicFrameLocks noChangeAspect="1"/></wp:cNvGraphicFramePr>` +
+	`<a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:pic>` +
+	`<pic:nvPicPr><pic:cNvPr id="0" name="%s"/><pic:cNvPicPr/></pic:nvPicPr>` +
+	`<pic:blipFill><a:blip r:embed="%s"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill>` +
+	`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%d" cy="%d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr>` +
+	`</pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing></w:r>`
+
+const docxNumberingStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:numbering xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">`
+
+// docxStyles defines the paragraph, character and table styles used by the
+// export, named after Word's built-in styles so they map onto them
+const docxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:docDefaults>
+<w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:eastAsia="Calibri" w:cs="Calibri"/><w:color w:val="333333"/><w:sz w:val="22"/><w:szCs w:val="22"/><w:lang w:val="en-US"/></w:rPr></w:rPrDefault>
+<w:pPrDefault><w:pPr><w:spacing w:after="160" w:line="276" w:lineRule="auto"/></w:pPr></w:pPrDefault>
+</w:docDefaults>
+<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:qFormat/></w:style>
+<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:keepLines/><w:pBdr><w:bottom w:val="single" w:sz="4" w:space="4" w:color="DFE2E5"/></w:pBdr><w:spacing w:before="360" w:after="160"/><w:outlineLvl w:val="0"/></w:pPr><w:rPr><w:b/><w:color w:val="1F2328"/><w:sz w:val="44"/><w:szCs w:val="44"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:keepLines/><w:pBdr><w:bottom w:val="single" w:sz="4" w:space="4" w:color="DFE2E5"/></w:pBdr><w:spacing w:before="320" w:after="160"/><w:outlineLvl w:val="1"/></w:pPr><w:rPr><w:b/><w:color w:val="1F2328"/><w:sz w:val="34"/><w:szCs w:val="34"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading3"><w:name w:val="heading 3"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:keepLines/><w:spacing w:before="280" w:after="120"/><w:outlineLvl w:val="2"/></w:pPr><w:rPr><w:b/><w:color w:val="1F2328"/><w:sz w:val="28"/><w:szCs w:val="28"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading4"><w:name w:val="heading 4"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:keepLines/><w:spacing w:before="240" w:after="120"/><w:outlineLvl w:val="3"/></w:pPr><w:rPr><w:b/><w:color w:val="1F2328"/><w:sz w:val="24"/><w:szCs w:val="24"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading5"><w:name w:val="heading 5"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:keepLines/><w:spacing w:before="240" w:after="120"/><w:outlineLvl w:val="4"/></w:pPr><w:rPr><w:b/><w:color w:val="1F2328"/><w:sz w:val="22"/><w:szCs w:val="22"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Heading6"><w:name w:val="heading 6"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:qFormat/><w:pPr><w:keepNext/><w:keepLines/><w:spacing w:before="240" w:after="120"/><w:outlineLvl w:val="5"/></w:pPr><w:rPr><w:b/><w:color w:val="6A737D"/><w:sz w:val="22"/><w:szCs w:val="22"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="BlockText"><w:name w:val="Block Text"/><w:basedOn w:val="Normal"/><w:qFormat/><w:pPr><w:pBdr><w:left w:val="single" w:sz="18" w:space="8" w:color="DFE2E5"/></w:pBdr></w:pPr><w:rPr><w:i/><w:color w:val="6A737D"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:customStyle="1" w:styleId="SourceCode"><w:name w:val="Source Code"/><w:basedOn w:val="Normal"/><w:pPr><w:wordWrap w:val="off"/><w:spacing w:after="160" w:line="240" w:lineRule="auto"/></w:pPr><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="19"/><w:szCs w:val="19"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:customStyle="1" w:styleId="Compact"><w:name w:val="Compact"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:before="40" w:after="40"/></w:pPr></w:style>
+<w:style w:type="character" w:default="1" w:styleId="DefaultParagraphFont"><w:name w:val="Default Paragraph Font"/><w:uiPriority w:val="1"/><w:semiHidden/></w:style>
+<w:style w:type="character" w:customStyle="1" w:styleId="VerbatimChar"><w:name w:val="Verbatim Char"/><w:basedOn w:val="DefaultParagraphFont"/><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="20"/><w:shd w:val="clear" w:color="auto" w:fill="F0F1F2"/></w:rPr></w:style>
+<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:basedOn w:val="DefaultParagraphFont"/><w:rPr><w:color w:val="0969DA"/><w:u w:val="single"/></w:rPr></w:style>
+<w:style w:type="table" w:default="1" w:styleId="TableNormal"><w:name w:val="Normal Table"/><w:semiHidden/><w:tblPr><w:tblInd w:w="0" w:type="dxa"/><w:tblCellMar><w:top w:w="0" w:type="dxa"/><w:left w:w="108" w:type="dxa"/><w:bottom w:w="0" w:type="dxa"/><w:right w:w="108" w:type="dxa"/></w:tblCellMar></w:tblPr></w:style>
+<w:style w:type="table" w:customStyle="1" w:styleId="Table"><w:name w:val="Table"/><w:basedOn w:val="TableNormal"/><w:tblPr><w:tblBorders><w:top w:val="single" w:sz="4" w:space="0" w:color="DFE2E5"/><w:left w:val="single" w:sz="4" w:space="0" w:color="DFE2E5"/><w:bottom w:val="single" w:sz="4" w:space="0" w:color="DFE2E5"/><w:right w:val="single" w:sz="4" w:space="0" w:color="DFE2E5"/><w:insideH w:val="single" w:sz="4" w:space="0" w:color="DFE2E5"/><w:insideV w:val="single" w:sz="4" w:space="0" w:color="DFE2E5"/></w:tblBorders><w:tblCellMar><w:top w:w="60" w:type="dxa"/><w:left w:w="120" w:type="dxa"/><w:bottom w:w="60" w:type="dxa"/><w:right w:w="120" w:type="dxa"/></w:tblCellMar></w:tblPr></w:style>
+</w:styles>`
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"unicode/utf8"
 
@@ -11,46 +13,120 @@ import (
 	"fyne.io/fyne/v2/widget"
 )
 
+// preferenceWordWrap stores whether long lines wrap in the editor
+const preferenceWordWrap = "view.wordWrap"
+
 // Editor represents the text editor component
 type Editor struct {
 	controller *AppController
-	entry      *widget.Entry
+	entry      *SourceEntry
 	container  *fyne.Container
+	// crlf is set when the file was loaded with Windows line endings, which
+	// are shown as plain line breaks and written back when it is saved
+	crlf bool
+	// search is shared by the find and replace dialogs, and kept for Find
+	// Next once they are closed
+	search editorSearch
+	// form is the find or replace dialog that is open, if any
+	form *searchForm
+}
+
+// editorSearch is the last search in an editor and its matches
+type editorSearch struct {
+	query   string
+	options searchOptions
+	pattern *searchPattern
+	err     error
+	matches []searchMatch
+	// current is the match that is selected, or -1
+	current int
+	// showing is set while a dialog highlights the matches
+	showing bool
+	// replacement and preserveCase are kept for the next replace dialog
+	replacement  string
+	preserveCase bool
 }
 
 // NewEditor creates a new editor instance
 func NewEditor(controller *AppController) *Editor {
 	e := &Editor{
 		controller: controller,
-		entry:      widget.NewMultiLineEntry(),
+		entry:      NewSourceEntry(),
 	}
 
 	e.entry.PlaceHolder = "Start typing your markdown here..."
+	e.entry.SetWrap(controller.WordWrap())
 	e.entry.OnChanged = func(content string) {
-		controller.OnTextChanged(content)
+		if e.search.showing {
+			e.updateSearch()
+			if e.form != nil {
+				e.form.update()
+			}
+		}
+		controller.OnTextChanged(e, content)
+	}
+	e.entry.OnCursorChanged = func() {
+		controller.OnCursorMoved(e)
+	}
+	e.entry.OnScrolled = func() {
+		controller.OnEditorScrolled(e)
 	}
-
-	// Enable word wrap
-	e.entry.Wrapping = fyne.TextWrapWord
 
 	return e
 }
 
 // Create creates the editor UI component
 func (e *Editor) Create() fyne.CanvasObject {
-	scrollContainer := container.NewScroll(e.entry)
-	e.container = container.NewBorder(nil, nil, nil, nil, scrollContainer)
+	e.container = container.NewBorder(nil, nil, nil, nil, e.entry)
 	return e.container
 }
 
-// SetContent sets the editor content
+// SetContent sets the editor content, keeping note of its line endings
 func (e *Editor) SetContent(content string) {
-	e.entry.SetText(content)
+	e.crlf = usesCRLF(content)
+	e.entry.SetText(strings.ReplaceAll(content, "\r\n", "\n"))
 }
 
-// GetContent returns the editor content
+// GetContent returns the editor content, with plain line breaks
 func (e *Editor) GetContent() string {
-	return e.entry.Text
+	return e.entry.Text()
+}
+
+// FileContent returns the editor content with the line endings it was loaded with
+func (e *Editor) FileContent() string {
+	if !e.crlf {
+		return e.entry.Text()
+	}
+	return strings.ReplaceAll(e.entry.Text(), "\n", "\r\n")
+}
+
+// SetWrap turns wrapping long lines on or off
+func (e *Editor) SetWrap(wrap bool) {
+	e.entry.SetWrap(wrap)
+}
+
+// ReplaceText replaces the whole text as one step that can be undone. Only
+// the part that differs is replaced, so the view stays where it was.
+func (e *Editor) ReplaceText(text string) {
+	old := []rune(e.entry.Text())
+	updated := []rune(text)
+
+	prefix := 0
+	for prefix < len(old) && prefix < len(updated) && old[prefix] == updated[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(updated)-prefix &&
+		old[len(old)-1-suffix] == updated[len(updated)-1-suffix] {
+		suffix++
+	}
+	if prefix == len(old) && prefix == len(updated) {
+		return
+	}
+
+	startRow, startColumn := endOf(0, 0, old[:prefix])
+	endRow, endColumn := endOf(0, 0, old[:len(old)-suffix])
+	e.entry.Replace(startRow, startColumn, endRow, endColumn, string(updated[prefix:len(updated)-suffix]))
 }
 
 // InsertMarkdown inserts markdown syntax around selected text or at cursor
@@ -86,8 +162,16 @@ func (e *Editor) InsertAtLineStart(prefix string) {
 	}
 
 	if selection := e.entry.SelectedText(); selection != "" {
+		// Numbered items count up from the number in the prefix
+		marker, ordered := parseListPrefix(prefix)
+		ordered = ordered && marker.ordered()
 		lines := strings.Split(selection, "\n")
 		for i, line := range lines {
+			if ordered {
+				start := len(marker.quote) + len(marker.indent)
+				lines[i] = prefix[:start] + strconv.Itoa(marker.number+i) + prefix[start+marker.digits:] + line
+				continue
+			}
 			lines[i] = prefix + line
 		}
 
@@ -96,7 +180,7 @@ func (e *Editor) InsertAtLineStart(prefix string) {
 	}
 
 	cursor := e.cursorIndex()
-	textRunes := []rune(e.entry.Text)
+	textRunes := []rune(e.entry.Text())
 
 	lineStart := cursor
 	for lineStart > 0 && textRunes[lineStart-1] != '\n' {
@@ -110,148 +194,342 @@ func (e *Editor) InsertAtLineStart(prefix string) {
 	e.setCursorAtIndex(lineStart + runeCount(prefix) + relative)
 }
 
-// ShowFindDialog shows the find dialog
-func (e *Editor) ShowFindDialog() {
-	findEntry := widget.NewEntry()
-	findEntry.PlaceHolder = "Find text..."
+// Cursor returns the 1-based line and column of the cursor
+func (e *Editor) Cursor() (line, column int) {
+	row, column := e.entry.CursorPosition()
+	return row + 1, column + 1
+}
 
-	resultLabel := widget.NewLabel("")
+// GoTo moves the cursor to a 1-based line and column, clamped to the text
+func (e *Editor) GoTo(line, column int) {
+	e.entry.SetCursor(line-1, column-1)
+}
+
+// TopLine returns the fractional 0-based line shown at the top of the editor
+func (e *Editor) TopLine() float32 {
+	return e.entry.TopLine()
+}
 
+// ScrollToLine scrolls so that a fractional 0-based line is at the top of the editor
+func (e *Editor) ScrollToLine(line float32) {
+	e.entry.ScrollToLine(line)
+}
+
+// CursorOffset returns how far below the top of the visible editor area the
+// cursor line is shown
+func (e *Editor) CursorOffset() float32 {
+	row, _ := e.entry.CursorPosition()
+	return e.entry.LineTop(row) - e.entry.ScrollOffset().Y
+}
+
+// ShowFindDialog shows the find dialog
+func (e *Editor) ShowFindDialog() {
+	form := e.newSearchForm()
 	content := container.NewVBox(
 		widget.NewLabel("Find:"),
-		findEntry,
-		resultLabel,
+		form.query,
+		form.options,
+		form.status,
 	)
 
 	d := dialog.NewCustom("Find", "Close", content, e.controller.window)
-
-	lastIndex := 0
-
-	resetSearch := func(string) {
-		lastIndex = 0
-	}
-
-	findEntry.OnChanged = resetSearch
-
-	findNext := func() {
-		searchText := findEntry.Text
-		if searchText == "" {
-			resultLabel.SetText("Enter search text")
-			return
-		}
-
-		content := e.entry.Text
-		runes := []rune(content)
-		searchRunes := []rune(searchText)
-		if len(searchRunes) == 0 {
-			resultLabel.SetText("Enter search text")
-			return
-		}
-
-		wrapped := false
-		index := findFoldIndex(runes, searchRunes, lastIndex)
-		if index < 0 && lastIndex > 0 {
-			wrapped = true
-			index = findFoldIndex(runes, searchRunes, 0)
-		}
-
-		if index < 0 {
-			resultLabel.SetText("Not found")
-			return
-		}
-
-		prefix := string(runes[:index])
-		lineNum := strings.Count(prefix, "\n") + 1
-		if wrapped {
-			resultLabel.SetText(fmt.Sprintf("Found at line %d (wrapped)", lineNum))
-		} else {
-			resultLabel.SetText(fmt.Sprintf("Found at line %d", lineNum))
-		}
-
-		e.setCursorAtIndex(index)
-
-		lastIndex = index + len(searchRunes)
-		if lastIndex > len(runes) {
-			lastIndex = len(runes)
-		}
-	}
-
-	findEntry.OnSubmitted = func(s string) { findNext() }
-
+	form.query.OnSubmitted = func(string) { form.next(false) }
 	d.SetButtons([]fyne.CanvasObject{
-		widget.NewButton("Find Next", findNext),
+		widget.NewButton("Find Previous", func() { form.next(true) }),
+		widget.NewButton("Find Next", func() { form.next(false) }),
 		widget.NewButton("Close", d.Hide),
 	})
+	d.SetOnClosed(form.close)
 
-	d.Resize(fyne.NewSize(300, 150))
+	d.Resize(fyne.NewSize(460, 220))
 	d.Show()
+	e.controller.window.Canvas().Focus(form.query)
 }
 
 // ShowReplaceDialog shows the find and replace dialog
 func (e *Editor) ShowReplaceDialog() {
-	findEntry := widget.NewEntry()
-	findEntry.PlaceHolder = "Find text..."
-
+	form := e.newSearchForm()
 	replaceEntry := widget.NewEntry()
-	replaceEntry.PlaceHolder = "Replace with..."
+	replaceEntry.PlaceHolder = "Replace with... ($1 inserts a group of a regular expression)"
+	replaceEntry.SetText(e.search.replacement)
+	replaceEntry.OnChanged = func(text string) { e.search.replacement = text }
 
-	resultLabel := widget.NewLabel("")
+	preserveCase := widget.NewCheck("Preserve case", func(checked bool) { e.search.preserveCase = checked })
+	preserveCase.Checked = e.search.preserveCase
 
 	content := container.NewVBox(
 		widget.NewLabel("Find:"),
-		findEntry,
+		form.query,
 		widget.NewLabel("Replace:"),
 		replaceEntry,
-		resultLabel,
+		form.options,
+		preserveCase,
+		form.status,
 	)
 
 	d := dialog.NewCustom("Find and Replace", "Close", content, e.controller.window)
 
 	replaceOne := func() {
-		find := findEntry.Text
-		replace := replaceEntry.Text
-		if find == "" {
-			resultLabel.SetText("Enter search text")
+		if form.query.Text == "" {
+			form.status.SetText("Enter search text")
 			return
 		}
-
-		text := e.entry.Text
-		if strings.Contains(text, find) {
-			newText := strings.Replace(text, find, replace, 1)
-			e.entry.SetText(newText)
-			resultLabel.SetText("Replaced 1 occurrence")
-		} else {
-			resultLabel.SetText("Not found")
-		}
+		e.ReplaceNext(replaceEntry.Text)
+		form.update()
 	}
 
 	replaceAll := func() {
-		find := findEntry.Text
-		replace := replaceEntry.Text
-		if find == "" {
-			resultLabel.SetText("Enter search text")
+		if form.query.Text == "" {
+			form.status.SetText("Enter search text")
 			return
 		}
-
-		text := e.entry.Text
-		count := strings.Count(text, find)
-		if count > 0 {
-			newText := strings.ReplaceAll(text, find, replace)
-			e.entry.SetText(newText)
-			resultLabel.SetText(fmt.Sprintf("Replaced %d occurrences", count))
-		} else {
-			resultLabel.SetText("Not found")
+		switch count := e.ReplaceAll(replaceEntry.Text); count {
+		case 0:
+			form.update()
+		case 1:
+			form.status.SetText("Replaced 1 occurrence")
+		default:
+			form.status.SetText(fmt.Sprintf("Replaced %d occurrences", count))
 		}
 	}
 
+	form.query.OnSubmitted = func(string) { form.next(false) }
+	replaceEntry.OnSubmitted = func(string) { replaceOne() }
 	d.SetButtons([]fyne.CanvasObject{
 		widget.NewButton("Replace", replaceOne),
 		widget.NewButton("Replace All", replaceAll),
 		widget.NewButton("Close", d.Hide),
 	})
+	d.SetOnClosed(form.close)
 
-	d.Resize(fyne.NewSize(350, 200))
+	d.Resize(fyne.NewSize(460, 300))
 	d.Show()
+	e.controller.window.Canvas().Focus(form.query)
+}
+
+// FindNext selects the next match of the last search after the cursor, or
+// the one before it when backward, wrapping around the ends of the text.
+// It reports false if there was no search or nothing matched.
+func (e *Editor) FindNext(backward bool) bool {
+	if e.search.pattern == nil {
+		return false
+	}
+	if !e.search.showing {
+		// The matches are only kept up to date while a dialog shows them
+		e.updateSearch()
+	}
+
+	start, end := e.entry.SelectionRange()
+	i := matchAfter(e.search.matches, end)
+	if backward {
+		i = matchBefore(e.search.matches, start)
+	}
+	if i < 0 {
+		return false
+	}
+	e.selectMatch(i)
+	return true
+}
+
+// ReplaceNext replaces the selected match of the search and selects the
+// next one. If no match is selected it only selects the next one, so that
+// it can be seen before it is replaced.
+func (e *Editor) ReplaceNext(template string) {
+	if i := e.selectedMatch(); i >= 0 {
+		m := e.search.matches[i]
+		startRow, startColumn := e.entry.PositionOf(m.start)
+		endRow, endColumn := e.entry.PositionOf(m.end)
+		e.entry.Replace(startRow, startColumn, endRow, endColumn,
+			e.search.pattern.replacement(template, m, e.search.preserveCase))
+	}
+	e.FindNext(false)
+}
+
+// ReplaceAll replaces every match of the search as one step that can be
+// undone, and returns how many there were. The cursor keeps its place in
+// the text around it and the view does not move.
+func (e *Editor) ReplaceAll(template string) int {
+	if e.search.pattern == nil {
+		return 0
+	}
+	if !e.search.showing {
+		e.updateSearch()
+	}
+	matches := e.search.matches
+	if len(matches) == 0 {
+		return 0
+	}
+
+	offset := e.entry.ScrollOffset()
+	cursor, _ := e.entry.SelectionRange()
+	moved := cursor
+	for _, m := range matches {
+		if m.start >= cursor {
+			break
+		}
+		replacement := runeCount(e.search.pattern.replacement(template, m, e.search.preserveCase))
+		moved += replacement - (min(m.end, cursor) - m.start)
+	}
+
+	e.ReplaceText(e.search.pattern.replaceMatches(e.entry.Text(), matches, template, e.search.preserveCase))
+	e.entry.SetCursor(e.entry.PositionOf(moved))
+	e.entry.ScrollToOffset(offset)
+	return len(matches)
+}
+
+// setSearch changes the query or its options and finds the matches again
+func (e *Editor) setSearch(query string, options searchOptions) {
+	e.search.query, e.search.options = query, options
+	e.search.pattern, e.search.err = nil, nil
+	if query != "" {
+		e.search.pattern, e.search.err = compileSearch(query, options)
+	}
+	e.updateSearch()
+}
+
+// updateSearch finds the matches of the search in the text, keeping track
+// of the one that is selected
+func (e *Editor) updateSearch() {
+	e.search.matches = nil
+	if e.search.pattern != nil {
+		e.search.matches = e.search.pattern.findAll(e.entry.Text())
+	}
+	e.search.current = e.selectedMatch()
+	if e.search.showing {
+		e.entry.SetHighlights(e.search.matches)
+	}
+}
+
+// selectedMatch returns the match that is exactly selected, or -1
+func (e *Editor) selectedMatch() int {
+	start, end := e.entry.SelectionRange()
+	for i, m := range e.search.matches {
+		if m.start == start && m.end == end {
+			return i
+		}
+		if m.start > start {
+			break
+		}
+	}
+	return -1
+}
+
+// selectMatch selects a match, scrolling it into view
+func (e *Editor) selectMatch(i int) {
+	m := e.search.matches[i]
+	e.Select(m.start, m.end)
+	e.search.current = i
+}
+
+// Select selects the text between two rune offsets
+func (e *Editor) Select(start, end int) {
+	startRow, startColumn := e.entry.PositionOf(start)
+	endRow, endColumn := e.entry.PositionOf(end)
+	e.entry.Select(startRow, startColumn, endRow, endColumn)
+}
+
+// searchStatus describes the matches of the search, counting up to the
+// selected one as in "3 of 17"
+func (e *Editor) searchStatus() string {
+	count := len(e.search.matches)
+	switch {
+	case e.search.err != nil:
+		message := e.search.err.Error()
+		return strings.ToUpper(message[:1]) + message[1:]
+	case e.search.query == "":
+		return ""
+	case count == 0:
+		return "No matches"
+	case e.search.current < 0 && count == 1:
+		return "1 match"
+	case e.search.current < 0:
+		return fmt.Sprintf("%d matches", count)
+	}
+	return fmt.Sprintf("%d of %d", e.search.current+1, count)
+}
+
+// searchForm holds the fields shared by the find and replace dialogs
+type searchForm struct {
+	editor  *Editor
+	query   *widget.Entry
+	options fyne.CanvasObject
+	status  *widget.Label
+	// origin is where the cursor was when the dialog opened, which typing
+	// searches forward from
+	origin int
+}
+
+// newSearchForm creates the search fields, filled in with the selection if
+// it is on one line or else the last search, and highlights the matches
+func (e *Editor) newSearchForm() *searchForm {
+	f := &searchForm{
+		editor: e,
+		query:  widget.NewEntry(),
+		status: widget.NewLabel(""),
+	}
+	f.query.PlaceHolder = "Find text..."
+	f.origin, _ = e.entry.SelectionRange()
+
+	options := e.search.options
+	query := e.search.query
+	if selected := e.entry.SelectedText(); selected != "" && !strings.Contains(selected, "\n") {
+		query = selected
+		if options.regex {
+			query = regexp.QuoteMeta(selected)
+		}
+	}
+
+	regex := widget.NewCheck("Regular expression", nil)
+	matchCase := widget.NewCheck("Match case", nil)
+	wholeWord := widget.NewCheck("Whole word", nil)
+	regex.Checked, matchCase.Checked, wholeWord.Checked = options.regex, options.matchCase, options.wholeWord
+	changed := func(bool) {
+		f.search(searchOptions{regex: regex.Checked, matchCase: matchCase.Checked, wholeWord: wholeWord.Checked})
+	}
+	regex.OnChanged, matchCase.OnChanged, wholeWord.OnChanged = changed, changed, changed
+	f.options = container.NewHBox(regex, matchCase, wholeWord)
+
+	e.search.showing = true
+	e.form = f
+	f.query.SetText(query)
+	f.query.OnChanged = func(string) { changed(false) }
+	changed(false)
+	return f
+}
+
+// search runs the query as typed, selecting the first match from where the
+// search started
+func (f *searchForm) search(options searchOptions) {
+	e := f.editor
+	e.setSearch(f.query.Text, options)
+	if i := matchAfter(e.search.matches, f.origin); i >= 0 {
+		e.selectMatch(i)
+	}
+	f.update()
+}
+
+// next selects the next or previous match
+func (f *searchForm) next(backward bool) {
+	if f.query.Text == "" {
+		f.status.SetText("Enter search text")
+		return
+	}
+	f.editor.FindNext(backward)
+	f.update()
+}
+
+// update shows the number of matches
+func (f *searchForm) update() {
+	f.status.SetText(f.editor.searchStatus())
+}
+
+// close stops highlighting the matches once the dialog is closed
+func (f *searchForm) close() {
+	if f.editor.form == f {
+		f.editor.form = nil
+	}
+	f.editor.search.showing = false
+	f.editor.entry.SetHighlights(nil)
 }
 
 // Focus sets focus to the editor
@@ -260,19 +538,19 @@ func (e *Editor) Focus() {
 }
 
 func (e *Editor) pasteText(text string) {
-	clipboard := &staticClipboard{content: text}
-	e.entry.TypedShortcut(&fyne.ShortcutPaste{Clipboard: clipboard})
+	e.entry.ReplaceSelection(text)
 }
 
 func (e *Editor) cursorIndex() int {
-	runes := []rune(e.entry.Text)
+	runes := []rune(e.entry.Text())
 	if len(runes) == 0 {
 		return 0
 	}
 
+	cursorRow, cursorColumn := e.entry.CursorPosition()
 	row := 0
 	index := 0
-	for index < len(runes) && row < e.entry.CursorRow {
+	for index < len(runes) && row < cursorRow {
 		if runes[index] == '\n' {
 			row++
 		}
@@ -280,7 +558,7 @@ func (e *Editor) cursorIndex() int {
 	}
 
 	column := 0
-	for index < len(runes) && column < e.entry.CursorColumn {
+	for index < len(runes) && column < cursorColumn {
 		if runes[index] == '\n' {
 			break
 		}
@@ -292,7 +570,7 @@ func (e *Editor) cursorIndex() int {
 }
 
 func (e *Editor) setCursorAtIndex(idx int) {
-	runes := []rune(e.entry.Text)
+	runes := []rune(e.entry.Text())
 	if idx < 0 {
 		idx = 0
 	}
@@ -311,42 +589,15 @@ func (e *Editor) setCursorAtIndex(idx int) {
 		column++
 	}
 
-	e.entry.CursorRow = row
-	e.entry.CursorColumn = column
-	e.entry.Refresh()
-}
-
-func findFoldIndex(content []rune, search []rune, start int) int {
-	if len(search) == 0 {
-		return -1
-	}
-	if start < 0 {
-		start = 0
-	}
-	if start > len(content) {
-		start = len(content)
-	}
-
-	target := string(search)
-	for i := start; i <= len(content)-len(search); i++ {
-		segment := string(content[i : i+len(search)])
-		if strings.EqualFold(segment, target) {
-			return i
-		}
-	}
-	return -1
+	e.entry.SetCursor(row, column)
 }
 
 func runeCount(s string) int {
 	return utf8.RuneCountInString(s)
 }
 
-type staticClipboard struct {
-	content string
-}
-
-func (c *staticClipboard) Content() string {
-	return c.content
+// usesCRLF reports whether text has Windows line endings, going by its first line break
+func usesCRLF(text string) bool {
+	i := strings.IndexByte(text, '\n')
+	return i > 0 && text[i-1] == '\r'
 }
-
-func (c *staticClipboard) SetContent(string) {}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// newMarkdown creates the goldmark pipeline shared by the preview, the
+// exports and the command line converter, with any extra extensions
+func newMarkdown(extensions ...goldmark.Extender) goldmark.Markdown {
+	return goldmark.New(
+		goldmark.WithExtensions(append([]goldmark.Extender{
+			extension.GFM,
+			extension.Typographer,
+			frontMatterExtension{},
+			mathExtension{},
+			diagramExtension{},
+		}, extensions...)...),
+		goldmark.WithParserOptions(
+			parser.WithAutoHeadingID(),
+		),
+		goldmark.WithRendererOptions(
+			html.WithUnsafe(),
+		),
+	)
+}
+
+// parseMarkdown parses markdown source into a goldmark AST
+func parseMarkdown(md goldmark.Markdown, source []byte) ast.Node {
+	return md.Parser().Parse(text.NewReader(source))
+}
+
+// nodeLines returns the raw source lines held by a block node
+func nodeLines(source []byte, n ast.Node) string {
+	var buf strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		buf.Write(line.Value(source))
+	}
+	return buf.String()
+}
+
+// localImage is an image file that a document refers to
+type localImage struct {
+	path string
+	data []byte
+	// format is the image format as named by the image package
+	format        string
+	width, height int
+}
+
+// errNotLocal is returned for references to assets that are not local files,
+// such as web addresses and data URIs
+var errNotLocal = errors.New("not a local file")
+
+// localAssetPath returns the file that a link or image destination refers
+// to, resolving relative paths against dir
+func localAssetPath(destination, dir string) (string, error) {
+	path := destination
+	u, err := url.Parse(destination)
+	switch {
+	case err == nil && u.Scheme == "file":
+		path = u.Path
+	case err == nil && len(u.Scheme) > 1:
+		// One letter schemes are Windows drive letters
+		return "", errNotLocal
+	default:
+		if unescaped, err := url.PathUnescape(path); err == nil {
+			path = unescaped
+		}
+	}
+	if path == "" {
+		return "", errNotLocal
+	}
+
+	if !filepath.IsAbs(path) {
+		if dir == "" {
+			return "", errors.New("the document has not been saved, so relative paths cannot be found")
+		}
+		path = filepath.Join(dir, filepath.FromSlash(path))
+	}
+	return path, nil
+}
+
+// readLocalImage reads a PNG, JPEG or GIF file referred to by an image
+// destination, resolving relative paths against dir
+func readLocalImage(destination, dir string) (*localImage, error) {
+	path, err := localAssetPath(destination, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &localImage{path: path, data: data, format: format, width: config.Width, height: config.Height}, nil
+}
+
+// titleHeading returns the first top-level heading of a document that has
+// text, and that text, or nil if there is none
+func titleHeading(source []byte, doc ast.Node) (*ast.Heading, string) {
+	r := &richTextRenderer{source: source}
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		if heading, ok := child.(*ast.Heading); ok && heading.Level == 1 {
+			if title := strings.TrimSpace(r.plainText(heading)); title != "" {
+				return heading, title
+			}
+		}
+	}
+	return nil, ""
+}
+
+// documentTitle returns the title given in a document's front matter, or the
+// text of its first top-level heading, or fallback if it has neither
+func documentTitle(source []byte, doc ast.Node, fallback string) string {
+	if title := metaTitle(source, doc); title != "" {
+		return title
+	}
+	if _, title := titleHeading(source, doc); title != "" {
+		return title
+	}
+	return fallback
+}
+
+// htmlPageOptions describes how a document is rendered as an HTML page
+type htmlPageOptions struct {
+	code codeHighlight
+	math mathOptions
+	// page is the template to fill in, the default one when nil
+	page *pageTemplate
+	// title is used when the document has no title of its own
+	title string
+}
+
+// renderHTMLPage renders a parsed document into a standalone HTML page
+func renderHTMLPage(source []byte, doc ast.Node, opts htmlPageOptions) (string, error) {
+	page := opts.page
+	if page == nil {
+		page = builtinPageTemplates[pageTemplateDefault]
+	}
+	// A title from the front matter leaves every heading in the body
+	var heading *ast.Heading
+	title := metaTitle(source, doc)
+	if title == "" {
+		heading, title = titleHeading(source, doc)
+	}
+	if title == "" {
+		title = opts.title
+	}
+
+	// Blocks are rendered one by one so the body can leave out the title
+	md := newMarkdown(opts.code.htmlExtension(page.dark), opts.math.htmlExtension(), diagramHTMLExtension(page.dark))
+	var content, body bytes.Buffer
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		var buf bytes.Buffer
+		if err := md.Renderer().Render(&buf, source, child); err != nil {
+			return "", err
+		}
+		content.Write(buf.Bytes())
+		if child != ast.Node(heading) {
+			body.Write(buf.Bytes())
+		}
+	}
+
+	var head string
+	if documentHasMath(doc) {
+		var err error
+		if head, err = opts.math.head(); err != nil {
+			return "", err
+		}
+	}
+	if documentHasDiagrams(doc) {
+		head += diagramCSS
+	}
+
+	headings := pageHeadings(source, doc)
+	var contents []pageHeading
+	for _, h := range headings {
+		if h.node != heading {
+			contents = append(contents, h)
+		}
+	}
+
+	return page.execute(pageData{
+		Title:    title,
+		Date:     time.Now(),
+		Content:  template.HTML(content.String()),
+		Body:     template.HTML(body.String()),
+		Headings: headings,
+		TOC:      tocHTML(contents),
+		CodeCSS:  template.CSS(opts.code.css(page.dark)),
+		Head:     template.HTML(head),
+		Meta:     documentMeta(source, doc),
+	})
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// markdownExtensions are the files the editor opens and searches
+var markdownExtensions = []string{".md", ".markdown", ".txt"}
+
+// isMarkdownFile reports whether a file name has one of markdownExtensions
+func isMarkdownFile(name string) bool {
+	return slices.Contains(markdownExtensions, strings.ToLower(filepath.Ext(name)))
+}
+
+// folderSearchLimit stops a folder search from listing more matches than
+// can usefully be shown
+const folderSearchLimit = 10000
+
+// folderMatch is a match found by a folder search
+type folderMatch struct {
+	match searchMatch
+	// line and column are 1-based, with the column counted in runes
+	line, column int
+	// preview is the line the match starts on, and start and end are the
+	// rune offsets of the match in it
+	preview    string
+	start, end int
+}
+
+// folderFile is a file with matches of a folder search
+type folderFile struct {
+	path string
+	// text is the content that was searched, which a replace is made to
+	text    string
+	matches []folderMatch
+}
+
+// folderEdit is a file changed by a replace across a folder, kept so that
+// the replace can be undone
+type folderEdit struct {
+	path          string
+	before, after string
+}
+
+// searchFolder searches the markdown files under root concurrently, taking
+// the text of open documents from buffers, keyed by path, rather than from
+// disk. Folders whose names start with a dot are skipped. The files come
+// back sorted by path, with at most limit matches unless it is 0, and
+// reports whether the limit was reached.
+func searchFolder(ctx context.Context, root string, pattern *searchPattern, buffers map[string]string, limit int) ([]folderFile, bool, error) {
+	paths := make(chan string)
+	results := make(chan folderFile)
+
+	var workers sync.WaitGroup
+	for range runtime.NumCPU() {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for path := range paths {
+				text, ok := buffers[path]
+				if !ok {
+					data, err := os.ReadFile(path)
+					if err != nil || !utf8.Valid(data) {
+						continue
+					}
+					text = string(data)
+				}
+				if matches := folderMatches(text, pattern.findAll(text)); len(matches) > 0 {
+					results <- folderFile{path: path, text: text, matches: matches}
+				}
+			}
+		}()
+	}
+
+	var walkErr error
+	go func() {
+		defer close(paths)
+		walkErr = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				// Folders that cannot be read are left out rather than
+				// ending the search
+				if entry != nil && entry.IsDir() && path != root {
+					return fs.SkipDir
+				}
+				return err
+			}
+			if entry.IsDir() {
+				if path != root && strings.HasPrefix(entry.Name(), ".") {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if !isMarkdownFile(entry.Name()) {
+				return nil
+			}
+			select {
+			case paths <- path:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	var files []folderFile
+	for file := range results {
+		files = append(files, file)
+	}
+	if walkErr != nil {
+		return nil, false, walkErr
+	}
+
+	slices.SortFunc(files, func(a, b folderFile) int { return strings.Compare(a.path, b.path) })
+	limited := false
+	total := 0
+	for i := range files {
+		if limit > 0 && total+len(files[i].matches) > limit {
+			files[i].matches = files[i].matches[:limit-total]
+			files = files[:i+1]
+			limited = true
+			break
+		}
+		total += len(files[i].matches)
+	}
+	return files, limited, nil
+}
+
+// folderMatches places matches in text by line, with the line each starts
+// on to show it in
+func folderMatches(text string, matches []searchMatch) []folderMatch {
+	if len(matches) == 0 {
+		return nil
+	}
+	result := make([]folderMatch, 0, len(matches))
+	line, lineStart, offset := 1, 0, 0
+	rest := text
+	for _, m := range matches {
+		// Move through the text to the line the match starts on
+		for {
+			i := strings.IndexByte(rest, '\n')
+			if i < 0 || offset+utf8.RuneCountInString(rest[:i]) >= m.start {
+				break
+			}
+			offset += utf8.RuneCountInString(rest[:i]) + 1
+			rest = rest[i+1:]
+			line++
+			lineStart = offset
+		}
+		end := strings.IndexByte(rest, '\n')
+		if end < 0 {
+			end = len(rest)
+		}
+		preview := strings.TrimSuffix(rest[:end], "\r")
+		start := m.start - lineStart
+		result = append(result, folderMatch{
+			match:   m,
+			line:    line,
+			column:  start + 1,
+			preview: preview,
+			start:   start,
+			end:     min(m.end-lineStart, utf8.RuneCountInString(preview)),
+		})
+	}
+	return result
+}
+
+// replaceInFolder works out the replacement for every file of a search
+func replaceInFolder(files []folderFile, pattern *searchPattern, template string, preserveCase bool) []folderEdit {
+	edits := make([]folderEdit, 0, len(files))
+	for _, file := range files {
+		matches := make([]searchMatch, len(file.matches))
+		for i, m := range file.matches {
+			matches[i] = m.match
+		}
+		after := pattern.replaceMatches(file.text, matches, template, preserveCase)
+		if after != file.text {
+			edits = append(edits, folderEdit{path: file.path, before: file.text, after: after})
+		}
+	}
+	return edits
+}
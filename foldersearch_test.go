@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSearchFolderLimit(t *testing.T) {
+	root := t.TempDir()
+	for name, text := range map[string]string{
+		"a.md":         "cat cat cat",
+		"b.md":         "cat\ncat",
+		"notes.go":     "cat",
+		".hidden/c.md": "cat",
+		"sub/d.txt":    "a cat",
+		"sub/empty.md": "dog",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pattern, err := compileSearch("cat", searchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		limit       int
+		wantMatches int
+		wantLimited bool
+	}{
+		{name: "no limit", limit: 0, wantMatches: 6},
+		{name: "limit above the matches", limit: 10, wantMatches: 6},
+		{name: "limit within a file", limit: 4, wantMatches: 4, wantLimited: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files, limited, err := searchFolder(context.Background(), root, pattern, nil, test.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			count := 0
+			for _, file := range files {
+				count += len(file.matches)
+			}
+			if count != test.wantMatches || limited != test.wantLimited {
+				t.Errorf("got %d matches, limited %v, want %d, %v", count, limited, test.wantMatches, test.wantLimited)
+			}
+		})
+	}
+
+	// A replace works from a search without the limit, so nothing is left behind
+	files, _, err := searchFolder(context.Background(), root, pattern, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, edit := range replaceInFolder(files, pattern, "dog", false) {
+		if strings.Contains(edit.after, "cat") {
+			t.Errorf("%s still contains cat after the replace: %q", edit.path, edit.after)
+		}
+	}
+}
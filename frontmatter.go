@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/BurntSushi/toml"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+	"gopkg.in/yaml.v3"
+)
+
+// Front matter formats, named by their delimiter lines
+const (
+	frontMatterYAML = "---"
+	frontMatterTOML = "+++"
+)
+
+// kindFrontMatter is the node kind of front matter
+var kindFrontMatter = ast.NewNodeKind("FrontMatter")
+
+// frontMatterNode is the metadata block at the start of a document. It stays
+// in the AST, so that blocks keep their source lines, but every renderer
+// leaves it out of the text.
+type frontMatterNode struct {
+	ast.BaseBlock
+	// delimiter is the opening line, which tells YAML from TOML
+	delimiter string
+}
+
+// Kind returns kindFrontMatter
+func (n *frontMatterNode) Kind() ast.NodeKind {
+	return kindFrontMatter
+}
+
+// IsRaw returns true as the lines are data rather than markdown
+func (n *frontMatterNode) IsRaw() bool {
+	return true
+}
+
+// Dump prints the node for debugging
+func (n *frontMatterNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Delimiter": n.delimiter}, nil)
+}
+
+// frontMatterExtension recognises YAML front matter between --- lines and
+// TOML front matter between +++ lines at the very start of a document
+type frontMatterExtension struct{}
+
+// Extend adds the front matter parser, and a renderer that leaves it out of
+// exported HTML
+func (frontMatterExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithBlockParsers(
+		// Before thematic breaks and setext headings, which also use ---
+		util.Prioritized(frontMatterParser{}, 0),
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(frontMatterHTMLRenderer{}, 0),
+	))
+}
+
+// frontMatterParser parses front matter into a frontMatterNode holding its
+// lines without the delimiters
+type frontMatterParser struct{}
+
+// Trigger returns the first characters of the delimiters
+func (frontMatterParser) Trigger() []byte {
+	return []byte{'-', '+'}
+}
+
+// Open starts front matter on the first line of a document, if a closing
+// delimiter follows, so that a lone rule at the top is still a rule
+func (frontMatterParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	if parent.Kind() != ast.KindDocument || parent.HasChildren() || segment.Start != 0 {
+		return nil, parser.NoChildren
+	}
+	delimiter := string(bytes.TrimRight(line, " \t\r\n"))
+	if delimiter != frontMatterYAML && delimiter != frontMatterTOML {
+		return nil, parser.NoChildren
+	}
+
+	rest := reader.Source()[segment.Stop:]
+	closed := false
+	for len(rest) > 0 && !closed {
+		end := bytes.IndexByte(rest, '\n') + 1
+		if end == 0 {
+			end = len(rest)
+		}
+		closed = isFrontMatterEnd(rest[:end], delimiter)
+		rest = rest[end:]
+	}
+	if !closed {
+		return nil, parser.NoChildren
+	}
+	return &frontMatterNode{delimiter: delimiter}, parser.NoChildren
+}
+
+// Continue collects lines up to the closing delimiter
+func (frontMatterParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if isFrontMatterEnd(line, node.(*frontMatterNode).delimiter) {
+		newline := 0
+		if line[len(line)-1] == '\n' {
+			newline = 1
+		}
+		reader.Advance(segment.Len() - newline)
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	reader.Advance(segment.Len() - 1)
+	return parser.Continue | parser.NoChildren
+}
+
+// Close does nothing, as the lines are only decoded when asked for
+func (frontMatterParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+// CanInterruptParagraph returns false, as front matter only starts a document
+func (frontMatterParser) CanInterruptParagraph() bool {
+	return false
+}
+
+// CanAcceptIndentedLine returns false, as delimiters are not indented
+func (frontMatterParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// isFrontMatterEnd reports whether line closes front matter, where YAML may
+// also end with ...
+func isFrontMatterEnd(line []byte, delimiter string) bool {
+	trimmed := string(bytes.TrimRight(line, " \t\r\n"))
+	return trimmed == delimiter || delimiter == frontMatterYAML && trimmed == "..."
+}
+
+// frontMatterHTMLRenderer renders front matter as nothing
+type frontMatterHTMLRenderer struct{}
+
+// RegisterFuncs registers the renderer for front matter nodes
+func (frontMatterHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindFrontMatter, func(util.BufWriter, []byte, ast.Node, bool) (ast.WalkStatus, error) {
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// frontMatter is the decoded metadata of a document
+type frontMatter struct {
+	fields map[string]any
+	// keys are the top-level field names in the order they are written
+	keys []string
+}
+
+// documentFrontMatter returns the front matter node of a parsed document,
+// or nil if it has none
+func documentFrontMatter(doc ast.Node) *frontMatterNode {
+	node, _ := doc.FirstChild().(*frontMatterNode)
+	return node
+}
+
+// documentMeta returns the front matter fields of a document, which are
+// empty when it has none or they cannot be decoded
+func documentMeta(source []byte, doc ast.Node) map[string]any {
+	node := documentFrontMatter(doc)
+	if node == nil {
+		return map[string]any{}
+	}
+	matter, err := decodeFrontMatter(source, node)
+	if err != nil {
+		return map[string]any{}
+	}
+	return matter.fields
+}
+
+// metaTitle returns the title field of a document's front matter, or "" if
+// it has none
+func metaTitle(source []byte, doc ast.Node) string {
+	title, ok := documentMeta(source, doc)["title"]
+	if !ok || title == nil {
+		return ""
+	}
+	return strings.TrimSpace(formatMetaValue(title))
+}
+
+// decodeFrontMatter decodes the fields of front matter
+func decodeFrontMatter(source []byte, node *frontMatterNode) (*frontMatter, error) {
+	data := nodeLines(source, node)
+	matter := &frontMatter{fields: make(map[string]any)}
+
+	if node.delimiter == frontMatterTOML {
+		meta, err := toml.Decode(data, &matter.fields)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range meta.Keys() {
+			if len(key) == 1 {
+				matter.keys = append(matter.keys, key[0])
+			}
+		}
+		return matter, nil
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		// Front matter with no fields at all
+		return matter, nil
+	}
+	mapping := document.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil, errors.New("front matter is not a set of fields")
+	}
+	if err := mapping.Decode(&matter.fields); err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		matter.keys = append(matter.keys, mapping.Content[i].Value)
+	}
+	return matter, nil
+}
+
+// formatMetaValue writes a field value as short text: lists are joined with
+// commas and dates without a time of day are shown as dates
+func formatMetaValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04")
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatMetaValue(item)
+		}
+		return strings.Join(items, ", ")
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := make([]string, len(keys))
+		for i, key := range keys {
+			items[i] = key + ": " + formatMetaValue(v[key])
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	}
+	return fmt.Sprint(value)
+}
+
+// metadataPanel is the state of the front matter panel in a preview, which
+// stays open or closed as the front matter is edited
+type metadataPanel struct {
+	open bool
+	// resized is called when the panel opens or closes
+	resized func()
+}
+
+// frontMatterSegment shows front matter in the preview as a panel of fields
+// that can be collapsed
+type frontMatterSegment struct {
+	matter *frontMatter
+	err    error
+	panel  *metadataPanel
+}
+
+// Inline returns false as the panel is a block
+func (s *frontMatterSegment) Inline() bool {
+	return false
+}
+
+// Textual returns the fields one per line
+func (s *frontMatterSegment) Textual() string {
+	if s.matter == nil {
+		return ""
+	}
+	var buf strings.Builder
+	for _, key := range s.matter.keys {
+		fmt.Fprintf(&buf, "%s: %s\n", key, formatMetaValue(s.matter.fields[key]))
+	}
+	return buf.String()
+}
+
+// Visual builds the panel with a header that opens and closes it
+func (s *frontMatterSegment) Visual() fyne.CanvasObject {
+	var details fyne.CanvasObject
+	title := "Metadata"
+	switch {
+	case s.err != nil:
+		title = "Metadata (invalid)"
+		message := widget.NewLabel(s.err.Error())
+		message.Wrapping = fyne.TextWrapWord
+		message.Importance = widget.DangerImportance
+		details = message
+	case len(s.matter.keys) == 0:
+		details = widget.NewLabelWithStyle("No fields", fyne.TextAlignLeading, fyne.TextStyle{Italic: true})
+	default:
+		title = fmt.Sprintf("Metadata (%d)", len(s.matter.keys))
+		grid := container.New(layout.NewFormLayout())
+		for _, key := range s.matter.keys {
+			value := widget.NewLabel(formatMetaValue(s.matter.fields[key]))
+			value.Wrapping = fyne.TextWrapWord
+			grid.Add(widget.NewLabelWithStyle(key, fyne.TextAlignTrailing, fyne.TextStyle{Bold: true}))
+			grid.Add(value)
+		}
+		details = grid
+	}
+
+	var header *widget.Button
+	update := func() {
+		if s.panel.open {
+			header.SetIcon(theme.MenuDropDownIcon())
+			details.Show()
+		} else {
+			header.SetIcon(theme.MenuExpandIcon())
+			details.Hide()
+		}
+	}
+	header = widget.NewButtonWithIcon(title, nil, func() {
+		s.panel.open = !s.panel.open
+		update()
+		if s.panel.resized != nil {
+			s.panel.resized()
+		}
+	})
+	header.Alignment = widget.ButtonAlignLeading
+	header.Importance = widget.LowImportance
+	update()
+
+	return container.NewVBox(header, details, widget.NewSeparator())
+}
+
+// Update does nothing, as the panel is built again when the front matter
+// changes
+func (s *frontMatterSegment) Update(fyne.CanvasObject) {}
+
+// Select does nothing as the panel cannot be selected
+func (s *frontMatterSegment) Select(_, _ fyne.Position) {}
+
+// SelectedText returns nothing as the panel cannot be selected
+func (s *frontMatterSegment) SelectedText() string {
+	return ""
+}
+
+// Unselect does nothing as the panel cannot be selected
+func (s *frontMatterSegment) Unselect() {}
@@ -0,0 +1,516 @@
+package main
+
+import (
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+)
+
+// spanStyle is how a run of markdown source is drawn in the editor
+type spanStyle struct {
+	color     fyne.ThemeColorName
+	bold      bool
+	italic    bool
+	monospace bool
+}
+
+// textStyle returns the font style for the span
+func (s spanStyle) textStyle() fyne.TextStyle {
+	return fyne.TextStyle{Bold: s.bold, Italic: s.italic, Monospace: s.monospace}
+}
+
+// Styles used when highlighting markdown source
+var (
+	styleText    = spanStyle{color: theme.ColorNameForeground}
+	styleMarkup  = spanStyle{color: theme.ColorNamePlaceHolder}
+	styleHeading = spanStyle{color: theme.ColorNamePrimary, bold: true}
+	styleCode    = spanStyle{color: theme.ColorNameSuccess, monospace: true}
+	styleLink    = spanStyle{color: theme.ColorNameHyperlink}
+	styleURL     = spanStyle{color: theme.ColorNamePlaceHolder, italic: true}
+	styleHTML    = spanStyle{color: theme.ColorNameWarning}
+)
+
+// highlightSpan styles the runes of a line from start up to end
+type highlightSpan struct {
+	start, end int
+	style      spanStyle
+}
+
+// lineState is the block context a line of source starts in
+type lineState struct {
+	// fence is the character of the open code fence, or 0 outside code blocks
+	fence    rune
+	fenceLen int
+}
+
+// markdownHighlighter splits markdown source lines into styled spans.
+// The state each line starts in is cached, so after an edit only the lines
+// from the edit onwards are looked at again, and only once they are shown.
+type markdownHighlighter struct {
+	// states[i] is the state line i starts in, for the lines checked so far
+	states []lineState
+	spans  map[int][]highlightSpan
+}
+
+func newMarkdownHighlighter() *markdownHighlighter {
+	return &markdownHighlighter{spans: make(map[int][]highlightSpan)}
+}
+
+// invalidate forgets everything that depends on the lines from row onwards
+func (h *markdownHighlighter) invalidate(row int) {
+	if row+1 < len(h.states) {
+		h.states = h.states[:row+1]
+	}
+	for cached := range h.spans {
+		if cached >= row {
+			delete(h.spans, cached)
+		}
+	}
+}
+
+// lineSpans returns the styled spans of a line
+func (h *markdownHighlighter) lineSpans(lines [][]rune, row int) []highlightSpan {
+	if spans, ok := h.spans[row]; ok {
+		return spans
+	}
+	spans := highlightLine(lines[row], h.stateAt(lines, row))
+	h.spans[row] = spans
+	return spans
+}
+
+// stateAt returns the state a line starts in, scanning forward from the
+// last line that is known
+func (h *markdownHighlighter) stateAt(lines [][]rune, row int) lineState {
+	if len(h.states) == 0 {
+		h.states = append(h.states, lineState{})
+	}
+	for len(h.states) <= row {
+		i := len(h.states) - 1
+		h.states = append(h.states, nextLineState(lines[i], h.states[i]))
+	}
+	return h.states[row]
+}
+
+// nextLineState returns the state the line after line starts in
+func nextLineState(line []rune, state lineState) lineState {
+	fence, n := codeFence(line)
+	if state.fence != 0 {
+		if fence == state.fence && n >= state.fenceLen && onlySpaces(line[leadingSpaces(line)+n:]) {
+			return lineState{}
+		}
+		return state
+	}
+	if fence != 0 {
+		return lineState{fence: fence, fenceLen: n}
+	}
+	return state
+}
+
+// codeFence reports the fence character and length if line is a code fence
+func codeFence(line []rune) (rune, int) {
+	indent := leadingSpaces(line)
+	if indent > 3 || indent >= len(line) {
+		return 0, 0
+	}
+
+	c := line[indent]
+	if c != '`' && c != '~' {
+		return 0, 0
+	}
+	n := runLength(line, indent, c)
+	if n < 3 {
+		return 0, 0
+	}
+	// The info string of a backtick fence cannot contain backticks
+	if c == '`' {
+		for _, r := range line[indent+n:] {
+			if r == '`' {
+				return 0, 0
+			}
+		}
+	}
+	return c, n
+}
+
+// highlightLine splits one line into styled spans covering all of it
+func highlightLine(line []rune, state lineState) []highlightSpan {
+	var spans []highlightSpan
+	emit := func(start, end int, style spanStyle) {
+		if end <= start {
+			return
+		}
+		if n := len(spans); n > 0 && spans[n-1].style == style && spans[n-1].end == start {
+			spans[n-1].end = end
+			return
+		}
+		spans = append(spans, highlightSpan{start: start, end: end, style: style})
+	}
+
+	if state.fence != 0 {
+		emit(0, len(line), styleCode)
+		return spans
+	}
+	if fence, _ := codeFence(line); fence != 0 {
+		emit(0, len(line), styleCode)
+		return spans
+	}
+
+	i := leadingSpaces(line)
+	if i > 3 {
+		emit(0, len(line), styleText)
+		return spans
+	}
+	emit(0, i, styleText)
+
+	// ATX headings
+	if n := runLength(line, i, '#'); n >= 1 && n <= 6 && (i+n == len(line) || line[i+n] == ' ' || line[i+n] == '\t') {
+		emit(i, i+n, styleMarkup)
+		emit(i+n, len(line), styleHeading)
+		return spans
+	}
+
+	// Thematic breaks and setext heading underlines
+	if isRuleLine(line[i:]) {
+		emit(i, len(line), styleMarkup)
+		return spans
+	}
+
+	base := styleText
+	for {
+		// Block quote markers
+		if i < len(line) && line[i] == '>' {
+			emit(i, i+1, styleMarkup)
+			i++
+			base.italic = true
+			next := i + leadingSpaces(line[i:])
+			emit(i, next, base)
+			i = next
+			continue
+		}
+
+		// List markers, with an optional task box
+		if n := listMarker(line[i:]); n > 0 {
+			emit(i, i+n, styleMarkup)
+			i += n
+			if n := taskBox(line[i:]); n > 0 {
+				emit(i, i+n, styleMarkup)
+				i += n
+			}
+			next := i + leadingSpaces(line[i:])
+			emit(i, next, base)
+			i = next
+			continue
+		}
+		break
+	}
+
+	highlightInline(line, i, len(line), base, emit)
+	return spans
+}
+
+// highlightInline styles emphasis, code spans, links and HTML from start up to end
+func highlightInline(line []rune, start, end int, base spanStyle, emit func(int, int, spanStyle)) {
+	text := start
+	flush := func(upTo int) {
+		emit(text, upTo, base)
+	}
+
+	for i := start; i < end; {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < end:
+			i += 2
+			continue
+
+		case c == '`':
+			n := runLength(line[:end], i, '`')
+			if closing := findRun(line[:end], i+n, '`', n); closing >= 0 {
+				flush(i)
+				emit(i, closing+n, styleCode)
+				i = closing + n
+				text = i
+				continue
+			}
+			i += n
+			continue
+
+		case c == '*' || c == '_' || c == '~':
+			n := runLength(line[:end], i, c)
+			if n > 3 || (c == '~' && n != 2) || (c == '_' && i > 0 && isWordRune(line[i-1])) ||
+				i+n >= end || unicode.IsSpace(line[i+n]) {
+				i += n
+				continue
+			}
+			closing := findDelimiter(line[:end], i+n, c, n)
+			if closing < 0 {
+				i += n
+				continue
+			}
+
+			inner := base
+			switch {
+			case c == '~':
+				inner.color = theme.ColorNamePlaceHolder
+			case n == 1:
+				inner.italic = true
+			case n == 2:
+				inner.bold = true
+			default:
+				inner.bold, inner.italic = true, true
+			}
+			flush(i)
+			emit(i, i+n, styleMarkup)
+			highlightInline(line, i+n, closing, inner, emit)
+			emit(closing, closing+n, styleMarkup)
+			i = closing + n
+			text = i
+			continue
+
+		case c == '[' || (c == '!' && i+1 < end && line[i+1] == '['):
+			open := i
+			if c == '!' {
+				open++
+			}
+			if closing := link(line[:end], open); closing > 0 {
+				label := matchingBracket(line[:end], open, '[', ']')
+				flush(i)
+				emit(i, open+1, styleMarkup)
+				emit(open+1, label, styleLink)
+				emit(label, label+2, styleMarkup)
+				emit(label+2, closing, styleURL)
+				emit(closing, closing+1, styleMarkup)
+				i = closing + 1
+				text = i
+				continue
+			}
+
+		case c == '<':
+			if closing := angleBracket(line[:end], i); closing > 0 {
+				style := styleHTML
+				if isAutolink(line[i+1 : closing]) {
+					style = styleLink
+				}
+				flush(i)
+				emit(i, closing+1, style)
+				i = closing + 1
+				text = i
+				continue
+			}
+		}
+		i++
+	}
+	flush(end)
+}
+
+// link returns the index of the closing bracket of an inline [text](url)
+// or reference [text][ref] link starting at open, or -1
+func link(line []rune, open int) int {
+	label := matchingBracket(line, open, '[', ']')
+	if label < 0 || label+1 >= len(line) {
+		return -1
+	}
+	switch line[label+1] {
+	case '(':
+		return matchingBracket(line, label+1, '(', ')')
+	case '[':
+		return matchingBracket(line, label+1, '[', ']')
+	}
+	return -1
+}
+
+// matchingBracket finds the bracket closing the one at open, allowing nesting
+func matchingBracket(line []rune, open int, opening, closing rune) int {
+	depth := 0
+	for i := open; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case opening:
+			depth++
+		case closing:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// angleBracket finds the end of an autolink or HTML tag starting at open
+func angleBracket(line []rune, open int) int {
+	if open+1 >= len(line) {
+		return -1
+	}
+	first := line[open+1]
+	if !unicode.IsLetter(first) && first != '/' && first != '!' {
+		return -1
+	}
+	for i := open + 1; i < len(line); i++ {
+		if line[i] == '>' {
+			return i
+		}
+		if line[i] == '<' {
+			return -1
+		}
+	}
+	return -1
+}
+
+// isAutolink reports whether the text inside angle brackets is a URL or email address
+func isAutolink(text []rune) bool {
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			return false
+		}
+		if r == ':' && i > 1 {
+			return true
+		}
+		if r == '@' && i > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// findRun returns the start of the next run of exactly n copies of c
+func findRun(line []rune, from int, c rune, n int) int {
+	for i := from; i < len(line); {
+		if line[i] != c {
+			i++
+			continue
+		}
+		run := runLength(line, i, c)
+		if run == n {
+			return i
+		}
+		i += run
+	}
+	return -1
+}
+
+// findDelimiter returns the start of the emphasis delimiter run closing one
+// of n copies of c, which must directly follow text that is not a space
+func findDelimiter(line []rune, from int, c rune, n int) int {
+	for i := from; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++
+		case line[i] == '`':
+			// Delimiters inside code spans do not count
+			run := runLength(line, i, '`')
+			if closing := findRun(line, i+run, '`', run); closing >= 0 {
+				i = closing + run - 1
+			} else {
+				i += run - 1
+			}
+		case line[i] == c:
+			run := runLength(line, i, c)
+			if run == n && i > from && !unicode.IsSpace(line[i-1]) &&
+				(c != '_' || i+run >= len(line) || !isWordRune(line[i+run])) {
+				return i
+			}
+			i += run - 1
+		}
+	}
+	return -1
+}
+
+// listMarker returns the length of a bullet or ordered list marker and the
+// space after it at the start of text, or 0
+func listMarker(text []rune) int {
+	if len(text) == 0 {
+		return 0
+	}
+	n := 0
+	switch text[0] {
+	case '-', '*', '+':
+		n = 1
+	default:
+		for n < len(text) && n < 9 && text[n] >= '0' && text[n] <= '9' {
+			n++
+		}
+		if n == 0 || n >= len(text) || (text[n] != '.' && text[n] != ')') {
+			return 0
+		}
+		n++
+	}
+	if n == len(text) {
+		return n
+	}
+	if text[n] != ' ' && text[n] != '\t' {
+		return 0
+	}
+	return n + 1
+}
+
+// taskBox returns the length of a [ ] or [x] task box and the space after it, or 0
+func taskBox(text []rune) int {
+	if len(text) < 3 || text[0] != '[' || text[2] != ']' {
+		return 0
+	}
+	switch text[1] {
+	case ' ', 'x', 'X':
+	default:
+		return 0
+	}
+	if len(text) == 3 {
+		return 3
+	}
+	if text[3] != ' ' {
+		return 0
+	}
+	return 4
+}
+
+// isRuleLine reports whether text is a thematic break or setext underline
+func isRuleLine(text []rune) bool {
+	var marker rune
+	count := 0
+	spaced := false
+	for _, r := range text {
+		if r == ' ' || r == '\t' {
+			spaced = count > 0
+			continue
+		}
+		if marker == 0 && (r == '-' || r == '*' || r == '_' || r == '=') {
+			marker = r
+		}
+		// Setext underlines cannot have inner spaces
+		if r != marker || (marker == '=' && spaced) {
+			return false
+		}
+		count++
+	}
+	return marker == '=' || (marker != 0 && count >= 3)
+}
+
+func leadingSpaces(line []rune) int {
+	n := 0
+	for n < len(line) && line[n] == ' ' {
+		n++
+	}
+	return n
+}
+
+func runLength(line []rune, from int, c rune) int {
+	n := 0
+	for from+n < len(line) && line[from+n] == c {
+		n++
+	}
+	return n
+}
+
+func onlySpaces(text []rune) bool {
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
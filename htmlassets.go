@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+	"golang.org/x/net/html"
+)
+
+// Preference keys for the self-contained HTML export
+const (
+	preferenceEmbedStylesheets = "embedStylesheets"
+	preferenceEmbedFonts       = "embedFonts"
+)
+
+// embedOptions chooses what a self-contained HTML export carries besides
+// its images
+type embedOptions struct {
+	// stylesheets replaces links to local stylesheets and scripts with their
+	// content
+	stylesheets bool
+	// fonts embeds the editor's fonts and any local font files that
+	// stylesheets refer to
+	fonts bool
+}
+
+// missingAsset is a reference that could not be embedded, and still points
+// to where the document said
+type missingAsset struct {
+	ref    string
+	reason string
+}
+
+func (m missingAsset) String() string {
+	return m.ref + ": " + m.reason
+}
+
+// cssURL matches url() references in a stylesheet
+var cssURL = regexp.MustCompile(`url\(\s*(['"]?)([^'")]+)(['"]?)\s*\)`)
+
+// fontExtensions are the font files embedded only when fonts are asked for
+var fontExtensions = map[string]bool{".woff": true, ".woff2": true, ".ttf": true, ".otf": true}
+
+// assetEmbedder rewrites local references in an HTML page as data URIs
+type assetEmbedder struct {
+	opts    embedOptions
+	missing []missingAsset
+	seen    map[string]bool
+}
+
+// embedAssets makes an HTML page portable by inlining the local images,
+// and optionally stylesheets and fonts, that it refers to. Relative
+// references are resolved against dir. References that cannot be read are
+// left as they are and returned, each once.
+func embedAssets(page, dir string, opts embedOptions) (string, []missingAsset) {
+	e := &assetEmbedder{opts: opts, seen: make(map[string]bool)}
+	var buf strings.Builder
+	z := html.NewTokenizer(strings.NewReader(page))
+	inStyle := false
+	for {
+		kind := z.Next()
+		if kind == html.ErrorToken {
+			if z.Err() != io.EOF {
+				// The tokenizer stops at the first error, so keep the rest as it was
+				buf.Write(z.Raw())
+				buf.Write(z.Buffered())
+			}
+			break
+		}
+
+		switch kind {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := z.Token()
+			switch token.Data {
+			case "img":
+				e.embedAttr(&token, "src", dir)
+				buf.WriteString(token.String())
+				continue
+			case "link":
+				if css, ok := e.linkedStylesheet(token, dir); ok {
+					buf.WriteString("<style>\n" + css + "\n</style>")
+					continue
+				}
+			case "script":
+				if script, ok := e.linkedScript(&token, dir); ok && kind == html.StartTagToken {
+					buf.WriteString(token.String() + "\n" + script + "\n")
+					continue
+				}
+			case "style":
+				inStyle = kind == html.StartTagToken
+			}
+			buf.WriteString(token.String())
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "style":
+				inStyle = false
+			case "head":
+				if e.opts.fonts {
+					buf.WriteString(editorFontsCSS())
+				}
+			}
+			buf.Write(z.Raw())
+		case html.TextToken:
+			if inStyle {
+				buf.WriteString(e.embedCSS(string(z.Raw()), dir))
+			} else {
+				buf.Write(z.Raw())
+			}
+		default:
+			buf.Write(z.Raw())
+		}
+	}
+	return buf.String(), e.missing
+}
+
+// embedAttr replaces a reference held in a tag attribute with a data URI
+func (e *assetEmbedder) embedAttr(token *html.Token, key, dir string) {
+	for i, attr := range token.Attr {
+		if attr.Key == key {
+			if uri, ok := e.dataURI(attr.Val, dir); ok {
+				token.Attr[i].Val = uri
+			}
+		}
+	}
+}
+
+// linkedStylesheet reads the local stylesheet that a link tag refers to
+func (e *assetEmbedder) linkedStylesheet(token html.Token, dir string) (string, bool) {
+	if !e.opts.stylesheets {
+		return "", false
+	}
+	rel, href := "", ""
+	for _, attr := range token.Attr {
+		switch attr.Key {
+		case "rel":
+			rel = attr.Val
+		case "href":
+			href = attr.Val
+		}
+	}
+	if !strings.EqualFold(strings.TrimSpace(rel), "stylesheet") || href == "" {
+		return "", false
+	}
+
+	data, path, ok := e.readLocal(href, dir)
+	if !ok {
+		return "", false
+	}
+
+	// References in a stylesheet are relative to the stylesheet
+	css := e.embedCSS(string(data), filepath.Dir(path))
+	// A closing tag in the text would end the inlined style element early
+	return strings.ReplaceAll(css, "</", `<\/`), true
+}
+
+// linkedScript reads the local script that a script tag refers to, taking
+// the reference out of the tag
+func (e *assetEmbedder) linkedScript(token *html.Token, dir string) (string, bool) {
+	if !e.opts.stylesheets {
+		return "", false
+	}
+	attrs := token.Attr[:0:0]
+	src := ""
+	for _, attr := range token.Attr {
+		switch attr.Key {
+		case "src":
+			src = attr.Val
+		case "defer", "async":
+			// Inline scripts run where they are
+		default:
+			attrs = append(attrs, attr)
+		}
+	}
+	if src == "" {
+		return "", false
+	}
+	data, _, ok := e.readLocal(src, dir)
+	if !ok {
+		return "", false
+	}
+	token.Attr = attrs
+	return scriptEnd.ReplaceAllString(string(data), `<\/script`), true
+}
+
+// scriptEnd matches text that would end an inlined script element early
+var scriptEnd = regexp.MustCompile(`(?i)</script`)
+
+// readLocal reads a local file that a page refers to, recording it as
+// missing when it cannot be read. Remote references are left alone.
+func (e *assetEmbedder) readLocal(ref, dir string) ([]byte, string, bool) {
+	path, err := localAssetPath(ref, dir)
+	if errors.Is(err, errNotLocal) {
+		return nil, "", false
+	}
+	var data []byte
+	if err == nil {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		e.addMissing(ref, err)
+		return nil, "", false
+	}
+	return data, path, true
+}
+
+// embedCSS replaces the url() references of a stylesheet with data URIs
+func (e *assetEmbedder) embedCSS(css, dir string) string {
+	return cssURL.ReplaceAllStringFunc(css, func(match string) string {
+		parts := cssURL.FindStringSubmatch(match)
+		ref := strings.TrimSpace(parts[2])
+		if fontExtensions[strings.ToLower(filepath.Ext(ref))] && !e.opts.fonts {
+			return match
+		}
+		if uri, ok := e.dataURI(ref, dir); ok {
+			return `url("` + uri + `")`
+		}
+		return match
+	})
+}
+
+// dataURI reads a local file as a data URI, recording it as missing when it
+// cannot be read. Remote and data references are left alone.
+func (e *assetEmbedder) dataURI(ref, dir string) (string, bool) {
+	if strings.HasPrefix(ref, "#") {
+		return "", false
+	}
+	data, path, ok := e.readLocal(ref, dir)
+	if !ok {
+		return "", false
+	}
+	return encodeDataURI(assetMimeType(path, data), data), true
+}
+
+func (e *assetEmbedder) addMissing(ref string, err error) {
+	if e.seen[ref] {
+		return
+	}
+	e.seen[ref] = true
+
+	reason := err.Error()
+	var pathErr *fs.PathError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		reason = "file not found"
+	case errors.As(err, &pathErr):
+		reason = pathErr.Err.Error()
+	}
+	e.missing = append(e.missing, missingAsset{ref: ref, reason: reason})
+}
+
+// assetMimeType guesses the media type of a file from its name, then from
+// its content
+func assetMimeType(path string, data []byte) string {
+	kind := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if kind == "" {
+		kind = http.DetectContentType(data)
+	}
+	// Parameters such as the charset are not needed in a data URI
+	kind, _, _ = strings.Cut(kind, ";")
+	return strings.TrimSpace(kind)
+}
+
+func encodeDataURI(kind string, data []byte) string {
+	return "data:" + kind + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// editorFontsCSS embeds the fonts of the default theme and uses them for
+// the page, so it looks the same on machines without the usual web fonts
+func editorFontsCSS() string {
+	fonts := theme.DefaultTheme()
+	face := func(family string, style fyne.TextStyle, weight, slant string) string {
+		return fmt.Sprintf("@font-face { font-family: %q; font-weight: %s; font-style: %s; src: url(%q) format(\"truetype\"); }\n",
+			family, weight, slant, encodeDataURI("font/ttf", fonts.Font(style).Content()))
+	}
+
+	var buf strings.Builder
+	buf.WriteString("<style>\n")
+	buf.WriteString(face("Editor Sans", fyne.TextStyle{}, "normal", "normal"))
+	buf.WriteString(face("Editor Sans", fyne.TextStyle{Bold: true}, "bold", "normal"))
+	buf.WriteString(face("Editor Sans", fyne.TextStyle{Italic: true}, "normal", "italic"))
+	buf.WriteString(face("Editor Sans", fyne.TextStyle{Bold: true, Italic: true}, "bold", "italic"))
+	buf.WriteString(face("Editor Mono", fyne.TextStyle{Monospace: true}, "normal", "normal"))
+	buf.WriteString(`body { font-family: "Editor Sans", sans-serif; }
+code, pre { font-family: "Editor Mono", monospace; }
+</style>
+`)
+	return buf.String()
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// preferenceHTMLTemplate stores the template used for HTML exports, a
+// built-in name or the path of the user's own template
+const preferenceHTMLTemplate = "htmlTemplate"
+
+// pageTemplateDefault is the template used when none has been chosen
+const pageTemplateDefault = "github"
+
+// pageTemplateChoices are the built-in templates, in menu order
+var pageTemplateChoices = []string{"github", "academic", "dark", "print"}
+
+// pageTemplateLabels name the built-in templates in the menu
+var pageTemplateLabels = map[string]string{
+	"github":   "GitHub",
+	"academic": "Academic",
+	"dark":     "Dark",
+	"print":    "Print-Friendly",
+}
+
+// pageTemplate is a layout for exported HTML pages
+type pageTemplate struct {
+	tmpl *template.Template
+	// dark pages highlight code with the dark color scheme when it follows
+	// the theme
+	dark bool
+}
+
+// pageData is what export templates are executed with
+type pageData struct {
+	// Title comes from the front matter, the first top-level heading, or
+	// else the file name
+	Title string
+	// Date is when the page was exported
+	Date time.Time
+	// Content is the whole document as HTML
+	Content template.HTML
+	// Body is the document without the heading that gave the title, for
+	// templates that show the title themselves
+	Body template.HTML
+	// Headings lists the top-level headings in document order
+	Headings []pageHeading
+	// TOC is a nested list of links to the headings after the title
+	TOC template.HTML
+	// CodeCSS is the stylesheet for code highlighted with CSS classes
+	CodeCSS template.CSS
+	// Head is markup for the head of the page that the document needs, such
+	// as the stylesheet for its formulas
+	Head template.HTML
+	// Meta holds the front matter fields by name
+	Meta map[string]any
+}
+
+// pageHeading is a heading as seen by export templates
+type pageHeading struct {
+	Level int
+	ID    string
+	Text  string
+	node  *ast.Heading
+}
+
+// pageFuncs are the functions export templates can call besides the
+// html/template ones
+var pageFuncs = template.FuncMap{
+	// format writes a front matter value as text, joining lists with commas
+	"format": formatMetaValue,
+}
+
+// builtinPageTemplates are parsed once, as they cannot change
+var builtinPageTemplates = map[string]*pageTemplate{
+	"github":   newBuiltinPageTemplate(githubPageCSS, contentPageBody, false),
+	"academic": newBuiltinPageTemplate(academicPageCSS, academicPageBody, false),
+	"dark":     newBuiltinPageTemplate(darkPageCSS, contentPageBody, true),
+	"print":    newBuiltinPageTemplate(printPageCSS, contentPageBody, false),
+}
+
+func newBuiltinPageTemplate(css, body string, dark bool) *pageTemplate {
+	tmpl := template.Must(template.New("page").Funcs(pageFuncs).Parse(pageLayout))
+	template.Must(tmpl.New("style").Parse(css))
+	template.Must(tmpl.New("body").Parse(body))
+	return &pageTemplate{tmpl: tmpl, dark: dark}
+}
+
+// isBuiltinPageTemplate reports whether a template choice names a built-in
+// template rather than a file
+func isBuiltinPageTemplate(choice string) bool {
+	_, ok := builtinPageTemplates[choice]
+	return ok
+}
+
+// loadPageTemplate returns a built-in template by name, or parses the
+// html/template file at a path
+func loadPageTemplate(choice string) (*pageTemplate, error) {
+	if choice == "" {
+		choice = pageTemplateDefault
+	}
+	if page, ok := builtinPageTemplates[choice]; ok {
+		return page, nil
+	}
+
+	data, err := os.ReadFile(choice)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no built-in template or file named %q", choice)
+	} else if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(choice)).Funcs(pageFuncs).Parse(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return &pageTemplate{tmpl: tmpl}, nil
+}
+
+// execute fills in the template for a rendered document
+func (p *pageTemplate) execute(data pageData) (string, error) {
+	var buf bytes.Buffer
+	if err := p.tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// pageHeadings lists the top-level headings of a document for templates
+func pageHeadings(source []byte, doc ast.Node) []pageHeading {
+	r := &richTextRenderer{source: source}
+	var headings []pageHeading
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		if heading, ok := child.(*ast.Heading); ok {
+			id, _ := heading.AttributeString("id")
+			idBytes, _ := id.([]byte)
+			headings = append(headings, pageHeading{
+				Level: heading.Level,
+				ID:    string(idBytes),
+				Text:  strings.TrimSpace(r.plainText(heading)),
+				node:  heading,
+			})
+		}
+	}
+	return headings
+}
+
+// tocHTML builds nested lists of links to headings, following the heading
+// levels even when some are skipped
+func tocHTML(headings []pageHeading) template.HTML {
+	var buf strings.Builder
+	var open []int
+	for _, heading := range headings {
+		if heading.ID == "" {
+			continue
+		}
+		for len(open) > 0 && open[len(open)-1] > heading.Level {
+			buf.WriteString("</li></ul>")
+			open = open[:len(open)-1]
+		}
+		if len(open) > 0 && open[len(open)-1] == heading.Level {
+			buf.WriteString("</li>")
+		} else {
+			buf.WriteString("<ul>")
+			open = append(open, heading.Level)
+		}
+		fmt.Fprintf(&buf, `<li><a href="#%s">%s</a>`,
+			template.HTMLEscapeString(heading.ID), template.HTMLEscapeString(heading.Text))
+	}
+	for range open {
+		buf.WriteString("</li></ul>")
+	}
+	return template.HTML(buf.String())
+}
+
+// pageLayout is the page shared by the built-in templates, which fill in
+// its style and body
+const pageLayout = `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>{{.Title}}</title>
+    <style>
+{{template "style" .}}{{.CodeCSS}}
+    </style>
+{{with .Head}}{{.}}
+{{end}}</head>
+<body>
+{{template "body" .}}
+</body>
+</html>
+`
+
+// contentPageBody shows the document as it is written
+const contentPageBody = `{{.Content}}`
+
+// academicPageBody sets the title, author, date and table of contents
+// apart before the text
+const academicPageBody = `<header>
+<h1 class="title">{{.Title}}</h1>
+{{with .Meta.author}}<p class="author">{{format .}}</p>
+{{end}}<p class="date">{{with .Meta.date}}{{format .}}{{else}}{{.Date.Format "2 January 2006"}}{{end}}</p>
+</header>
+{{with .TOC}}<nav class="toc">
+<h2>Contents</h2>
+{{.}}
+</nav>
+{{end}}<main>
+{{.Body}}
+</main>`
+
+// githubPageCSS is GitHub-like styling
+const githubPageCSS = `body {
+    font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif;
+    font-size: 16px;
+    line-height: 1.6;
+    color: #333;
+    background-color: #fff;
+    margin: 0;
+    padding: 20px;
+    max-width: 800px;
+    margin: 0 auto;
+}
+h1, h2, h3, h4, h5, h6 {
+    margin-top: 24px;
+    margin-bottom: 16px;
+    font-weight: 600;
+    line-height: 1.25;
+}
+h1 { font-size: 2em; border-bottom: 1px solid #eee; padding-bottom: 0.3em; }
+h2 { font-size: 1.5em; border-bottom: 1px solid #eee; padding-bottom: 0.3em; }
+h3 { font-size: 1.25em; }
+h4 { font-size: 1em; }
+h5 { font-size: 0.875em; }
+h6 { font-size: 0.85em; color: #777; }
+p { margin-top: 0; margin-bottom: 16px; }
+a { color: #0969da; text-decoration: none; }
+a:hover { text-decoration: underline; }
+code {
+    padding: 0.2em 0.4em;
+    margin: 0;
+    font-size: 85%;
+    background-color: rgba(27,31,35,0.05);
+    border-radius: 3px;
+    font-family: "SFMono-Regular", Consolas, "Liberation Mono", Menlo, monospace;
+}
+pre {
+    padding: 16px;
+    overflow: auto;
+    font-size: 85%;
+    line-height: 1.45;
+    background-color: #f6f8fa;
+    border-radius: 3px;
+}
+pre code {
+    display: inline;
+    padding: 0;
+    margin: 0;
+    border: 0;
+    background-color: transparent;
+}
+blockquote {
+    padding: 0 1em;
+    color: #6a737d;
+    border-left: 0.25em solid #dfe2e5;
+    margin: 0 0 16px 0;
+}
+ul, ol {
+    padding-left: 2em;
+    margin-top: 0;
+    margin-bottom: 16px;
+}
+li { margin-bottom: 0.25em; }
+table {
+    border-spacing: 0;
+    border-collapse: collapse;
+    margin-bottom: 16px;
+}
+table th, table td {
+    padding: 6px 13px;
+    border: 1px solid #dfe2e5;
+}
+table th {
+    font-weight: 600;
+    background-color: #f6f8fa;
+}
+table tr {
+    background-color: #fff;
+    border-top: 1px solid #c6cbd1;
+}
+table tr:nth-child(2n) {
+    background-color: #f6f8fa;
+}
+hr {
+    height: 0.25em;
+    padding: 0;
+    margin: 24px 0;
+    background-color: #e1e4e8;
+    border: 0;
+}
+img {
+    max-width: 100%;
+    box-sizing: content-box;
+}
+.task-list-item {
+    list-style-type: none;
+}
+.task-list-item input {
+    margin: 0 0.2em 0.25em -1.6em;
+    vertical-align: middle;
+}
+`
+
+// academicPageCSS sets a paper in a serif face with numbered sections
+const academicPageCSS = `body {
+    font-family: "Latin Modern Roman", "Computer Modern", Georgia, "Times New Roman", serif;
+    font-size: 17px;
+    line-height: 1.55;
+    color: #111;
+    background-color: #fff;
+    max-width: 42em;
+    margin: 0 auto;
+    padding: 3em 1.5em;
+}
+header { text-align: center; margin-bottom: 2.5em; }
+h1.title { font-size: 2em; font-weight: normal; margin: 0 0 0.5em 0; }
+.author { font-size: 1.15em; margin: 0.3em 0; }
+.date { font-style: italic; margin: 0.3em 0; }
+.toc { margin-bottom: 2.5em; }
+.toc h2 { font-size: 1.1em; text-transform: uppercase; letter-spacing: 0.1em; }
+.toc ul { list-style: none; padding-left: 1.5em; margin: 0; }
+.toc > ul { padding-left: 0; }
+.toc a { color: inherit; text-decoration: none; }
+main { counter-reset: section; text-align: justify; hyphens: auto; }
+main h1, main h2, main h3, main h4, main h5, main h6 { font-weight: bold; text-align: left; margin: 1.8em 0 0.6em 0; line-height: 1.3; }
+main h1 { font-size: 1.5em; }
+main h2 { font-size: 1.3em; counter-reset: subsection; }
+main h3 { font-size: 1.1em; }
+main h4, main h5, main h6 { font-size: 1em; font-style: italic; }
+main h2::before { counter-increment: section; content: counter(section) ". "; }
+main h3::before { counter-increment: subsection; content: counter(section) "." counter(subsection) " "; }
+p { margin: 0 0 1em 0; }
+a { color: #1a4d8f; }
+blockquote { margin: 1em 2em; font-style: italic; }
+code { font-family: "Latin Modern Mono", Menlo, Consolas, monospace; font-size: 0.9em; }
+pre { padding: 1em; overflow: auto; font-size: 0.85em; line-height: 1.4; border: 1px solid #ddd; }
+table { border-collapse: collapse; margin: 1.5em auto; border-top: 2px solid #111; border-bottom: 2px solid #111; }
+table th { border-bottom: 1px solid #111; }
+table th, table td { padding: 0.3em 0.9em; }
+hr { border: 0; border-top: 1px solid #999; margin: 2em 25%; }
+img { max-width: 100%; display: block; margin: 1em auto; }
+.task-list-item { list-style-type: none; }
+.task-list-item input { margin: 0 0.3em 0.25em -1.4em; vertical-align: middle; }
+`
+
+// darkPageCSS is GitHub-like styling on a dark background
+const darkPageCSS = `body {
+    font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif;
+    font-size: 16px;
+    line-height: 1.6;
+    color: #c9d1d9;
+    background-color: #0d1117;
+    max-width: 800px;
+    margin: 0 auto;
+    padding: 20px;
+}
+h1, h2, h3, h4, h5, h6 { margin-top: 24px; margin-bottom: 16px; font-weight: 600; line-height: 1.25; color: #e6edf3; }
+h1 { font-size: 2em; border-bottom: 1px solid #21262d; padding-bottom: 0.3em; }
+h2 { font-size: 1.5em; border-bottom: 1px solid #21262d; padding-bottom: 0.3em; }
+h3 { font-size: 1.25em; }
+h4 { font-size: 1em; }
+h5 { font-size: 0.875em; }
+h6 { font-size: 0.85em; color: #8b949e; }
+p { margin-top: 0; margin-bottom: 16px; }
+a { color: #58a6ff; text-decoration: none; }
+a:hover { text-decoration: underline; }
+code {
+    padding: 0.2em 0.4em;
+    font-size: 85%;
+    background-color: rgba(110,118,129,0.4);
+    border-radius: 6px;
+    font-family: "SFMono-Regular", Consolas, "Liberation Mono", Menlo, monospace;
+}
+pre { padding: 16px; overflow: auto; font-size: 85%; line-height: 1.45; background-color: #161b22; border-radius: 6px; }
+pre code { display: inline; padding: 0; margin: 0; border: 0; background-color: transparent; }
+blockquote { padding: 0 1em; color: #8b949e; border-left: 0.25em solid #30363d; margin: 0 0 16px 0; }
+ul, ol { padding-left: 2em; margin-top: 0; margin-bottom: 16px; }
+li { margin-bottom: 0.25em; }
+table { border-spacing: 0; border-collapse: collapse; margin-bottom: 16px; }
+table th, table td { padding: 6px 13px; border: 1px solid #30363d; }
+table th { font-weight: 600; background-color: #161b22; }
+table tr { background-color: #0d1117; border-top: 1px solid #21262d; }
+table tr:nth-child(2n) { background-color: #161b22; }
+hr { height: 0.25em; padding: 0; margin: 24px 0; background-color: #30363d; border: 0; }
+img { max-width: 100%; box-sizing: content-box; }
+.task-list-item { list-style-type: none; }
+.task-list-item input { margin: 0 0.2em 0.25em -1.6em; vertical-align: middle; }
+`
+
+// printPageCSS suits paper: black text, no backgrounds, link addresses
+// written out and no breaks inside code, tables or images
+const printPageCSS = `@page { margin: 2cm; }
+body {
+    font-family: Georgia, "Times New Roman", serif;
+    font-size: 11pt;
+    line-height: 1.5;
+    color: #000;
+    background-color: #fff;
+    margin: 0;
+}
+h1, h2, h3, h4, h5, h6 { font-family: "Helvetica Neue", Helvetica, Arial, sans-serif; line-height: 1.25; margin: 1.4em 0 0.5em 0; page-break-after: avoid; break-after: avoid; }
+h1 { font-size: 20pt; }
+h2 { font-size: 16pt; }
+h3 { font-size: 13pt; }
+h4, h5, h6 { font-size: 11pt; }
+p { margin: 0 0 0.8em 0; orphans: 3; widows: 3; }
+a { color: #000; text-decoration: underline; }
+a[href^="http"]::after { content: " (" attr(href) ")"; font-size: 90%; word-break: break-all; }
+code { font-family: "Courier New", Courier, monospace; font-size: 10pt; }
+pre { font-size: 9pt; line-height: 1.35; white-space: pre-wrap; border: 1px solid #999; padding: 0.6em; }
+pre, blockquote, table, img, figure { page-break-inside: avoid; break-inside: avoid; }
+blockquote { margin: 0 0 0.8em 0; padding-left: 1em; border-left: 3px solid #999; font-style: italic; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+table th, table td { border: 1px solid #000; padding: 4px 8px; }
+hr { border: 0; border-top: 1px solid #000; }
+img { max-width: 100%; }
+.task-list-item { list-style-type: none; }
+.task-list-item input { margin: 0 0.2em 0.25em -1.6em; vertical-align: middle; }
+`
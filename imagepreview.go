@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/fyne-io/oksvg"
+)
+
+// previewImage is a local image decoded for the preview
+type previewImage struct {
+	modified time.Time
+	size     int64
+	// img is the decoded picture, or nil for SVG, which is kept as a
+	// resource so that it is drawn sharp at any size
+	img      image.Image
+	resource fyne.Resource
+	width    float32
+	height   float32
+}
+
+// previewImages keeps decoded images by path, as the preview renders every
+// block again whenever the document changes
+var previewImages = struct {
+	sync.Mutex
+	images map[string]*previewImage
+}{images: make(map[string]*previewImage)}
+
+// loadPreviewImage decodes a PNG, JPEG, GIF or SVG file, or returns the copy
+// decoded before if the file has not changed since
+func loadPreviewImage(path string) (*previewImage, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	previewImages.Lock()
+	defer previewImages.Unlock()
+	if cached, ok := previewImages.images[path]; ok && cached.modified.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	loaded := &previewImage{modified: info.ModTime(), size: info.Size()}
+	if strings.EqualFold(filepath.Ext(path), ".svg") {
+		icon, err := oksvg.ReadIconStream(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 {
+			return nil, errors.New("the SVG has no size")
+		}
+		loaded.resource = fyne.NewStaticResource(filepath.Base(path), data)
+		loaded.width, loaded.height = float32(icon.ViewBox.W), float32(icon.ViewBox.H)
+	} else {
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		bounds := img.Bounds()
+		loaded.img = img
+		loaded.width, loaded.height = float32(bounds.Dx()), float32(bounds.Dy())
+	}
+
+	if len(previewImages.images) >= 64 {
+		clear(previewImages.images)
+	}
+	previewImages.images[path] = loaded
+	return loaded, nil
+}
+
+// canvasImage returns the image at its natural size, which the preview
+// shrinks to the width of the pane
+func (p *previewImage) canvasImage() *canvas.Image {
+	var img *canvas.Image
+	if p.resource != nil {
+		img = canvas.NewImageFromResource(p.resource)
+	} else {
+		img = canvas.NewImageFromImage(p.img)
+	}
+	img.FillMode = canvas.ImageFillContain
+	img.SetMinSize(fyne.NewSize(p.width, p.height))
+	return img
+}
+
+// renderImage returns the segment for an image. Local images are loaded
+// relative to dir, others are left for the preview to fetch.
+func renderImage(destination, alt, dir string, style inlineStyle) []widget.RichTextSegment {
+	path, err := localAssetPath(destination, dir)
+	if errors.Is(err, errNotLocal) {
+		uri, err := storage.ParseURI(destination)
+		if err != nil {
+			style.text.Italic = true
+			return []widget.RichTextSegment{style.segment("[" + alt + "]")}
+		}
+		return []widget.RichTextSegment{&widget.ImageSegment{Source: uri, Title: alt}}
+	}
+	if err == nil {
+		_, err = loadPreviewImage(path)
+	}
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		err = errors.New("the file does not exist")
+	case errors.Is(err, image.ErrFormat):
+		err = errors.New("the file is not a PNG, JPEG, GIF or SVG image")
+	}
+	if err != nil {
+		return []widget.RichTextSegment{&brokenImageSegment{destination: destination, reason: err.Error()}}
+	}
+	return []widget.RichTextSegment{&imageSegment{path: path, alt: alt}}
+}
+
+// imageSegment is a local image in the preview, centered in the width of
+// the preview and shrunk to fit it
+type imageSegment struct {
+	path, alt string
+}
+
+// image returns the picture, or an empty one if the file went away since
+// the preview was rendered
+func (s *imageSegment) image() *canvas.Image {
+	loaded, err := loadPreviewImage(s.path)
+	if err != nil {
+		fyne.LogError("Failed to load image", err)
+		return canvas.NewImageFromResource(nil)
+	}
+	return loaded.canvasImage()
+}
+
+// Inline returns false as an image is shown as a block of its own
+func (s *imageSegment) Inline() bool {
+	return false
+}
+
+// Textual returns the description of the image
+func (s *imageSegment) Textual() string {
+	return s.alt
+}
+
+// Visual returns the image centered in the width of the preview
+func (s *imageSegment) Visual() fyne.CanvasObject {
+	b := &imageBlock{image: s.image()}
+	b.ExtendBaseWidget(b)
+	return b
+}
+
+// Update loads the image again, as the file may have changed
+func (s *imageSegment) Update(o fyne.CanvasObject) {
+	b := o.(*imageBlock)
+	img := s.image()
+	b.image.Image, b.image.Resource = img.Image, img.Resource
+	b.image.SetMinSize(img.MinSize())
+	b.Refresh()
+}
+
+// Select does nothing as the preview text cannot be selected
+func (s *imageSegment) Select(_, _ fyne.Position) {}
+
+// SelectedText returns an empty string as the preview text cannot be selected
+func (s *imageSegment) SelectedText() string {
+	return ""
+}
+
+// Unselect does nothing as the preview text cannot be selected
+func (s *imageSegment) Unselect() {}
+
+// brokenImageSegment stands in for an image that could not be loaded,
+// showing its path and why
+type brokenImageSegment struct {
+	destination, reason string
+}
+
+// Inline returns false as the placeholder is shown as a block of its own
+func (s *brokenImageSegment) Inline() bool {
+	return false
+}
+
+// Textual returns the path of the image
+func (s *brokenImageSegment) Textual() string {
+	return s.destination
+}
+
+// Visual returns a broken image icon next to the path and the reason
+func (s *brokenImageSegment) Visual() fyne.CanvasObject {
+	label := widget.NewLabel("")
+	label.Wrapping = fyne.TextWrapWord
+	label.Importance = widget.LowImportance
+	placeholder := container.NewBorder(nil, nil, widget.NewIcon(theme.BrokenImageIcon()), nil, label)
+	s.Update(placeholder)
+	return placeholder
+}
+
+// Update shows the path and reason of this placeholder
+func (s *brokenImageSegment) Update(o fyne.CanvasObject) {
+	for _, child := range o.(*fyne.Container).Objects {
+		if label, ok := child.(*widget.Label); ok {
+			label.SetText(s.destination + "\n" + s.reason)
+		}
+	}
+}
+
+// Select does nothing as the preview text cannot be selected
+func (s *brokenImageSegment) Select(_, _ fyne.Position) {}
+
+// SelectedText returns an empty string as the preview text cannot be selected
+func (s *brokenImageSegment) SelectedText() string {
+	return ""
+}
+
+// Unselect does nothing as the preview text cannot be selected
+func (s *brokenImageSegment) Unselect() {}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// instanceRequest is sent by a new launch to the editor that is already running
+type instanceRequest struct {
+	Targets []openTarget `json:"targets"`
+}
+
+// instanceSocketPath returns the local socket a running editor listens on
+func instanceSocketPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "fynemd", "instance.sock")
+}
+
+// forwardToRunningInstance asks an editor that is already running to open the
+// targets, reporting whether one accepted them
+func forwardToRunningInstance(targets []openTarget) bool {
+	conn, err := net.DialTimeout("unix", instanceSocketPath(), time.Second)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if err := json.NewEncoder(conn).Encode(instanceRequest{Targets: targets}); err != nil {
+		return false
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	return err == nil && strings.TrimSpace(reply) == "ok"
+}
+
+// InstanceServer accepts files to open from later launches of the editor,
+// so that they reuse this window instead of starting another process
+type InstanceServer struct {
+	listener net.Listener
+}
+
+// ListenForInstances starts listening on the instance socket
+func ListenForInstances() (*InstanceServer, error) {
+	path := instanceSocketPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	// A socket left here did not answer forwardToRunningInstance, so it is stale
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &InstanceServer{listener: listener}, nil
+}
+
+// Serve hands each forwarded request to open on the UI thread
+func (s *InstanceServer) Serve(open func([]openTarget)) {
+	go func() {
+		for {
+			conn, err := s.listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn, open)
+		}
+	}()
+}
+
+func (s *InstanceServer) handle(conn net.Conn, open func([]openTarget)) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	var request instanceRequest
+	if err := json.NewDecoder(conn).Decode(&request); err != nil {
+		fyne.LogError("Invalid request from another instance", err)
+		return
+	}
+
+	fyne.Do(func() {
+		open(request.Targets)
+	})
+	conn.Write([]byte("ok\n"))
+}
+
+// Close stops accepting requests and removes the socket
+func (s *InstanceServer) Close() {
+	s.listener.Close()
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// katexVersion is the KaTeX release that is bundled and loaded from the CDN
+const katexVersion = "0.16.11"
+
+//go:generate go run ./tools/fetchkatex -version 0.16.11 -out katex
+
+// katexFiles is the bundled copy of KaTeX, fetched by go generate
+//
+//go:embed katex
+var katexFiles embed.FS
+
+// katexBundled is the katexLocation that inlines the bundled copy of KaTeX
+// in the page, so that it typesets math without the web
+const katexBundled = "bundled"
+
+// errKaTeXNotBundled is returned for the bundled option by builds made
+// without fetching KaTeX first
+var errKaTeXNotBundled = errors.New("this build does not include KaTeX; run go generate before building to bundle it")
+
+// katexIsBundled reports whether the build includes KaTeX
+func katexIsBundled() bool {
+	_, err := fs.Stat(katexFiles, "katex/katex.min.css")
+	return err == nil
+}
+
+// inlineKaTeXHead returns the head markup that inlines the KaTeX release in
+// the katex folder of files: its stylesheet with the fonts as data URIs,
+// and its scripts
+func inlineKaTeXHead(files fs.FS) (string, error) {
+	var texts [3]string
+	for i, name := range []string{"katex.min.css", "katex.min.js", "contrib/auto-render.min.js"} {
+		data, err := fs.ReadFile(files, "katex/"+name)
+		if err != nil {
+			return "", errKaTeXNotBundled
+		}
+		texts[i] = string(data)
+	}
+
+	// Only the WOFF2 fonts are bundled, which every current browser reads,
+	// so the other formats are left for the browser to skip
+	css := cssURL.ReplaceAllStringFunc(texts[0], func(match string) string {
+		ref := strings.TrimSpace(cssURL.FindStringSubmatch(match)[2])
+		data, err := fs.ReadFile(files, path.Join("katex", ref))
+		if err != nil {
+			return match
+		}
+		return `url("` + encodeDataURI("font/woff2", data) + `")`
+	})
+
+	// A closing tag in the scripts would end the element early
+	script := func(js string) string {
+		return "<script>" + strings.ReplaceAll(js, "</script", `<\/script`) + "</script>\n"
+	}
+	return "<style>" + strings.ReplaceAll(css, "</style", `<\/style`) + "</style>\n" +
+		script(texts[1]) + script(texts[2]) +
+		`<script>document.addEventListener("DOMContentLoaded", function () { renderMathInElement(document.body); });</script>`, nil
+}
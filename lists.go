@@ -0,0 +1,331 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// listPrefixPattern matches the block quote markers, indent, bullet or
+// number and task box at the start of a list item
+var listPrefixPattern = regexp.MustCompile(`^((?: {0,3}>[ \t]?)*)([ \t]*)(?:([-*+])|([0-9]{1,9})([.)]))([ \t]+|$)(\[[ xX]\](?:[ \t]+|$))?`)
+
+// quotePattern matches the block quote markers at the start of a line
+var quotePattern = regexp.MustCompile(`^(?: {0,3}>[ \t]?)+`)
+
+// thematicBreakPattern matches a horizontal rule, which looks like a bullet
+var thematicBreakPattern = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+
+// listPrefix is the start of a line in a list or block quote, which Enter
+// carries on to the next line
+type listPrefix struct {
+	// quote is the > of any enclosing block quotes, with their spaces
+	quote string
+	// indent is the white space before the bullet or number
+	indent string
+	// bullet is -, * or + for a bullet item
+	bullet string
+	// number and delimiter are set for an ordered item, as in 3. or 3),
+	// and digits is how many digits the number was written with
+	number    int
+	digits    int
+	delimiter string
+	// space is the white space after the bullet or number
+	space string
+	// task is the box of a task item, as [ ] or [x]
+	task string
+	// width is the length of the marker in runes, up to the item text
+	width int
+}
+
+// parseListPrefix returns the list item or block quote a line starts with
+func parseListPrefix(line string) (listPrefix, bool) {
+	if loc := listPrefixPattern.FindStringSubmatchIndex(line); loc != nil {
+		group := func(i int) string {
+			if loc[2*i] < 0 {
+				return ""
+			}
+			return line[loc[2*i]:loc[2*i+1]]
+		}
+		m := listPrefix{
+			quote:     group(1),
+			indent:    group(2),
+			bullet:    group(3),
+			delimiter: group(5),
+			space:     group(6),
+			task:      strings.TrimRight(group(7), " \t"),
+			width:     loc[1],
+		}
+		if !thematicBreakPattern.MatchString(line[len(m.quote):]) {
+			m.number, _ = strconv.Atoi(group(4))
+			m.digits = len(group(4))
+			return m, true
+		}
+	}
+	if quote := quotePattern.FindString(line); quote != "" {
+		return listPrefix{quote: quote, width: len(quote)}, true
+	}
+	return listPrefix{}, false
+}
+
+// item reports whether the marker is a list item rather than only a quote
+func (m listPrefix) item() bool {
+	return m.bullet != "" || m.delimiter != ""
+}
+
+// ordered reports whether the marker is a numbered list item
+func (m listPrefix) ordered() bool {
+	return m.delimiter != ""
+}
+
+// next returns the marker for a new item after this one, with the next
+// number and an unchecked box
+func (m listPrefix) next() string {
+	if !m.item() {
+		return m.quote
+	}
+	marker := m.bullet
+	if m.ordered() {
+		marker = strconv.Itoa(m.number+1) + m.delimiter
+	}
+	space := m.space
+	if space == "" {
+		space = " "
+	}
+	next := m.quote + m.indent + marker + space
+	if m.task != "" {
+		next += "[ ] "
+	}
+	return next
+}
+
+// end returns what is left of the line when an empty item ends its list:
+// the quote around the list, or the quote around an empty quote line
+func (m listPrefix) end() string {
+	if m.item() {
+		return m.quote
+	}
+	return m.quote[:strings.LastIndexByte(m.quote, '>')]
+}
+
+// childIndent returns the indent that nests an item under this one, lining
+// it up with the text of this item
+func (m listPrefix) childIndent() string {
+	marker := len(m.bullet) + m.digits + len(m.delimiter)
+	return m.indent + strings.Repeat(" ", marker+max(len(m.space), 1))
+}
+
+// indentWidth returns how many columns leading white space takes up
+func indentWidth(indent string) int {
+	width := 0
+	for _, r := range indent {
+		if r == '\t' {
+			width += tabWidth - width%tabWidth
+		} else {
+			width++
+		}
+	}
+	return width
+}
+
+// lineIndent splits a line into its quote markers and the white space after them
+func lineIndent(line string) (quote, indent string) {
+	quote = quotePattern.FindString(line)
+	rest := line[len(quote):]
+	return quote, rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+}
+
+// listParent returns the item that a list item at row is nested in, or the
+// item before it at the same level, looking back no further than the list
+func listParent(line func(int) string, row int, sibling bool) (listPrefix, bool) {
+	m, _ := parseListPrefix(line(row))
+	width := indentWidth(m.indent)
+	for r := row - 1; r >= 0; r-- {
+		text := line(r)
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		above, ok := parseListPrefix(text)
+		quote, indent := lineIndent(text)
+		if quote != m.quote {
+			return listPrefix{}, false
+		}
+		if !ok || !above.item() {
+			// Text indented under an item belongs to it, anything else ends the list
+			if indent == "" {
+				return listPrefix{}, false
+			}
+			continue
+		}
+		aboveWidth := indentWidth(above.indent)
+		if (sibling && aboveWidth == width) || (!sibling && aboveWidth < width) {
+			return above, true
+		}
+		if aboveWidth < width {
+			return listPrefix{}, false
+		}
+	}
+	return listPrefix{}, false
+}
+
+// numberChange is a list item number that renumbering changes
+type numberChange struct {
+	row int
+	// start and end are the columns of the number
+	start, end int
+	number     string
+}
+
+// renumberLimit stops renumbering from looking through very long lists
+const renumberLimit = 5000
+
+// renumberLists numbers the ordered lists that the rows from first to last
+// are in, which were just edited, the way each list was numbered before:
+// one after another from the number of its first item, or all with the
+// same number. Lists numbered some other way are left alone. Nested lists
+// are numbered on their own.
+func renumberLists(line func(int) string, count, first, last int) []numberChange {
+	inList := func(row int) bool {
+		text := line(row)
+		if strings.TrimSpace(text) == "" {
+			return true
+		}
+		if m, ok := parseListPrefix(text); ok && m.item() {
+			return true
+		}
+		_, indent := lineIndent(text)
+		return indent != ""
+	}
+	from, to := first, last
+	for limit := renumberLimit; from > 0 && limit > 0 && inList(from-1); limit-- {
+		from--
+	}
+	for limit := renumberLimit; to < count-1 && limit > 0 && inList(to+1); limit-- {
+		to++
+	}
+
+	type listLevel struct {
+		quote     string
+		indent    int
+		delimiter string
+		items     []listItem
+	}
+	var levels []listLevel
+	var changes []numberChange
+	end := func(level listLevel) {
+		if level.delimiter != "" {
+			changes = append(changes, numberList(level.items, first, last)...)
+		}
+	}
+	fence := ""
+	for row := from; row <= to; row++ {
+		text := line(row)
+		quote, indent := lineIndent(text)
+		rest := text[len(quote)+len(indent):]
+		if rest == "" {
+			continue
+		}
+
+		// Numbers in code blocks are left alone
+		if fence != "" {
+			if strings.HasPrefix(rest, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(rest, "```") || strings.HasPrefix(rest, "~~~") {
+			fence = rest[:3]
+			continue
+		}
+
+		m, ok := parseListPrefix(text)
+		isItem := ok && m.item()
+		width := indentWidth(indent)
+		// A line ends the lists it is not indented under
+		for len(levels) > 0 {
+			top := levels[len(levels)-1]
+			if top.quote == quote && (width > top.indent || (width == top.indent && isItem && top.delimiter == m.delimiter)) {
+				break
+			}
+			end(top)
+			levels = levels[:len(levels)-1]
+		}
+		if !isItem {
+			continue
+		}
+
+		item := listItem{
+			row:    row,
+			start:  len(m.quote) + len(m.indent),
+			digits: m.digits,
+			number: m.number,
+		}
+		if n := len(levels); n > 0 && levels[n-1].indent == width {
+			levels[n-1].items = append(levels[n-1].items, item)
+			continue
+		}
+		levels = append(levels, listLevel{quote: quote, indent: width, delimiter: m.delimiter, items: []listItem{item}})
+	}
+	for i := len(levels) - 1; i >= 0; i-- {
+		end(levels[i])
+	}
+
+	sort.Slice(changes, func(a, b int) bool { return changes[a].row < changes[b].row })
+	return changes
+}
+
+// listItem is an item of an ordered list being renumbered
+type listItem struct {
+	row int
+	// start is the column of the number, written with digits digits
+	start, digits int
+	number        int
+}
+
+// numberList returns the changes that number the items of one list the way
+// the items outside the rows from first to last, which were just edited,
+// are numbered
+func numberList(items []listItem, first, last int) []numberChange {
+	edited := func(item listItem) bool { return item.row >= first && item.row <= last }
+	var kept []listItem
+	same := true
+	for _, item := range items {
+		if edited(item) {
+			continue
+		}
+		if len(kept) > 0 && item.number != kept[0].number {
+			same = false
+		}
+		kept = append(kept, item)
+	}
+
+	// Items count up one after another unless an edit came between them
+	sequential := true
+	for i := 1; i < len(items); i++ {
+		between := items[i-1].row <= last && items[i].row >= first
+		if !between && items[i].number != items[i-1].number+1 {
+			sequential = false
+		}
+	}
+	number := func(i int) int { return items[0].number + i }
+	if len(kept) >= 2 && same {
+		// A list written with one number throughout keeps it, as in 1. 1. 1.
+		number = func(int) int { return kept[0].number }
+	} else if !sequential {
+		return nil
+	}
+
+	var changes []numberChange
+	for i, item := range items {
+		if n := number(i); n != item.number {
+			changes = append(changes, numberChange{
+				row:    item.row,
+				start:  item.start,
+				end:    item.start + item.digits,
+				number: strconv.Itoa(n),
+			})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/test"
+)
+
+func TestRenumberLists(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		first, last int
+		want        string
+	}{
+		{name: "new item", text: "1. a\n2. b\n3. new\n3. c\n4. d", first: 2, last: 2, want: "1. a\n2. b\n3. new\n4. c\n5. d"},
+		{name: "removed item", text: "1. a\n2. b\n4. d\n5. e", first: 2, last: 2, want: "1. a\n2. b\n3. d\n4. e"},
+		{name: "starts past one", text: "3) a\n5) new\n4) b", first: 1, last: 1, want: "3) a\n4) new\n5) b"},
+		{name: "same number", text: "1. a\n1. b\n2. new\n1. c", first: 2, last: 2, want: "1. a\n1. b\n1. new\n1. c"},
+		{name: "other numbering", text: "1. a\n5. b\n9. c\n10. new", first: 3, last: 3, want: "1. a\n5. b\n9. c\n10. new"},
+		{name: "nested", text: "1. a\n   1. x\n   3. y\n2. b\n3. c", first: 2, last: 2, want: "1. a\n   1. x\n   2. y\n2. b\n3. c"},
+		{name: "item moved out", text: "1. a\n   b\n3. c", first: 1, last: 1, want: "1. a\n   b\n2. c"},
+		{name: "code block", text: "1. a\n3. b\n```\n7. code\n```", first: 1, last: 1, want: "1. a\n2. b\n```\n7. code\n```"},
+		{name: "bullets", text: "- a\n- b", first: 1, last: 1, want: "- a\n- b"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := strings.Split(test.text, "\n")
+			line := func(row int) string { return lines[row] }
+			for _, change := range renumberLists(line, len(lines), test.first, test.last) {
+				lines[change.row] = lines[change.row][:change.start] + change.number + lines[change.row][change.end:]
+			}
+			if got := strings.Join(lines, "\n"); got != test.want {
+				t.Errorf("renumbered to %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSourceEntryLists(t *testing.T) {
+	test.NewApp()
+	// The cursor is written as | in the text before and after the key
+	tests := []struct {
+		name string
+		text string
+		key  fyne.KeyName
+		// shift is held for Shift+Tab
+		shift bool
+		want  string
+	}{
+		{name: "bullet", text: "- a|", key: fyne.KeyReturn, want: "- a\n- |"},
+		{name: "task", text: "- [x] done|", key: fyne.KeyReturn, want: "- [x] done\n- [ ] |"},
+		{name: "quote", text: "> a|", key: fyne.KeyReturn, want: "> a\n> |"},
+		{name: "split item", text: "- a| b", key: fyne.KeyReturn, want: "- a\n- |b"},
+		{name: "numbered", text: "1. a|\n2. b", key: fyne.KeyReturn, want: "1. a\n2. |\n3. b"},
+		{name: "same number", text: "1. a\n1. b|", key: fyne.KeyReturn, want: "1. a\n1. b\n1. |"},
+		{name: "empty item ends list", text: "1. a\n2. |", key: fyne.KeyReturn, want: "1. a\n|"},
+		{name: "empty quote line", text: "> > |", key: fyne.KeyReturn, want: "> |"},
+		{name: "before marker", text: "|- a", key: fyne.KeyReturn, want: "\n|- a"},
+		{name: "tab nests", text: "1. a\n2. b|\n3. c", key: fyne.KeyTab, want: "1. a\n   1. b|\n2. c"},
+		{name: "tab nests bullet", text: "- a\n- b|", key: fyne.KeyTab, want: "- a\n  - b|"},
+		{name: "tab moves sub-items", text: "- a\n- b|\n  - c", key: fyne.KeyTab, want: "- a\n  - b|\n    - c"},
+		{name: "tab in text", text: "a|", key: fyne.KeyTab, want: "a\t|"},
+		{name: "shift tab", text: "1. a\n   1. b|\n2. c", key: fyne.KeyTab, shift: true, want: "1. a\n2. b|\n3. c"},
+		{name: "shift tab bullet", text: "- a\n  - b|", key: fyne.KeyTab, shift: true, want: "- a\n- b|"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := NewSourceEntry()
+			cursor := strings.Index(test.text, "|")
+			e.SetText(strings.Replace(test.text, "|", "", 1))
+			e.SetCursor(e.PositionOf(len([]rune(test.text[:cursor]))))
+			if test.shift {
+				e.KeyDown(&fyne.KeyEvent{Name: desktop.KeyShiftLeft})
+			}
+			e.TypedKey(&fyne.KeyEvent{Name: test.key})
+
+			row, column := e.CursorPosition()
+			got := []rune(e.Text())
+			offset := e.OffsetOf(row, column)
+			if got := string(got[:offset]) + "|" + string(got[offset:]); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+
+			// The edit and any renumbering are undone together
+			e.Undo()
+			if got := e.Text(); got != strings.Replace(test.text, "|", "", 1) {
+				t.Errorf("undone to %q", got)
+			}
+		})
+	}
+}
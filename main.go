@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
@@ -8,8 +11,29 @@ import (
 )
 
 func main() {
+	// Subcommands such as render run headless, without starting Fyne
+	if handled, code := runCommand(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); handled {
+		os.Exit(code)
+	}
+
+	launch, err := parseLaunchArgs(os.Args[1:], os.Stderr)
+	if err != nil {
+		os.Exit(exitUsage)
+	}
+
+	// Reuse an editor that is already running unless asked for a new window
+	var instance *InstanceServer
+	if !launch.newWindow {
+		if forwardToRunningInstance(launch.targets) {
+			return
+		}
+		if instance, err = ListenForInstances(); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not listen for other instances:", err)
+		}
+	}
+
 	// Create application
-	myApp := app.New()
+	myApp := app.NewWithID("com.github.nattie-nkosi.markdown")
 	myApp.Settings().SetTheme(&myTheme{})
 
 	// Create main window
@@ -20,13 +44,27 @@ func main() {
 	// Create application controller
 	appController := NewAppController(window)
 
-	// Create UI components
-	editor := NewEditor(appController)
-	preview := NewPreview()
+	// Create status bar
+	statusBar := NewStatusBar()
+	appController.SetStatusBar(statusBar)
+
+	// Create the document tabs, each with its own editor and preview
+	tabs := appController.CreateTabs()
+
+	// Create the files of the workspace folder
+	workspace := NewWorkspace(appController)
+	workspacePanel := workspace.Create()
+	appController.SetWorkspace(workspace)
+
+	// Create the outline of the active document
+	outline := NewOutline(appController)
+	outlinePanel := outline.Create()
+	appController.SetOutline(outline)
 
-	// Set up the controller
-	appController.SetEditor(editor)
-	appController.SetPreview(preview)
+	// Create the panel that finds and replaces across a folder
+	searchPanel := NewSearchPanel(appController)
+	searchPanelContent := searchPanel.Create()
+	appController.SetSearchPanel(searchPanel)
 
 	// Create menu
 	menu := NewMenu(appController)
@@ -35,20 +73,13 @@ func main() {
 	// Create toolbar
 	toolbar := NewToolbar(appController)
 
-	// Create status bar
-	statusBar := NewStatusBar()
-	appController.SetStatusBar(statusBar)
-
 	// Layout the application
 	content := container.NewBorder(
 		toolbar.Create(),
 		statusBar.Create(),
-		nil,
-		nil,
-		container.NewHSplit(
-			editor.Create(),
-			preview.Create(),
-		),
+		container.NewHBox(workspacePanel, outlinePanel),
+		searchPanelContent,
+		tabs,
 	)
 
 	window.SetContent(content)
@@ -78,29 +109,78 @@ func main() {
 		appController.SaveAs()
 	})
 	
+	window.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName: fyne.KeyW, Modifier: fyne.KeyModifierControl,
+	}, func(shortcut fyne.Shortcut) {
+		appController.CloseTab()
+	})
+	
 	window.Canvas().AddShortcut(&desktop.CustomShortcut{
 		KeyName: fyne.KeyF, Modifier: fyne.KeyModifierControl,
 	}, func(shortcut fyne.Shortcut) {
 		appController.ShowFind()
 	})
 	
+	window.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName: fyne.KeyG, Modifier: fyne.KeyModifierControl,
+	}, func(shortcut fyne.Shortcut) {
+		appController.FindNext()
+	})
+	
+	window.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName: fyne.KeyG, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift,
+	}, func(shortcut fyne.Shortcut) {
+		appController.FindPrevious()
+	})
+	
 	window.Canvas().AddShortcut(&desktop.CustomShortcut{
 		KeyName: fyne.KeyH, Modifier: fyne.KeyModifierControl,
 	}, func(shortcut fyne.Shortcut) {
 		appController.ShowReplace()
 	})
 	
+	window.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName: fyne.KeyF, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift,
+	}, func(shortcut fyne.Shortcut) {
+		appController.ShowFindInFolder()
+	})
+	
 	window.Canvas().AddShortcut(&desktop.CustomShortcut{
 		KeyName: fyne.KeyP, Modifier: fyne.KeyModifierControl,
 	}, func(shortcut fyne.Shortcut) {
 		appController.TogglePreview()
 	})
+	
+	window.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName: fyne.KeyO, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift,
+	}, func(shortcut fyne.Shortcut) {
+		appController.ToggleOutline()
+	})
+	
+	window.Canvas().AddShortcut(&desktop.CustomShortcut{
+		KeyName: fyne.KeyE, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift,
+	}, func(shortcut fyne.Shortcut) {
+		appController.ToggleWorkspace()
+	})
 
 	// Handle window close
 	window.SetCloseIntercept(func() {
 		appController.HandleClose()
 	})
 
+	// Protect unsaved work and offer anything left over from a crash
+	appController.StartAutosave()
+	appController.RestoreRecovered()
+
+	// Carry on from the last session, then open files from the command line
+	// and from later launches
+	appController.RestoreSession()
+	appController.OpenTargets(launch.targets)
+	if instance != nil {
+		instance.Serve(appController.OpenLaunch)
+		defer instance.Close()
+	}
+
 	// Show and run
 	window.ShowAndRun()
 }
\ No newline at end of file
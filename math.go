@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Preference keys for math in exported HTML
+const (
+	preferenceMathKaTeX     = "mathKaTeX"
+	preferenceKaTeXLocation = "katexLocation"
+)
+
+// katexCDN is where KaTeX is loaded from unless the bundled or a local copy
+// is chosen
+const katexCDN = "https://cdn.jsdelivr.net/npm/katex@" + katexVersion + "/dist"
+
+// mathOptions describes how math is written in exported HTML
+type mathOptions struct {
+	// katex leaves the TeX for KaTeX to typeset in the browser, rather than
+	// writing MathML
+	katex bool
+	// katexLocation is the web address or local folder of a KaTeX release,
+	// katexBundled for the copy built into the editor, or "" for the CDN
+	katexLocation string
+}
+
+// Node kinds of math
+var (
+	kindMathInline = ast.NewNodeKind("MathInline")
+	kindMathBlock  = ast.NewNodeKind("MathBlock")
+)
+
+// mathInlineNode is a formula between $ signs, or between $$ signs inside
+// a paragraph, which sets it in display style
+type mathInlineNode struct {
+	ast.BaseInline
+	tex     string
+	display bool
+}
+
+// Kind returns kindMathInline
+func (n *mathInlineNode) Kind() ast.NodeKind {
+	return kindMathInline
+}
+
+// Dump prints the node for debugging
+func (n *mathInlineNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": n.tex}, nil)
+}
+
+// mathBlockNode is a display formula between $$ lines
+type mathBlockNode struct {
+	ast.BaseBlock
+	// closed is set once the closing $$ has been read
+	closed bool
+}
+
+// Kind returns kindMathBlock
+func (n *mathBlockNode) Kind() ast.NodeKind {
+	return kindMathBlock
+}
+
+// IsRaw returns true as the lines are TeX rather than markdown
+func (n *mathBlockNode) IsRaw() bool {
+	return true
+}
+
+// Dump prints the node for debugging
+func (n *mathBlockNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// tex returns the formula held by the node
+func (n *mathBlockNode) tex(source []byte) string {
+	return strings.TrimSpace(nodeLines(source, n))
+}
+
+// mathExtension recognises $..$ inline math and $$..$$ display math, and
+// writes it as MathML in HTML
+type mathExtension struct{}
+
+// Extend adds the math parsers and the MathML renderer
+func (mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(mathBlockParser{}, 650)),
+		parser.WithInlineParsers(util.Prioritized(mathInlineParser{}, 150)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(mathHTMLRenderer{}, 500),
+	))
+}
+
+// htmlExtension returns the goldmark extension that writes math in exported
+// HTML as chosen, in place of the MathML of newMarkdown
+func (o mathOptions) htmlExtension() goldmark.Extender {
+	return mathRendererExtension{o}
+}
+
+// mathRendererExtension replaces the renderer of math nodes
+type mathRendererExtension struct {
+	opts mathOptions
+}
+
+// Extend adds the renderer ahead of the one added by mathExtension
+func (e mathRendererExtension) Extend(m goldmark.Markdown) {
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(mathHTMLRenderer{katex: e.opts.katex}, 100),
+	))
+}
+
+// mathBlockParser parses $$ display math that starts a line
+type mathBlockParser struct{}
+
+// Trigger returns the first character of $$
+func (mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Open starts display math on a line beginning with $$, if the closing $$
+// ends a line, so that a paragraph that starts with a price is left alone
+func (mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	start := segment.Start + pos + 2
+
+	// The formula may close on the same line
+	rest := reader.Source()[start:]
+	if end := bytes.IndexByte(rest, '\n'); end >= 0 {
+		rest = rest[:end+1]
+	}
+	node := &mathBlockNode{}
+	if i := bytes.Index(rest, []byte("$$")); i >= 0 {
+		if len(bytes.TrimSpace(rest[i+2:])) > 0 {
+			return nil, parser.NoChildren
+		}
+		node.Lines().Append(text.NewSegment(start, start+i))
+		node.closed = true
+		reader.Advance(segment.Len() - 1)
+		return node, parser.NoChildren
+	}
+	if !mathBlockCloses(reader.Source()[start+len(rest):]) {
+		return nil, parser.NoChildren
+	}
+	node.Lines().Append(text.NewSegment(start, start+len(rest)))
+	reader.Advance(segment.Len() - 1)
+	return node, parser.NoChildren
+}
+
+// mathBlockCloses reports whether a line of source ends with $$
+func mathBlockCloses(source []byte) bool {
+	for len(source) > 0 {
+		end := bytes.IndexByte(source, '\n') + 1
+		if end == 0 {
+			end = len(source)
+		}
+		line := bytes.TrimSpace(source[:end])
+		if bytes.HasSuffix(line, []byte("$$")) {
+			return true
+		}
+		if len(line) == 0 {
+			// A blank line ends the paragraph the $$ would otherwise be in
+			return false
+		}
+		source = source[end:]
+	}
+	return false
+}
+
+// Continue collects lines up to the one that ends with $$
+func (mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	if node.(*mathBlockNode).closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	trimmed := bytes.TrimRight(line, " \t\r\n")
+	if bytes.HasSuffix(trimmed, []byte("$$")) {
+		node.Lines().Append(text.NewSegment(segment.Start, segment.Start+len(trimmed)-2))
+		reader.Advance(segment.Len() - 1)
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	reader.Advance(segment.Len() - 1)
+	return parser.Continue | parser.NoChildren
+}
+
+// Close does nothing, as the formula is only parsed when rendered
+func (mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+// CanInterruptParagraph returns true, so that $$ on its own line after text
+// starts a formula
+func (mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine returns false, as indented lines are code
+func (mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// mathInlineParser parses math between $ or $$ signs inside a paragraph.
+// As in Pandoc, the opening $ must be followed by a non-space, and the
+// closing $ must follow a non-space and not be followed by a digit, so that
+// prices stay text.
+type mathInlineParser struct{}
+
+// Trigger returns $
+func (mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse reads a formula that may continue over the following lines
+func (mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	delimiter := 1
+	if len(line) > 1 && line[1] == '$' {
+		delimiter = 2
+	}
+	if len(line) <= delimiter || delimiter == 1 && isMathSpace(line[1]) {
+		return nil
+	}
+
+	l, pos := block.Position()
+	block.Advance(delimiter)
+	var tex bytes.Buffer
+	for {
+		line, _ := block.PeekLine()
+		if line == nil {
+			block.SetPosition(l, pos)
+			return nil
+		}
+		for i := 0; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				// Escaped characters, including \$, are part of the TeX
+				i++
+				continue
+			case '$':
+			default:
+				continue
+			}
+			if i+delimiter > len(line) || string(line[i:i+delimiter]) != "$$"[:delimiter] {
+				continue
+			}
+			closed := i > 0 && (delimiter == 2 || !isMathSpace(line[i-1]))
+			if delimiter == 1 {
+				next := i + 1
+				closed = closed && (next >= len(line) || line[next] < '0' || line[next] > '9')
+			}
+			if delimiter == 1 && (i > 0 && line[i-1] == '$' || i+1 < len(line) && line[i+1] == '$') {
+				// Part of a $$
+				closed = false
+			}
+			if !closed {
+				continue
+			}
+			tex.Write(line[:i])
+			block.Advance(i + delimiter)
+			return &mathInlineNode{tex: strings.TrimSpace(tex.String()), display: delimiter == 2}
+		}
+		tex.Write(bytes.TrimRight(line, "\r\n"))
+		tex.WriteByte(' ')
+		block.AdvanceLine()
+	}
+}
+
+func isMathSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// mathHTMLRenderer writes math as MathML, or as TeX between \( \) and \[ \]
+// for KaTeX's auto-render script. Formulas that cannot be parsed are shown
+// as their source, marked as errors.
+type mathHTMLRenderer struct {
+	katex bool
+}
+
+// RegisterFuncs registers the renderer for math nodes
+func (r mathHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMathInline, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			node := n.(*mathInlineNode)
+			r.write(w, node.tex, node.display, "span")
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	reg.Register(kindMathBlock, func(w util.BufWriter, source []byte, n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			r.write(w, n.(*mathBlockNode).tex(source), true, "div")
+			w.WriteByte('\n')
+		}
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+func (r mathHTMLRenderer) write(w util.BufWriter, tex string, display bool, element string) {
+	class := "math inline"
+	open, close := `\(`, `\)`
+	if display {
+		class = "math display"
+		open, close = `\[`, `\]`
+	}
+	if r.katex {
+		w.WriteString("<" + element + ` class="` + class + `">` + html.EscapeString(open+tex+close) + "</" + element + ">")
+		return
+	}
+
+	mathml, err := texMathML(tex, display)
+	if err != nil {
+		w.WriteString("<" + element + ` class="` + class + ` math-error" title="` + html.EscapeString(err.Error()) + `">`)
+		w.WriteString(html.EscapeString(mathSource(tex, display)))
+		w.WriteString("</" + element + ">")
+		return
+	}
+	w.WriteString("<" + element + ` class="` + class + `">` + mathml + "</" + element + ">")
+}
+
+// mathSource returns a formula as it was written, for showing one that
+// cannot be parsed
+func mathSource(tex string, display bool) string {
+	if display {
+		return "$$" + tex + "$$"
+	}
+	return "$" + tex + "$"
+}
+
+// documentHasMath reports whether a parsed document has any formulas
+func documentHasMath(doc ast.Node) bool {
+	found := false
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if n.Kind() == kindMathInline || n.Kind() == kindMathBlock {
+			found = true
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return found
+}
+
+// mathMLCSS styles formulas written as MathML
+const mathMLCSS = `<style>
+.math.display { display: block; margin: 1em 0; overflow-x: auto; text-align: center; }
+.math-error { color: #cb2431; font-family: monospace; }
+</style>`
+
+// head returns the markup that the head of a page with formulas needs: the
+// stylesheet for MathML, or the KaTeX stylesheet and scripts
+func (o mathOptions) head() (string, error) {
+	if !o.katex {
+		return mathMLCSS, nil
+	}
+	if o.katexLocation == katexBundled {
+		return inlineKaTeXHead(katexFiles)
+	}
+	base := katexBaseURL(o.katexLocation)
+	return `<link rel="stylesheet" href="` + html.EscapeString(base+"/katex.min.css") + `">
+<script defer src="` + html.EscapeString(base+"/katex.min.js") + `"></script>
+<script defer src="` + html.EscapeString(base+"/contrib/auto-render.min.js") + `"></script>
+<script>document.addEventListener("DOMContentLoaded", function () { renderMathInElement(document.body); });</script>`, nil
+}
+
+// katexBaseURL returns the address of a KaTeX release, turning a local
+// folder into a file URL
+func katexBaseURL(location string) string {
+	location = strings.TrimRight(location, `/\`)
+	if location == "" {
+		return katexCDN
+	}
+	if u, err := url.Parse(location); err == nil && len(u.Scheme) > 1 {
+		return location
+	}
+	if abs, err := filepath.Abs(location); err == nil {
+		location = abs
+	}
+	path := filepath.ToSlash(location)
+	if !strings.HasPrefix(path, "/") {
+		// Windows paths start with a drive letter
+		path = "/" + path
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String()
+}
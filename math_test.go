@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMathInlineParser(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   []string
+	}{
+		{
+			name:   "inline formula",
+			source: "Euler wrote $e^{i\\pi} = -1$ once.",
+			want:   []string{"<math"},
+		},
+		{
+			name:   "display formula in a paragraph",
+			source: "Before $$x^2$$ after.",
+			want:   []string{`display="block"`},
+		},
+		{
+			name:   "dollar at the start of a continuation line",
+			source: "Lunch was $5 and\n$10 was dinner.",
+			want:   []string{"$10 was dinner."},
+		},
+		{
+			name:   "dollar alone on a continuation line",
+			source: "Prices\n$\nrose.",
+			want:   []string{"$"},
+		},
+		{
+			name:   "currency amounts",
+			source: "It cost $5 and $10.",
+			want:   []string{"$5 and $10."},
+		},
+		{
+			name:   "escaped dollar",
+			source: `Pay \$5, or $x$.`,
+			want:   []string{"$5, or", "<math"},
+		},
+		{
+			name:   "space after the opening dollar",
+			source: "A $ x$ is not math.",
+			want:   []string{"A $ x$ is not math."},
+		},
+		{
+			name:   "unclosed formula",
+			source: "Starts $x but never ends",
+			want:   []string{"Starts $x but never ends"},
+		},
+		{
+			name:   "formula across lines",
+			source: "See $a +\nb$ here.",
+			want:   []string{"<math", "here."},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := newMarkdown().Convert([]byte(test.source), &out); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output %q does not contain %q", out.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestInlineKaTeXHead(t *testing.T) {
+	release := fstest.MapFS{
+		"katex/katex.min.css":                  {Data: []byte(`.katex{font:1em KaTeX_Main}@font-face{font-family:KaTeX_Main;src:url(fonts/KaTeX_Main-Regular.woff2) format("woff2"),url(fonts/KaTeX_Main-Regular.woff) format("woff")}`)},
+		"katex/katex.min.js":                   {Data: []byte(`var katex={};"</script>";`)},
+		"katex/contrib/auto-render.min.js":     {Data: []byte(`function renderMathInElement(e){}`)},
+		"katex/fonts/KaTeX_Main-Regular.woff2": {Data: []byte("wOF2")},
+	}
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "release",
+			files: release,
+			want: []string{
+				`url("data:font/woff2;base64,d09GMg==")`,
+				// Fonts that are not bundled are left for the browser to skip
+				`url(fonts/KaTeX_Main-Regular.woff)`,
+				`var katex={};"<\/script>";`,
+				"function renderMathInElement(e){}",
+				"renderMathInElement(document.body)",
+			},
+		},
+		{name: "not bundled", files: fstest.MapFS{"katex/README.md": {Data: []byte("notes")}}, wantErr: errKaTeXNotBundled},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			head, err := inlineKaTeXHead(test.files)
+			if err != test.wantErr {
+				t.Fatalf("error %v, want %v", err, test.wantErr)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(head, want) {
+					t.Errorf("head does not contain %q:\n%s", want, head)
+				}
+			}
+			if err == nil && strings.Count(head, "</script>") != 3 {
+				t.Errorf("head should hold three script elements:\n%s", head)
+			}
+		})
+	}
+}
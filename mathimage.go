@@ -0,0 +1,906 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/go-fonts/stix/stix2mathregular"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// Font parameters of the typesetter, in ems of the current size. They
+// follow the MATH table of STIX Two Math.
+const (
+	mathAxisHeight    = 0.258
+	mathRuleThickness = 0.068
+	mathXHeight       = 0.45
+	mathScriptScale   = 0.7
+	mathScript2Scale  = 0.5
+	mathLargeOpScale  = 1.4
+)
+
+// mathFont returns STIX Two Math, which has the symbols and alphabets that
+// formulas use
+var mathFont = sync.OnceValues(func() (*sfnt.Font, error) {
+	return opentype.Parse(stix2mathregular.TTF)
+})
+
+// mathPoint is a point in a box, with y growing downwards from the baseline
+type mathPoint struct {
+	x, y float64
+}
+
+// mathItem is something drawn in a box: a run of text or filled outlines
+type mathItem struct {
+	// x and y are the start of the baseline of text
+	x, y float64
+	text string
+	size float64
+	// polygons are filled outlines, drawn when there is no text
+	polygons [][]mathPoint
+}
+
+// mathBox is a typeset part of a formula. Its origin is the left end of the
+// baseline.
+type mathBox struct {
+	width, ascent, descent float64
+	// italic is how far the ink of a slanted letter leans past its width,
+	// which superscripts leave room for
+	italic float64
+	items  []mathItem
+}
+
+// place adds the items of a child box with its origin at x, y
+func (b *mathBox) place(child *mathBox, x, y float64) {
+	for _, item := range child.items {
+		item.x += x
+		item.y += y
+		if item.polygons != nil {
+			moved := make([][]mathPoint, len(item.polygons))
+			for i, polygon := range item.polygons {
+				moved[i] = make([]mathPoint, len(polygon))
+				for j, p := range polygon {
+					moved[i][j] = mathPoint{p.x + x, p.y + y}
+				}
+			}
+			item.polygons = moved
+			item.x, item.y = 0, 0
+		}
+		b.items = append(b.items, item)
+	}
+	b.ascent = math.Max(b.ascent, child.ascent-y)
+	b.descent = math.Max(b.descent, child.descent+y)
+}
+
+// append adds a child box after the end of the box
+func (b *mathBox) append(child *mathBox) {
+	b.place(child, b.width, 0)
+	b.width += child.width
+	b.italic = child.italic
+}
+
+// rule adds a filled rectangle with its top left corner at x, y
+func (b *mathBox) rule(x, y, width, height float64) {
+	b.items = append(b.items, mathItem{polygons: [][]mathPoint{{
+		{x, y}, {x + width, y}, {x + width, y + height}, {x, y + height},
+	}}})
+}
+
+// stroke adds lines of a width through points, with joins between them.
+// Every outline winds the same way so that their overlaps stay filled.
+func (b *mathBox) stroke(points []mathPoint, width float64) {
+	var polygons [][]mathPoint
+	half := width / 2
+	for i := 0; i+1 < len(points); i++ {
+		a, c := points[i], points[i+1]
+		length := math.Hypot(c.x-a.x, c.y-a.y)
+		if length == 0 {
+			continue
+		}
+		nx, ny := -(c.y-a.y)/length*half, (c.x-a.x)/length*half
+		polygons = append(polygons, []mathPoint{
+			{a.x + nx, a.y + ny}, {c.x + nx, c.y + ny}, {c.x - nx, c.y - ny}, {a.x - nx, a.y - ny},
+		})
+	}
+	for _, p := range points[1 : len(points)-1] {
+		var join []mathPoint
+		for k := 8; k > 0; k-- {
+			angle := float64(k) * math.Pi / 4
+			join = append(join, mathPoint{p.x + half*math.Cos(angle), p.y + half*math.Sin(angle)})
+		}
+		polygons = append(polygons, join)
+	}
+	b.items = append(b.items, mathItem{polygons: polygons})
+}
+
+// quadPoints returns points along a quadratic curve, without its start
+func quadPoints(from, control, to mathPoint) []mathPoint {
+	const steps = 12
+	points := make([]mathPoint, steps)
+	for i := 1; i <= steps; i++ {
+		t := float64(i) / steps
+		u := 1 - t
+		points[i-1] = mathPoint{
+			u*u*from.x + 2*u*t*control.x + t*t*to.x,
+			u*u*from.y + 2*u*t*control.y + t*t*to.y,
+		}
+	}
+	return points
+}
+
+// mathTypesetter lays out parsed formulas in boxes at one size
+type mathTypesetter struct {
+	font *sfnt.Font
+	// size is the size of text style in pixels
+	size  float64
+	faces map[float64]font.Face
+}
+
+func newMathTypesetter(size float64) (*mathTypesetter, error) {
+	f, err := mathFont()
+	if err != nil {
+		return nil, err
+	}
+	return &mathTypesetter{font: f, size: size, faces: make(map[float64]font.Face)}, nil
+}
+
+// face returns the font at a size in pixels
+func (t *mathTypesetter) face(size float64) font.Face {
+	if face, ok := t.faces[size]; ok {
+		return face
+	}
+	face, err := opentype.NewFace(t.font, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		// Only invalid options fail, and these are always valid
+		panic(err)
+	}
+	t.faces[size] = face
+	return face
+}
+
+// em returns the size of a style in pixels
+func (t *mathTypesetter) em(level texLevel) float64 {
+	switch level {
+	case texScript:
+		return t.size * mathScriptScale
+	case texScriptScript:
+		return t.size * mathScript2Scale
+	}
+	return t.size
+}
+
+// glyphs sets a run of text, measuring its ink
+func (t *mathTypesetter) glyphs(text string, size float64) *mathBox {
+	bounds, advance := font.BoundString(t.face(size), text)
+	box := &mathBox{
+		width:   fixedFloat(advance),
+		ascent:  math.Max(-fixedFloat(bounds.Min.Y), 0),
+		descent: math.Max(fixedFloat(bounds.Max.Y), 0),
+		items:   []mathItem{{text: text, size: size}},
+	}
+	box.italic = math.Max(fixedFloat(bounds.Max.X)-box.width, 0)
+	return box
+}
+
+func fixedFloat(v fixed.Int26_6) float64 {
+	return float64(v) / 64
+}
+
+// typeset lays out a formula in display or inline style
+func (t *mathTypesetter) typeset(row texRow, display bool) *mathBox {
+	level := texInline
+	if display {
+		level = texDisplay
+	}
+	return t.row(row, level)
+}
+
+// texSpacing is the space between classes of nodes in eighteenths of an em,
+// indexed by the classes on the left and right. Negative spaces are only
+// used outside scripts.
+var texSpacing = [8][8]float64{
+	texOrd:   {0, 3, -4, -5, 0, 0, 0, -3},
+	texOp:    {3, 3, 0, -5, 0, 0, 0, -3},
+	texBin:   {-4, -4, 0, 0, -4, 0, 0, -4},
+	texRel:   {-5, -5, 0, 0, -5, 0, 0, -5},
+	texOpen:  {0, 0, 0, 0, 0, 0, 0, 0},
+	texClose: {0, 3, -4, -5, 0, 0, 0, -3},
+	texPunct: {-3, -3, 0, -3, -3, -3, -3, -3},
+	texInner: {-3, 3, -4, -5, -3, 0, -3, -3},
+}
+
+// row lays out nodes side by side with the space that TeX puts between them
+func (t *mathTypesetter) row(row texRow, level texLevel) *mathBox {
+	classes := make([]texClass, len(row))
+	last := texNone
+	for i, node := range row {
+		classes[i] = node.class()
+		if classes[i] == texNone {
+			continue
+		}
+		// A binary operator with nothing to its left is a sign
+		if classes[i] == texBin && (last == texNone || last == texBin || last == texOp ||
+			last == texRel || last == texOpen || last == texPunct) {
+			classes[i] = texOrd
+		}
+		// and so is one with nothing to its right
+		if last == texBin && (classes[i] == texRel || classes[i] == texClose || classes[i] == texPunct) {
+			for j := i - 1; j >= 0; j-- {
+				if classes[j] == texBin {
+					classes[j] = texOrd
+					break
+				}
+			}
+		}
+		last = classes[i]
+	}
+	if last == texBin {
+		for j := len(classes) - 1; j >= 0; j-- {
+			if classes[j] == texBin {
+				classes[j] = texOrd
+				break
+			}
+		}
+	}
+
+	box := &mathBox{}
+	last = texNone
+	for i, node := range row {
+		if classes[i] != texNone {
+			if last != texNone {
+				space := texSpacing[last][classes[i]]
+				if space < 0 && level < texScript {
+					space = -space
+				}
+				box.width += math.Max(space, 0) / 18 * t.em(level)
+			}
+			last = classes[i]
+		}
+		box.append(t.node(node, level))
+	}
+	return box
+}
+
+func (t *mathTypesetter) node(node texNode, level texLevel) *mathBox {
+	switch n := node.(type) {
+	case *texAtom:
+		return t.atom(n, level)
+	case *texGroup:
+		return t.row(n.row, level)
+	case *texFrac:
+		return t.frac(n, level)
+	case *texSqrt:
+		return t.sqrt(n, level)
+	case *texScripts:
+		return t.scripts(n, level)
+	case *texFenced:
+		body := t.row(n.body, level)
+		box := &mathBox{}
+		box.append(t.fence(n.open, body, level))
+		box.append(body)
+		box.append(t.fence(n.close, body, level))
+		return box
+	case *texSpace:
+		return &mathBox{width: n.em * t.em(level)}
+	case *texAccent:
+		return t.accent(n, level)
+	case *texTable:
+		return t.table(n, level)
+	case *texStyle:
+		return t.row(n.row, n.level)
+	}
+	return &mathBox{}
+}
+
+// atom sets a symbol, letters set in italics, and large operators bigger
+// and centered on the axis
+func (t *mathTypesetter) atom(a *texAtom, level texLevel) *mathBox {
+	em := t.em(level)
+	text := a.text
+	if a.kind == texIdentifier && !a.upright && utf8.RuneCountInString(text) == 1 {
+		r, _ := utf8.DecodeRuneInString(text)
+		text = string(mathItalic(r))
+	}
+
+	switch {
+	case a.scale > 0:
+		return t.delimiter(a.text, a.scale*t.size, level)
+	case a.large:
+		size := em
+		if level == texDisplay {
+			size *= mathLargeOpScale
+		}
+		box := t.glyphs(text, size)
+		return t.centered(box, level)
+	}
+	return t.glyphs(text, em)
+}
+
+// centered moves a box so that it is centered on the math axis
+func (t *mathTypesetter) centered(box *mathBox, level texLevel) *mathBox {
+	shift := (box.ascent-box.descent)/2 - mathAxisHeight*t.em(level)
+	moved := &mathBox{width: box.width, italic: box.italic}
+	moved.place(box, 0, shift)
+	return moved
+}
+
+// mathItalic returns the italic form of a Latin or Greek letter
+func mathItalic(r rune) rune {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		return mathAlphanumeric(r, texVariantItalic)
+	case r >= 'α' && r <= 'ω':
+		return 0x1D6FC + r - 'α'
+	}
+	if italic, ok := map[rune]rune{'ϵ': 0x1D716, 'ϑ': 0x1D717, 'ϰ': 0x1D718, 'ϕ': 0x1D719,
+		'ϱ': 0x1D71A, 'ϖ': 0x1D71B}[r]; ok {
+		return italic
+	}
+	return r
+}
+
+// frac sets a fraction with its parts centered over and under a rule on
+// the axis
+func (t *mathTypesetter) frac(f *texFrac, level texLevel) *mathBox {
+	inner := level
+	if f.level >= 0 {
+		inner = f.level
+	}
+	part := texInline
+	if inner != texDisplay {
+		part = scriptLevel(inner)
+	}
+	num := t.row(f.num, part)
+	den := t.row(f.den, part)
+
+	em := t.em(inner)
+	axis := mathAxisHeight * em
+	thickness := math.Max(mathRuleThickness*em, 1)
+	gap := thickness
+	numShift, denShift := 0.394*em, 0.345*em
+	if inner == texDisplay {
+		gap = 3 * thickness
+		numShift, denShift = 0.677*em, 0.686*em
+	}
+	if f.noLine {
+		thickness = 0
+		gap *= 2.5
+	}
+	numY := math.Min(-(axis + thickness/2 + gap + num.descent), -numShift)
+	denY := math.Max(-axis+thickness/2+gap+den.ascent, denShift)
+
+	pad := 0.12 * em
+	width := math.Max(num.width, den.width) + 2*pad
+	box := &mathBox{width: width}
+	box.place(num, (width-num.width)/2, numY)
+	box.place(den, (width-den.width)/2, denY)
+	if thickness > 0 {
+		box.rule(0, -axis-thickness/2, width, thickness)
+	}
+	if f.open == "" {
+		return box
+	}
+
+	fenced := &mathBox{}
+	fenced.append(t.fence(f.open, box, inner))
+	fenced.append(box)
+	fenced.append(t.fence(f.close, box, inner))
+	return fenced
+}
+
+// sqrt sets a root under a radical sign drawn to its height
+func (t *mathTypesetter) sqrt(s *texSqrt, level texLevel) *mathBox {
+	body := t.row(s.body, level)
+	em := t.em(level)
+	thickness := math.Max(mathRuleThickness*em, 1)
+	gap := thickness + 0.1*em
+	if level == texDisplay {
+		gap = thickness + 0.2*em
+	}
+	top := -(math.Max(body.ascent, mathXHeight*em) + gap + thickness)
+	bottom := math.Max(body.descent, 0.1*em) + 0.05*em
+
+	// The sign is a short tick up, a stroke down to the bottom and a long
+	// stroke up to the rule over the root
+	height := bottom - top
+	signWidth := math.Min(0.55*em+0.05*height, 1.0*em)
+	var index *mathBox
+	indent := 0.0
+	if len(s.index) > 0 {
+		index = t.row(s.index, texScriptScript)
+		indent = math.Max(index.width-0.3*signWidth, 0)
+	}
+
+	box := &mathBox{}
+	mid := bottom - 0.45*math.Min(height, 1.2*em)
+	box.stroke([]mathPoint{
+		{indent, mid + 0.06*em},
+		{indent + 0.2*signWidth, mid - 0.04*em},
+	}, thickness)
+	box.stroke([]mathPoint{
+		{indent + 0.2*signWidth, mid - 0.04*em},
+		{indent + 0.5*signWidth, bottom - thickness},
+	}, 2*thickness)
+	box.stroke([]mathPoint{
+		{indent + 0.5*signWidth, bottom - thickness},
+		{indent + signWidth, top + thickness/2},
+	}, thickness)
+	x := indent + signWidth
+	box.rule(x-thickness/2, top, body.width+0.1*em+thickness/2, thickness)
+	box.place(body, x+0.05*em, 0)
+	box.width = x + body.width + 0.15*em
+	box.ascent = math.Max(box.ascent, -top)
+	box.descent = math.Max(box.descent, bottom)
+	if index != nil {
+		box.place(index, 0, mid-0.1*em-index.descent)
+	}
+	return box
+}
+
+// scripts sets subscripts and superscripts beside their base, or limits
+// above and below it
+func (t *mathTypesetter) scripts(s *texScripts, level texLevel) *mathBox {
+	base := t.node(s.base, level)
+	scriptLevel := scriptLevel(level)
+	var sub, sup *mathBox
+	if s.sub != nil {
+		sub = t.node(s.sub, scriptLevel)
+	}
+	if s.sup != nil {
+		sup = t.node(s.sup, scriptLevel)
+	}
+	em := t.em(level)
+
+	if s.limits(level) {
+		width := base.width
+		for _, script := range []*mathBox{sub, sup} {
+			if script != nil {
+				width = math.Max(width, script.width)
+			}
+		}
+		box := &mathBox{width: width}
+		box.place(base, (width-base.width)/2, 0)
+		gap := 0.15 * em
+		if sup != nil {
+			box.place(sup, (width-sup.width)/2+base.italic/2, -(base.ascent + gap + sup.descent))
+		}
+		if sub != nil {
+			box.place(sub, (width-sub.width)/2-base.italic/2, base.descent+gap+sub.ascent)
+		}
+		return box
+	}
+
+	box := &mathBox{width: base.width}
+	box.place(base, 0, 0)
+	scriptEm := t.em(scriptLevel)
+	space := 0.05 * em
+	supShift, subShift := 0.0, 0.0
+	if sup != nil {
+		supShift = math.Max(math.Max(base.ascent-0.386*scriptEm, 0.41*em), sup.descent+mathXHeight*em/4)
+	}
+	if sub != nil {
+		subShift = math.Max(math.Max(base.descent+0.05*scriptEm, 0.15*em), sub.ascent-0.8*mathXHeight*em)
+		if sup != nil {
+			subShift = math.Max(subShift, 0.25*em)
+			// Keep a gap between the two scripts
+			thickness := mathRuleThickness * em
+			if gap := (supShift - sup.descent) - (sub.ascent - subShift); gap < 4*thickness {
+				subShift += 4*thickness - gap
+			}
+		}
+	}
+
+	width := base.width
+	if sup != nil {
+		box.place(sup, base.width+base.italic, -supShift)
+		width = math.Max(width, base.width+base.italic+sup.width)
+	}
+	if sub != nil {
+		// Large operators such as integrals slant, so the subscript tucks in
+		x := base.width
+		if atom, ok := s.base.(*texAtom); ok && atom.large {
+			x -= base.italic
+		}
+		box.place(sub, x, subShift)
+		width = math.Max(width, x+sub.width)
+	}
+	box.width = width + space
+	return box
+}
+
+// fence returns a delimiter tall enough for a box centered on the axis
+func (t *mathTypesetter) fence(delimiter string, body *mathBox, level texLevel) *mathBox {
+	axis := mathAxisHeight * t.em(level)
+	half := math.Max(body.ascent-axis, body.descent+axis)
+	// As in TeX, a delimiter may be a little shorter than what it encloses
+	height := math.Max(2*half*0.901, 2*half-0.5*t.em(level))
+	return t.delimiter(delimiter, height, level)
+}
+
+// delimiter returns a delimiter of a height, centered on the axis. Short
+// delimiters are glyphs, and taller ones are drawn.
+func (t *mathTypesetter) delimiter(delimiter string, height float64, level texLevel) *mathBox {
+	em := t.em(level)
+	if delimiter == "" {
+		return &mathBox{width: 0.12 * em}
+	}
+	glyph := t.glyphs(delimiter, em)
+	if height <= (glyph.ascent+glyph.descent)*1.1 || !drawnDelimiter(delimiter) {
+		return t.centered(glyph, level)
+	}
+
+	axis := mathAxisHeight * em
+	top, bottom := -axis-height/2, -axis+height/2
+	mid := -axis
+	thickness := math.Max(mathRuleThickness*em*1.1, 1)
+	side := 0.08 * em
+	box := &mathBox{ascent: -top, descent: bottom}
+
+	switch delimiter {
+	case "(", ")":
+		width := math.Min(0.3*em+0.04*height, 0.7*em)
+		bulge := 0.0
+		end := width
+		if delimiter == ")" {
+			bulge, end = width, 0
+		}
+		outer := mathPoint{2*bulge - end, mid}
+		if delimiter == "(" {
+			outer.x = -end + 2*side
+		} else {
+			outer.x = 2*width - 2*side
+		}
+		inner := mathPoint{outer.x + 2*thickness, mid}
+		if delimiter == ")" {
+			inner.x = outer.x - 2*thickness
+		}
+		polygon := []mathPoint{{end, top}}
+		polygon = append(polygon, quadPoints(mathPoint{end, top}, outer, mathPoint{end, bottom})...)
+		polygon = append(polygon, quadPoints(mathPoint{end, bottom}, inner, mathPoint{end, top})...)
+		box.items = append(box.items, mathItem{polygons: [][]mathPoint{polygon}})
+		box.width = width
+	case "[", "]", "⌊", "⌋", "⌈", "⌉":
+		width := 0.32 * em
+		x := side
+		serif := width - side
+		if delimiter == "]" || delimiter == "⌋" || delimiter == "⌉" {
+			x = width - side - thickness
+			serif = -(width - side - thickness - side)
+		}
+		box.rule(x, top, thickness, height)
+		if delimiter != "⌊" && delimiter != "⌋" {
+			box.rule(math.Min(x, x+serif), top, math.Abs(serif)+thickness, thickness)
+		}
+		if delimiter != "⌈" && delimiter != "⌉" {
+			box.rule(math.Min(x, x+serif), bottom-thickness, math.Abs(serif)+thickness, thickness)
+		}
+		box.width = width
+	case "{", "}":
+		width := 0.5 * em
+		left, right := side, width-side
+		if delimiter == "}" {
+			left, right = right, left
+		}
+		centre := (left + right) / 2
+		radius := math.Min(0.15*em, height/8)
+		points := []mathPoint{{right, top + thickness/2}}
+		points = append(points, quadPoints(points[0], mathPoint{centre, top + thickness/2}, mathPoint{centre, top + radius})...)
+		points = append(points, mathPoint{centre, mid - radius})
+		points = append(points, quadPoints(mathPoint{centre, mid - radius}, mathPoint{centre, mid}, mathPoint{left, mid})...)
+		points = append(points, quadPoints(mathPoint{left, mid}, mathPoint{centre, mid}, mathPoint{centre, mid + radius})...)
+		points = append(points, mathPoint{centre, bottom - radius})
+		points = append(points, quadPoints(mathPoint{centre, bottom - radius}, mathPoint{centre, bottom - thickness/2}, mathPoint{right, bottom - thickness/2})...)
+		box.stroke(points, thickness)
+		box.width = width
+	case "|", "‖":
+		box.rule(side, top, thickness, height)
+		box.width = 2*side + thickness
+		if delimiter == "‖" {
+			box.rule(side+3*thickness, top, thickness, height)
+			box.width += 3 * thickness
+		}
+	case "⟨", "⟩":
+		width := math.Min(0.3*em+0.06*height, 0.6*em)
+		tip, ends := side, width-side
+		if delimiter == "⟩" {
+			tip, ends = ends, tip
+		}
+		box.stroke([]mathPoint{{ends, top + thickness}, {tip, mid}, {ends, bottom - thickness}}, thickness)
+		box.width = width
+	case "/":
+		width := 0.3*em + 0.2*height
+		box.stroke([]mathPoint{{width - side, top}, {side, bottom}}, thickness)
+		box.width = width
+	}
+	return box
+}
+
+// drawnDelimiter reports whether delimiter can be drawn at any height
+func drawnDelimiter(delimiter string) bool {
+	switch delimiter {
+	case "(", ")", "[", "]", "{", "}", "|", "‖", "⟨", "⟩", "⌊", "⌋", "⌈", "⌉", "/":
+		return true
+	}
+	return false
+}
+
+// accent sets a mark over or under its base. Marks that stretch are drawn
+// to the width of the base.
+func (t *mathTypesetter) accent(a *texAccent, level texLevel) *mathBox {
+	base := t.row(a.base, level)
+	em := t.em(level)
+	thickness := math.Max(mathRuleThickness*em, 1)
+	gap := 0.08 * em
+	box := &mathBox{width: base.width, italic: base.italic}
+	box.place(base, 0, 0)
+
+	if !a.stretchy {
+		mark := t.glyphs(a.mark, em)
+		// Marks over slanted letters lean with them
+		x := (base.width-mark.width)/2 + base.italic/2
+		box.place(mark, x, -(math.Max(base.ascent, mathXHeight*em)+gap)-mark.descent)
+		return box
+	}
+
+	width := math.Max(base.width, 0.5*em)
+	if a.under {
+		y := base.descent + gap
+		switch a.mark {
+		case "⏟":
+			t.horizontalBrace(box, 0, width, y, y+0.3*em, thickness)
+			box.descent = math.Max(box.descent, y+0.3*em+thickness)
+		default:
+			box.rule(0, y, width, thickness)
+			box.descent = math.Max(box.descent, y+thickness)
+		}
+		return box
+	}
+
+	bottom := -(math.Max(base.ascent, mathXHeight*em) + gap)
+	height := 0.25 * em
+	switch a.mark {
+	case "^":
+		box.stroke([]mathPoint{{0, bottom}, {width / 2, bottom - height}, {width, bottom}}, thickness)
+	case "ˇ":
+		box.stroke([]mathPoint{{0, bottom - height}, {width / 2, bottom}, {width, bottom - height}}, thickness)
+	case "~":
+		var points []mathPoint
+		for i := 0; i <= 16; i++ {
+			x := float64(i) / 16
+			points = append(points, mathPoint{x * width, bottom - height/2 - math.Sin(x*2*math.Pi)*height/2.5})
+		}
+		box.stroke(points, thickness)
+	case "→", "←":
+		y := bottom - height/2
+		head := 0.18 * em
+		tip, tail := width, 0.0
+		if a.mark == "←" {
+			tip, tail = tail, tip
+		}
+		direction := math.Copysign(1, tip-tail)
+		box.stroke([]mathPoint{{tail, y}, {tip - direction*thickness/2, y}}, thickness)
+		box.stroke([]mathPoint{{tip - direction*head, y - head*0.7}, {tip, y}, {tip - direction*head, y + head*0.7}}, thickness)
+	case "⏞":
+		height = 0.3 * em
+		t.horizontalBrace(box, 0, width, bottom, bottom-height, thickness)
+	default:
+		box.rule(0, bottom-thickness, width, thickness)
+		height = thickness
+	}
+	box.ascent = math.Max(box.ascent, -(bottom-height)+thickness)
+	return box
+}
+
+// horizontalBrace draws a brace from left to right with its ends at y and
+// its point at tip
+func (t *mathTypesetter) horizontalBrace(box *mathBox, left, right, y, tip, thickness float64) {
+	mid := (left + right) / 2
+	centre := (y + tip) / 2
+	radius := math.Min((right-left)/8, math.Abs(tip-y))
+	dir := math.Copysign(1, right-left)
+	points := []mathPoint{{left, y}}
+	points = append(points, quadPoints(points[0], mathPoint{left, centre}, mathPoint{left + dir*radius, centre})...)
+	points = append(points, mathPoint{mid - radius, centre})
+	points = append(points, quadPoints(mathPoint{mid - radius, centre}, mathPoint{mid, centre}, mathPoint{mid, tip})...)
+	points = append(points, quadPoints(mathPoint{mid, tip}, mathPoint{mid, centre}, mathPoint{mid + radius, centre})...)
+	points = append(points, mathPoint{right - radius, centre})
+	points = append(points, quadPoints(mathPoint{right - radius, centre}, mathPoint{right, centre}, mathPoint{right, y})...)
+	box.stroke(points, thickness)
+}
+
+// table sets the cells of a matrix or of aligned equations in a grid
+// centered on the axis
+func (t *mathTypesetter) table(tb *texTable, level texLevel) *mathBox {
+	inner := texInline
+	switch {
+	case tb.small:
+		inner = texScript
+	case tb.alternate:
+		inner = texDisplay
+	}
+	em := t.em(inner)
+
+	var cells [][]*mathBox
+	var widths []float64
+	for _, row := range tb.rows {
+		boxes := make([]*mathBox, len(row))
+		for i, cell := range row {
+			// A relation after an alignment point keeps its space on the left,
+			// as if something came before it
+			if tb.alternate && i%2 == 1 {
+				cell = append(texRow{&texGroup{}}, cell...)
+			}
+			boxes[i] = t.row(cell, inner)
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = math.Max(widths[i], boxes[i].width)
+		}
+		cells = append(cells, boxes)
+	}
+
+	// Aligned equations pair a right and a left column with no gap
+	gaps := make([]float64, len(widths))
+	for i := 1; i < len(widths); i++ {
+		switch {
+		case tb.alternate && i%2 == 1:
+			gaps[i] = 0
+		case tb.alternate:
+			gaps[i] = 2 * em
+		case tb.small:
+			gaps[i] = 0.5 * em
+		default:
+			gaps[i] = 1 * em
+		}
+	}
+
+	box := &mathBox{}
+	y := 0.0
+	for r, row := range cells {
+		ascent, descent := 0.7*em, 0.3*em
+		for _, cell := range row {
+			ascent = math.Max(ascent, cell.ascent)
+			descent = math.Max(descent, cell.descent)
+		}
+		if r > 0 {
+			y += 0.2 * em
+			if tb.alternate {
+				y += 0.1 * em
+			}
+		}
+		y += ascent
+		x := 0.0
+		for i, cell := range row {
+			x += gaps[i]
+			offset := 0.0
+			switch tb.columnAlign(i) {
+			case 'c':
+				offset = (widths[i] - cell.width) / 2
+			case 'r':
+				offset = widths[i] - cell.width
+			}
+			box.place(cell, x+offset, y)
+			x += widths[i]
+		}
+		y += descent
+	}
+	for i, width := range widths {
+		box.width += gaps[i] + width
+	}
+
+	// Center the grid on the axis
+	grid := &mathBox{width: box.width}
+	grid.place(box, 0, -y/2-mathAxisHeight*t.em(level))
+	grid.ascent = y/2 + mathAxisHeight*t.em(level)
+	grid.descent = y/2 - mathAxisHeight*t.em(level)
+	if tb.open == "" && tb.close == "" {
+		return grid
+	}
+
+	fenced := &mathBox{}
+	fenced.append(t.fence(tb.open, grid, level))
+	fenced.append(&mathBox{width: 0.1 * em})
+	fenced.append(grid)
+	fenced.append(&mathBox{width: 0.1 * em})
+	fenced.append(t.fence(tb.close, grid, level))
+	return fenced
+}
+
+// mathImage is a formula drawn as a picture
+type mathImage struct {
+	img *image.RGBA
+	// baseline is the distance from the top of the picture to the baseline
+	// of the formula, in pixels
+	baseline float64
+}
+
+// renderMathImage typesets and draws a formula in a color, at a size in
+// pixels for the text around it
+func renderMathImage(tex string, display bool, size float64, c color.Color) (*mathImage, error) {
+	row, err := parseTeX(tex)
+	if err != nil {
+		return nil, err
+	}
+	t, err := newMathTypesetter(size)
+	if err != nil {
+		return nil, err
+	}
+	box := t.typeset(row, display)
+
+	pad := math.Ceil(0.1 * size)
+	width := int(math.Ceil(box.width + 2*pad))
+	height := int(math.Ceil(box.ascent + box.descent + 2*pad))
+	img := image.NewRGBA(image.Rect(0, 0, max(width, 1), max(height, 1)))
+	originX, originY := pad, pad+box.ascent
+	ink := image.NewUniform(c)
+
+	for _, item := range box.items {
+		if item.text != "" {
+			d := font.Drawer{Dst: img, Src: ink, Face: t.face(item.size),
+				Dot: fixed.Point26_6{X: floatFixed(originX + item.x), Y: floatFixed(originY + item.y)}}
+			d.DrawString(item.text)
+			continue
+		}
+
+		r := vector.NewRasterizer(img.Bounds().Dx(), img.Bounds().Dy())
+		r.DrawOp = draw.Over
+		for _, polygon := range item.polygons {
+			for i, p := range polygon {
+				x, y := float32(originX+p.x), float32(originY+p.y)
+				if i == 0 {
+					r.MoveTo(x, y)
+				} else {
+					r.LineTo(x, y)
+				}
+			}
+			r.ClosePath()
+		}
+		r.Draw(img, img.Bounds(), ink, image.Point{})
+	}
+	return &mathImage{img: img, baseline: originY}, nil
+}
+
+func floatFixed(v float64) fixed.Int26_6 {
+	return fixed.Int26_6(math.Round(v * 64))
+}
+
+// mathPicture is a formula drawn for a document export
+type mathPicture struct {
+	png []byte
+	// width, height and baseline, from the top, are in points
+	width, height, baseline float64
+}
+
+// mathPictureScale draws exported formulas at four times 72 DPI
+const mathPictureScale = 4
+
+// renderMathPicture draws a formula as a PNG for the exports that cannot
+// typeset it themselves, at a text size in points
+func renderMathPicture(tex string, display bool, size float64) (*mathPicture, error) {
+	m, err := renderMathImage(tex, display, size*mathPictureScale, color.Black)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, m.img); err != nil {
+		return nil, err
+	}
+
+	bounds := m.img.Bounds()
+	return &mathPicture{
+		png:      buf.Bytes(),
+		width:    float64(bounds.Dx()) / mathPictureScale,
+		height:   float64(bounds.Dy()) / mathPictureScale,
+		baseline: m.baseline / mathPictureScale,
+	}, nil
+}
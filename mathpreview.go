@@ -0,0 +1,423 @@
+package main
+
+import (
+	"image/color"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	// mathOversample draws formulas at twice their size, so that they stay
+	// sharp on high density screens
+	mathOversample = 2
+	// mathTextScale matches formulas to the text around them, as letters
+	// of the math font are smaller than those of the theme at one size
+	mathTextScale = 1.15
+)
+
+// mathImageKey identifies a drawn formula in the cache
+type mathImageKey struct {
+	tex     string
+	display bool
+	size    float32
+	color   color.NRGBA
+}
+
+// mathImages keeps drawn formulas, as the preview redraws a block whenever
+// its source changes
+var mathImages = struct {
+	sync.Mutex
+	images map[mathImageKey]*mathImage
+}{images: make(map[mathImageKey]*mathImage)}
+
+// cachedMathImage draws a formula at a text size, or returns the copy drawn
+// before
+func cachedMathImage(tex string, display bool, size float32, c color.Color) (*mathImage, error) {
+	key := mathImageKey{tex, display, size, color.NRGBAModel.Convert(c).(color.NRGBA)}
+	mathImages.Lock()
+	defer mathImages.Unlock()
+	if image, ok := mathImages.images[key]; ok {
+		return image, nil
+	}
+
+	image, err := renderMathImage(tex, display, float64(size*mathOversample), c)
+	if err != nil {
+		return nil, err
+	}
+	// A simple bound is enough, as the formulas of one document fit easily
+	if len(mathImages.images) >= 256 {
+		clear(mathImages.images)
+	}
+	mathImages.images[key] = image
+	return image, nil
+}
+
+// renderMath returns the segments for a formula, or its source in the error
+// color when it cannot be parsed
+func renderMath(tex string, display, block bool, style inlineStyle) []widget.RichTextSegment {
+	if _, err := parseTeX(tex); err != nil {
+		style.text.Monospace = true
+		style.color = theme.ColorNameError
+		if !block {
+			return []widget.RichTextSegment{style.segment(mathSource(tex, display))}
+		}
+
+		message := style.segment(err.Error())
+		message.Style.Inline = false
+		source := &widget.TextSegment{Style: widget.RichTextStyleCodeBlock, Text: "$$\n" + tex + "\n$$"}
+		return []widget.RichTextSegment{message, source}
+	}
+	return []widget.RichTextSegment{&mathSegment{tex: tex, display: display, style: style}}
+}
+
+// mathSegment is a formula in the preview, drawn as a picture in the color
+// of the text around it. Display formulas are centered blocks, and inline
+// ones are laid out by a mathFlowSegment.
+type mathSegment struct {
+	tex     string
+	display bool
+	style   inlineStyle
+}
+
+// picture draws the formula with the current theme
+func (s *mathSegment) picture() *mathImage {
+	size := theme.TextSize()
+	if s.style.size != "" {
+		size = theme.Size(s.style.size)
+	}
+	name := s.style.color
+	if name == "" {
+		name = theme.ColorNameForeground
+	}
+
+	image, err := cachedMathImage(s.tex, s.display, size*mathTextScale, theme.Color(name))
+	if err != nil {
+		fyne.LogError("Failed to draw formula", err)
+		return &mathImage{}
+	}
+	return image
+}
+
+// image returns the formula as a canvas image at its size on screen, and
+// the distance from its top to the baseline
+func (s *mathSegment) image() (*canvas.Image, float32) {
+	picture := s.picture()
+	if picture.img == nil {
+		return canvas.NewImageFromResource(nil), 0
+	}
+
+	img := canvas.NewImageFromImage(picture.img)
+	img.FillMode = canvas.ImageFillContain
+	bounds := picture.img.Bounds()
+	img.SetMinSize(fyne.NewSize(float32(bounds.Dx())/mathOversample, float32(bounds.Dy())/mathOversample))
+	return img, float32(picture.baseline) / mathOversample
+}
+
+// Inline returns false for display formulas, which are blocks of their own
+func (s *mathSegment) Inline() bool {
+	return !s.display
+}
+
+// Textual returns the TeX source of the formula
+func (s *mathSegment) Textual() string {
+	return s.tex
+}
+
+// Visual returns the formula centered in the width of the preview
+func (s *mathSegment) Visual() fyne.CanvasObject {
+	img, _ := s.image()
+	d := &imageBlock{image: img}
+	d.ExtendBaseWidget(d)
+	return d
+}
+
+// Update draws the formula again, as the theme may have changed
+func (s *mathSegment) Update(o fyne.CanvasObject) {
+	d := o.(*imageBlock)
+	img, _ := s.image()
+	d.image.Image = img.Image
+	d.image.SetMinSize(img.MinSize())
+	d.Refresh()
+}
+
+// Select does nothing as the preview text cannot be selected
+func (s *mathSegment) Select(_, _ fyne.Position) {}
+
+// SelectedText returns an empty string as the preview text cannot be selected
+func (s *mathSegment) SelectedText() string {
+	return ""
+}
+
+// Unselect does nothing as the preview text cannot be selected
+func (s *mathSegment) Unselect() {}
+
+// flowMath puts the segments of a paragraph in a mathFlowSegment if they
+// contain an inline formula, as rich text cannot line pictures up with the
+// baseline of the text around them
+func flowMath(segs []widget.RichTextSegment) ([]widget.RichTextSegment, bool) {
+	for _, seg := range segs {
+		if _, ok := seg.(*mathSegment); ok {
+			return []widget.RichTextSegment{&mathFlowSegment{segments: segs}}, true
+		}
+	}
+	return segs, false
+}
+
+// mathFlowSegment is a paragraph with formulas in it, which wraps its words
+// and formulas itself
+type mathFlowSegment struct {
+	segments []widget.RichTextSegment
+	// bulleted is the paragraph with a list bullet, kept so that rich text
+	// reuses its visual
+	bulleted *mathFlowSegment
+	// visual is kept as rich text forgets the visuals of nested segments,
+	// and a new one would not know its width
+	visual *mathFlow
+}
+
+// withBullet returns the paragraph with a list bullet in front of it
+func (s *mathFlowSegment) withBullet(bullet *widget.TextSegment) *mathFlowSegment {
+	if s.bulleted != nil && s.bulleted.segments[0].Textual() == bullet.Text {
+		return s.bulleted
+	}
+	inline := *bullet
+	inline.Style.Inline = true
+	s.bulleted = &mathFlowSegment{segments: append([]widget.RichTextSegment{&inline}, s.segments...)}
+	return s.bulleted
+}
+
+// Inline returns false as the paragraph is a block
+func (s *mathFlowSegment) Inline() bool {
+	return false
+}
+
+// Textual returns the text of the paragraph, with the source of formulas
+func (s *mathFlowSegment) Textual() string {
+	var buf strings.Builder
+	for _, seg := range s.segments {
+		buf.WriteString(seg.Textual())
+	}
+	return buf.String()
+}
+
+// Visual returns the laid out paragraph
+func (s *mathFlowSegment) Visual() fyne.CanvasObject {
+	if s.visual == nil {
+		s.visual = &mathFlow{segments: s.segments}
+		s.visual.ExtendBaseWidget(s.visual)
+	}
+	return s.visual
+}
+
+// Update rebuilds the paragraph, as the theme may have changed
+func (s *mathFlowSegment) Update(o fyne.CanvasObject) {
+	o.(*mathFlow).Refresh()
+}
+
+// Select does nothing as the preview text cannot be selected
+func (s *mathFlowSegment) Select(_, _ fyne.Position) {}
+
+// SelectedText returns an empty string as the preview text cannot be selected
+func (s *mathFlowSegment) SelectedText() string {
+	return ""
+}
+
+// Unselect does nothing as the preview text cannot be selected
+func (s *mathFlowSegment) Unselect() {}
+
+// mathFlow lays out words, links and formulas in lines that wrap to its
+// width, with everything on a line sharing one baseline
+type mathFlow struct {
+	widget.BaseWidget
+	segments []widget.RichTextSegment
+}
+
+func (f *mathFlow) CreateRenderer() fyne.WidgetRenderer {
+	r := &mathFlowRenderer{flow: f}
+	r.build()
+	return r
+}
+
+// flowItem is one word, formula or picture of a mathFlow
+type flowItem struct {
+	object   fyne.CanvasObject
+	size     fyne.Size
+	baseline float32
+	// space is set when the item ends with a space, where a line may break
+	space bool
+	// newline ends the line, and is as tall as an empty line
+	newline bool
+	x       float32
+}
+
+type mathFlowRenderer struct {
+	flow    *mathFlow
+	items   []flowItem
+	objects []fyne.CanvasObject
+}
+
+// build creates the objects for the segments with the current theme
+func (r *mathFlowRenderer) build() {
+	r.items = r.items[:0]
+	r.objects = r.objects[:0]
+	for _, seg := range r.flow.segments {
+		switch s := seg.(type) {
+		case *widget.TextSegment:
+			size := theme.TextSize()
+			if s.Style.SizeName != "" {
+				size = theme.Size(s.Style.SizeName)
+			}
+			name := s.Style.ColorName
+			if name == "" {
+				name = theme.ColorNameForeground
+			}
+			r.addWords(s.Text, size, s.Style.TextStyle, func(word string) fyne.CanvasObject {
+				text := canvas.NewText(word, theme.Color(name))
+				text.TextSize = size
+				text.TextStyle = s.Style.TextStyle
+				return text
+			})
+			if !s.Style.Inline {
+				r.items = append(r.items, flowItem{newline: true, size: fyne.MeasureText("M", size, s.Style.TextStyle)})
+			}
+		case *widget.HyperlinkSegment:
+			r.addWords(s.Text, theme.TextSize(), fyne.TextStyle{}, func(word string) fyne.CanvasObject {
+				return newFlowLink(word, s.URL)
+			})
+		case *mathSegment:
+			img, baseline := s.image()
+			r.add(flowItem{object: img, size: img.MinSize(), baseline: baseline})
+		default:
+			visual := seg.Visual()
+			size := visual.MinSize()
+			r.add(flowItem{object: visual, size: size, baseline: size.Height})
+		}
+	}
+}
+
+// addWords adds each word of text, keeping its following space with it
+func (r *mathFlowRenderer) addWords(text string, size float32, style fyne.TextStyle, object func(string) fyne.CanvasObject) {
+	for _, word := range strings.SplitAfter(text, " ") {
+		if word == "" {
+			continue
+		}
+		measured, baseline := fyne.CurrentApp().Driver().RenderedTextSize(word, size, style, nil)
+		r.add(flowItem{object: object(word), size: measured, baseline: baseline, space: strings.HasSuffix(word, " ")})
+	}
+}
+
+func (r *mathFlowRenderer) add(item flowItem) {
+	r.items = append(r.items, item)
+	r.objects = append(r.objects, item.object)
+}
+
+// arrange places the items in lines no wider than width, moving them if
+// place is set, and returns the size they take up
+func (r *mathFlowRenderer) arrange(width float32, place bool) fyne.Size {
+	var y, x, widest, ascent, descent float32
+	start := 0
+	breakable := false
+	endLine := func(end int) {
+		for i := start; i < end; i++ {
+			if item := r.items[i]; place && item.object != nil {
+				item.object.Resize(item.size)
+				item.object.Move(fyne.NewPos(item.x, y+ascent-item.baseline))
+			}
+		}
+		widest = fyne.Max(widest, x)
+		y += ascent + descent
+		x, ascent, descent = 0, 0, 0
+		start = end
+		breakable = false
+	}
+
+	for i := range r.items {
+		item := &r.items[i]
+		if item.newline {
+			if start == i {
+				ascent = item.size.Height
+			}
+			endLine(i + 1)
+			continue
+		}
+		if x > 0 && breakable && x+item.size.Width > width {
+			endLine(i)
+		}
+		item.x = x
+		x += item.size.Width
+		ascent = fyne.Max(ascent, item.baseline)
+		descent = fyne.Max(descent, item.size.Height-item.baseline)
+		breakable = item.space
+	}
+	if start < len(r.items) {
+		endLine(len(r.items))
+	}
+	return fyne.NewSize(widest, y)
+}
+
+func (r *mathFlowRenderer) Layout(size fyne.Size) {
+	r.arrange(size.Width, true)
+}
+
+// MinSize is the height of the lines at the current width, as the preview
+// sets the width of its blocks before asking for their height
+func (r *mathFlowRenderer) MinSize() fyne.Size {
+	width := r.flow.Size().Width
+	if width <= 0 {
+		width = math.MaxFloat32
+	}
+	size := r.arrange(width, false)
+	size.Width = fyne.Min(size.Width, width)
+	return size
+}
+
+func (r *mathFlowRenderer) Refresh() {
+	r.build()
+	r.Layout(r.flow.Size())
+	canvas.Refresh(r.flow)
+}
+
+func (r *mathFlowRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *mathFlowRenderer) Destroy() {}
+
+// flowLink is one word of a link in a mathFlow
+type flowLink struct {
+	widget.BaseWidget
+	text *canvas.Text
+	url  *url.URL
+}
+
+func newFlowLink(word string, link *url.URL) *flowLink {
+	l := &flowLink{text: canvas.NewText(word, theme.Color(theme.ColorNameHyperlink)), url: link}
+	l.ExtendBaseWidget(l)
+	return l
+}
+
+// Tapped opens the link like the links of rich text do
+func (l *flowLink) Tapped(*fyne.PointEvent) {
+	if l.url != nil {
+		if err := fyne.CurrentApp().OpenURL(l.url); err != nil {
+			fyne.LogError("Failed to open link", err)
+		}
+	}
+}
+
+// Cursor shows that the word can be clicked
+func (l *flowLink) Cursor() desktop.Cursor {
+	return desktop.PointerCursor
+}
+
+func (l *flowLink) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(l.text)
+}
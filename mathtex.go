@@ -0,0 +1,1285 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// texClass is the TeX class of a node, which decides the space around it
+type texClass int
+
+const (
+	texOrd texClass = iota
+	texOp
+	texBin
+	texRel
+	texOpen
+	texClose
+	texPunct
+	texInner
+	// texNone is for spaces, which leave the classes of their neighbours alone
+	texNone
+)
+
+// texKind is how an atom is written in MathML
+type texKind int
+
+const (
+	texIdentifier texKind = iota
+	texNumber
+	texOperator
+	texText
+)
+
+// texLevel is a TeX style, which sets the size of a formula and where the
+// limits of large operators go
+type texLevel int
+
+const (
+	texDisplay texLevel = iota
+	texInline
+	texScript
+	texScriptScript
+)
+
+// texNode is a node of a parsed formula
+type texNode interface {
+	class() texClass
+}
+
+// texRow is a horizontal list of nodes
+type texRow []texNode
+
+// texAtom is a symbol, number, name or run of text
+type texAtom struct {
+	text string
+	cls  texClass
+	kind texKind
+	// upright identifiers are not set in italics
+	upright bool
+	// limits puts scripts above and below, as for sums and lim
+	limits bool
+	// large operators are bigger in display style
+	large bool
+	// scale enlarges a delimiter sized with \big and friends
+	scale float64
+}
+
+func (a *texAtom) class() texClass { return a.cls }
+
+// texGroup is a braced group, which TeX treats as one ordinary symbol
+type texGroup struct {
+	row texRow
+}
+
+func (g *texGroup) class() texClass { return texOrd }
+
+// texFrac is a fraction, or a binomial coefficient when it has no line
+type texFrac struct {
+	num, den    texRow
+	noLine      bool
+	open, close string
+	// level is the style forced by \dfrac and \tfrac, or -1
+	level texLevel
+}
+
+func (f *texFrac) class() texClass { return texInner }
+
+// texSqrt is a square root, or another root when it has an index
+type texSqrt struct {
+	body, index texRow
+}
+
+func (s *texSqrt) class() texClass { return texOrd }
+
+// texScripts is a base with a subscript, a superscript or both
+type texScripts struct {
+	base     texNode
+	sub, sup texNode
+	// stacked puts the scripts above and below the base even inline, as for
+	// \overset and \underset
+	stacked bool
+}
+
+func (s *texScripts) class() texClass { return s.base.class() }
+
+// limits reports whether the scripts go above and below the base
+func (s *texScripts) limits(level texLevel) bool {
+	if s.stacked {
+		return true
+	}
+	// Labels on horizontal braces go over and under them at any size
+	if accent, ok := s.base.(*texAccent); ok {
+		return accent.mark == "⏞" || accent.mark == "⏟"
+	}
+	atom, ok := s.base.(*texAtom)
+	return ok && atom.limits && level == texDisplay
+}
+
+// texFenced is a row between delimiters that grow to fit it, from \left
+// and \right. An empty delimiter is left out.
+type texFenced struct {
+	open, close string
+	body        texRow
+}
+
+func (f *texFenced) class() texClass { return texInner }
+
+// texSpace is horizontal space in ems
+type texSpace struct {
+	em float64
+}
+
+func (s *texSpace) class() texClass { return texNone }
+
+// texAccent is a mark above or below its base
+type texAccent struct {
+	base     texRow
+	mark     string
+	stretchy bool
+	under    bool
+}
+
+func (a *texAccent) class() texClass { return texOrd }
+
+// texTable is a matrix, a set of cases or aligned equations
+type texTable struct {
+	rows [][]texRow
+	// align holds 'l', 'c' or 'r' for each column. Further columns use
+	// alternate when it is set, and are centered otherwise.
+	align     []byte
+	alternate bool
+	// open and close are the delimiters around the table, if any
+	open, close string
+	small       bool
+}
+
+func (t *texTable) class() texClass { return texInner }
+
+// columnAlign returns the alignment of a column
+func (t *texTable) columnAlign(column int) byte {
+	if column < len(t.align) {
+		return t.align[column]
+	}
+	if t.alternate {
+		return "rl"[column%2]
+	}
+	return 'c'
+}
+
+// texStyle sets the rest of a row in another style, from \displaystyle and
+// friends
+type texStyle struct {
+	level texLevel
+	row   texRow
+}
+
+func (s *texStyle) class() texClass { return texOrd }
+
+// Symbol constructors for the command tables
+func texOrdinary(text string) texAtom { return texAtom{text: text, cls: texOrd, kind: texIdentifier} }
+func texUpright(text string) texAtom {
+	return texAtom{text: text, cls: texOrd, kind: texIdentifier, upright: true}
+}
+func texSymbol(text string) texAtom { return texAtom{text: text, cls: texOrd, kind: texOperator} }
+func texBinary(text string) texAtom { return texAtom{text: text, cls: texBin, kind: texOperator} }
+func texRelation(text string) texAtom {
+	return texAtom{text: text, cls: texRel, kind: texOperator}
+}
+func texLarge(text string, limits bool) texAtom {
+	return texAtom{text: text, cls: texOp, kind: texOperator, large: true, limits: limits}
+}
+func texFunction(name string, limits bool) texAtom {
+	return texAtom{text: name, cls: texOp, kind: texIdentifier, upright: true, limits: limits}
+}
+
+// texSymbols are the commands that stand for one symbol
+var texSymbols = map[string]texAtom{
+	// Greek letters
+	"alpha": texOrdinary("α"), "beta": texOrdinary("β"), "gamma": texOrdinary("γ"),
+	"delta": texOrdinary("δ"), "epsilon": texOrdinary("ϵ"), "varepsilon": texOrdinary("ε"),
+	"zeta": texOrdinary("ζ"), "eta": texOrdinary("η"), "theta": texOrdinary("θ"),
+	"vartheta": texOrdinary("ϑ"), "iota": texOrdinary("ι"), "kappa": texOrdinary("κ"),
+	"lambda": texOrdinary("λ"), "mu": texOrdinary("μ"), "nu": texOrdinary("ν"),
+	"xi": texOrdinary("ξ"), "pi": texOrdinary("π"), "varpi": texOrdinary("ϖ"),
+	"rho": texOrdinary("ρ"), "varrho": texOrdinary("ϱ"), "sigma": texOrdinary("σ"),
+	"varsigma": texOrdinary("ς"), "tau": texOrdinary("τ"), "upsilon": texOrdinary("υ"),
+	"phi": texOrdinary("ϕ"), "varphi": texOrdinary("φ"), "chi": texOrdinary("χ"),
+	"psi": texOrdinary("ψ"), "omega": texOrdinary("ω"),
+	"Gamma": texUpright("Γ"), "Delta": texUpright("Δ"), "Theta": texUpright("Θ"),
+	"Lambda": texUpright("Λ"), "Xi": texUpright("Ξ"), "Pi": texUpright("Π"),
+	"Sigma": texUpright("Σ"), "Upsilon": texUpright("Υ"), "Phi": texUpright("Φ"),
+	"Psi": texUpright("Ψ"), "Omega": texUpright("Ω"),
+
+	// Ordinary symbols
+	"infty": texSymbol("∞"), "partial": texSymbol("∂"), "nabla": texSymbol("∇"),
+	"forall": texSymbol("∀"), "exists": texSymbol("∃"), "nexists": texSymbol("∄"),
+	"emptyset": texSymbol("∅"), "varnothing": texSymbol("∅"), "neg": texSymbol("¬"),
+	"lnot": texSymbol("¬"), "hbar": texOrdinary("ℏ"), "ell": texOrdinary("ℓ"),
+	"Re": texUpright("ℜ"), "Im": texUpright("ℑ"), "aleph": texUpright("ℵ"),
+	"wp": texOrdinary("℘"), "angle": texSymbol("∠"), "triangle": texSymbol("△"),
+	"prime": texSymbol("′"), "degree": texSymbol("°"), "cdots": texSymbol("⋯"),
+	"ldots": texSymbol("…"), "dots": texSymbol("…"), "vdots": texSymbol("⋮"),
+	"ddots": texSymbol("⋱"), "top": texSymbol("⊤"), "bot": texSymbol("⊥"),
+	"imath": texOrdinary("ı"), "jmath": texOrdinary("ȷ"), "checkmark": texSymbol("✓"),
+	"|": texSymbol("‖"), "vert": texSymbol("|"), "Vert": texSymbol("‖"),
+	"backslash": texSymbol("∖"), "%": texSymbol("%"), "$": texSymbol("$"),
+	"&": texSymbol("&"), "#": texSymbol("#"), "_": texSymbol("_"),
+	"clubsuit": texSymbol("♣"), "diamondsuit": texSymbol("♢"), "heartsuit": texSymbol("♡"),
+	"spadesuit": texSymbol("♠"), "square": texSymbol("□"), "blacksquare": texSymbol("■"),
+
+	// Binary operators
+	"pm": texBinary("±"), "mp": texBinary("∓"), "times": texBinary("×"),
+	"div": texBinary("÷"), "cdot": texBinary("⋅"), "ast": texBinary("∗"),
+	"star": texBinary("⋆"), "circ": texBinary("∘"), "bullet": texBinary("∙"),
+	"cap": texBinary("∩"), "cup": texBinary("∪"), "vee": texBinary("∨"),
+	"lor": texBinary("∨"), "wedge": texBinary("∧"), "land": texBinary("∧"),
+	"setminus": texBinary("∖"), "oplus": texBinary("⊕"), "ominus": texBinary("⊖"),
+	"otimes": texBinary("⊗"), "oslash": texBinary("⊘"), "odot": texBinary("⊙"),
+	"sqcup": texBinary("⊔"), "sqcap": texBinary("⊓"), "uplus": texBinary("⊎"),
+	"amalg": texBinary("⨿"), "wr": texBinary("≀"), "dagger": texBinary("†"),
+	"ddagger": texBinary("‡"), "bmod": {text: "mod", cls: texBin, kind: texIdentifier, upright: true},
+
+	// Relations
+	"leq": texRelation("≤"), "le": texRelation("≤"), "geq": texRelation("≥"),
+	"ge": texRelation("≥"), "neq": texRelation("≠"), "ne": texRelation("≠"),
+	"equiv": texRelation("≡"), "approx": texRelation("≈"), "sim": texRelation("∼"),
+	"simeq": texRelation("≃"), "cong": texRelation("≅"), "propto": texRelation("∝"),
+	"in": texRelation("∈"), "notin": texRelation("∉"), "ni": texRelation("∋"),
+	"subset": texRelation("⊂"), "supset": texRelation("⊃"), "subseteq": texRelation("⊆"),
+	"supseteq": texRelation("⊇"), "subsetneq": texRelation("⊊"), "supsetneq": texRelation("⊋"),
+	"ll": texRelation("≪"), "gg": texRelation("≫"), "perp": texRelation("⊥"),
+	"parallel": texRelation("∥"), "mid": texRelation("∣"), "nmid": texRelation("∤"),
+	"prec": texRelation("≺"), "succ": texRelation("≻"), "preceq": texRelation("⪯"),
+	"succeq": texRelation("⪰"), "vdash": texRelation("⊢"), "dashv": texRelation("⊣"),
+	"models": texRelation("⊨"), "asymp": texRelation("≍"), "doteq": texRelation("≐"),
+	"leqslant": texRelation("⩽"), "geqslant": texRelation("⩾"), "lesssim": texRelation("≲"),
+	"gtrsim": texRelation("≳"), "coloneqq": texRelation("≔"), "triangleq": texRelation("≜"),
+	"to": texRelation("→"), "rightarrow": texRelation("→"), "leftarrow": texRelation("←"),
+	"gets": texRelation("←"), "leftrightarrow": texRelation("↔"), "Rightarrow": texRelation("⇒"),
+	"Leftarrow": texRelation("⇐"), "Leftrightarrow": texRelation("⇔"), "implies": texRelation("⟹"),
+	"impliedby": texRelation("⟸"), "iff": texRelation("⟺"), "mapsto": texRelation("↦"),
+	"longrightarrow": texRelation("⟶"), "longleftarrow": texRelation("⟵"),
+	"longleftrightarrow": texRelation("⟷"), "Longrightarrow": texRelation("⟹"),
+	"Longleftarrow": texRelation("⟸"), "Longleftrightarrow": texRelation("⟺"),
+	"longmapsto": texRelation("⟼"), "uparrow": texRelation("↑"), "downarrow": texRelation("↓"),
+	"updownarrow": texRelation("↕"), "Uparrow": texRelation("⇑"), "Downarrow": texRelation("⇓"),
+	"nearrow": texRelation("↗"), "searrow": texRelation("↘"), "swarrow": texRelation("↙"),
+	"nwarrow": texRelation("↖"), "hookrightarrow": texRelation("↪"), "hookleftarrow": texRelation("↩"),
+	"rightleftharpoons": texRelation("⇌"),
+
+	// Large operators
+	"sum": texLarge("∑", true), "prod": texLarge("∏", true), "coprod": texLarge("∐", true),
+	"int": texLarge("∫", false), "iint": texLarge("∬", false), "iiint": texLarge("∭", false),
+	"oint": texLarge("∮", false), "bigcup": texLarge("⋃", true), "bigcap": texLarge("⋂", true),
+	"bigoplus": texLarge("⨁", true), "bigotimes": texLarge("⨂", true), "bigodot": texLarge("⨀", true),
+	"bigvee": texLarge("⋁", true), "bigwedge": texLarge("⋀", true), "bigsqcup": texLarge("⨆", true),
+	"biguplus": texLarge("⨄", true),
+
+	// Punctuation
+	"colon": {text: ":", cls: texPunct, kind: texOperator},
+}
+
+// texFunctions are the named functions set upright, and whether they take
+// limits like lim
+var texFunctions = map[string]bool{
+	"sin": false, "cos": false, "tan": false, "cot": false, "sec": false, "csc": false,
+	"arcsin": false, "arccos": false, "arctan": false, "sinh": false, "cosh": false,
+	"tanh": false, "coth": false, "log": false, "ln": false, "lg": false, "exp": false,
+	"deg": false, "dim": false, "ker": false, "hom": false, "arg": false,
+	"lim": true, "limsup": true, "liminf": true, "max": true, "min": true, "sup": true,
+	"inf": true, "det": true, "Pr": true, "gcd": true, "argmax": true, "argmin": true,
+}
+
+// texDelimiters are the delimiters that \left, \right and \big accept
+var texDelimiters = map[string]string{
+	"(": "(", ")": ")", "[": "[", "]": "]", `\{`: "{", `\}`: "}", "|": "|", `\|`: "‖",
+	"/": "/", ".": "", "<": "⟨", ">": "⟩",
+	`\lbrace`: "{", `\rbrace`: "}", `\lbrack`: "[", `\rbrack`: "]",
+	`\langle`: "⟨", `\rangle`: "⟩", `\lfloor`: "⌊", `\rfloor`: "⌋", `\lceil`: "⌈", `\rceil`: "⌉",
+	`\vert`: "|", `\Vert`: "‖", `\lvert`: "|", `\rvert`: "|", `\lVert`: "‖", `\rVert`: "‖",
+	`\uparrow`: "↑", `\downarrow`: "↓", `\updownarrow`: "↕", `\backslash`: "∖",
+}
+
+// texSpaces are the spacing commands, in ems
+var texSpaces = map[string]float64{
+	`\,`: 3.0 / 18, `\thinspace`: 3.0 / 18, `\:`: 4.0 / 18, `\>`: 4.0 / 18,
+	`\medspace`: 4.0 / 18, `\;`: 5.0 / 18, `\thickspace`: 5.0 / 18, `\!`: -3.0 / 18,
+	`\negthinspace`: -3.0 / 18, `\ `: 0.25, "~": 0.25, `\enspace`: 0.5, `\quad`: 1, `\qquad`: 2,
+}
+
+// texAccents are the marks put above or below their argument
+var texAccents = map[string]texAccent{
+	`\hat`: {mark: "^"}, `\widehat`: {mark: "^", stretchy: true},
+	`\check`: {mark: "ˇ"}, `\widecheck`: {mark: "ˇ", stretchy: true},
+	`\tilde`: {mark: "~"}, `\widetilde`: {mark: "~", stretchy: true},
+	`\bar`: {mark: "¯"}, `\overline`: {mark: "‾", stretchy: true},
+	`\vec`: {mark: "→"}, `\overrightarrow`: {mark: "→", stretchy: true},
+	`\overleftarrow`: {mark: "←", stretchy: true},
+	`\dot`:           {mark: "˙"}, `\ddot`: {mark: "¨"}, `\acute`: {mark: "´"}, `\grave`: {mark: "`"},
+	`\breve`: {mark: "˘"}, `\mathring`: {mark: "˚"},
+	`\overbrace`:  {mark: "⏞", stretchy: true},
+	`\underline`:  {mark: "_", stretchy: true, under: true},
+	`\underbrace`: {mark: "⏟", stretchy: true, under: true},
+}
+
+// texNegations are the symbols that \not crosses out with one of their own
+var texNegations = map[string]string{
+	"=": "≠", "∈": "∉", "⊂": "⊄", "⊃": "⊅", "⊆": "⊈", "⊇": "⊉", "≡": "≢", "∼": "≁",
+	"≈": "≉", "≅": "≇", "<": "≮", ">": "≯", "≤": "≰", "≥": "≱", "∣": "∤", "∥": "∦",
+}
+
+// texParser parses the subset of TeX math that the editor can typeset
+type texParser struct {
+	src string
+	pos int
+}
+
+// parseTeX parses a formula. Rows separated by \\ outside an environment
+// are gathered into a table.
+func parseTeX(src string) (texRow, error) {
+	p := &texParser{src: src}
+	rows, err := p.parseRows()
+	if err != nil {
+		return nil, err
+	}
+	switch p.peek() {
+	case "":
+	case "}":
+		return nil, fmt.Errorf("unmatched }")
+	case `\right`:
+		return nil, fmt.Errorf(`\right without \left`)
+	case `\end`:
+		return nil, fmt.Errorf(`\end without \begin`)
+	default:
+		return nil, fmt.Errorf("unexpected %s", p.peek())
+	}
+
+	if len(rows) == 1 && len(rows[0]) == 1 {
+		return rows[0][0], nil
+	}
+	table := &texTable{rows: rows}
+	for _, row := range rows {
+		table.alternate = table.alternate || len(row) > 1
+	}
+	return texRow{table}, nil
+}
+
+// skipSpace skips white space and comments
+func (p *texParser) skipSpace() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '%':
+			end := strings.IndexByte(p.src[p.pos:], '\n')
+			if end < 0 {
+				p.pos = len(p.src)
+			} else {
+				p.pos += end + 1
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// token reads the next token from pos, returning it and where it ends. A
+// token is a command such as \frac or \{, or a single character.
+func (p *texParser) token() (string, int) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return "", p.pos
+	}
+	if p.src[p.pos] != '\\' {
+		_, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		return p.src[p.pos : p.pos+size], p.pos + size
+	}
+
+	end := p.pos + 1
+	for end < len(p.src) && isASCIILetter(p.src[end]) {
+		end++
+	}
+	if end == p.pos+1 && end < len(p.src) {
+		// A command made of one character that is not a letter
+		_, size := utf8.DecodeRuneInString(p.src[end:])
+		end += size
+	}
+	return p.src[p.pos:end], end
+}
+
+func (p *texParser) peek() string {
+	tok, _ := p.token()
+	return tok
+}
+
+func (p *texParser) next() string {
+	tok, end := p.token()
+	p.pos = end
+	return tok
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parseRows parses cells separated by & and rows separated by \\, up to a
+// token that ends them, which is left to the caller
+func (p *texParser) parseRows() ([][]texRow, error) {
+	var rows [][]texRow
+	var cells []texRow
+	for {
+		cell, err := p.parseRow()
+		if err != nil {
+			return nil, err
+		}
+		cells = append(cells, cell)
+
+		switch p.peek() {
+		case "&":
+			p.next()
+		case `\\`, `\cr`:
+			p.next()
+			p.skipOptional()
+			rows = append(rows, cells)
+			cells = nil
+		default:
+			// A \\ at the end of the last row does not start another one
+			if len(rows) == 0 || len(cells) > 1 || len(cells[0]) > 0 {
+				rows = append(rows, cells)
+			}
+			return rows, nil
+		}
+	}
+}
+
+// parseRow parses nodes up to a closing brace, a cell or row separator,
+// \right, \end or the end of the formula, which is left to the caller
+func (p *texParser) parseRow() (texRow, error) {
+	var row texRow
+	for {
+		tok := p.peek()
+		switch tok {
+		case "", "}", "&", `\\`, `\cr`, `\right`, `\end`:
+			return row, nil
+		case "^", "_":
+			p.next()
+			if err := p.attachScript(&row, tok); err != nil {
+				return nil, err
+			}
+			continue
+		case "'":
+			primes := ""
+			for p.peek() == "'" {
+				p.next()
+				primes += "′"
+			}
+			scripted := p.scripted(&row)
+			if scripted.sup != nil {
+				return nil, fmt.Errorf("double superscript")
+			}
+			scripted.sup = &texAtom{text: primes, cls: texOrd, kind: texOperator}
+			continue
+		case `\displaystyle`, `\textstyle`, `\scriptstyle`, `\scriptscriptstyle`:
+			p.next()
+			rest, err := p.parseRow()
+			if err != nil {
+				return nil, err
+			}
+			level := map[string]texLevel{`\displaystyle`: texDisplay, `\textstyle`: texInline,
+				`\scriptstyle`: texScript, `\scriptscriptstyle`: texScriptScript}[tok]
+			return append(row, &texStyle{level: level, row: rest}), nil
+		case `\limits`, `\nolimits`:
+			p.next()
+			if atom := lastAtom(row); atom != nil && atom.cls == texOp {
+				atom.limits = tok == `\limits`
+			}
+			continue
+		}
+
+		node, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		if node == nil {
+			continue
+		}
+		// Digits are read one at a time, so that \frac12 works, and joined here
+		if atom, ok := node.(*texAtom); ok && atom.kind == texNumber {
+			if last := lastAtom(row); last != nil && last.kind == texNumber {
+				last.text += atom.text
+				continue
+			}
+		}
+		row = append(row, node)
+	}
+}
+
+// lastAtom returns the last node of a row if it is an atom without scripts
+func lastAtom(row texRow) *texAtom {
+	if len(row) == 0 {
+		return nil
+	}
+	atom, _ := row[len(row)-1].(*texAtom)
+	return atom
+}
+
+// scripted returns the last node of a row with room for scripts, adding an
+// empty base if the row has none
+func (p *texParser) scripted(row *texRow) *texScripts {
+	if n := len(*row); n > 0 {
+		if scripts, ok := (*row)[n-1].(*texScripts); ok && !scripts.stacked {
+			return scripts
+		}
+		scripts := &texScripts{base: (*row)[n-1]}
+		(*row)[n-1] = scripts
+		return scripts
+	}
+	scripts := &texScripts{base: &texGroup{}}
+	*row = append(*row, scripts)
+	return scripts
+}
+
+// attachScript reads the argument of ^ or _ and attaches it to the last node
+func (p *texParser) attachScript(row *texRow, op string) error {
+	arg, err := p.parseArgument(op)
+	if err != nil {
+		return err
+	}
+	scripts := p.scripted(row)
+	if op == "^" {
+		if scripts.sup != nil {
+			return fmt.Errorf("double superscript")
+		}
+		scripts.sup = arg
+	} else {
+		if scripts.sub != nil {
+			return fmt.Errorf("double subscript")
+		}
+		scripts.sub = arg
+	}
+	return nil
+}
+
+// parseArgument parses the argument of a command or script, which is a
+// braced group or a single symbol
+func (p *texParser) parseArgument(command string) (texNode, error) {
+	switch p.peek() {
+	case "", "}", "&", `\\`, "^", "_", `\right`, `\end`:
+		return nil, fmt.Errorf("%s is missing an argument", command)
+	}
+	node, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	if node == nil {
+		return &texGroup{}, nil
+	}
+	return node, nil
+}
+
+// parseRowArgument parses an argument as a row
+func (p *texParser) parseRowArgument(command string) (texRow, error) {
+	node, err := p.parseArgument(command)
+	if err != nil {
+		return nil, err
+	}
+	if group, ok := node.(*texGroup); ok {
+		return group.row, nil
+	}
+	return texRow{node}, nil
+}
+
+// rawArgument reads a braced argument as text, as for \text and \begin
+func (p *texParser) rawArgument(command string) (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) || p.src[p.pos] != '{' {
+		return "", fmt.Errorf("%s is missing an argument", command)
+	}
+	var buf strings.Builder
+	depth := 0
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch c := p.src[i]; c {
+		case '\\':
+			if i+1 < len(p.src) {
+				i++
+				if next := p.src[i]; strings.IndexByte(`{}$%&#_ \`, next) >= 0 {
+					buf.WriteByte(next)
+				} else {
+					buf.WriteByte('\\')
+					buf.WriteByte(next)
+				}
+			}
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				p.pos = i + 1
+				return buf.String(), nil
+			}
+			depth--
+		case '~':
+			buf.WriteRune(' ')
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("missing } after %s", command)
+}
+
+// skipOptional skips an optional [..] argument, as after \\
+func (p *texParser) skipOptional() {
+	if p.peek() == "[" {
+		if end := strings.IndexByte(p.src[p.pos:], ']'); end >= 0 {
+			p.pos += end + 1
+		}
+	}
+}
+
+// optionalRow parses an optional [..] argument as a row, as for \sqrt
+func (p *texParser) optionalRow() (texRow, error) {
+	if p.peek() != "[" {
+		return nil, nil
+	}
+	p.next()
+	var row texRow
+	for p.peek() != "]" {
+		if p.peek() == "" {
+			return nil, fmt.Errorf("missing ] in \\sqrt")
+		}
+		node, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			row = append(row, node)
+		}
+	}
+	p.next()
+	return row, nil
+}
+
+// parseDelimiter reads the delimiter after \left, \right or \big
+func (p *texParser) parseDelimiter(command string) (string, error) {
+	tok := p.next()
+	delimiter, ok := texDelimiters[tok]
+	if !ok {
+		if tok == "" {
+			return "", fmt.Errorf("%s is missing a delimiter", command)
+		}
+		return "", fmt.Errorf("%s cannot be used after %s", tok, command)
+	}
+	return delimiter, nil
+}
+
+// parseNode parses one symbol, group or command with its arguments. It
+// returns nil for commands that add nothing.
+func (p *texParser) parseNode() (texNode, error) {
+	tok := p.next()
+	if !strings.HasPrefix(tok, `\`) || len(tok) == 1 {
+		return p.parseCharacter(tok)
+	}
+
+	name := tok[1:]
+	if atom, ok := texSymbols[name]; ok {
+		return &atom, nil
+	}
+	if limits, ok := texFunctions[name]; ok {
+		atom := texFunction(name, limits)
+		return &atom, nil
+	}
+	if em, ok := texSpaces[tok]; ok {
+		return &texSpace{em: em}, nil
+	}
+	if accent, ok := texAccents[tok]; ok {
+		base, err := p.parseRowArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		accent.base = base
+		return &accent, nil
+	}
+	if delimiter, ok := texDelimiters[tok]; ok {
+		atom := texDelimiterAtom(delimiter)
+		return atom, nil
+	}
+	if variant, ok := texVariants[name]; ok {
+		row, err := p.parseRowArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		applyTeXVariant(row, variant)
+		return &texGroup{row: row}, nil
+	}
+
+	switch tok {
+	case `\frac`, `\dfrac`, `\tfrac`, `\cfrac`, `\binom`, `\dbinom`, `\tbinom`:
+		num, err := p.parseRowArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		den, err := p.parseRowArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		frac := &texFrac{num: num, den: den, level: -1}
+		switch tok {
+		case `\dfrac`, `\cfrac`, `\dbinom`:
+			frac.level = texDisplay
+		case `\tfrac`, `\tbinom`:
+			frac.level = texInline
+		}
+		if strings.HasSuffix(tok, "binom") {
+			frac.noLine, frac.open, frac.close = true, "(", ")"
+		}
+		return frac, nil
+	case `\sqrt`:
+		index, err := p.optionalRow()
+		if err != nil {
+			return nil, err
+		}
+		body, err := p.parseRowArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		return &texSqrt{body: body, index: index}, nil
+	case `\left`:
+		open, err := p.parseDelimiter(tok)
+		if err != nil {
+			return nil, err
+		}
+		body, err := p.parseRow()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != `\right` {
+			return nil, fmt.Errorf(`\left without \right`)
+		}
+		close, err := p.parseDelimiter(`\right`)
+		if err != nil {
+			return nil, err
+		}
+		return &texFenced{open: open, close: close, body: body}, nil
+	case `\big`, `\Big`, `\bigg`, `\Bigg`, `\bigl`, `\Bigl`, `\biggl`, `\Biggl`,
+		`\bigr`, `\Bigr`, `\biggr`, `\Biggr`, `\bigm`, `\Bigm`, `\biggm`, `\Biggm`:
+		delimiter, err := p.parseDelimiter(tok)
+		if err != nil {
+			return nil, err
+		}
+		atom := texDelimiterAtom(delimiter)
+		atom.scale = map[string]float64{"big": 1.2, "Big": 1.8, "bigg": 2.4, "Bigg": 3}[strings.TrimRight(name, "lrm")]
+		switch name[len(name)-1] {
+		case 'l':
+			atom.cls = texOpen
+		case 'r':
+			atom.cls = texClose
+		case 'm':
+			atom.cls = texRel
+		}
+		return atom, nil
+	case `\text`, `\textrm`, `\textnormal`, `\textit`, `\textbf`, `\textsf`, `\texttt`, `\mbox`, `\hbox`:
+		text, err := p.rawArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		return &texAtom{text: text, cls: texOrd, kind: texText}, nil
+	case `\operatorname`, `\operatorname*`:
+		limits := false
+		if p.peek() == "*" {
+			p.next()
+			limits = true
+		}
+		text, err := p.rawArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		atom := texFunction(strings.TrimSpace(text), limits)
+		return &atom, nil
+	case `\pmod`:
+		row, err := p.parseRowArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		mod := texFunction("mod", false)
+		inner := append(texRow{&mod, &texSpace{em: 1.0 / 3}}, row...)
+		return &texGroup{row: texRow{&texSpace{em: 1}, &texAtom{text: "(", cls: texOpen, kind: texOperator},
+			&texGroup{row: inner}, &texAtom{text: ")", cls: texClose, kind: texOperator}}}, nil
+	case `\not`:
+		node, err := p.parseArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		if atom, ok := node.(*texAtom); ok {
+			if negated, ok := texNegations[atom.text]; ok {
+				atom.text = negated
+			} else {
+				atom.text += "̸"
+			}
+		}
+		return node, nil
+	case `\overset`, `\underset`, `\stackrel`:
+		script, err := p.parseArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		base, err := p.parseArgument(tok)
+		if err != nil {
+			return nil, err
+		}
+		scripts := &texScripts{base: base, stacked: true}
+		if tok == `\underset` {
+			scripts.sub = script
+		} else {
+			scripts.sup = script
+		}
+		return scripts, nil
+	case `\begin`:
+		return p.parseEnvironment()
+	}
+	return nil, fmt.Errorf("unknown command %s", tok)
+}
+
+// texDelimiterAtom returns a delimiter as an atom of the class it has alone
+func texDelimiterAtom(delimiter string) *texAtom {
+	atom := &texAtom{text: delimiter, cls: texOrd, kind: texOperator}
+	switch delimiter {
+	case "(", "[", "{", "⟨", "⌊", "⌈":
+		atom.cls = texOpen
+	case ")", "]", "}", "⟩", "⌋", "⌉":
+		atom.cls = texClose
+	}
+	return atom
+}
+
+// parseCharacter parses a token that is not a command
+func (p *texParser) parseCharacter(tok string) (texNode, error) {
+	switch tok {
+	case "{":
+		row, err := p.parseRow()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != "}" {
+			return nil, fmt.Errorf("missing }")
+		}
+		return &texGroup{row: row}, nil
+	case "+":
+		return &texAtom{text: "+", cls: texBin, kind: texOperator}, nil
+	case "-":
+		return &texAtom{text: "−", cls: texBin, kind: texOperator}, nil
+	case "*":
+		return &texAtom{text: "∗", cls: texBin, kind: texOperator}, nil
+	case "=", "<", ">", ":":
+		return &texAtom{text: tok, cls: texRel, kind: texOperator}, nil
+	case "(", "[":
+		return &texAtom{text: tok, cls: texOpen, kind: texOperator}, nil
+	case ")", "]", "!", "?":
+		return &texAtom{text: tok, cls: texClose, kind: texOperator}, nil
+	case ",", ";":
+		return &texAtom{text: tok, cls: texPunct, kind: texOperator}, nil
+	case "|", "/", "@":
+		return &texAtom{text: tok, cls: texOrd, kind: texOperator}, nil
+	case "~":
+		return &texSpace{em: texSpaces["~"]}, nil
+	case "\\":
+		return nil, fmt.Errorf(`\ at the end of the formula`)
+	case "#", "$":
+		return nil, fmt.Errorf("%s cannot be used in math", tok)
+	}
+
+	r, _ := utf8.DecodeRuneInString(tok)
+	switch {
+	case r >= '0' && r <= '9', r == '.':
+		return &texAtom{text: tok, cls: texOrd, kind: texNumber}, nil
+	case unicode.IsLetter(r):
+		return &texAtom{text: tok, cls: texOrd, kind: texIdentifier}, nil
+	}
+	return &texAtom{text: tok, cls: texOrd, kind: texOperator}, nil
+}
+
+// parseEnvironment parses \begin{name}..\end{name}
+func (p *texParser) parseEnvironment() (texNode, error) {
+	name, err := p.rawArgument(`\begin`)
+	if err != nil {
+		return nil, err
+	}
+	table := &texTable{}
+	switch name {
+	case "matrix":
+	case "pmatrix":
+		table.open, table.close = "(", ")"
+	case "bmatrix":
+		table.open, table.close = "[", "]"
+	case "Bmatrix":
+		table.open, table.close = "{", "}"
+	case "vmatrix":
+		table.open, table.close = "|", "|"
+	case "Vmatrix":
+		table.open, table.close = "‖", "‖"
+	case "smallmatrix":
+		table.small = true
+	case "cases":
+		table.open, table.align = "{", []byte("ll")
+	case "rcases":
+		table.close, table.align = "}", []byte("ll")
+	case "aligned", "align", "align*", "split", "alignat", "alignat*", "alignedat", "eqnarray", "eqnarray*":
+		table.alternate = true
+		if strings.HasPrefix(name, "alignat") || name == "alignedat" {
+			// The number of columns is not needed
+			if _, err := p.rawArgument(`\begin{` + name + `}`); err != nil {
+				return nil, err
+			}
+		}
+	case "gathered", "gather", "gather*", "equation", "equation*":
+	case "array":
+		spec, err := p.rawArgument(`\begin{array}`)
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < len(spec); i++ {
+			if c := spec[i]; c == 'l' || c == 'c' || c == 'r' {
+				table.align = append(table.align, c)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown environment %s", name)
+	}
+
+	table.rows, err = p.parseRows()
+	if err != nil {
+		return nil, err
+	}
+	if p.next() != `\end` {
+		return nil, fmt.Errorf(`\begin{%s} without \end`, name)
+	}
+	end, err := p.rawArgument(`\end`)
+	if err != nil {
+		return nil, err
+	}
+	if end != name {
+		return nil, fmt.Errorf(`\begin{%s} ended by \end{%s}`, name, end)
+	}
+	return table, nil
+}
+
+// texVariant is a math alphabet, from \mathbf and friends
+type texVariant int
+
+const (
+	texVariantUpright texVariant = iota
+	texVariantBold
+	texVariantItalic
+	texVariantBoldItalic
+	texVariantDoubleStruck
+	texVariantScript
+	texVariantFraktur
+	texVariantSansSerif
+	texVariantMonospace
+)
+
+// texVariants are the commands that set their argument in another alphabet
+var texVariants = map[string]texVariant{
+	"mathrm": texVariantUpright, "mathup": texVariantUpright, "mathbf": texVariantBold,
+	"mathit": texVariantItalic, "boldsymbol": texVariantBoldItalic, "bm": texVariantBoldItalic,
+	"mathbb": texVariantDoubleStruck, "mathcal": texVariantScript, "mathscr": texVariantScript,
+	"mathfrak": texVariantFraktur, "mathsf": texVariantSansSerif, "mathtt": texVariantMonospace,
+}
+
+// applyTeXVariant sets the letters and digits of a row in an alphabet,
+// using the Unicode mathematical alphanumeric symbols so that they need no
+// font of their own
+func applyTeXVariant(row texRow, variant texVariant) {
+	for _, node := range row {
+		switch n := node.(type) {
+		case *texAtom:
+			if n.kind != texIdentifier && n.kind != texNumber {
+				continue
+			}
+			if variant == texVariantUpright {
+				n.upright = true
+				continue
+			}
+			var buf strings.Builder
+			for _, r := range n.text {
+				buf.WriteRune(mathAlphanumeric(r, variant))
+			}
+			n.text = buf.String()
+			// The alphabets carry their own slant
+			n.upright = true
+		case *texGroup:
+			applyTeXVariant(n.row, variant)
+		case *texScripts:
+			applyTeXVariant(texRow{n.base}, variant)
+		case *texFrac:
+			applyTeXVariant(n.num, variant)
+			applyTeXVariant(n.den, variant)
+		case *texSqrt:
+			applyTeXVariant(n.body, variant)
+		case *texFenced:
+			applyTeXVariant(n.body, variant)
+		case *texAccent:
+			applyTeXVariant(n.base, variant)
+		}
+	}
+}
+
+// mathAlphabets holds the first capital, small letter and digit of each
+// alphabet in the mathematical alphanumeric symbols block, or 0 where the
+// alphabet has none
+var mathAlphabets = map[texVariant][3]rune{
+	texVariantBold:         {0x1D400, 0x1D41A, 0x1D7CE},
+	texVariantItalic:       {0x1D434, 0x1D44E, 0},
+	texVariantBoldItalic:   {0x1D468, 0x1D482, 0x1D7CE},
+	texVariantDoubleStruck: {0x1D538, 0x1D552, 0x1D7D8},
+	texVariantScript:       {0x1D49C, 0x1D4B6, 0},
+	texVariantFraktur:      {0x1D504, 0x1D51E, 0},
+	texVariantSansSerif:    {0x1D5A0, 0x1D5BA, 0x1D7E2},
+	texVariantMonospace:    {0x1D670, 0x1D68A, 0x1D7F6},
+}
+
+// mathAlphabetHoles are the letters that Unicode had encoded before the
+// block, which are left out of it
+var mathAlphabetHoles = map[texVariant]map[rune]rune{
+	texVariantItalic: {'h': 'ℎ'},
+	texVariantDoubleStruck: {'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ',
+		'Z': 'ℤ'},
+	texVariantScript: {'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ',
+		'R': 'ℛ', 'e': 'ℯ', 'g': 'ℊ', 'o': 'ℴ'},
+	texVariantFraktur: {'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ'},
+}
+
+// mathAlphanumeric returns a letter or digit in an alphabet, or r itself
+// if the alphabet does not have it
+func mathAlphanumeric(r rune, variant texVariant) rune {
+	if hole, ok := mathAlphabetHoles[variant][r]; ok {
+		return hole
+	}
+	starts, ok := mathAlphabets[variant]
+	if !ok {
+		return r
+	}
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return starts[0] + r - 'A'
+	case r >= 'a' && r <= 'z':
+		return starts[1] + r - 'a'
+	case r >= '0' && r <= '9' && starts[2] != 0:
+		return starts[2] + r - '0'
+	case variant == texVariantBold && r >= 'Α' && r <= 'Ω':
+		return 0x1D6A8 + r - 'Α'
+	case variant == texVariantBold && r >= 'α' && r <= 'ω':
+		return 0x1D6C2 + r - 'α'
+	case variant == texVariantBoldItalic && r >= 'Α' && r <= 'Ω':
+		return 0x1D71C + r - 'Α'
+	case variant == texVariantBoldItalic && r >= 'α' && r <= 'ω':
+		return 0x1D736 + r - 'α'
+	}
+	return r
+}
+
+// texMathML writes a formula as a MathML element, with the TeX kept as an
+// annotation so that it can be copied
+func texMathML(tex string, display bool) (string, error) {
+	row, err := parseTeX(tex)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	buf.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML"`)
+	if display {
+		buf.WriteString(` display="block"`)
+	}
+	buf.WriteString("><semantics>")
+	level := texInline
+	if display {
+		level = texDisplay
+	}
+	writeMathMLRow(&buf, row, level, true)
+	buf.WriteString(`<annotation encoding="application/x-tex">`)
+	buf.WriteString(html.EscapeString(strings.TrimSpace(tex)))
+	buf.WriteString("</annotation></semantics></math>")
+	return buf.String(), nil
+}
+
+// writeMathMLRow writes a row, always in an mrow when wrap is set
+func writeMathMLRow(buf *strings.Builder, row texRow, level texLevel, wrap bool) {
+	if len(row) == 1 && !wrap {
+		writeMathML(buf, row[0], level)
+		return
+	}
+	buf.WriteString("<mrow>")
+	for _, node := range row {
+		writeMathML(buf, node, level)
+	}
+	buf.WriteString("</mrow>")
+}
+
+// scriptLevel returns the style of scripts and fraction parts in a style
+func scriptLevel(level texLevel) texLevel {
+	if level < texScript {
+		return texScript
+	}
+	return texScriptScript
+}
+
+func writeMathML(buf *strings.Builder, node texNode, level texLevel) {
+	switch n := node.(type) {
+	case *texAtom:
+		writeMathMLAtom(buf, n)
+	case *texGroup:
+		writeMathMLRow(buf, n.row, level, true)
+	case *texFrac:
+		inner := level
+		if n.level >= 0 {
+			inner = n.level
+			fmt.Fprintf(buf, `<mstyle displaystyle="%t" scriptlevel="0">`, inner == texDisplay)
+		}
+		if n.open != "" {
+			buf.WriteString("<mrow><mo>" + html.EscapeString(n.open) + "</mo>")
+		}
+		buf.WriteString("<mfrac")
+		if n.noLine {
+			buf.WriteString(` linethickness="0"`)
+		}
+		buf.WriteString(">")
+		part := texInline
+		if inner != texDisplay {
+			part = scriptLevel(inner)
+		}
+		writeMathMLRow(buf, n.num, part, true)
+		writeMathMLRow(buf, n.den, part, true)
+		buf.WriteString("</mfrac>")
+		if n.close != "" {
+			buf.WriteString("<mo>" + html.EscapeString(n.close) + "</mo></mrow>")
+		}
+		if n.level >= 0 {
+			buf.WriteString("</mstyle>")
+		}
+	case *texSqrt:
+		if len(n.index) > 0 {
+			buf.WriteString("<mroot>")
+			writeMathMLRow(buf, n.body, level, true)
+			writeMathMLRow(buf, n.index, texScriptScript, true)
+			buf.WriteString("</mroot>")
+			return
+		}
+		buf.WriteString("<msqrt>")
+		writeMathMLRow(buf, n.body, level, false)
+		buf.WriteString("</msqrt>")
+	case *texScripts:
+		element := map[[2]bool]string{{true, false}: "msub", {false, true}: "msup", {true, true}: "msubsup"}
+		if n.limits(texDisplay) {
+			element = map[[2]bool]string{{true, false}: "munder", {false, true}: "mover", {true, true}: "munderover"}
+		}
+		name := element[[2]bool{n.sub != nil, n.sup != nil}]
+		buf.WriteString("<" + name + ">")
+		writeMathML(buf, n.base, level)
+		for _, script := range []texNode{n.sub, n.sup} {
+			if script != nil {
+				writeMathMLRow(buf, texRow{script}, scriptLevel(level), true)
+			}
+		}
+		buf.WriteString("</" + name + ">")
+	case *texFenced:
+		buf.WriteString("<mrow>")
+		if n.open != "" {
+			buf.WriteString(`<mo fence="true" form="prefix" stretchy="true">` + html.EscapeString(n.open) + "</mo>")
+		}
+		for _, child := range n.body {
+			writeMathML(buf, child, level)
+		}
+		if n.close != "" {
+			buf.WriteString(`<mo fence="true" form="postfix" stretchy="true">` + html.EscapeString(n.close) + "</mo>")
+		}
+		buf.WriteString("</mrow>")
+	case *texSpace:
+		fmt.Fprintf(buf, `<mspace width="%.4gem"/>`, n.em)
+	case *texAccent:
+		name, attr := "mover", "accent"
+		if n.under {
+			name, attr = "munder", "accentunder"
+		}
+		fmt.Fprintf(buf, `<%s %s="true">`, name, attr)
+		writeMathMLRow(buf, n.base, level, true)
+		fmt.Fprintf(buf, `<mo stretchy="%t">%s</mo></%s>`, n.stretchy, html.EscapeString(n.mark), name)
+	case *texTable:
+		buf.WriteString("<mrow>")
+		if n.open != "" {
+			buf.WriteString(`<mo fence="true" form="prefix" stretchy="true">` + html.EscapeString(n.open) + "</mo>")
+		}
+		inner := texInline
+		if n.small {
+			inner = texScript
+			buf.WriteString(`<mstyle scriptlevel="1">`)
+		}
+		buf.WriteString("<mtable")
+		if n.alternate {
+			buf.WriteString(` displaystyle="true"`)
+			inner = texDisplay
+		}
+		buf.WriteString(">")
+		for _, row := range n.rows {
+			buf.WriteString("<mtr>")
+			for i, cell := range row {
+				align := map[byte]string{'l': "left", 'c': "center", 'r': "right"}[n.columnAlign(i)]
+				fmt.Fprintf(buf, `<mtd style="text-align: %s">`, align)
+				writeMathMLRow(buf, cell, inner, false)
+				buf.WriteString("</mtd>")
+			}
+			buf.WriteString("</mtr>")
+		}
+		buf.WriteString("</mtable>")
+		if n.small {
+			buf.WriteString("</mstyle>")
+		}
+		if n.close != "" {
+			buf.WriteString(`<mo fence="true" form="postfix" stretchy="true">` + html.EscapeString(n.close) + "</mo>")
+		}
+		buf.WriteString("</mrow>")
+	case *texStyle:
+		fmt.Fprintf(buf, `<mstyle displaystyle="%t" scriptlevel="%d">`, n.level == texDisplay, max(int(n.level)-1, 0))
+		writeMathMLRow(buf, n.row, n.level, false)
+		buf.WriteString("</mstyle>")
+	}
+}
+
+func writeMathMLAtom(buf *strings.Builder, a *texAtom) {
+	text := html.EscapeString(a.text)
+	switch {
+	case a.kind == texText:
+		buf.WriteString("<mtext>" + text + "</mtext>")
+	case a.kind == texNumber:
+		buf.WriteString("<mn>" + text + "</mn>")
+	case a.kind == texIdentifier && a.cls == texOp && a.limits:
+		// Only operators move their limits to the side in inline math
+		buf.WriteString(`<mo form="prefix" movablelimits="true">` + text + "</mo>")
+	case a.kind == texIdentifier && a.cls == texOp:
+		// A named function, with the invisible function application after it
+		buf.WriteString("<mi>" + text + "</mi><mo>⁡</mo>")
+	case a.kind == texIdentifier:
+		if a.upright && utf8.RuneCountInString(a.text) == 1 {
+			buf.WriteString(`<mi mathvariant="normal">` + text + "</mi>")
+		} else {
+			buf.WriteString("<mi>" + text + "</mi>")
+		}
+	default:
+		buf.WriteString("<mo")
+		switch {
+		case a.large:
+			buf.WriteString(` largeop="true"`)
+		case a.scale > 0:
+			fmt.Fprintf(buf, ` stretchy="true" symmetric="true" minsize="%.2gem" maxsize="%.2gem"`, a.scale, a.scale)
+		case a.cls == texOpen || a.cls == texClose || a.cls == texOrd:
+			// Only delimiters from \left and \right grow with their content
+			buf.WriteString(` stretchy="false"`)
+		}
+		if a.cls == texOrd {
+			buf.WriteString(` lspace="0" rspace="0"`)
+		}
+		buf.WriteString(">" + text + "</mo>")
+	}
+}
@@ -27,6 +27,12 @@ func (m *Menu) CreateMainMenu() *fyne.MainMenu {
 	openItem := fyne.NewMenuItem("Open...", m.controller.Open)
 	openItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyO, Modifier: fyne.KeyModifierControl}
 	
+	openFolderItem := fyne.NewMenuItem("Open Folder...", m.controller.OpenFolder)
+	
+	openRecentItem := fyne.NewMenuItem("Open Recent", nil)
+	openRecentItem.ChildMenu = fyne.NewMenu("Open Recent")
+	m.controller.SetRecentMenu(openRecentItem.ChildMenu)
+	
 	saveItem := fyne.NewMenuItem("Save", m.controller.Save)
 	saveItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyS, Modifier: fyne.KeyModifierControl}
 	saveItem.Disabled = true
@@ -36,15 +42,47 @@ func (m *Menu) CreateMainMenu() *fyne.MainMenu {
 	saveAsItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyS, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift}
 	
 	exportHTMLItem := fyne.NewMenuItem("Export as HTML...", m.controller.ExportHTML)
+	exportSelfContainedItem := fyne.NewMenuItem("Export as Self-Contained HTML...", m.controller.ExportSelfContainedHTML)
+	exportPDFItem := fyne.NewMenuItem("Export as PDF...", m.controller.ExportPDF)
+	exportDOCXItem := fyne.NewMenuItem("Export as DOCX...", m.controller.ExportDOCX)
+	exportODTItem := fyne.NewMenuItem("Export as ODT...", m.controller.ExportODT)
+	
+	htmlTemplateItem := fyne.NewMenuItem("HTML Template", nil)
+	htmlTemplateItem.ChildMenu = m.createHTMLTemplateMenu()
+	
+	mathItem := fyne.NewMenuItem("Math in HTML", nil)
+	mathItem.ChildMenu = m.createMathMenu()
+	
+	backupItem := fyne.NewMenuItem("Backup on Save", nil)
+	backupItem.ChildMenu = m.createBackupMenu()
+	
+	closeTabItem := fyne.NewMenuItem("Close Tab", m.controller.CloseTab)
+	closeTabItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyW, Modifier: fyne.KeyModifierControl}
+	
+	closeOthersItem := fyne.NewMenuItem("Close Other Tabs", m.controller.CloseOtherTabs)
+	closeAllItem := fyne.NewMenuItem("Close All Tabs", m.controller.CloseAllTabs)
 	
 	fileMenu := fyne.NewMenu("File",
 		newItem,
 		openItem,
+		openFolderItem,
+		openRecentItem,
 		fyne.NewMenuItemSeparator(),
 		saveItem,
 		saveAsItem,
+		backupItem,
 		fyne.NewMenuItemSeparator(),
 		exportHTMLItem,
+		exportSelfContainedItem,
+		exportPDFItem,
+		exportDOCXItem,
+		exportODTItem,
+		htmlTemplateItem,
+		mathItem,
+		fyne.NewMenuItemSeparator(),
+		closeTabItem,
+		closeOthersItem,
+		closeAllItem,
 	)
 	
 	// Edit menu
@@ -75,9 +113,18 @@ func (m *Menu) CreateMainMenu() *fyne.MainMenu {
 	findItem := fyne.NewMenuItem("Find...", m.controller.ShowFind)
 	findItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyF, Modifier: fyne.KeyModifierControl}
 	
+	findNextItem := fyne.NewMenuItem("Find Next", m.controller.FindNext)
+	findNextItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyG, Modifier: fyne.KeyModifierControl}
+	
+	findPreviousItem := fyne.NewMenuItem("Find Previous", m.controller.FindPrevious)
+	findPreviousItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyG, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift}
+	
 	replaceItem := fyne.NewMenuItem("Replace...", m.controller.ShowReplace)
 	replaceItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyH, Modifier: fyne.KeyModifierControl}
 	
+	findInFolderItem := fyne.NewMenuItem("Find in Folder...", m.controller.ShowFindInFolder)
+	findInFolderItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyF, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift}
+	
 	editMenu := fyne.NewMenu("Edit",
 		undoItem,
 		redoItem,
@@ -88,15 +135,53 @@ func (m *Menu) CreateMainMenu() *fyne.MainMenu {
 		selectAllItem,
 		fyne.NewMenuItemSeparator(),
 		findItem,
+		findNextItem,
+		findPreviousItem,
 		replaceItem,
+		findInFolderItem,
 	)
 	
 	// View menu
 	togglePreviewItem := fyne.NewMenuItem("Toggle Preview", m.controller.TogglePreview)
 	togglePreviewItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyP, Modifier: fyne.KeyModifierControl}
 	
+	var syncScrollItem *fyne.MenuItem
+	syncScrollItem = fyne.NewMenuItem("Synchronized Scrolling", func() {
+		m.controller.SetSyncScroll(!m.controller.SyncScroll())
+		syncScrollItem.Checked = m.controller.SyncScroll()
+		if mainMenu := m.controller.window.MainMenu(); mainMenu != nil {
+			mainMenu.Refresh()
+		}
+	})
+	syncScrollItem.Checked = m.controller.SyncScroll()
+	
+	var wordWrapItem *fyne.MenuItem
+	wordWrapItem = fyne.NewMenuItem("Word Wrap", func() {
+		m.controller.SetWordWrap(!m.controller.WordWrap())
+		wordWrapItem.Checked = m.controller.WordWrap()
+		if mainMenu := m.controller.window.MainMenu(); mainMenu != nil {
+			mainMenu.Refresh()
+		}
+	})
+	wordWrapItem.Checked = m.controller.WordWrap()
+	
+	codeHighlightItem := fyne.NewMenuItem("Code Highlighting", nil)
+	codeHighlightItem.ChildMenu = m.createCodeHighlightMenu()
+	
+	toggleWorkspaceItem := fyne.NewMenuItem("Toggle Workspace", m.controller.ToggleWorkspace)
+	toggleWorkspaceItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyE, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift}
+	
+	toggleOutlineItem := fyne.NewMenuItem("Toggle Outline", m.controller.ToggleOutline)
+	toggleOutlineItem.Shortcut = &desktop.CustomShortcut{KeyName: fyne.KeyO, Modifier: fyne.KeyModifierControl | fyne.KeyModifierShift}
+	
 	viewMenu := fyne.NewMenu("View",
 		togglePreviewItem,
+		toggleWorkspaceItem,
+		toggleOutlineItem,
+		syncScrollItem,
+		wordWrapItem,
+		fyne.NewMenuItemSeparator(),
+		codeHighlightItem,
 	)
 	
 	// Insert menu
@@ -190,6 +275,143 @@ func (m *Menu) CreateMainMenu() *fyne.MainMenu {
 	)
 }
 
+// createBackupMenu creates the choice of backup policies, checking the active one
+func (m *Menu) createBackupMenu() *fyne.Menu {
+	policies := []BackupPolicy{BackupNone, BackupSingle, BackupNumbered}
+	items := make([]*fyne.MenuItem, len(policies))
+
+	update := func() {
+		current := m.controller.BackupPolicy()
+		for i, policy := range policies {
+			items[i].Checked = policy == current
+		}
+	}
+
+	for i, policy := range policies {
+		items[i] = fyne.NewMenuItem(policy.String(), func() {
+			m.controller.SetBackupPolicy(policy)
+			update()
+			if mainMenu := m.controller.window.MainMenu(); mainMenu != nil {
+				mainMenu.Refresh()
+			}
+		})
+	}
+	update()
+
+	return fyne.NewMenu("Backup on Save", items...)
+}
+
+// createCodeHighlightMenu creates the choice of color schemes for code blocks
+// and whether exported HTML uses CSS classes, checking the active ones
+func (m *Menu) createCodeHighlightMenu() *fyne.Menu {
+	names := append([]string{codeStyleAuto}, codeStyleChoices...)
+	styleItems := make([]*fyne.MenuItem, len(names))
+	var classesItem *fyne.MenuItem
+
+	update := func() {
+		current := m.controller.CodeHighlight()
+		for i, name := range names {
+			styleItems[i].Checked = name == current.style
+		}
+		classesItem.Checked = current.classes
+		if mainMenu := m.controller.window.MainMenu(); mainMenu != nil {
+			mainMenu.Refresh()
+		}
+	}
+
+	for i, name := range names {
+		label := name
+		if name == codeStyleAuto {
+			label = "Match Theme"
+		}
+		styleItems[i] = fyne.NewMenuItem(label, func() {
+			code := m.controller.CodeHighlight()
+			code.style = name
+			m.controller.SetCodeHighlight(code)
+			update()
+		})
+	}
+	classesItem = fyne.NewMenuItem("Use CSS Classes in HTML Export", func() {
+		code := m.controller.CodeHighlight()
+		code.classes = !code.classes
+		m.controller.SetCodeHighlight(code)
+		update()
+	})
+	update()
+
+	items := append(styleItems, fyne.NewMenuItemSeparator(), classesItem)
+	return fyne.NewMenu("Code Highlighting", items...)
+}
+
+// createHTMLTemplateMenu creates the choice of templates for HTML exports,
+// checking the active one
+func (m *Menu) createHTMLTemplateMenu() *fyne.Menu {
+	items := make([]*fyne.MenuItem, len(pageTemplateChoices))
+	var customItem *fyne.MenuItem
+
+	update := func() {
+		current := m.controller.HTMLTemplate()
+		for i, name := range pageTemplateChoices {
+			items[i].Checked = name == current
+		}
+		customItem.Checked = !isBuiltinPageTemplate(current)
+		if mainMenu := m.controller.window.MainMenu(); mainMenu != nil {
+			mainMenu.Refresh()
+		}
+	}
+
+	for i, name := range pageTemplateChoices {
+		items[i] = fyne.NewMenuItem(pageTemplateLabels[name], func() {
+			m.controller.SetHTMLTemplate(name)
+			update()
+		})
+	}
+	customItem = fyne.NewMenuItem("Custom Template...", func() {
+		m.controller.ChooseHTMLTemplate(update)
+	})
+	update()
+
+	items = append(items, fyne.NewMenuItemSeparator(), customItem)
+	return fyne.NewMenu("HTML Template", items...)
+}
+
+// createMathMenu creates the choice of how formulas are written in HTML
+// exports, checking the active one
+func (m *Menu) createMathMenu() *fyne.Menu {
+	var mathMLItem, cdnItem, bundledItem, localItem *fyne.MenuItem
+
+	update := func() {
+		current := m.controller.MathOptions()
+		mathMLItem.Checked = !current.katex
+		cdnItem.Checked = current.katex && current.katexLocation == ""
+		bundledItem.Checked = current.katex && current.katexLocation == katexBundled
+		localItem.Checked = current.katex && current.katexLocation != "" && current.katexLocation != katexBundled
+		if mainMenu := m.controller.window.MainMenu(); mainMenu != nil {
+			mainMenu.Refresh()
+		}
+	}
+
+	mathMLItem = fyne.NewMenuItem("MathML", func() {
+		m.controller.SetMathOptions(mathOptions{})
+		update()
+	})
+	cdnItem = fyne.NewMenuItem("KaTeX from the Web", func() {
+		m.controller.SetMathOptions(mathOptions{katex: true})
+		update()
+	})
+	bundledItem = fyne.NewMenuItem("KaTeX Bundled, for Offline Pages", func() {
+		m.controller.SetMathOptions(mathOptions{katex: true, katexLocation: katexBundled})
+		update()
+	})
+	bundledItem.Disabled = !katexIsBundled()
+	localItem = fyne.NewMenuItem("KaTeX from a Folder...", func() {
+		m.controller.ChooseKaTeXFolder(update)
+	})
+	update()
+
+	return fyne.NewMenu("Math in HTML", mathMLItem, cdnItem, bundledItem, localItem)
+}
+
 func (m *Menu) showMarkdownCheatsheet() {
 	content := `# Markdown Cheatsheet
 
@@ -249,6 +471,21 @@ function example() {
 | Cell 1   | Cell 2   |
 | Cell 3   | Cell 4   |
 
+## Math
+Inline: $e^{i\pi} + 1 = 0$
+Display:
+$$
+\int_0^1 x^2\,dx = \frac{1}{3}
+$$
+A dollar sign: \$5
+
+## Diagrams
+` + "```mermaid" + `
+flowchart LR
+  A[Start] --> B{Check} -->|yes| C[Done]
+` + "```" + `
+Also ` + "```dot" + ` and ` + "```plantuml" + `
+
 ## Horizontal Rule
 ---
 or
@@ -263,6 +500,7 @@ Ctrl+N - New File
 Ctrl+O - Open File
 Ctrl+S - Save
 Ctrl+Shift+S - Save As
+Ctrl+W - Close Tab
 
 Edit Operations:
 Ctrl+Z - Undo
@@ -272,10 +510,16 @@ Ctrl+C - Copy
 Ctrl+V - Paste
 Ctrl+A - Select All
 Ctrl+F - Find
+Ctrl+G - Find Next
+Ctrl+Shift+G - Find Previous
 Ctrl+H - Replace
+Ctrl+Shift+F - Find in Folder
+Tab/Shift+Tab - Indent/Outdent List Item
 
 View:
-Ctrl+P - Toggle Preview`
+Ctrl+P - Toggle Preview
+Ctrl+Shift+E - Toggle Workspace
+Ctrl+Shift+O - Toggle Outline`
 
 	dialog.ShowInformation("Keyboard Shortcuts", shortcuts, m.controller.window)
 }
\ No newline at end of file
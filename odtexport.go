@@ -0,0 +1,662 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+// odtMimeType identifies an OpenDocument text package
+const odtMimeType = "application/vnd.oasis.opendocument.text"
+
+// odtTextWidth is the width of the text area in inches, on A4 with one inch
+// margins
+const odtTextWidth = 6.27
+
+// odtTextSize is the size of body text in points
+const odtTextSize = 11
+
+// odtStyle tracks the formatting that applies to a run of inline text
+type odtStyle struct {
+	bold, italic, strike, code bool
+}
+
+// odtRenderer converts a goldmark AST into an OpenDocument text package
+type odtRenderer struct {
+	source []byte
+	// dir resolves relative image paths, and is empty for unsaved documents
+	dir   string
+	style *chroma.Style
+	body  strings.Builder
+
+	bookmarks bookmarkNames
+	media     []packageFile
+	images    map[string]string
+	// autoStyles maps the properties of each automatic style to its name
+	autoStyles map[string]string
+	automatic  strings.Builder
+
+	// listDepth and quoteDepth count the enclosing lists and block quotes
+	listDepth  int
+	quoteDepth int
+	// lineStart is set at the start of a line, where spaces would be dropped
+	lineStart bool
+	tables    int
+	frames    int
+}
+
+// renderODT writes a parsed document as an OpenDocument text file,
+// resolving local images against dir and coloring fenced code as given
+func renderODT(w io.Writer, source []byte, doc ast.Node, dir, title string, code codeHighlight) error {
+	r := &odtRenderer{
+		source:     source,
+		dir:        dir,
+		style:      code.chromaStyle(false),
+		bookmarks:  make(bookmarkNames),
+		images:     make(map[string]string),
+		autoStyles: make(map[string]string),
+	}
+	r.addBookmarks(doc)
+	r.renderBlocks(doc)
+
+	var manifest strings.Builder
+	for _, file := range r.media {
+		fmt.Fprintf(&manifest, ` <manifest:file-entry manifest:full-path="%s" manifest:media-type="%s"/>`+"\n",
+			file.name, imageMimeType(file.name))
+	}
+
+	files := []packageFile{
+		{name: "mimetype", data: []byte(odtMimeType), stored: true},
+		{name: "META-INF/manifest.xml", data: []byte(fmt.Sprintf(odtManifest, odtMimeType, manifest.String()))},
+		{name: "meta.xml", data: []byte(fmt.Sprintf(odtMeta, escapeXML(title), time.Now().Format("2006-01-02T15:04:05")))},
+		{name: "styles.xml", data: []byte(odtStyles)},
+		{name: "content.xml", data: []byte(fmt.Sprintf(odtContent, r.automatic.String(), r.body.String()))},
+	}
+	return writePackage(w, append(files, r.media...))
+}
+
+// addBookmarks names the headings up front, as links may point forwards
+func (r *odtRenderer) addBookmarks(doc ast.Node) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			if id, ok := heading.AttributeString("id"); ok {
+				r.bookmarks.add(string(id.([]byte)))
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func (r *odtRenderer) renderBlocks(parent ast.Node) {
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		r.renderBlock(child)
+	}
+}
+
+func (r *odtRenderer) renderBlock(n ast.Node) {
+	switch t := n.(type) {
+	case *ast.Paragraph, *ast.TextBlock:
+		r.openParagraph(r.bodyStyle())
+		r.renderInlines(n, odtStyle{})
+		r.body.WriteString("</text:p>")
+	case *ast.Heading:
+		fmt.Fprintf(&r.body, `<text:h text:style-name="Heading_20_%d" text:outline-level="%d">`, t.Level, t.Level)
+		r.lineStart = true
+		if id, ok := t.AttributeString("id"); ok {
+			fmt.Fprintf(&r.body, `<text:bookmark text:name="%s"/>`, r.bookmarks.add(string(id.([]byte))))
+		}
+		r.renderInlines(n, odtStyle{})
+		r.body.WriteString("</text:h>")
+	case *ast.Blockquote:
+		r.quoteDepth++
+		r.renderBlocks(n)
+		r.quoteDepth--
+	case *ast.List:
+		r.renderList(t)
+	case *ast.CodeBlock, *ast.FencedCodeBlock:
+		language := ""
+		if fenced, ok := n.(*ast.FencedCodeBlock); ok {
+			language = string(fenced.Language(r.source))
+		}
+		r.renderCode(nodeLines(r.source, n), language)
+	case *ast.HTMLBlock:
+		r.renderCode(nodeLines(r.source, n), "")
+	case *ast.ThematicBreak:
+		r.body.WriteString(`<text:p text:style-name="Horizontal_20_Line"/>`)
+	case *east.Table:
+		r.renderTable(t)
+	case *mathBlockNode:
+		r.openParagraph(r.autoStyle("paragraph", r.bodyStyle(), `<style:paragraph-properties fo:text-align="center"/>`))
+		r.renderMath(t.tex(r.source), true, odtStyle{})
+		r.body.WriteString("</text:p>")
+	case *diagramNode:
+		r.renderDiagram(t.syntax, t.code(r.source))
+	default:
+		// Unknown blocks still show their inline content rather than vanishing
+		if n.Type() == ast.TypeBlock && n.HasChildren() {
+			r.renderBlocks(n)
+		}
+	}
+}
+
+// bodyStyle returns the paragraph style for text at the current nesting,
+// indenting nested quotes further
+func (r *odtRenderer) bodyStyle() string {
+	switch {
+	case r.quoteDepth > 1:
+		return r.autoStyle("paragraph", "Quotations",
+			fmt.Sprintf(`<style:paragraph-properties fo:margin-left="%.2fin"/>`, 0.4*float64(r.quoteDepth)))
+	case r.quoteDepth == 1:
+		return "Quotations"
+	case r.listDepth > 0:
+		return "List_20_Contents"
+	}
+	return "Text_20_body"
+}
+
+// renderList writes a list, numbered from its start if it is ordered
+func (r *odtRenderer) renderList(list *ast.List) {
+	style := "Bullets"
+	if list.IsOrdered() {
+		style = "Numbering_20_123"
+	}
+	if r.listDepth == 0 {
+		fmt.Fprintf(&r.body, `<text:list text:style-name="%s">`, style)
+	} else {
+		r.body.WriteString("<text:list>")
+	}
+
+	r.listDepth++
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		if item == list.FirstChild() && list.IsOrdered() && list.Start != 1 {
+			fmt.Fprintf(&r.body, `<text:list-item text:start-value="%d">`, list.Start)
+		} else {
+			r.body.WriteString("<text:list-item>")
+		}
+		if !item.HasChildren() {
+			r.body.WriteString(`<text:p text:style-name="List_20_Contents"/>`)
+		}
+		r.renderBlocks(item)
+		r.body.WriteString("</text:list-item>")
+	}
+	r.listDepth--
+	r.body.WriteString("</text:list>")
+}
+
+// renderCode writes code as one shaded paragraph colored by the scheme
+func (r *odtRenderer) renderCode(code, language string) {
+	code = strings.TrimSuffix(code, "\n")
+	if code == "" {
+		return
+	}
+
+	background := r.style.Get(chroma.Background).Background
+	if !background.IsSet() {
+		background = chroma.ParseColour("#f6f8fa")
+	}
+	fallback := codeTextColor(r.style)
+	r.openParagraph(r.autoStyle("paragraph", "Preformatted_20_Text",
+		fmt.Sprintf(`<style:paragraph-properties fo:background-color="%s"/>`, background.String())))
+
+	for i, line := range codeLines(codeTokens(code, language), 0) {
+		if i > 0 {
+			r.body.WriteString("<text:line-break/>")
+			r.lineStart = true
+		}
+		for _, token := range line {
+			entry := r.style.Get(token.Type)
+			colour := entry.Colour
+			if !colour.IsSet() {
+				colour = fallback
+			}
+
+			var props strings.Builder
+			if colour.IsSet() {
+				fmt.Fprintf(&props, ` fo:color="%s"`, colour.String())
+			}
+			if entry.Bold == chroma.Yes {
+				props.WriteString(` fo:font-weight="bold"`)
+			}
+			if entry.Italic == chroma.Yes {
+				props.WriteString(` fo:font-style="italic"`)
+			}
+			if props.Len() == 0 {
+				r.writeText(token.Value)
+				continue
+			}
+			name := r.autoStyle("text", "", "<style:text-properties"+props.String()+"/>")
+			fmt.Fprintf(&r.body, `<text:span text:style-name="%s">`, name)
+			r.writeText(token.Value)
+			r.body.WriteString("</text:span>")
+		}
+	}
+	r.body.WriteString("</text:p>")
+}
+
+// renderTable writes a table with a repeated header row. List items cannot
+// hold tables, so a table in a list is written as one line per row.
+func (r *odtRenderer) renderTable(table *east.Table) {
+	columns := len(table.Alignments)
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		columns = max(columns, row.ChildCount())
+	}
+	if columns == 0 {
+		return
+	}
+
+	if r.listDepth > 0 {
+		for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+			_, header := row.(*east.TableHeader)
+			r.openParagraph(r.bodyStyle())
+			for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+				if cell != row.FirstChild() {
+					r.body.WriteString("<text:tab/>")
+				}
+				r.renderInlines(cell, odtStyle{bold: header})
+			}
+			r.body.WriteString("</text:p>")
+		}
+		return
+	}
+
+	r.tables++
+	fmt.Fprintf(&r.body, `<table:table table:name="Table%d" table:style-name="%s">`, r.tables,
+		r.autoStyle("table", "", fmt.Sprintf(`<style:table-properties style:width="%.2fin" table:align="margins"/>`, odtTextWidth)))
+	fmt.Fprintf(&r.body, `<table:table-column table:number-columns-repeated="%d"/>`, columns)
+	cellStyle := r.autoStyle("table-cell", "", `<style:table-cell-properties fo:padding="0.04in" fo:border="0.5pt solid #dfe2e5"/>`)
+
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		_, header := row.(*east.TableHeader)
+		if header {
+			r.body.WriteString("<table:table-header-rows>")
+		}
+		r.body.WriteString("<table:table-row>")
+
+		cell := row.FirstChild()
+		for c := 0; c < columns; c++ {
+			paragraph := "Table_20_Contents"
+			if header {
+				paragraph = "Table_20_Heading"
+			}
+			if c < len(table.Alignments) {
+				switch table.Alignments[c] {
+				case east.AlignLeft:
+					paragraph = r.autoStyle("paragraph", paragraph, `<style:paragraph-properties fo:text-align="start"/>`)
+				case east.AlignRight:
+					paragraph = r.autoStyle("paragraph", paragraph, `<style:paragraph-properties fo:text-align="end"/>`)
+				case east.AlignCenter:
+					paragraph = r.autoStyle("paragraph", paragraph, `<style:paragraph-properties fo:text-align="center"/>`)
+				}
+			}
+
+			fmt.Fprintf(&r.body, `<table:table-cell table:style-name="%s" office:value-type="string">`, cellStyle)
+			r.openParagraph(paragraph)
+			if cell != nil {
+				r.renderInlines(cell, odtStyle{})
+				cell = cell.NextSibling()
+			}
+			r.body.WriteString("</text:p></table:table-cell>")
+		}
+
+		r.body.WriteString("</table:table-row>")
+		if header {
+			r.body.WriteString("</table:table-header-rows>")
+		}
+	}
+	r.body.WriteString("</table:table>")
+}
+
+func (r *odtRenderer) openParagraph(style string) {
+	fmt.Fprintf(&r.body, `<text:p text:style-name="%s">`, style)
+	r.lineStart = true
+}
+
+func (r *odtRenderer) renderInlines(parent ast.Node, style odtStyle) {
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		r.renderInline(child, style)
+	}
+}
+
+func (r *odtRenderer) renderInline(n ast.Node, style odtStyle) {
+	switch t := n.(type) {
+	case *ast.Text:
+		text := string(t.Value(r.source))
+		if t.SoftLineBreak() {
+			text += " "
+		}
+		r.span(text, style)
+		if t.HardLineBreak() {
+			r.body.WriteString("<text:line-break/>")
+			r.lineStart = true
+		}
+	case *ast.String:
+		r.span(html.UnescapeString(string(t.Value)), style)
+	case *ast.Emphasis:
+		if t.Level >= 2 {
+			style.bold = true
+		} else {
+			style.italic = true
+		}
+		r.renderInlines(n, style)
+	case *east.Strikethrough:
+		style.strike = true
+		r.renderInlines(n, style)
+	case *ast.CodeSpan:
+		style.code = true
+		r.span((&richTextRenderer{source: r.source}).plainText(n), style)
+	case *ast.Link:
+		r.openLink(string(t.Destination))
+		r.renderInlines(n, style)
+		r.body.WriteString("</text:a>")
+	case *ast.AutoLink:
+		r.openLink(string(t.URL(r.source)))
+		r.span(string(t.Label(r.source)), style)
+		r.body.WriteString("</text:a>")
+	case *ast.Image:
+		r.renderImage(t, style)
+	case *ast.RawHTML:
+		var raw strings.Builder
+		for i := 0; i < t.Segments.Len(); i++ {
+			segment := t.Segments.At(i)
+			raw.Write(segment.Value(r.source))
+		}
+		style.code = true
+		r.span(raw.String(), style)
+	case *east.TaskCheckBox:
+		if t.IsChecked {
+			r.span("☒ ", style)
+		} else {
+			r.span("☐ ", style)
+		}
+	case *mathInlineNode:
+		r.renderMath(t.tex, t.display, style)
+	default:
+		r.renderInlines(n, style)
+	}
+}
+
+// openLink starts a hyperlink to a heading of the document or to a URL
+func (r *odtRenderer) openLink(destination string) {
+	if id, ok := strings.CutPrefix(destination, "#"); ok {
+		if name, ok := r.bookmarks[id]; ok {
+			destination = "#" + name
+		}
+	}
+	fmt.Fprintf(&r.body, `<text:a xlink:type="simple" xlink:href="%s" text:style-name="Internet_20_link" text:visited-style-name="Visited_20_Internet_20_Link">`,
+		escapeXML(destination))
+}
+
+// renderImage embeds a local image in the line, scaled down to the text
+// width. Other images show their description.
+func (r *odtRenderer) renderImage(n *ast.Image, style odtStyle) {
+	alt := (&richTextRenderer{source: r.source}).plainText(n)
+	img, err := readLocalImage(string(n.Destination), r.dir)
+	if err != nil {
+		style.italic = true
+		r.span("["+alt+"]", style)
+		return
+	}
+
+	name, ok := r.images[img.path]
+	if !ok {
+		name = fmt.Sprintf("Pictures/image%d.%s", len(r.media)+1, img.format)
+		r.media = append(r.media, packageFile{name: name, data: img.data})
+		r.images[img.path] = name
+	}
+
+	// Images are measured at 96 DPI
+	width, height := float64(img.width)/96, float64(img.height)/96
+	if width > odtTextWidth {
+		height = height * odtTextWidth / width
+		width = odtTextWidth
+	}
+	r.frames++
+	fmt.Fprintf(&r.body, `<draw:frame draw:name="Image%d" text:anchor-type="as-char" svg:width="%.3fin" svg:height="%.3fin">`+
+		`<draw:image xlink:href="%s" xlink:type="simple" xlink:show="embed" xlink:actuate="onLoad"/><svg:desc>%s</svg:desc></draw:frame>`,
+		r.frames, width, height, name, escapeXML(alt))
+	r.lineStart = false
+}
+
+// renderMath embeds a formula as a picture standing on the baseline. One
+// that cannot be parsed shows its source.
+func (r *odtRenderer) renderMath(tex string, display bool, style odtStyle) {
+	picture, err := renderMathPicture(tex, display, odtTextSize)
+	if err != nil {
+		style.code = true
+		r.span(mathSource(tex, display), style)
+		return
+	}
+
+	name := fmt.Sprintf("Pictures/image%d.png", len(r.media)+1)
+	r.media = append(r.media, packageFile{name: name, data: picture.png})
+
+	// Pictures are measured in points
+	width, height, baseline := picture.width/72, picture.height/72, picture.baseline/72
+	if width > odtTextWidth {
+		height, baseline = height*odtTextWidth/width, baseline*odtTextWidth/width
+		width = odtTextWidth
+	}
+	frameStyle := r.autoStyle("graphic", "", `<style:graphic-properties style:vertical-pos="from-top" style:vertical-rel="baseline"/>`)
+	r.frames++
+	fmt.Fprintf(&r.body, `<draw:frame draw:style-name="%s" draw:name="Image%d" text:anchor-type="as-char" svg:y="%.3fin" svg:width="%.3fin" svg:height="%.3fin">`+
+		`<draw:image xlink:href="%s" xlink:type="simple" xlink:show="embed" xlink:actuate="onLoad"/><svg:desc>%s</svg:desc></draw:frame>`,
+		frameStyle, r.frames, -baseline, width, height, name, escapeXML(tex))
+	r.lineStart = false
+}
+
+// renderDiagram embeds a diagram as a centered picture. One that cannot be
+// drawn shows why, followed by its source.
+func (r *odtRenderer) renderDiagram(syntax, code string) {
+	picture, err := renderDiagramPicture(syntax, code)
+	if err != nil {
+		r.openParagraph(r.bodyStyle())
+		r.span(syntax+": "+err.Error(), odtStyle{italic: true})
+		r.body.WriteString("</text:p>")
+		r.renderCode(code, syntax)
+		return
+	}
+
+	name := fmt.Sprintf("Pictures/image%d.png", len(r.media)+1)
+	r.media = append(r.media, packageFile{name: name, data: picture.png})
+
+	// Pictures are measured in points
+	width, height := picture.width/72, picture.height/72
+	if width > odtTextWidth {
+		height = height * odtTextWidth / width
+		width = odtTextWidth
+	}
+	r.openParagraph(r.autoStyle("paragraph", r.bodyStyle(), `<style:paragraph-properties fo:text-align="center"/>`))
+	r.frames++
+	fmt.Fprintf(&r.body, `<draw:frame draw:name="Image%d" text:anchor-type="as-char" svg:width="%.3fin" svg:height="%.3fin">`+
+		`<draw:image xlink:href="%s" xlink:type="simple" xlink:show="embed" xlink:actuate="onLoad"/><svg:desc>%s</svg:desc></draw:frame>`,
+		r.frames, width, height, name, escapeXML(syntax+" diagram"))
+	r.body.WriteString("</text:p>")
+	r.lineStart = false
+}
+
+// span writes text with the formatting of a style
+func (r *odtRenderer) span(text string, style odtStyle) {
+	if text == "" {
+		return
+	}
+	if style == (odtStyle{}) {
+		r.writeText(text)
+		return
+	}
+
+	var props strings.Builder
+	if style.bold {
+		props.WriteString(` fo:font-weight="bold"`)
+	}
+	if style.italic {
+		props.WriteString(` fo:font-style="italic"`)
+	}
+	if style.strike {
+		props.WriteString(` style:text-line-through-style="solid"`)
+	}
+	parent := ""
+	if style.code {
+		parent = "Source_20_Text"
+	}
+	name := r.autoStyle("text", parent, "<style:text-properties"+props.String()+"/>")
+	fmt.Fprintf(&r.body, `<text:span text:style-name="%s">`, name)
+	r.writeText(text)
+	r.body.WriteString("</text:span>")
+}
+
+// writeText writes text, marking up the tabs, line breaks and runs of spaces
+// that ODF would otherwise collapse
+func (r *odtRenderer) writeText(text string) {
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '\t':
+			r.body.WriteString("<text:tab/>")
+		case '\n':
+			r.body.WriteString("<text:line-break/>")
+			r.lineStart = true
+			continue
+		case ' ':
+			n := 1
+			for i+n < len(runes) && runes[i+n] == ' ' {
+				n++
+			}
+			i += n - 1
+			if !r.lineStart {
+				r.body.WriteByte(' ')
+				n--
+			}
+			if n > 0 {
+				fmt.Fprintf(&r.body, `<text:s text:c="%d"/>`, n)
+			}
+		default:
+			r.body.WriteString(escapeXML(string(runes[i])))
+		}
+		r.lineStart = false
+	}
+}
+
+// autoStyle returns the name of an automatic style of a family with the
+// given parent and properties, adding it on first use
+func (r *odtRenderer) autoStyle(family, parent, properties string) string {
+	key := family + "\x00" + parent + "\x00" + properties
+	if name, ok := r.autoStyles[key]; ok {
+		return name
+	}
+
+	name := fmt.Sprintf("auto%d", len(r.autoStyles)+1)
+	r.autoStyles[key] = name
+	fmt.Fprintf(&r.automatic, `<style:style style:name="%s" style:family="%s"`, name, family)
+	if parent != "" {
+		fmt.Fprintf(&r.automatic, ` style:parent-style-name="%s"`, parent)
+	}
+	fmt.Fprintf(&r.automatic, ">%s</style:style>\n", properties)
+	return name
+}
+
+// imageMimeType returns the media type of an image part by its extension
+func imageMimeType(name string) string {
+	return "image/" + strings.TrimPrefix(name[strings.LastIndexByte(name, '.'):], ".")
+}
+
+const odtManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.3">
+ <manifest:file-entry manifest:full-path="/" manifest:version="1.3" manifest:media-type="%s"/>
+ <manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>
+ <manifest:file-entry manifest:full-path="styles.xml" manifest:media-type="text/xml"/>
+ <manifest:file-entry manifest:full-path="meta.xml" manifest:media-type="text/xml"/>
+%s</manifest:manifest>`
+
+const odtMeta = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-meta xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:meta="urn:oasis:names:tc:opendocument:xmlns:meta:1.0" xmlns:dc="http://purl.org/dc/elements/1.1/" office:version="1.3">
+<office:meta><dc:title>%s</dc:title><meta:creation-date>%s</meta:creation-date><meta:generator>Markdown Editor</meta:generator></office:meta>
+</office:document-meta>`
+
+// odtNamespaces are declared on the root of the content and styles parts
+const odtNamespaces = `xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" ` +
+	`xmlns:style="urn:oasis:names:tc:opendocument:xmlns:style:1.0" ` +
+	`xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" ` +
+	`xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" ` +
+	`xmlns:draw="urn:oasis:names:tc:opendocument:xmlns:drawing:1.0" ` +
+	`xmlns:fo="urn:oasis:names:tc:opendocument:xmlns:xsl-fo-compatible:1.0" ` +
+	`xmlns:xlink="http://www.w3.org/1999/xlink" ` +
+	`xmlns:svg="urn:oasis:names:tc:opendocument:xmlns:svg-compatible:1.0" ` +
+	`office:version="1.3"`
+
+const odtFontFaces = `<office:font-face-decls>
+<style:font-face style:name="Liberation Sans" svg:font-family="&apos;Liberation Sans&apos;" style:font-family-generic="swiss" style:font-pitch="variable"/>
+<style:font-face style:name="Liberation Mono" svg:font-family="&apos;Liberation Mono&apos;" style:font-family-generic="modern" style:font-pitch="fixed"/>
+</office:font-face-decls>`
+
+const odtContent = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content ` + odtNamespaces + `>
+` + odtFontFaces + `
+<office:automatic-styles>
+%s</office:automatic-styles>
+<office:body><office:text>%s</office:text></office:body>
+</office:document-content>`
+
+// odtStyles defines the named styles used by the export, with the names
+// LibreOffice gives its own so they map onto them
+var odtStyles = `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-styles ` + odtNamespaces + `>
+` + odtFontFaces + `
+<office:styles>
+<style:default-style style:family="paragraph"><style:paragraph-properties fo:margin-top="0in" fo:margin-bottom="0.08in"/><style:text-properties style:font-name="Liberation Sans" fo:font-size="11pt" fo:color="#333333" fo:language="en" fo:country="US"/></style:default-style>
+<style:style style:name="Standard" style:family="paragraph" style:class="text"/>
+<style:style style:name="Text_20_body" style:display-name="Text body" style:family="paragraph" style:parent-style-name="Standard" style:class="text"><style:paragraph-properties fo:margin-top="0in" fo:margin-bottom="0.1in" fo:line-height="115%"/></style:style>
+<style:style style:name="List_20_Contents" style:display-name="List Contents" style:family="paragraph" style:parent-style-name="Text_20_body" style:class="list"><style:paragraph-properties fo:margin-bottom="0.04in"/></style:style>
+<style:style style:name="Heading" style:family="paragraph" style:parent-style-name="Standard" style:next-style-name="Text_20_body" style:class="text"><style:paragraph-properties fo:margin-top="0.2in" fo:margin-bottom="0.1in" fo:keep-with-next="always"/><style:text-properties fo:color="#1f2328" fo:font-weight="bold"/></style:style>
+<style:style style:name="Heading_20_1" style:display-name="Heading 1" style:family="paragraph" style:parent-style-name="Heading" style:default-outline-level="1" style:class="text"><style:paragraph-properties fo:padding-bottom="0.04in" fo:border-bottom="0.5pt solid #dfe2e5"/><style:text-properties fo:font-size="22pt"/></style:style>
+<style:style style:name="Heading_20_2" style:display-name="Heading 2" style:family="paragraph" style:parent-style-name="Heading" style:default-outline-level="2" style:class="text"><style:paragraph-properties fo:padding-bottom="0.04in" fo:border-bottom="0.5pt solid #dfe2e5"/><style:text-properties fo:font-size="17pt"/></style:style>
+<style:style style:name="Heading_20_3" style:display-name="Heading 3" style:family="paragraph" style:parent-style-name="Heading" style:default-outline-level="3" style:class="text"><style:text-properties fo:font-size="14pt"/></style:style>
+<style:style style:name="Heading_20_4" style:display-name="Heading 4" style:family="paragraph" style:parent-style-name="Heading" style:default-outline-level="4" style:class="text"><style:text-properties fo:font-size="12pt"/></style:style>
+<style:style style:name="Heading_20_5" style:display-name="Heading 5" style:family="paragraph" style:parent-style-name="Heading" style:default-outline-level="5" style:class="text"><style:text-properties fo:font-size="11pt"/></style:style>
+<style:style style:name="Heading_20_6" style:display-name="Heading 6" style:family="paragraph" style:parent-style-name="Heading" style:default-outline-level="6" style:class="text"><style:text-properties fo:font-size="11pt" fo:color="#6a737d"/></style:style>
+<style:style style:name="Quotations" style:family="paragraph" style:parent-style-name="Text_20_body" style:class="html"><style:paragraph-properties fo:margin-left="0.4in" fo:padding-left="0.1in" fo:border-left="2.25pt solid #dfe2e5" fo:border-right="none" fo:border-top="none" fo:border-bottom="none"/><style:text-properties fo:font-style="italic" fo:color="#6a737d"/></style:style>
+<style:style style:name="Preformatted_20_Text" style:display-name="Preformatted Text" style:family="paragraph" style:parent-style-name="Standard" style:class="html"><style:paragraph-properties fo:margin-bottom="0.1in" fo:padding="0.08in"/><style:text-properties style:font-name="Liberation Mono" fo:font-size="9.5pt"/></style:style>
+<style:style style:name="Table_20_Contents" style:display-name="Table Contents" style:family="paragraph" style:parent-style-name="Standard" style:class="extra"/>
+<style:style style:name="Table_20_Heading" style:display-name="Table Heading" style:family="paragraph" style:parent-style-name="Table_20_Contents" style:class="extra"><style:text-properties fo:font-weight="bold"/></style:style>
+<style:style style:name="Horizontal_20_Line" style:display-name="Horizontal Line" style:family="paragraph" style:parent-style-name="Standard" style:class="html"><style:paragraph-properties fo:margin-bottom="0.2in" fo:padding="0in" fo:border-bottom="1.5pt solid #dfe2e5"/><style:text-properties fo:font-size="6pt"/></style:style>
+<style:style style:name="Source_20_Text" style:display-name="Source Text" style:family="text"><style:text-properties style:font-name="Liberation Mono" fo:font-size="10pt" fo:background-color="#f0f1f2"/></style:style>
+<style:style style:name="Internet_20_link" style:display-name="Internet link" style:family="text"><style:text-properties fo:color="#0969da" style:text-underline-style="solid" style:text-underline-width="auto" style:text-underline-color="font-color"/></style:style>
+<style:style style:name="Visited_20_Internet_20_Link" style:display-name="Visited Internet Link" style:family="text"><style:text-properties fo:color="#8250df" style:text-underline-style="solid" style:text-underline-width="auto" style:text-underline-color="font-color"/></style:style>
+<text:list-style style:name="Bullets">` + odtBulletLevels + `</text:list-style>
+<text:list-style style:name="Numbering_20_123" style:display-name="Numbering 123">` + odtNumberLevels + `</text:list-style>
+</office:styles>
+<office:automatic-styles>
+<style:page-layout style:name="pm1"><style:page-layout-properties fo:page-width="8.268in" fo:page-height="11.693in" fo:margin-top="1in" fo:margin-bottom="1in" fo:margin-left="1in" fo:margin-right="1in"/></style:page-layout>
+</office:automatic-styles>
+<office:master-styles><style:master-page style:name="Standard" style:page-layout-name="pm1"/></office:master-styles>
+</office:document-styles>`
+
+// odtBulletLevels and odtNumberLevels indent each level of a list by a
+// quarter inch more than the one above
+var (
+	odtBulletLevels = odtListLevels(func(level int) string {
+		bullets := []string{"•", "◦", "▪"}
+		return fmt.Sprintf(`<text:list-level-style-bullet text:level="%d" text:bullet-char="%s">`, level, bullets[(level-1)%len(bullets)])
+	}, "</text:list-level-style-bullet>")
+	odtNumberLevels = odtListLevels(func(level int) string {
+		return fmt.Sprintf(`<text:list-level-style-number text:level="%d" style:num-suffix="." style:num-format="1">`, level)
+	}, "</text:list-level-style-number>")
+)
+
+func odtListLevels(open func(level int) string, end string) string {
+	var buf strings.Builder
+	for level := 1; level <= 10; level++ {
+		buf.WriteString(open(level))
+		fmt.Fprintf(&buf, `<style:list-level-properties text:list-level-position-and-space-mode="label-alignment">`+
+			`<style:list-level-label-alignment text:label-followed-by="listtab" text:list-tab-stop-position="%.2fin" fo:text-indent="-0.25in" fo:margin-left="%.2fin"/>`+
+			`</style:list-level-properties>`, 0.25+0.25*float64(level), 0.25+0.25*float64(level))
+		buf.WriteString(end)
+	}
+	return buf.String()
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/yuin/goldmark/ast"
+)
+
+// preferenceOutlineVisible stores whether the outline panel is shown
+const preferenceOutlineVisible = "outlineVisible"
+
+// outlineWidth is the width the outline panel asks for
+const outlineWidth = 220
+
+// outlineHeading is a heading of the document and the section it starts
+type outlineHeading struct {
+	title string
+	level int
+	// line is the 0-based source line of the heading
+	line int
+	// start and end are the byte range of the section, which runs up to the
+	// next heading of the same or a higher level
+	start, end int
+	// key identifies the heading by its path of titles, to keep branches
+	// closed across edits
+	key string
+}
+
+// outlineHeadings lists the top-level headings of a parsed document in order
+func outlineHeadings(source []byte, doc ast.Node) []outlineHeading {
+	r := &richTextRenderer{source: source}
+	var headings []outlineHeading
+	var path []string
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		heading, ok := child.(*ast.Heading)
+		if !ok {
+			continue
+		}
+		line := sourceLine(source, heading)
+		if line < 0 {
+			continue
+		}
+
+		title := strings.TrimSpace(r.plainText(heading))
+		if title == "" {
+			title = "(untitled)"
+		}
+		for len(path) >= heading.Level {
+			path = path[:len(path)-1]
+		}
+		for len(path) < heading.Level-1 {
+			path = append(path, "")
+		}
+		path = append(path, title)
+
+		headings = append(headings, outlineHeading{
+			title: title,
+			level: heading.Level,
+			line:  line,
+			start: lineStart(source, line),
+			key:   strings.Join(path, "\x00"),
+		})
+	}
+
+	for i := range headings {
+		headings[i].end = len(source)
+		for _, next := range headings[i+1:] {
+			if next.level <= headings[i].level {
+				headings[i].end = next.start
+				break
+			}
+		}
+	}
+	return headings
+}
+
+// lineStart returns the byte offset of a 0-based line
+func lineStart(source []byte, line int) int {
+	offset := 0
+	for ; line > 0; line-- {
+		i := bytes.IndexByte(source[offset:], '\n')
+		if i < 0 {
+			return len(source)
+		}
+		offset += i + 1
+	}
+	return offset
+}
+
+// moveSection moves the section of headings[from] before the section of
+// headings[to], or after it, returning the new text and the byte offset the
+// moved section now starts at. Moving a section into itself is refused.
+func moveSection(text string, headings []outlineHeading, from, to int, after bool) (string, int, bool) {
+	section := headings[from]
+	target := headings[to].start
+	if after {
+		target = headings[to].end
+	}
+	if target >= section.start && target <= section.end {
+		return text, 0, false
+	}
+
+	moved := text[section.start:section.end]
+	if !strings.HasSuffix(moved, "\n") {
+		moved += "\n"
+	}
+	rest := text[:section.start] + text[section.end:]
+	if target > section.end {
+		target -= section.end - section.start
+	}
+
+	// Keep the moved heading at the start of a line
+	if target > 0 && rest[target-1] != '\n' {
+		moved = "\n" + moved
+		return rest[:target] + moved + rest[target:], target + 1, true
+	}
+	return rest[:target] + moved + rest[target:], target, true
+}
+
+// Outline is the side panel listing the headings of the active document
+type Outline struct {
+	controller *AppController
+	tree       *widget.Tree
+	container  *fyne.Container
+	overlay    *fyne.Container
+	indicator  *canvas.Rectangle
+	headings   []outlineHeading
+	children   map[widget.TreeNodeID][]widget.TreeNodeID
+	closed     map[string]bool
+	rows       []*outlineRow
+
+	dragFrom   int
+	dragTarget int
+	dragAfter  bool
+}
+
+// NewOutline creates a new outline panel
+func NewOutline(controller *AppController) *Outline {
+	return &Outline{
+		controller: controller,
+		children:   make(map[widget.TreeNodeID][]widget.TreeNodeID),
+		closed:     make(map[string]bool),
+		dragFrom:   -1,
+		dragTarget: -1,
+	}
+}
+
+// Create creates the outline UI component
+func (o *Outline) Create() fyne.CanvasObject {
+	o.tree = widget.NewTree(
+		func(id widget.TreeNodeID) []widget.TreeNodeID {
+			return o.children[id]
+		},
+		func(id widget.TreeNodeID) bool {
+			return len(o.children[id]) > 0
+		},
+		func(bool) fyne.CanvasObject {
+			row := newOutlineRow(o)
+			o.rows = append(o.rows, row)
+			return row
+		},
+		func(id widget.TreeNodeID, _ bool, object fyne.CanvasObject) {
+			row := object.(*outlineRow)
+			row.index = o.index(id)
+			if row.index >= 0 {
+				row.label.SetText(o.headings[row.index].title)
+			}
+		},
+	)
+	o.tree.OnSelected = func(id widget.TreeNodeID) {
+		o.tree.UnselectAll()
+		if i := o.index(id); i >= 0 {
+			o.controller.GoToLine(o.headings[i].line + 1)
+		}
+	}
+	o.tree.OnBranchClosed = func(id widget.TreeNodeID) {
+		if i := o.index(id); i >= 0 {
+			o.closed[o.headings[i].key] = true
+		}
+	}
+	o.tree.OnBranchOpened = func(id widget.TreeNodeID) {
+		if i := o.index(id); i >= 0 {
+			delete(o.closed, o.headings[i].key)
+		}
+	}
+
+	o.indicator = canvas.NewRectangle(theme.Color(theme.ColorNamePrimary))
+	o.indicator.Hide()
+	o.overlay = container.NewWithoutLayout(o.indicator)
+
+	title := widget.NewLabelWithStyle("Outline", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	titleContainer := container.NewBorder(nil, widget.NewSeparator(), nil, nil, container.NewPadded(title))
+
+	width := canvas.NewRectangle(color.Transparent)
+	width.SetMinSize(fyne.NewSize(outlineWidth, 0))
+
+	o.container = container.NewBorder(
+		titleContainer,
+		nil,
+		nil,
+		widget.NewSeparator(),
+		container.NewStack(width, o.tree, o.overlay),
+	)
+	if prefs := o.controller.preferences(); prefs != nil && !prefs.BoolWithFallback(preferenceOutlineVisible, true) {
+		o.container.Hide()
+	}
+	return o.container
+}
+
+// Update shows the headings of a parsed document
+func (o *Outline) Update(source []byte, doc ast.Node) {
+	o.headings = outlineHeadings(source, doc)
+	o.children = make(map[widget.TreeNodeID][]widget.TreeNodeID)
+
+	// Nest each heading under the closest preceding heading of a higher level
+	var parents []int
+	for i, heading := range o.headings {
+		for len(parents) > 0 && o.headings[parents[len(parents)-1]].level >= heading.level {
+			parents = parents[:len(parents)-1]
+		}
+		parent := ""
+		if len(parents) > 0 {
+			parent = strconv.Itoa(parents[len(parents)-1])
+		}
+		o.children[parent] = append(o.children[parent], strconv.Itoa(i))
+		parents = append(parents, i)
+	}
+
+	if o.tree == nil {
+		return
+	}
+	for i, heading := range o.headings {
+		id := strconv.Itoa(i)
+		if len(o.children[id]) == 0 {
+			continue
+		}
+		if o.closed[heading.key] {
+			o.tree.CloseBranch(id)
+		} else {
+			o.tree.OpenBranch(id)
+		}
+	}
+	o.tree.Refresh()
+}
+
+// ToggleVisibility shows or hides the outline panel
+func (o *Outline) ToggleVisibility() {
+	if o.container == nil {
+		return
+	}
+
+	visible := !o.container.Visible()
+	if visible {
+		o.container.Show()
+	} else {
+		o.container.Hide()
+	}
+	if prefs := o.controller.preferences(); prefs != nil {
+		prefs.SetBool(preferenceOutlineVisible, visible)
+	}
+}
+
+func (o *Outline) index(id widget.TreeNodeID) int {
+	i, err := strconv.Atoi(id)
+	if err != nil || i < 0 || i >= len(o.headings) {
+		return -1
+	}
+	return i
+}
+
+// dragged tracks a section being dragged from row, showing where it would
+// be dropped: above a heading to move it before that section, below to move
+// it after
+func (o *Outline) dragged(row *outlineRow, ev *fyne.DragEvent) {
+	if o.dragFrom < 0 {
+		o.dragFrom = row.index
+	}
+	driver := fyne.CurrentApp().Driver()
+	pointer := driver.AbsolutePositionForObject(row).Add(ev.Position)
+
+	treeTop := driver.AbsolutePositionForObject(o.tree).Y
+	treeBottom := treeTop + o.tree.Size().Height
+	o.dragTarget = -1
+	for _, candidate := range o.rows {
+		if !candidate.Visible() || candidate.index < 0 {
+			continue
+		}
+		top := driver.AbsolutePositionForObject(candidate).Y
+		height := candidate.Size().Height
+		if top < treeTop || top+height > treeBottom || pointer.Y < top || pointer.Y >= top+height {
+			continue
+		}
+
+		o.dragTarget = candidate.index
+		o.dragAfter = pointer.Y >= top+height/2
+		lineY := top
+		if o.dragAfter {
+			lineY += height
+		}
+		origin := driver.AbsolutePositionForObject(o.overlay)
+		o.indicator.Move(fyne.NewPos(0, lineY-origin.Y-1))
+		o.indicator.Resize(fyne.NewSize(o.overlay.Size().Width, 2))
+		o.indicator.Show()
+		return
+	}
+	o.indicator.Hide()
+}
+
+// dragEnd moves the dragged section to where it was dropped
+func (o *Outline) dragEnd() {
+	from, to, after := o.dragFrom, o.dragTarget, o.dragAfter
+	o.dragFrom, o.dragTarget = -1, -1
+	o.indicator.Hide()
+
+	if from < 0 || to < 0 || from >= len(o.headings) || to >= len(o.headings) {
+		return
+	}
+	o.controller.MoveSection(o.headings, from, to, after)
+}
+
+// outlineRow is a heading in the outline tree that can be dragged
+type outlineRow struct {
+	widget.BaseWidget
+	outline *Outline
+	label   *widget.Label
+	index   int
+}
+
+func newOutlineRow(outline *Outline) *outlineRow {
+	row := &outlineRow{
+		outline: outline,
+		label:   widget.NewLabel(""),
+		index:   -1,
+	}
+	row.label.Truncation = fyne.TextTruncateEllipsis
+	row.ExtendBaseWidget(row)
+	return row
+}
+
+// CreateRenderer returns the renderer for the row
+func (r *outlineRow) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(r.label)
+}
+
+// Dragged is called while the row is being dragged
+func (r *outlineRow) Dragged(ev *fyne.DragEvent) {
+	r.outline.dragged(r, ev)
+}
+
+// DragEnd is called when the row is dropped
+func (r *outlineRow) DragEnd() {
+	r.outline.dragEnd()
+}
@@ -0,0 +1,736 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"image"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/theme"
+	"github.com/alecthomas/chroma/v2"
+	"github.com/go-pdf/fpdf"
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+// Preference keys for the PDF page setup
+const (
+	preferencePDFPageSize = "pdfPageSize"
+	preferencePDFMargin   = "pdfMargin"
+	preferencePDFHeader   = "pdfHeader"
+	preferencePDFFooter   = "pdfFooter"
+)
+
+// pdfPageSizes are the paper sizes offered when exporting
+var pdfPageSizes = []string{"A4", "Letter", "Legal", "A5"}
+
+// Limits of the page margin in millimetres. The header and footer are
+// drawn inside the margin, so it cannot be too small.
+const (
+	pdfMinMargin = 10
+	pdfMaxMargin = 50
+)
+
+// pdfOptions is the page setup of a PDF export. The header and footer may
+// contain {title}, {page}, {pages} and {date}.
+type pdfOptions struct {
+	pageSize string
+	// margin is the page margin on every side in millimetres
+	margin float64
+	header string
+	footer string
+	title  string
+}
+
+// defaultPDFOptions returns the page setup used until the user changes it
+func defaultPDFOptions() pdfOptions {
+	return pdfOptions{
+		pageSize: "A4",
+		margin:   20,
+		header:   "{title}",
+		footer:   "Page {page} of {pages}",
+	}
+}
+
+// pageText fills in the placeholders of a header or footer for a page
+func (o pdfOptions) pageText(format string, page int) string {
+	return strings.NewReplacer(
+		"{title}", o.title,
+		"{page}", strconv.Itoa(page),
+		"{date}", time.Now().Format("2 January 2006"),
+	).Replace(format)
+}
+
+// pdfPagesAlias is replaced with the page count once the document is complete
+const pdfPagesAlias = "{pages}"
+
+// Font families embedded in exported PDFs
+const (
+	pdfSans = "sans"
+	pdfMono = "mono"
+)
+
+// Text sizes in points
+const (
+	pdfTextSize = 11
+	pdfCodeSize = 9
+	pdfPageSize = 9
+)
+
+// pdfLineSpacing is the line height as a multiple of the text size
+const pdfLineSpacing = 1.4
+
+// pdfStyle tracks the formatting that applies to a run of inline text
+type pdfStyle struct {
+	bold, italic, mono, strike bool
+	size                       float64
+	color                      [3]int
+	// link is the destination of the text, if it is a link
+	link string
+}
+
+var (
+	pdfTextColor  = [3]int{0x33, 0x33, 0x33}
+	pdfMutedColor = [3]int{0x6a, 0x73, 0x7d}
+	pdfLinkColor  = [3]int{0x09, 0x69, 0xda}
+	pdfRuleColor  = [3]int{0xdf, 0xe2, 0xe5}
+	pdfShadeColor = [3]int{0xf6, 0xf8, 0xfa}
+)
+
+// pdfRenderer draws a goldmark AST onto PDF pages
+type pdfRenderer struct {
+	pdf    *fpdf.Fpdf
+	source []byte
+	margin float64
+	// dir resolves relative image paths, and is empty for unsaved documents
+	dir   string
+	style *chroma.Style
+	// links are the internal link targets of headings by ID
+	links map[string]int
+	// levels are the heading levels of the open bookmarks
+	levels []int
+	// indent is the left indent of the current block in millimetres
+	indent float64
+	images map[string]bool
+	// formulas counts the formulas drawn, to name their pictures
+	formulas int
+	// diagrams counts the diagrams drawn, to name their pictures
+	diagrams int
+}
+
+// renderPDF writes a parsed document as a PDF, resolving local images
+// against dir and coloring fenced code as given
+func renderPDF(w io.Writer, source []byte, doc ast.Node, dir string, opts pdfOptions, code codeHighlight) (err error) {
+	// fpdf panics on some input rather than returning an error, which must
+	// not take the editor down with it
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("cannot write the PDF: %v", p)
+		}
+	}()
+
+	pdf := fpdf.New("P", "mm", opts.pageSize, "")
+	pdf.SetMargins(opts.margin, opts.margin, opts.margin)
+	pdf.SetAutoPageBreak(true, opts.margin)
+	pdf.SetTitle(opts.title, true)
+	pdf.SetCreator("Markdown Editor", true)
+	pdf.AliasNbPages(pdfPagesAlias)
+	addPDFFonts(pdf)
+
+	r := &pdfRenderer{
+		pdf:    pdf,
+		source: source,
+		margin: opts.margin,
+		dir:    dir,
+		style:  code.chromaStyle(false),
+		links:  make(map[string]int),
+		images: make(map[string]bool),
+	}
+	pdf.SetHeaderFuncMode(func() { r.pageText(opts.header, opts.margin/2, opts) }, true)
+	pdf.SetFooterFunc(func() { r.pageText(opts.footer, -opts.margin/2, opts) })
+
+	// Links may point forwards, so every heading needs a target up front
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			if id, ok := heading.AttributeString("id"); ok {
+				r.links[string(id.([]byte))] = pdf.AddLink()
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	pdf.AddPage()
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		r.renderBlock(child, pdfStyle{size: pdfTextSize, color: pdfTextColor}, true)
+	}
+	return pdf.Output(w)
+}
+
+// pdfText replaces the characters outside the Basic Multilingual Plane, such
+// as emoji, which the embedded fonts cannot hold and fpdf cannot measure
+func pdfText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r > 0xFFFF {
+			return unicode.ReplacementChar
+		}
+		return r
+	}, text)
+}
+
+// addPDFFonts embeds the fonts of the default theme, so the export looks the
+// same everywhere and covers more than the Latin-1 of the standard PDF fonts
+func addPDFFonts(pdf *fpdf.Fpdf) {
+	fonts := theme.DefaultTheme()
+	pdf.AddUTF8FontFromBytes(pdfSans, "", fonts.Font(fyne.TextStyle{}).Content())
+	pdf.AddUTF8FontFromBytes(pdfSans, "B", fonts.Font(fyne.TextStyle{Bold: true}).Content())
+	pdf.AddUTF8FontFromBytes(pdfSans, "I", fonts.Font(fyne.TextStyle{Italic: true}).Content())
+	pdf.AddUTF8FontFromBytes(pdfSans, "BI", fonts.Font(fyne.TextStyle{Bold: true, Italic: true}).Content())
+	pdf.AddUTF8FontFromBytes(pdfMono, "", fonts.Font(fyne.TextStyle{Monospace: true}).Content())
+}
+
+// pageText draws a header or footer centred at y, measured from the bottom
+// of the page when negative
+func (r *pdfRenderer) pageText(format string, y float64, opts pdfOptions) {
+	if format == "" {
+		return
+	}
+	height := lineHeight(pdfPageSize)
+	r.pdf.SetFont(pdfSans, "", pdfPageSize)
+	r.setColor(pdfMutedColor)
+	pageWidth, _ := r.pdf.GetPageSize()
+	r.pdf.SetXY(r.margin, y-height/2)
+	r.pdf.CellFormat(pageWidth-2*r.margin, height, pdfText(opts.pageText(format, r.pdf.PageNo())), "", 0, "C", false, 0, "")
+}
+
+func (r *pdfRenderer) renderBlocks(parent ast.Node, style pdfStyle, spaced bool) {
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		r.renderBlock(child, style, spaced)
+	}
+}
+
+// renderBlock draws a block, followed by paragraph spacing if spaced
+func (r *pdfRenderer) renderBlock(n ast.Node, style pdfStyle, spaced bool) {
+	switch t := n.(type) {
+	case *ast.Paragraph, *ast.TextBlock:
+		r.renderInlines(n, style)
+		r.newLine(style.size)
+	case *ast.Heading:
+		r.renderHeading(t, style)
+		return
+	case *ast.Blockquote:
+		style.italic = true
+		style.color = pdfMutedColor
+		r.indented(6, func() { r.renderBlocks(n, style, true) })
+		return
+	case *ast.List:
+		r.renderList(t, style)
+	case *ast.CodeBlock, *ast.FencedCodeBlock:
+		language := ""
+		if fenced, ok := n.(*ast.FencedCodeBlock); ok {
+			language = string(fenced.Language(r.source))
+		}
+		r.renderCode(nodeLines(r.source, n), language)
+	case *ast.HTMLBlock:
+		r.renderCode(nodeLines(r.source, n), "")
+	case *ast.ThematicBreak:
+		r.space(pdfTextSize)
+		y := r.pdf.GetY()
+		r.setDrawColor(pdfRuleColor)
+		r.pdf.SetLineWidth(0.8)
+		r.pdf.Line(r.left(), y, r.left()+r.width(), y)
+		r.pdf.SetLineWidth(0.2)
+		r.pdf.Ln(1)
+	case *east.Table:
+		r.renderTable(t, style)
+	case *mathBlockNode:
+		r.renderMath(t.tex(r.source), true, true, style)
+	case *diagramNode:
+		r.renderDiagram(t.syntax, t.code(r.source), style)
+	default:
+		// Unknown blocks still show their inline content rather than vanishing
+		if n.Type() == ast.TypeBlock && n.HasChildren() {
+			r.renderBlocks(n, style, spaced)
+		}
+		return
+	}
+
+	if spaced {
+		r.space(style.size)
+	}
+}
+
+// renderHeading draws a heading, makes it the target of links to its ID and
+// adds it to the bookmarks
+func (r *pdfRenderer) renderHeading(heading *ast.Heading, style pdfStyle) {
+	sizes := []float64{22, 18, 15, 13, 11, 11}
+	style.size = sizes[heading.Level-1]
+	style.bold = true
+	if heading.Level == 6 {
+		style.color = pdfMutedColor
+	}
+
+	// Keep the heading with the start of its section
+	r.space(style.size)
+	r.keep(lineHeight(style.size) + 2*lineHeight(pdfTextSize))
+	if id, ok := heading.AttributeString("id"); ok {
+		r.pdf.SetLink(r.links[string(id.([]byte))], -1, -1)
+	}
+
+	// Bookmark levels may not skip, so a lone H3 under an H1 nests one deep
+	for len(r.levels) > 0 && r.levels[len(r.levels)-1] >= heading.Level {
+		r.levels = r.levels[:len(r.levels)-1]
+	}
+	title := strings.TrimSpace((&richTextRenderer{source: r.source}).plainText(heading))
+	if title != "" {
+		r.pdf.Bookmark(pdfText(title), len(r.levels), -1)
+	}
+	r.levels = append(r.levels, heading.Level)
+
+	r.renderInlines(heading, style)
+	r.newLine(style.size)
+	if heading.Level <= 2 {
+		y := r.pdf.GetY() + 1
+		r.setDrawColor(pdfRuleColor)
+		r.pdf.Line(r.left(), y, r.left()+r.width(), y)
+		r.pdf.SetY(y + 1)
+	}
+	r.space(pdfTextSize)
+}
+
+// renderList draws list items with their bullet or number hanging in the indent
+func (r *pdfRenderer) renderList(list *ast.List, style pdfStyle) {
+	const indent = 7
+	number := list.Start
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		marker := "•"
+		if list.IsOrdered() {
+			marker = strconv.Itoa(number) + "."
+			number++
+		}
+
+		r.indented(indent, func() {
+			r.setFont(style)
+			r.pdf.SetX(r.left() - indent)
+			r.pdf.Write(lineHeight(style.size), marker)
+			r.pdf.SetX(r.left())
+			for child := item.FirstChild(); child != nil; child = child.NextSibling() {
+				r.renderBlock(child, style, !list.IsTight && child.NextSibling() != nil)
+			}
+		})
+		if !list.IsTight {
+			r.space(style.size)
+		}
+	}
+}
+
+// renderCode draws code on the scheme background, wrapping long lines
+func (r *pdfRenderer) renderCode(code, language string) {
+	code = strings.TrimSuffix(code, "\n")
+	if code == "" {
+		return
+	}
+	const padding = 3
+	height := lineHeight(pdfCodeSize)
+	r.pdf.SetFont(pdfMono, "", pdfCodeSize)
+	columns := int((r.width() - 2*padding) / r.pdf.GetStringWidth("m"))
+	lines := codeLines(codeTokens(code, language), columns)
+
+	background := r.style.Get(chroma.Background).Background
+	if !background.IsSet() {
+		background = chroma.ParseColour("#f6f8fa")
+	}
+	fallback := codeTextColor(r.style)
+	r.pdf.SetFillColor(int(background.Red()), int(background.Green()), int(background.Blue()))
+
+	for i, line := range lines {
+		top, bottom := 0.0, 0.0
+		if i == 0 {
+			top = padding
+		}
+		if i == len(lines)-1 {
+			bottom = padding
+		}
+		r.keep(top + height + bottom)
+		y := r.pdf.GetY()
+		r.pdf.Rect(r.left(), y, r.width(), top+height+bottom, "F")
+
+		r.pdf.SetXY(r.left()+padding, y+top)
+		for _, token := range line {
+			entry := r.style.Get(token.Type)
+			colour := entry.Colour
+			if !colour.IsSet() {
+				colour = fallback
+			}
+			r.setColor([3]int{int(colour.Red()), int(colour.Green()), int(colour.Blue())})
+			r.pdf.Write(height, pdfText(token.Value))
+		}
+		r.pdf.SetXY(r.left(), y+top+height+bottom)
+	}
+}
+
+// renderTable draws a table with columns of equal width and wrapped cells
+func (r *pdfRenderer) renderTable(table *east.Table, style pdfStyle) {
+	columns := len(table.Alignments)
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		columns = max(columns, row.ChildCount())
+	}
+	if columns == 0 {
+		return
+	}
+
+	const padding = 1.5
+	height := lineHeight(style.size)
+	width := r.width() / float64(columns)
+	text := &richTextRenderer{source: r.source}
+	r.setDrawColor(pdfRuleColor)
+
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		cellStyle := style
+		_, header := row.(*east.TableHeader)
+		cellStyle.bold = header
+		r.setFont(cellStyle)
+
+		cells := make([][]string, columns)
+		lines := 1
+		column := 0
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			cells[column] = r.pdf.SplitText(pdfText(text.plainText(cell)), width-2*padding)
+			lines = max(lines, len(cells[column]))
+			column++
+		}
+
+		rowHeight := float64(lines)*height + 2*padding
+		r.keep(rowHeight)
+		y := r.pdf.GetY()
+		for c, cell := range cells {
+			x := r.left() + float64(c)*width
+			if header {
+				r.pdf.SetFillColor(pdfShadeColor[0], pdfShadeColor[1], pdfShadeColor[2])
+				r.pdf.Rect(x, y, width, rowHeight, "FD")
+			} else {
+				r.pdf.Rect(x, y, width, rowHeight, "D")
+			}
+
+			align := "L"
+			if c < len(table.Alignments) {
+				switch table.Alignments[c] {
+				case east.AlignRight:
+					align = "R"
+				case east.AlignCenter:
+					align = "C"
+				}
+			}
+			r.setColor(cellStyle.color)
+			for i, line := range cell {
+				r.pdf.SetXY(x+padding, y+padding+float64(i)*height)
+				r.pdf.CellFormat(width-2*padding, height, line, "", 0, align, false, 0, "")
+			}
+		}
+		r.pdf.SetXY(r.left(), y+rowHeight)
+	}
+}
+
+func (r *pdfRenderer) renderInlines(parent ast.Node, style pdfStyle) {
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		r.renderInline(child, style)
+	}
+}
+
+func (r *pdfRenderer) renderInline(n ast.Node, style pdfStyle) {
+	switch t := n.(type) {
+	case *ast.Text:
+		text := string(t.Value(r.source))
+		if t.SoftLineBreak() {
+			text += " "
+		}
+		r.write(text, style)
+		if t.HardLineBreak() {
+			r.newLine(style.size)
+		}
+	case *ast.String:
+		r.write(html.UnescapeString(string(t.Value)), style)
+	case *ast.Emphasis:
+		if t.Level >= 2 {
+			style.bold = true
+		} else {
+			style.italic = true
+		}
+		r.renderInlines(n, style)
+	case *east.Strikethrough:
+		style.strike = true
+		r.renderInlines(n, style)
+	case *ast.CodeSpan:
+		style.mono = true
+		r.write((&richTextRenderer{source: r.source}).plainText(n), style)
+	case *ast.Link:
+		style.link = string(t.Destination)
+		style.color = pdfLinkColor
+		r.renderInlines(n, style)
+	case *ast.AutoLink:
+		style.link = string(t.URL(r.source))
+		style.color = pdfLinkColor
+		r.write(string(t.Label(r.source)), style)
+	case *ast.Image:
+		r.renderImage(t, style)
+	case *ast.RawHTML:
+		var raw strings.Builder
+		for i := 0; i < t.Segments.Len(); i++ {
+			segment := t.Segments.At(i)
+			raw.Write(segment.Value(r.source))
+		}
+		style.mono = true
+		r.write(raw.String(), style)
+	case *east.TaskCheckBox:
+		style.mono = true
+		if t.IsChecked {
+			r.write("[x] ", style)
+		} else {
+			r.write("[ ] ", style)
+		}
+	case *mathInlineNode:
+		r.renderMath(t.tex, t.display, false, style)
+	default:
+		r.renderInlines(n, style)
+	}
+}
+
+// write draws inline text from the current position, wrapping at the margin
+func (r *pdfRenderer) write(text string, style pdfStyle) {
+	if text == "" {
+		return
+	}
+	text = pdfText(text)
+	r.setFont(style)
+	height := lineHeight(style.size)
+	if style.link == "" {
+		r.pdf.Write(height, text)
+	} else if link, ok := r.links[strings.TrimPrefix(style.link, "#")]; ok && strings.HasPrefix(style.link, "#") {
+		r.pdf.WriteLinkID(height, text, link)
+	} else {
+		r.pdf.WriteLinkString(height, text, style.link)
+	}
+}
+
+// renderImage draws a local image on its own line, scaled down to fit the
+// page. Other images show their description.
+func (r *pdfRenderer) renderImage(img *ast.Image, style pdfStyle) {
+	alt := (&richTextRenderer{source: r.source}).plainText(img)
+	name, width, height, ok := r.loadImage(string(img.Destination))
+	if !ok {
+		style.italic = true
+		r.write("["+alt+"]", style)
+		return
+	}
+
+	// Images are measured at 96 DPI
+	width, height = width*25.4/96, height*25.4/96
+	_, pageHeight := r.pdf.GetPageSize()
+	_, top, _, bottom := r.pdf.GetMargins()
+	scale := min(1, r.width()/width, (pageHeight-top-bottom)/height)
+	width, height = width*scale, height*scale
+
+	if r.pdf.GetX() > r.left() {
+		r.newLine(style.size)
+	}
+	r.keep(height)
+	r.pdf.ImageOptions(name, r.left(), r.pdf.GetY(), width, height, true, fpdf.ImageOptions{}, 0, "")
+}
+
+// renderMath draws a formula as a picture, in the line on its baseline or
+// centred on a line of its own. One that cannot be parsed shows its source.
+func (r *pdfRenderer) renderMath(tex string, display, block bool, style pdfStyle) {
+	picture, err := renderMathPicture(tex, display, style.size)
+	if err != nil {
+		style.mono = true
+		r.write(mathSource(tex, display), style)
+		return
+	}
+	r.formulas++
+	name := "formula" + strconv.Itoa(r.formulas)
+	r.pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(picture.png))
+	if !r.pdf.Ok() {
+		return
+	}
+
+	// Pictures are measured in points
+	width, height, baseline := picture.width*25.4/72, picture.height*25.4/72, picture.baseline*25.4/72
+	if block {
+		r.newLine(style.size)
+		scale := min(1, r.width()/width)
+		width, height = width*scale, height*scale
+		r.keep(height)
+		y := r.pdf.GetY()
+		r.pdf.ImageOptions(name, r.left()+(r.width()-width)/2, y, width, height, false, fpdf.ImageOptions{}, 0, "")
+		r.pdf.SetY(y + height)
+		r.pdf.SetX(r.left())
+		return
+	}
+
+	if r.pdf.GetX()+width > r.left()+r.width() {
+		r.newLine(style.size)
+	}
+	// Written text is centred in its line, with the baseline 0.3 of the
+	// font size below the middle
+	x, y := r.pdf.GetX(), r.pdf.GetY()
+	base := y + lineHeight(style.size)/2 + 0.3*style.size*25.4/72
+	r.pdf.ImageOptions(name, x, base-baseline, width, height, false, fpdf.ImageOptions{}, 0, "")
+	r.pdf.SetXY(x+width, y)
+}
+
+// renderDiagram draws a diagram centered and scaled down to the width of
+// the page. One that cannot be drawn shows why, followed by its source.
+func (r *pdfRenderer) renderDiagram(syntax, code string, style pdfStyle) {
+	picture, err := renderDiagramPicture(syntax, code)
+	if err != nil {
+		style.italic = true
+		style.color = pdfMutedColor
+		r.write(syntax+": "+err.Error(), style)
+		r.newLine(style.size)
+		r.space(style.size)
+		r.renderCode(code, syntax)
+		return
+	}
+	r.diagrams++
+	name := "diagram" + strconv.Itoa(r.diagrams)
+	r.pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: "PNG"}, bytes.NewReader(picture.png))
+	if !r.pdf.Ok() {
+		return
+	}
+
+	// Pictures are measured in points
+	width, height := picture.width*25.4/72, picture.height*25.4/72
+	scale := min(1, r.width()/width)
+	width, height = width*scale, height*scale
+	r.keep(height)
+	y := r.pdf.GetY()
+	r.pdf.ImageOptions(name, r.left()+(r.width()-width)/2, y, width, height, false, fpdf.ImageOptions{}, 0, "")
+	r.pdf.SetY(y + height)
+	r.pdf.SetX(r.left())
+}
+
+// loadImage registers a local image with the PDF, returning its name and
+// size in pixels
+func (r *pdfRenderer) loadImage(destination string) (string, float64, float64, bool) {
+	img, err := readLocalImage(destination, r.dir)
+	if err != nil {
+		return "", 0, 0, false
+	}
+
+	if !r.images[img.path] {
+		// Images other than JPEG are embedded as plain PNG, which the PDF
+		// writer supports in every variant
+		data := img.data
+		options := fpdf.ImageOptions{ImageType: "JPG"}
+		if img.format != "jpeg" {
+			decoded, _, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				return "", 0, 0, false
+			}
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, decoded); err != nil {
+				return "", 0, 0, false
+			}
+			data = buf.Bytes()
+			options.ImageType = "PNG"
+		}
+		r.pdf.RegisterImageOptionsReader(img.path, options, bytes.NewReader(data))
+		if !r.pdf.Ok() {
+			return "", 0, 0, false
+		}
+		r.images[img.path] = true
+	}
+	return img.path, float64(img.width), float64(img.height), true
+}
+
+// setFont selects the font and color of a style
+func (r *pdfRenderer) setFont(style pdfStyle) {
+	styles := ""
+	family := pdfSans
+	size := style.size
+	if style.mono {
+		family = pdfMono
+		size *= 0.9
+	} else {
+		if style.bold {
+			styles += "B"
+		}
+		if style.italic {
+			styles += "I"
+		}
+	}
+	if style.strike {
+		styles += "S"
+	}
+	if style.link != "" {
+		styles += "U"
+	}
+	r.pdf.SetFont(family, styles, size)
+	r.setColor(style.color)
+}
+
+func (r *pdfRenderer) setColor(c [3]int) {
+	r.pdf.SetTextColor(c[0], c[1], c[2])
+}
+
+func (r *pdfRenderer) setDrawColor(c [3]int) {
+	r.pdf.SetDrawColor(c[0], c[1], c[2])
+}
+
+// indented runs draw with the left margin moved in by indent millimetres
+func (r *pdfRenderer) indented(indent float64, draw func()) {
+	r.indent += indent
+	r.pdf.SetLeftMargin(r.left())
+	r.pdf.SetX(r.left())
+	draw()
+	r.indent -= indent
+	r.pdf.SetLeftMargin(r.left())
+	r.pdf.SetX(r.left())
+}
+
+// left returns the left edge of the current block
+func (r *pdfRenderer) left() float64 {
+	return r.margin + r.indent
+}
+
+// width returns the width of the current block
+func (r *pdfRenderer) width() float64 {
+	pageWidth, _ := r.pdf.GetPageSize()
+	return pageWidth - 2*r.margin - r.indent
+}
+
+// newLine moves to the start of the next line if anything is on this one
+func (r *pdfRenderer) newLine(size float64) {
+	if r.pdf.GetX() > r.left()+0.01 {
+		r.pdf.Ln(lineHeight(size))
+	}
+	r.pdf.SetX(r.left())
+}
+
+// space leaves a gap of half a line between blocks
+func (r *pdfRenderer) space(size float64) {
+	r.pdf.Ln(lineHeight(size) / 2)
+	r.pdf.SetX(r.left())
+}
+
+// keep starts a new page unless height fits on the current one
+func (r *pdfRenderer) keep(height float64) {
+	_, pageHeight := r.pdf.GetPageSize()
+	_, bottom := r.pdf.GetAutoPageBreak()
+	if r.pdf.GetY()+height > pageHeight-bottom {
+		r.pdf.AddPage()
+	}
+	r.pdf.SetX(r.left())
+}
+
+// lineHeight converts a text size in points to a line height in millimetres
+func lineHeight(size float64) float64 {
+	return size * pdfLineSpacing * 25.4 / 72
+}
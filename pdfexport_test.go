@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRenderPDF(t *testing.T) {
+	tests := []struct {
+		name   string
+		title  string
+		source string
+	}{
+		{name: "plain text", title: "Notes", source: "# Notes\n\nSome *text* and a [link](https://example.com).\n"},
+		{name: "emoji in a paragraph", title: "Notes", source: "Party time 🎉 tonight.\n"},
+		{name: "emoji in a heading", title: "Notes", source: "# Launch 🚀\n\nText.\n"},
+		{name: "emoji in a link", title: "Notes", source: "[Go 🚀](https://go.dev) and [back](#top)\n"},
+		{name: "emoji in code", title: "Notes", source: "```go\nfmt.Println(\"😀\")\n```\n"},
+		{name: "emoji in a table", title: "Notes", source: "| a | b |\n|---|---|\n| 😀 | 𠀀 |\n"},
+		{name: "emoji in the title", title: "Trip 🌍", source: "Text.\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := []byte(test.source)
+			opts := defaultPDFOptions()
+			opts.title = test.title
+			var out bytes.Buffer
+			err := renderPDF(&out, source, parseMarkdown(newMarkdown(), source), "", opts, codeHighlight{style: "github"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(out.Bytes(), []byte("%PDF")) {
+				t.Errorf("output does not start with %%PDF")
+			}
+		})
+	}
+}
+
+func TestPDFPageText(t *testing.T) {
+	opts := pdfOptions{title: "Report 🚀"}
+	tests := []struct {
+		format string
+		page   int
+		want   string
+	}{
+		{format: "{title}", page: 1, want: "Report 🚀"},
+		{format: "Page {page} of {pages}", page: 3, want: "Page 3 of {pages}"},
+		{format: "", page: 1, want: ""},
+		{format: "{unknown}", page: 1, want: "{unknown}"},
+	}
+	for _, test := range tests {
+		if got := opts.pageText(test.format, test.page); got != test.want {
+			t.Errorf("pageText(%q, %d) = %q, want %q", test.format, test.page, got, test.want)
+		}
+	}
+	if got := pdfText(opts.title); got != "Report �" {
+		t.Errorf("pdfText(%q) = %q", opts.title, got)
+	}
+}
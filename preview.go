@@ -1,52 +1,60 @@
 package main
 
 import (
-	"bytes"
-	"fmt"
 	"strings"
+	"time"
 
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"github.com/yuin/goldmark"
-	"github.com/yuin/goldmark/extension"
-	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/ast"
 )
 
+// previewDelay is how long typing has to pause before the preview is rendered again
+const previewDelay = 150 * time.Millisecond
+
 // Preview represents the markdown preview component
 type Preview struct {
-	content         *widget.RichText
+	content         *blockList
+	blocks          []*widget.RichText
+	blockLines      []int
+	blockKeys       []string
+	lineCount       int
 	container       *fyne.Container
 	scrollContainer *container.Scroll
 	placeholder     fyne.CanvasObject
 	visible         bool
 	rawMarkdown     string
+	code            codeHighlight
+	dir             string
 	rendered        string
 	md              goldmark.Markdown
+	source          []byte
+	document        ast.Node
+	metadata        metadataPanel
+
+	// OnScrolled is called when the user scrolls the preview
+	OnScrolled func()
 }
 
 // NewPreview creates a new preview instance
 func NewPreview() *Preview {
-	md := goldmark.New(
-		goldmark.WithExtensions(
-			extension.GFM,
-			extension.Typographer,
-		),
-		goldmark.WithParserOptions(
-			parser.WithAutoHeadingID(),
-		),
-		goldmark.WithRendererOptions(
-			html.WithUnsafe(),
-		),
-	)
-
 	p := &Preview{
-		content: widget.NewRichTextFromMarkdown(""),
+		content: newBlockList(),
 		visible: true,
-		md:      md,
+		md:      newMarkdown(),
+	}
+	p.metadata.resized = func() {
+		// Front matter can only be the first block
+		if len(p.blocks) > 0 {
+			p.blocks[0].Refresh()
+			p.content.Forget(p.blocks[0])
+			p.scrollContainer.Refresh()
+		}
 	}
-	p.content.Wrapping = fyne.TextWrapWord
 	return p
 }
 
@@ -55,6 +63,11 @@ func (p *Preview) Create() fyne.CanvasObject {
 	p.scrollContainer = container.NewScroll(
 		container.NewPadded(p.content),
 	)
+	p.scrollContainer.OnScrolled = func(fyne.Position) {
+		if p.OnScrolled != nil {
+			p.OnScrolled()
+		}
+	}
 	p.scrollContainer.Hide()
 
 	placeholderLabel := widget.NewLabelWithStyle(
@@ -92,7 +105,7 @@ func (p *Preview) UpdateContent(markdown string) {
 	trimmed := strings.TrimSpace(markdown)
 	if trimmed == "" {
 		p.rendered = ""
-		p.content.ParseMarkdown("")
+		p.setBlocks(nil)
 		p.scrollContainer.Hide()
 		p.placeholder.Show()
 		return
@@ -107,148 +120,316 @@ func (p *Preview) UpdateContent(markdown string) {
 	p.placeholder.Hide()
 	p.scrollContainer.Show()
 
-	// Use Fyne's built-in markdown parsing for the preview
-	p.content.ParseMarkdown(markdown)
+	// Render from the same goldmark AST that the HTML export uses
+	doc := p.parse(markdown)
+	p.setBlocks(renderRichText(p.source, doc, p.code, &p.metadata, p.dir))
+	p.lineCount = strings.Count(markdown, "\n") + 1
 
 	// Refresh the scroll container to ensure proper rendering
 	p.scrollContainer.Refresh()
 	p.rendered = markdown
 }
 
+// setBlocks shows the rendered blocks. Blocks whose source did not change
+// keep their rich text widgets from the previous render without being laid
+// out again, so that editing a long document stays fast and does not flicker.
+func (p *Preview) setBlocks(blocks []richTextBlock) {
+	previous := make(map[string][]*widget.RichText)
+	for i, text := range p.blocks {
+		if key := p.blockKeys[i]; key != "" {
+			previous[key] = append(previous[key], text)
+		}
+	}
+
+	p.blocks = make([]*widget.RichText, len(blocks))
+	p.blockLines = make([]int, len(blocks))
+	p.blockKeys = make([]string, len(blocks))
+	objects := make([]fyne.CanvasObject, len(blocks))
+	for i, block := range blocks {
+		if reuse := previous[block.key]; block.key != "" && len(reuse) > 0 {
+			p.blocks[i] = reuse[0]
+			previous[block.key] = reuse[1:]
+		} else {
+			p.blocks[i] = widget.NewRichText(block.segments...)
+			p.blocks[i].Wrapping = fyne.TextWrapWord
+		}
+		p.blockLines[i] = block.line
+		p.blockKeys[i] = block.key
+		objects[i] = p.blocks[i]
+	}
+	p.content.SetObjects(objects)
+}
+
+// SetDir sets the folder that relative image paths are found in, which is
+// empty for unsaved documents
+func (p *Preview) SetDir(dir string) {
+	if dir == p.dir {
+		return
+	}
+	p.dir = dir
+
+	// Any image may now be found elsewhere, so no block can be kept
+	p.blocks, p.blockLines, p.blockKeys = nil, nil, nil
+	p.rendered = ""
+	if p.scrollContainer != nil {
+		p.UpdateContent(p.rawMarkdown)
+	}
+}
+
+// anchors pairs source lines with the offsets in the scrolled content where
+// they are shown, starting at the top and ending at the bottom of the document
+func (p *Preview) anchors() (lines, offsets []float32) {
+	lines = append(lines, 0)
+	offsets = append(offsets, 0)
+
+	top := p.content.Position().Y
+	for i, text := range p.blocks {
+		line := float32(p.blockLines[i])
+		if p.blockLines[i] < 0 || line < lines[len(lines)-1] {
+			continue
+		}
+		lines = append(lines, line)
+		offsets = append(offsets, top+text.Position().Y)
+	}
+
+	lines = append(lines, float32(p.lineCount))
+	offsets = append(offsets, p.scrollContainer.Content.Size().Height)
+	return lines, offsets
+}
+
+// TopLine returns the fractional 0-based source line shown at the top of the preview
+func (p *Preview) TopLine() float32 {
+	if p.scrollContainer == nil {
+		return 0
+	}
+	lines, offsets := p.anchors()
+	return interpolate(offsets, lines, p.scrollContainer.Offset.Y)
+}
+
+// ScrollToLine scrolls so that a fractional 0-based source line is shown
+// at the given distance from the top of the preview
+func (p *Preview) ScrollToLine(line, at float32) {
+	if p.scrollContainer == nil || !p.scrollContainer.Visible() {
+		return
+	}
+
+	lines, offsets := p.anchors()
+	y := interpolate(lines, offsets, line) - at
+	maxY := p.scrollContainer.Content.Size().Height - p.scrollContainer.Size().Height
+	if y > maxY {
+		y = maxY
+	}
+	if y < 0 {
+		y = 0
+	}
+	p.scrollContainer.ScrollToOffset(fyne.NewPos(p.scrollContainer.Offset.X, y))
+}
+
 // ToggleVisibility toggles the preview pane visibility
 func (p *Preview) ToggleVisibility() {
+	p.SetVisible(!p.visible)
+}
+
+// SetVisible shows or hides the preview pane
+func (p *Preview) SetVisible(visible bool) {
 	if p.container == nil {
 		return
 	}
 
-	if p.visible {
-		p.container.Hide()
-	} else {
+	if visible {
 		p.container.Show()
+	} else {
+		p.container.Hide()
+	}
+	p.visible = visible
+}
+
+// IsVisible reports whether the preview pane is shown
+func (p *Preview) IsVisible() bool {
+	return p.visible
+}
+
+// parse returns the goldmark AST for the markdown, reusing the last parse
+// when the content has not changed since
+func (p *Preview) parse(markdown string) ast.Node {
+	if p.document != nil && string(p.source) == markdown {
+		return p.document
+	}
+
+	p.source = []byte(markdown)
+	p.document = parseMarkdown(p.md, p.source)
+	return p.document
+}
+
+// Parsed returns the source and goldmark AST of the current content
+func (p *Preview) Parsed() ([]byte, ast.Node) {
+	doc := p.parse(p.rawMarkdown)
+	return p.source, doc
+}
+
+// SetCodeHighlight changes how code blocks are highlighted, rendering the
+// preview again
+func (p *Preview) SetCodeHighlight(code codeHighlight) {
+	if code == p.code {
+		return
+	}
+	p.code = code
+
+	// Every code block changes, so no block can be kept
+	p.blocks, p.blockLines, p.blockKeys = nil, nil, nil
+	p.rendered = ""
+	if p.scrollContainer != nil {
+		p.UpdateContent(p.rawMarkdown)
+	}
+}
+
+// blockList stacks the rendered blocks of the preview. It remembers the size
+// of each block so that laying out a long document again after an edit only
+// measures the blocks that are new, and refreshing it does not refresh every
+// block as a container would.
+type blockList struct {
+	widget.BaseWidget
+	objects []fyne.CanvasObject
+
+	sizes    map[fyne.CanvasObject]fyne.Size
+	width    float32
+	textSize float32
+}
+
+func newBlockList() *blockList {
+	l := &blockList{sizes: make(map[fyne.CanvasObject]fyne.Size)}
+	l.ExtendBaseWidget(l)
+	return l
+}
+
+// SetObjects replaces the blocks shown
+func (l *blockList) SetObjects(objects []fyne.CanvasObject) {
+	sizes := make(map[fyne.CanvasObject]fyne.Size, len(objects))
+	for _, o := range objects {
+		if size, ok := l.sizes[o]; ok {
+			sizes[o] = size
+		}
+	}
+	l.objects = objects
+	l.sizes = sizes
+	l.Refresh()
+}
+
+// Forget measures a block again, as its content has changed size
+func (l *blockList) Forget(o fyne.CanvasObject) {
+	delete(l.sizes, o)
+	l.Refresh()
+}
+
+// blockSize returns the size a block needs at the width of the list
+func (l *blockList) blockSize(o fyne.CanvasObject) fyne.Size {
+	if size, ok := l.sizes[o]; ok {
+		return size
 	}
-	p.visible = !p.visible
-}
-
-// GetHTML returns the markdown converted to HTML
-func (p *Preview) GetHTML() string {
-	var buf bytes.Buffer
-
-	if err := p.md.Convert([]byte(p.rawMarkdown), &buf); err != nil {
-		return fmt.Sprintf("<p>Error converting markdown: %v</p>", err)
-	}
-
-	htmlTemplate := `<!DOCTYPE html>
-<html>
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Markdown Export</title>
-    <style>
-        body {
-            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif;
-            font-size: 16px;
-            line-height: 1.6;
-            color: #333;
-            background-color: #fff;
-            margin: 0;
-            padding: 20px;
-            max-width: 800px;
-            margin: 0 auto;
-        }
-        h1, h2, h3, h4, h5, h6 {
-            margin-top: 24px;
-            margin-bottom: 16px;
-            font-weight: 600;
-            line-height: 1.25;
-        }
-        h1 { font-size: 2em; border-bottom: 1px solid #eee; padding-bottom: 0.3em; }
-        h2 { font-size: 1.5em; border-bottom: 1px solid #eee; padding-bottom: 0.3em; }
-        h3 { font-size: 1.25em; }
-        h4 { font-size: 1em; }
-        h5 { font-size: 0.875em; }
-        h6 { font-size: 0.85em; color: #777; }
-        p { margin-top: 0; margin-bottom: 16px; }
-        a { color: #0969da; text-decoration: none; }
-        a:hover { text-decoration: underline; }
-        code {
-            padding: 0.2em 0.4em;
-            margin: 0;
-            font-size: 85%%;
-            background-color: rgba(27,31,35,0.05);
-            border-radius: 3px;
-            font-family: "SFMono-Regular", Consolas, "Liberation Mono", Menlo, monospace;
-        }
-        pre {
-            padding: 16px;
-            overflow: auto;
-            font-size: 85%%;
-            line-height: 1.45;
-            background-color: #f6f8fa;
-            border-radius: 3px;
-        }
-        pre code {
-            display: inline;
-            padding: 0;
-            margin: 0;
-            border: 0;
-            background-color: transparent;
-        }
-        blockquote {
-            padding: 0 1em;
-            color: #6a737d;
-            border-left: 0.25em solid #dfe2e5;
-            margin: 0 0 16px 0;
-        }
-        ul, ol {
-            padding-left: 2em;
-            margin-top: 0;
-            margin-bottom: 16px;
-        }
-        li { margin-bottom: 0.25em; }
-        table {
-            border-spacing: 0;
-            border-collapse: collapse;
-            margin-bottom: 16px;
-        }
-        table th, table td {
-            padding: 6px 13px;
-            border: 1px solid #dfe2e5;
-        }
-        table th {
-            font-weight: 600;
-            background-color: #f6f8fa;
-        }
-        table tr {
-            background-color: #fff;
-            border-top: 1px solid #c6cbd1;
-        }
-        table tr:nth-child(2n) {
-            background-color: #f6f8fa;
-        }
-        hr {
-            height: 0.25em;
-            padding: 0;
-            margin: 24px 0;
-            background-color: #e1e4e8;
-            border: 0;
-        }
-        img {
-            max-width: 100%%;
-            box-sizing: content-box;
-        }
-        .task-list-item {
-            list-style-type: none;
-        }
-        .task-list-item input {
-            margin: 0 0.2em 0.25em -1.6em;
-            vertical-align: middle;
-        }
-    </style>
-</head>
-<body>
-%s
-</body>
-</html>`
-
-	return fmt.Sprintf(htmlTemplate, buf.String())
+
+	// Wrapped text only knows its height once it has its width
+	o.Resize(fyne.NewSize(l.width, o.MinSize().Height))
+	size := o.MinSize()
+	l.sizes[o] = size
+	return size
+}
+
+// checkSizes forgets the sizes of the blocks when they may have changed
+func (l *blockList) checkSizes(width float32) {
+	textSize := l.Theme().Size(theme.SizeNameText)
+	if width != l.width || textSize != l.textSize {
+		l.sizes = make(map[fyne.CanvasObject]fyne.Size)
+		l.width = width
+		l.textSize = textSize
+	}
+}
+
+// CreateRenderer returns the renderer for the list
+func (l *blockList) CreateRenderer() fyne.WidgetRenderer {
+	return &blockListRenderer{list: l}
 }
+
+type blockListRenderer struct {
+	list *blockList
+}
+
+func (r *blockListRenderer) Layout(size fyne.Size) {
+	l := r.list
+	l.checkSizes(size.Width)
+	y := float32(0)
+	for _, o := range l.objects {
+		height := l.blockSize(o).Height
+		o.Move(fyne.NewPos(0, y))
+		o.Resize(fyne.NewSize(size.Width, height))
+		y += height
+	}
+}
+
+func (r *blockListRenderer) MinSize() fyne.Size {
+	l := r.list
+	l.checkSizes(l.Size().Width)
+	var min fyne.Size
+	for _, o := range l.objects {
+		size := l.blockSize(o)
+		min.Width = fyne.Max(min.Width, size.Width)
+		min.Height += size.Height
+	}
+	return min
+}
+
+func (r *blockListRenderer) Refresh() {
+	r.Layout(r.list.Size())
+	canvas.Refresh(r.list)
+}
+
+func (r *blockListRenderer) Objects() []fyne.CanvasObject {
+	return r.list.objects
+}
+
+func (r *blockListRenderer) Destroy() {}
+
+// imageBlock centers a picture in the width of the preview, and shrinks one
+// that is wider rather than cutting it off
+type imageBlock struct {
+	widget.BaseWidget
+	image *canvas.Image
+}
+
+func (b *imageBlock) CreateRenderer() fyne.WidgetRenderer {
+	return &imageBlockRenderer{block: b}
+}
+
+// scaled returns the size of the picture in a width
+func (b *imageBlock) scaled(width float32) fyne.Size {
+	natural := b.image.MinSize()
+	if natural.Width > width && width > 0 {
+		return fyne.NewSize(width, natural.Height*width/natural.Width)
+	}
+	return natural
+}
+
+type imageBlockRenderer struct {
+	block *imageBlock
+}
+
+func (r *imageBlockRenderer) Layout(size fyne.Size) {
+	scaled := r.block.scaled(size.Width)
+	r.block.image.Resize(scaled)
+	r.block.image.Move(fyne.NewPos((size.Width-scaled.Width)/2, (size.Height-scaled.Height)/2))
+}
+
+// MinSize asks for no width, so that a wide picture never widens the preview
+func (r *imageBlockRenderer) MinSize() fyne.Size {
+	return fyne.NewSize(0, r.block.scaled(r.block.Size().Width).Height)
+}
+
+func (r *imageBlockRenderer) Refresh() {
+	r.Layout(r.block.Size())
+	r.block.image.Refresh()
+}
+
+func (r *imageBlockRenderer) Objects() []fyne.CanvasObject {
+	return []fyne.CanvasObject{r.block.image}
+}
+
+func (r *imageBlockRenderer) Destroy() {}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"fyne.io/fyne/v2"
+)
+
+// autosaveInterval is how often unsaved buffers are written to the recovery journal
+const autosaveInterval = 30 * time.Second
+
+// recoveryOwnerFile holds the process ID of the editor a journal folder
+// belongs to. The editor touches it as it autosaves, so a folder whose owner
+// has stopped touching it is left over even if the ID has been reused.
+const recoveryOwnerFile = "owner.pid"
+
+// RecoveryJournal keeps copies of unsaved buffers under the app storage root
+// so that they survive a crash. Each buffer is stored as a markdown file with
+// a JSON sidecar describing where it came from. Every running editor keeps
+// its buffers in a folder of its own, so one never offers or removes the
+// buffers of another that is still open.
+type RecoveryJournal struct {
+	// root holds the folders of every editor, and dir the one of this editor
+	root string
+	dir  string
+}
+
+// RecoveryEntry describes one buffer held in the recovery journal
+type RecoveryEntry struct {
+	ID      string    `json:"id"`
+	URI     string    `json:"uri,omitempty"`
+	Name    string    `json:"name"`
+	Saved   time.Time `json:"saved"`
+	Content string    `json:"-"`
+
+	// dir is the journal folder the entry was found in
+	dir string
+}
+
+// NewRecoveryJournal creates a journal for this process in the recovery
+// folder of the storage root
+func NewRecoveryJournal(root fyne.URI) *RecoveryJournal {
+	if root == nil {
+		return &RecoveryJournal{}
+	}
+	base := filepath.Join(root.Path(), "recovery")
+	return &RecoveryJournal{root: base, dir: filepath.Join(base, fmt.Sprintf("%d-%s", os.Getpid(), newDocumentID()))}
+}
+
+// Save writes the current content of a document to the journal
+func (j *RecoveryJournal) Save(doc *Document, content string) error {
+	if j.dir == "" {
+		return nil
+	}
+	if err := j.claim(); err != nil {
+		return err
+	}
+
+	entry := RecoveryEntry{ID: doc.id, Name: doc.Name(), Saved: time.Now()}
+	if doc.uri != nil {
+		entry.URI = doc.uri.String()
+	}
+	meta, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// Write the content before the sidecar so a listed entry always has its text
+	if err := os.WriteFile(entryPath(j.dir, doc.id, ".md"), []byte(content), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(entryPath(j.dir, doc.id, ".json"), meta, 0600)
+}
+
+// Remove deletes a buffer of this editor from the journal
+func (j *RecoveryJournal) Remove(id string) {
+	if j.dir == "" {
+		return
+	}
+	os.Remove(entryPath(j.dir, id, ".json"))
+	os.Remove(entryPath(j.dir, id, ".md"))
+}
+
+// Touch marks the journal of this editor as still in use
+func (j *RecoveryJournal) Touch() {
+	if j.dir == "" {
+		return
+	}
+	now := time.Now()
+	os.Chtimes(filepath.Join(j.dir, recoveryOwnerFile), now, now)
+}
+
+// Entries lists the buffers left in the journal by editors that are no
+// longer running, oldest first
+func (j *RecoveryJournal) Entries() ([]*RecoveryEntry, error) {
+	if j.root == "" {
+		return nil, nil
+	}
+	folders, err := os.ReadDir(j.root)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Buffers kept before the journal had a folder per editor have no owner
+	entries := readRecoveryEntries(j.root)
+	for _, folder := range folders {
+		dir := filepath.Join(j.root, folder.Name())
+		if !folder.IsDir() || dir == j.dir || recoveryOwnerAlive(dir) {
+			continue
+		}
+
+		found := readRecoveryEntries(dir)
+		if len(found) == 0 {
+			// Nothing is left to offer from an editor that has gone
+			os.RemoveAll(dir)
+		}
+		entries = append(entries, found...)
+	}
+
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].Saved.Before(entries[b].Saved)
+	})
+	return entries, nil
+}
+
+// Adopt moves a buffer left by another editor into the journal of this one,
+// where it stays until the buffer is saved or closed
+func (j *RecoveryJournal) Adopt(entry *RecoveryEntry) error {
+	if j.dir == "" || entry.dir == j.dir {
+		return nil
+	}
+	if err := j.claim(); err != nil {
+		return err
+	}
+
+	// The sidecar goes last so the entry is never listed without its text
+	for _, ext := range []string{".md", ".json"} {
+		if err := os.Rename(entryPath(entry.dir, entry.ID, ext), entryPath(j.dir, entry.ID, ext)); err != nil {
+			return err
+		}
+	}
+	j.removeIfEmpty(entry.dir)
+	entry.dir = j.dir
+	return nil
+}
+
+// Discard deletes a buffer that was left in the journal
+func (j *RecoveryJournal) Discard(entry *RecoveryEntry) {
+	if entry.dir == "" {
+		return
+	}
+	os.Remove(entryPath(entry.dir, entry.ID, ".json"))
+	os.Remove(entryPath(entry.dir, entry.ID, ".md"))
+	j.removeIfEmpty(entry.dir)
+}
+
+// claim creates the folder of this editor with its owner file
+func (j *RecoveryJournal) claim() error {
+	owner := filepath.Join(j.dir, recoveryOwnerFile)
+	if _, err := os.Stat(owner); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(j.dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(owner, []byte(strconv.Itoa(os.Getpid())), 0600)
+}
+
+// removeIfEmpty deletes the folder of an editor that has gone once none of
+// its buffers are left
+func (j *RecoveryJournal) removeIfEmpty(dir string) {
+	if dir == j.dir || dir == j.root || len(readRecoveryEntries(dir)) > 0 {
+		return
+	}
+	os.RemoveAll(dir)
+}
+
+// readRecoveryEntries reads the buffers in one journal folder
+func readRecoveryEntries(dir string) []*RecoveryEntry {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	var entries []*RecoveryEntry
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+
+		id := strings.TrimSuffix(file.Name(), ".json")
+		meta, err := os.ReadFile(entryPath(dir, id, ".json"))
+		if err != nil {
+			continue
+		}
+		content, err := os.ReadFile(entryPath(dir, id, ".md"))
+		if err != nil {
+			continue
+		}
+
+		entry := &RecoveryEntry{}
+		if err := json.Unmarshal(meta, entry); err != nil {
+			continue
+		}
+		entry.ID = id
+		entry.Content = string(content)
+		entry.dir = dir
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// recoveryOwnerAlive reports whether the editor a journal folder belongs to
+// is still running: its process exists and it has autosaved recently
+func recoveryOwnerAlive(dir string) bool {
+	owner := filepath.Join(dir, recoveryOwnerFile)
+	info, err := os.Stat(owner)
+	if err != nil || time.Since(info.ModTime()) > 3*autosaveInterval {
+		return false
+	}
+	data, err := os.ReadFile(owner)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return false
+	}
+	return processAlive(pid)
+}
+
+// processAlive reports whether a process with the ID exists
+func processAlive(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// Windows only finds processes that exist, and cannot be sent signal 0
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+func entryPath(dir, id, ext string) string {
+	return filepath.Join(dir, id+ext)
+}
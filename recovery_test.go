@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/storage"
+)
+
+func TestRecoveryJournalOwners(t *testing.T) {
+	root := storage.NewFileURI(t.TempDir())
+	running := NewRecoveryJournal(root)
+	if err := running.Save(&Document{id: "draft"}, "unsaved"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second editor leaves the buffers of one that is still running alone
+	next := NewRecoveryJournal(root)
+	entries, err := next.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("listed %d entries of a running editor", len(entries))
+	}
+
+	// Once the first editor stops touching its journal it has gone
+	stale := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(running.dir, recoveryOwnerFile), stale, stale); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = next.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ID != "draft" || entries[0].Content != "unsaved" {
+		t.Fatalf("got %+v, want the draft", entries)
+	}
+
+	if err := next.Adopt(entries[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(running.dir); !os.IsNotExist(err) {
+		t.Errorf("folder of the gone editor is left after adopting its buffer: %v", err)
+	}
+	if _, err := os.Stat(entryPath(next.dir, "draft", ".md")); err != nil {
+		t.Errorf("adopted buffer is missing: %v", err)
+	}
+
+	// The adopted buffer belongs to the second editor until it is removed
+	third := NewRecoveryJournal(root)
+	if entries, _ := third.Entries(); len(entries) != 0 {
+		t.Fatalf("listed %d entries of a running editor", len(entries))
+	}
+	next.Remove("draft")
+	if entries := readRecoveryEntries(next.dir); len(entries) != 0 {
+		t.Fatalf("%d entries left after removing", len(entries))
+	}
+}
+
+func TestRecoveryJournalDiscard(t *testing.T) {
+	root := storage.NewFileURI(t.TempDir())
+	gone := NewRecoveryJournal(root)
+	for _, id := range []string{"a", "b"} {
+		if err := gone.Save(&Document{id: id}, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A process ID that is not running, as after a crash
+	if err := os.WriteFile(filepath.Join(gone.dir, recoveryOwnerFile), []byte("-1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	next := NewRecoveryJournal(root)
+	entries, err := next.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	next.Discard(entries[0])
+	if _, err := os.Stat(gone.dir); err != nil {
+		t.Fatalf("folder removed while it still holds a buffer: %v", err)
+	}
+	next.Discard(entries[1])
+	if _, err := os.Stat(gone.dir); !os.IsNotExist(err) {
+		t.Errorf("folder left after discarding its buffers: %v", err)
+	}
+}
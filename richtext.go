@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+// inlineStyle tracks the formatting that applies to a run of inline text
+type inlineStyle struct {
+	text   fyne.TextStyle
+	size   fyne.ThemeSizeName
+	color  fyne.ThemeColorName
+	strike bool
+}
+
+// segment creates an inline text segment carrying this style
+func (s inlineStyle) segment(text string) *widget.TextSegment {
+	if s.strike {
+		text = strikeThrough(text)
+	}
+	return &widget.TextSegment{
+		Text: text,
+		Style: widget.RichTextStyle{
+			ColorName: s.color,
+			Inline:    true,
+			SizeName:  s.size,
+			TextStyle: s.text,
+		},
+	}
+}
+
+// richTextRenderer converts a goldmark AST into Fyne rich text segments
+type richTextRenderer struct {
+	source   []byte
+	code     codeHighlight
+	metadata *metadataPanel
+	// dir resolves relative image paths, and is empty for unsaved documents
+	dir string
+}
+
+// richTextBlock is one top-level markdown block rendered as rich text
+type richTextBlock struct {
+	// line is the 0-based source line the block starts on, or -1 if unknown
+	line     int
+	segments []widget.RichTextSegment
+	// key is the source from the start of the block up to the next one, so
+	// that an unchanged block can keep its widget. It is empty if unknown.
+	key string
+}
+
+// renderRichText renders each top-level block of a parsed markdown document
+// separately, so that the preview can relate its position to source lines
+func renderRichText(source []byte, doc ast.Node, code codeHighlight, metadata *metadataPanel, dir string) []richTextBlock {
+	r := &richTextRenderer{source: source, code: code, metadata: metadata, dir: dir}
+	var blocks []richTextBlock
+	var starts []int
+	for child := doc.FirstChild(); child != nil; child = child.NextSibling() {
+		segs := r.renderBlock(child, inlineStyle{}, 0)
+		if len(segs) == 0 {
+			continue
+		}
+		blocks = append(blocks, richTextBlock{line: sourceLine(source, child), segments: segs})
+
+		start := sourceOffset(child)
+		if start >= 0 {
+			start = bytes.LastIndexByte(source[:start], '\n') + 1
+		}
+		starts = append(starts, start)
+	}
+
+	for i, start := range starts {
+		if start < 0 {
+			continue
+		}
+		end := len(source)
+		for _, next := range starts[i+1:] {
+			if next >= start {
+				end = next
+				break
+			}
+		}
+		blocks[i].key = string(source[start:end])
+	}
+	return blocks
+}
+
+func (r *richTextRenderer) renderBlocks(parent ast.Node, style inlineStyle, depth int) []widget.RichTextSegment {
+	var segs []widget.RichTextSegment
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		segs = append(segs, r.renderBlock(child, style, depth)...)
+	}
+	return segs
+}
+
+func (r *richTextRenderer) renderBlock(n ast.Node, style inlineStyle, depth int) []widget.RichTextSegment {
+	switch t := n.(type) {
+	case *ast.Paragraph, *ast.TextBlock:
+		return r.renderParagraph(n, style)
+	case *ast.Heading:
+		switch t.Level {
+		case 1:
+			style.size = theme.SizeNameHeadingText
+		case 2:
+			style.size = theme.SizeNameSubHeadingText
+		}
+		style.text.Bold = true
+		return r.renderParagraph(n, style)
+	case *ast.Blockquote:
+		style.text.Italic = true
+		style.color = theme.ColorNamePlaceHolder
+		return r.renderBlocks(n, style, depth)
+	case *ast.List:
+		items := make([]widget.RichTextSegment, 0, n.ChildCount())
+		for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+			items = append(items, &widget.ParagraphSegment{Texts: r.renderBlocks(item, style, depth+1)})
+		}
+		list := &listSegment{start: t.Start, depth: depth}
+		list.Items = items
+		list.Ordered = t.IsOrdered()
+		return []widget.RichTextSegment{list}
+	case *ast.CodeBlock, *ast.FencedCodeBlock:
+		code := strings.TrimSuffix(nodeLines(r.source, n), "\n")
+		if code == "" {
+			return nil
+		}
+		language := ""
+		if fenced, ok := n.(*ast.FencedCodeBlock); ok {
+			language = string(fenced.Language(r.source))
+		}
+		return []widget.RichTextSegment{&codeBlockSegment{code: code, language: language, highlight: r.code}}
+	case *ast.HTMLBlock:
+		code := strings.TrimSuffix(nodeLines(r.source, n), "\n")
+		if code == "" {
+			return nil
+		}
+		return []widget.RichTextSegment{&widget.TextSegment{Style: widget.RichTextStyleCodeBlock, Text: code}}
+	case *ast.ThematicBreak:
+		return []widget.RichTextSegment{&widget.SeparatorSegment{}}
+	case *frontMatterNode:
+		matter, err := decodeFrontMatter(r.source, t)
+		return []widget.RichTextSegment{&frontMatterSegment{matter: matter, err: err, panel: r.metadata}}
+	case *east.Table:
+		return []widget.RichTextSegment{r.renderTable(t, style)}
+	case *mathBlockNode:
+		return renderMath(t.tex(r.source), true, true, style)
+	case *diagramNode:
+		return renderDiagramBlock(t.syntax, t.code(r.source), style)
+	}
+
+	// Unknown blocks still show their inline content rather than vanishing
+	if n.Type() == ast.TypeBlock && n.HasChildren() {
+		return r.renderBlocks(n, style, depth)
+	}
+	return nil
+}
+
+// renderParagraph renders the inline content of a block as one paragraph
+func (r *richTextRenderer) renderParagraph(n ast.Node, style inlineStyle) []widget.RichTextSegment {
+	segs, flowed := flowMath(r.renderInlines(n, style))
+	if flowed {
+		return segs
+	}
+	return append(segs, endOfBlock())
+}
+
+func (r *richTextRenderer) renderInlines(parent ast.Node, style inlineStyle) []widget.RichTextSegment {
+	var segs []widget.RichTextSegment
+	for child := parent.FirstChild(); child != nil; child = child.NextSibling() {
+		segs = append(segs, r.renderInline(child, style)...)
+	}
+	return segs
+}
+
+func (r *richTextRenderer) renderInline(n ast.Node, style inlineStyle) []widget.RichTextSegment {
+	switch t := n.(type) {
+	case *ast.Text:
+		text := string(t.Value(r.source))
+		if t.SoftLineBreak() {
+			text += " "
+		}
+		segs := []widget.RichTextSegment{style.segment(text)}
+		if t.HardLineBreak() {
+			segs = append(segs, endOfBlock())
+		}
+		return segs
+	case *ast.String:
+		return []widget.RichTextSegment{style.segment(html.UnescapeString(string(t.Value)))}
+	case *ast.Emphasis:
+		if t.Level >= 2 {
+			style.text.Bold = true
+		} else {
+			style.text.Italic = true
+		}
+		return r.renderInlines(n, style)
+	case *east.Strikethrough:
+		style.strike = true
+		return r.renderInlines(n, style)
+	case *ast.CodeSpan:
+		style.text.Monospace = true
+		return []widget.RichTextSegment{style.segment(r.plainText(n))}
+	case *ast.Link:
+		return []widget.RichTextSegment{hyperlink(r.plainText(n), string(t.Destination))}
+	case *ast.AutoLink:
+		dest := string(t.URL(r.source))
+		return []widget.RichTextSegment{hyperlink(string(t.Label(r.source)), dest)}
+	case *ast.Image:
+		return renderImage(string(t.Destination), r.plainText(n), r.dir, style)
+	case *ast.RawHTML:
+		var raw strings.Builder
+		for i := 0; i < t.Segments.Len(); i++ {
+			segment := t.Segments.At(i)
+			raw.Write(segment.Value(r.source))
+		}
+		style.text.Monospace = true
+		return []widget.RichTextSegment{style.segment(raw.String())}
+	case *east.TaskCheckBox:
+		if t.IsChecked {
+			return []widget.RichTextSegment{style.segment("☑ ")}
+		}
+		return []widget.RichTextSegment{style.segment("☐ ")}
+	case *mathInlineNode:
+		return renderMath(t.tex, t.display, false, style)
+	}
+	return r.renderInlines(n, style)
+}
+
+func (r *richTextRenderer) renderTable(table *east.Table, style inlineStyle) *tableSegment {
+	seg := &tableSegment{alignments: table.Alignments}
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		cellStyle := style
+		if _, ok := row.(*east.TableHeader); ok {
+			cellStyle.text.Bold = true
+		}
+
+		var cells [][]widget.RichTextSegment
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			segs, _ := flowMath(r.renderInlines(cell, cellStyle))
+			cells = append(cells, segs)
+		}
+		seg.rows = append(seg.rows, cells)
+	}
+	return seg
+}
+
+// plainText flattens the text content of an inline node and its children
+func (r *richTextRenderer) plainText(n ast.Node) string {
+	var buf strings.Builder
+	ast.Walk(n, func(child ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch t := child.(type) {
+		case *ast.Text:
+			buf.Write(t.Value(r.source))
+			if t.SoftLineBreak() {
+				buf.WriteByte(' ')
+			}
+		case *ast.String:
+			buf.WriteString(html.UnescapeString(string(t.Value)))
+		}
+		return ast.WalkContinue, nil
+	})
+	return buf.String()
+}
+
+// endOfBlock terminates the current row so the next segment starts a new line
+func endOfBlock() widget.RichTextSegment {
+	return &widget.TextSegment{Style: widget.RichTextStyleParagraph}
+}
+
+func hyperlink(text, destination string) widget.RichTextSegment {
+	link, err := url.Parse(destination)
+	if err != nil {
+		return &widget.TextSegment{Style: widget.RichTextStyleInline, Text: text}
+	}
+	return &widget.HyperlinkSegment{Alignment: fyne.TextAlignLeading, Text: text, URL: link}
+}
+
+// strikeThrough overlays a combining long stroke on every character,
+// as Fyne text styles have no strikethrough of their own
+func strikeThrough(text string) string {
+	var buf strings.Builder
+	for _, r := range text {
+		buf.WriteRune(r)
+		if r != ' ' && r != '\n' {
+			buf.WriteRune('\u0336')
+		}
+	}
+	return buf.String()
+}
+
+// listSegment is a list that honours the start number of ordered lists
+// and indents its bullets by nesting depth
+type listSegment struct {
+	widget.ListSegment
+	start int
+	depth int
+}
+
+// Segments returns the bullet or number paragraphs for each item
+func (l *listSegment) Segments() []widget.RichTextSegment {
+	indent := strings.Repeat("    ", l.depth)
+	out := make([]widget.RichTextSegment, len(l.Items))
+	for i, item := range l.Items {
+		bullet := indent + "• "
+		if l.Ordered {
+			bullet = indent + strconv.Itoa(l.start+i) + ". "
+		}
+		bulletSegment := &widget.TextSegment{Text: bullet, Style: widget.RichTextStyleStrong}
+		// A paragraph with formulas lays itself out, so the bullet goes in it
+		if paragraph, ok := item.(*widget.ParagraphSegment); ok && len(paragraph.Texts) > 0 {
+			if flow, ok := paragraph.Texts[0].(*mathFlowSegment); ok {
+				texts := append([]widget.RichTextSegment{flow.withBullet(bulletSegment)}, paragraph.Texts[1:]...)
+				out[i] = &widget.ParagraphSegment{Texts: texts}
+				continue
+			}
+		}
+		out[i] = &widget.ParagraphSegment{Texts: []widget.RichTextSegment{bulletSegment, item}}
+	}
+	return out
+}
+
+// tableSegment renders a GFM table as a grid of rich text cells
+type tableSegment struct {
+	alignments []east.Alignment
+	rows       [][][]widget.RichTextSegment
+}
+
+// Inline returns false as a table is always a block
+func (t *tableSegment) Inline() bool {
+	return false
+}
+
+// Textual returns the table cells as tab separated text
+func (t *tableSegment) Textual() string {
+	var buf strings.Builder
+	for _, row := range t.rows {
+		for i, cell := range row {
+			if i > 0 {
+				buf.WriteByte('\t')
+			}
+			for _, seg := range cell {
+				buf.WriteString(seg.Textual())
+			}
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// Visual builds the grid of cells for this table
+func (t *tableSegment) Visual() fyne.CanvasObject {
+	columns := len(t.alignments)
+	for _, row := range t.rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	if columns == 0 {
+		return container.NewVBox()
+	}
+
+	header := container.New(layout.NewGridLayoutWithColumns(columns))
+	body := container.New(layout.NewGridLayoutWithColumns(columns))
+	for r, row := range t.rows {
+		grid := body
+		if r == 0 {
+			grid = header
+		}
+		for c := 0; c < columns; c++ {
+			var cell []widget.RichTextSegment
+			if c < len(row) {
+				cell = row[c]
+			}
+			grid.Add(t.cell(cell, c))
+		}
+	}
+	return container.NewVBox(header, widget.NewSeparator(), body)
+}
+
+func (t *tableSegment) cell(segs []widget.RichTextSegment, column int) fyne.CanvasObject {
+	text := widget.NewRichText(segs...)
+	align := east.AlignNone
+	if column < len(t.alignments) {
+		align = t.alignments[column]
+	}
+
+	switch align {
+	case east.AlignRight:
+		return container.NewHBox(layout.NewSpacer(), text)
+	case east.AlignCenter:
+		return container.NewHBox(layout.NewSpacer(), text, layout.NewSpacer())
+	}
+	return text
+}
+
+// Update is a no-op as table content does not change once rendered
+func (t *tableSegment) Update(fyne.CanvasObject) {}
+
+// Select is a no-op as tables do not support selection
+func (t *tableSegment) Select(_, _ fyne.Position) {}
+
+// SelectedText returns nothing as tables do not support selection
+func (t *tableSegment) SelectedText() string {
+	return ""
+}
+
+// Unselect is a no-op as tables do not support selection
+func (t *tableSegment) Unselect() {}
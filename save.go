@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// BackupPolicy controls which copies of the previous version are kept when saving
+type BackupPolicy int
+
+const (
+	// BackupNone keeps no copy of the previous version
+	BackupNone BackupPolicy = iota
+	// BackupSingle keeps the previous version as file.bak, replaced on every save
+	BackupSingle
+	// BackupNumbered keeps the last few versions as file.1.bak, file.2.bak and so on
+	BackupNumbered
+)
+
+// numberedBackups is how many versions BackupNumbered keeps
+const numberedBackups = 5
+
+// String returns the menu label for the policy
+func (p BackupPolicy) String() string {
+	switch p {
+	case BackupSingle:
+		return "Single .bak File"
+	case BackupNumbered:
+		return fmt.Sprintf("Numbered Backups (last %d)", numberedBackups)
+	}
+	return "No Backups"
+}
+
+// writeFileAtomic replaces the file at path with data. The new content is
+// written and flushed to a temporary sibling file which is then renamed over
+// the target, so a crash or full disk can never leave a truncated document.
+func writeFileAtomic(path string, data []byte, policy BackupPolicy) error {
+	// Save through symlinks rather than replacing the link itself
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+
+	mode := os.FileMode(0644)
+	info, err := os.Stat(path)
+	exists := err == nil
+	if exists {
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if exists && policy != BackupNone {
+		if err := backupFile(path, mode, policy); err != nil {
+			os.Remove(tmp.Name())
+			return fmt.Errorf("backup failed, file not saved: %w", err)
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// backupFile copies the current version of a file aside before it is replaced
+func backupFile(path string, mode os.FileMode, policy BackupPolicy) error {
+	if policy == BackupSingle {
+		return copyFile(path, path+".bak", mode)
+	}
+
+	// Rotate file.1.bak to file.2.bak and so on, dropping the oldest
+	numbered := func(n int) string {
+		return fmt.Sprintf("%s.%d.bak", path, n)
+	}
+	os.Remove(numbered(numberedBackups))
+	for n := numberedBackups - 1; n >= 1; n-- {
+		if err := os.Rename(numbered(n), numbered(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return copyFile(path, numbered(1), mode)
+}
+
+func copyFile(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// syncDir flushes a directory entry so that a rename survives power loss.
+// Not every platform supports this, so failures are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
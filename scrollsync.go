@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// preferenceSyncScroll stores whether the editor and preview scroll together
+const preferenceSyncScroll = "syncScroll"
+
+// sourceLine returns the 0-based line of the source a block starts on,
+// or -1 when the block carries no position
+func sourceLine(source []byte, n ast.Node) int {
+	offset := sourceOffset(n)
+	if offset < 0 || offset > len(source) {
+		return -1
+	}
+	return bytes.Count(source[:offset], []byte("\n"))
+}
+
+// sourceOffset finds the first byte of the source that belongs to a node
+func sourceOffset(n ast.Node) int {
+	switch t := n.(type) {
+	case *ast.FencedCodeBlock:
+		// The lines of a fenced block start after the fence, the info string is on it
+		if t.Info != nil {
+			return t.Info.Segment.Start
+		}
+	case *diagramNode:
+		return t.info.Segment.Start
+	case *ast.Text:
+		return t.Segment.Start
+	}
+
+	if n.Type() == ast.TypeBlock && n.Lines().Len() > 0 {
+		return n.Lines().At(0).Start
+	}
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		if offset := sourceOffset(child); offset >= 0 {
+			return offset
+		}
+	}
+	return -1
+}
+
+// interpolate maps x onto the piecewise linear function through the points
+// (xs[i], ys[i]). xs must be in ascending order.
+func interpolate(xs, ys []float32, x float32) float32 {
+	if len(xs) == 0 {
+		return 0
+	}
+
+	i := sort.Search(len(xs), func(i int) bool { return xs[i] > x })
+	if i == 0 {
+		return ys[0]
+	}
+	if i == len(xs) {
+		return ys[len(ys)-1]
+	}
+
+	x0, x1 := xs[i-1], xs[i]
+	y0, y1 := ys[i-1], ys[i]
+	if x1 == x0 {
+		return y0
+	}
+	return y0 + (x-x0)/(x1-x0)*(y1-y0)
+}
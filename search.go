@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// searchOptions are the ways a search can match text
+type searchOptions struct {
+	// regex reads the query as a regular expression rather than literal text
+	regex bool
+	// matchCase tells upper and lower case apart
+	matchCase bool
+	// wholeWord only matches text that is not part of a longer word
+	wholeWord bool
+}
+
+// searchPattern is a query compiled with its options
+type searchPattern struct {
+	re        *regexp.Regexp
+	regex     bool
+	wholeWord bool
+}
+
+// searchMatch is a match in a text, as rune offsets
+type searchMatch struct {
+	start, end int
+	// groups holds the text of the match and of each group in the pattern,
+	// empty for groups that did not take part
+	groups []string
+}
+
+// compileSearch compiles a query. Patterns match at the start and end of
+// every line with ^ and $, as in other editors.
+func compileSearch(query string, options searchOptions) (*searchPattern, error) {
+	pattern := query
+	if !options.regex {
+		pattern = regexp.QuoteMeta(query)
+	}
+	flags := "(?m)"
+	if !options.matchCase {
+		flags = "(?mi)"
+	}
+	re, err := regexp.Compile(flags + pattern)
+	var parseErr *syntax.Error
+	if errors.As(err, &parseErr) {
+		return nil, fmt.Errorf("invalid pattern: %s", parseErr.Code)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &searchPattern{re: re, regex: options.regex, wholeWord: options.wholeWord}, nil
+}
+
+// findAll returns every match in text in order, leaving out empty ones,
+// which cannot be shown or selected
+func (p *searchPattern) findAll(text string) []searchMatch {
+	var matches []searchMatch
+	offset, runes := 0, 0
+	for _, loc := range p.re.FindAllStringSubmatchIndex(text, -1) {
+		if loc[0] == loc[1] || (p.wholeWord && !isWholeWord(text, loc[0], loc[1])) {
+			continue
+		}
+		runes += utf8.RuneCountInString(text[offset:loc[0]])
+		start := runes
+		runes += utf8.RuneCountInString(text[loc[0]:loc[1]])
+		offset = loc[1]
+
+		groups := make([]string, len(loc)/2)
+		for i := range groups {
+			if loc[2*i] >= 0 {
+				groups[i] = text[loc[2*i]:loc[2*i+1]]
+			}
+		}
+		matches = append(matches, searchMatch{start: start, end: runes, groups: groups})
+	}
+	return matches
+}
+
+// replacement returns the text that replaces a match. For regular
+// expressions $1 or ${name} in the template stand for a group, $0 for the
+// whole match and $$ for a dollar sign, and \n and \t for a line break and a
+// tab. With preserveCase the replacement follows the case of the match.
+func (p *searchPattern) replacement(template string, m searchMatch, preserveCase bool) string {
+	text := template
+	if p.regex {
+		text = p.expand(template, m)
+	}
+	if preserveCase {
+		text = matchCase(text, m.groups[0])
+	}
+	return text
+}
+
+// expand fills the groups of a match into a replacement template
+func (p *searchPattern) expand(template string, m searchMatch) string {
+	var out strings.Builder
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c == '\\' && i+1 < len(template) {
+			switch template[i+1] {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case '\\':
+				out.WriteByte('\\')
+			default:
+				out.WriteByte(c)
+				continue
+			}
+			i++
+			continue
+		}
+		if c != '$' || i+1 == len(template) {
+			out.WriteByte(c)
+			continue
+		}
+
+		rest := template[i+1:]
+		switch {
+		case rest[0] == '$':
+			out.WriteByte('$')
+			i++
+		case rest[0] == '{':
+			end := strings.IndexByte(rest, '}')
+			group := -1
+			if end > 0 {
+				group = p.group(rest[1:end])
+			}
+			if group < 0 {
+				out.WriteByte(c)
+				continue
+			}
+			if group < len(m.groups) {
+				out.WriteString(m.groups[group])
+			}
+			i += end + 1
+		case rest[0] >= '0' && rest[0] <= '9':
+			// $10 is the tenth group if there is one, otherwise the first
+			// followed by a 0
+			digits := 1
+			if len(rest) > 1 && rest[1] >= '0' && rest[1] <= '9' {
+				if n, _ := strconv.Atoi(rest[:2]); n < len(m.groups) {
+					digits = 2
+				}
+			}
+			n, _ := strconv.Atoi(rest[:digits])
+			if n < len(m.groups) {
+				out.WriteString(m.groups[n])
+			}
+			i += digits
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// group returns the number of a group given by number or name, or -1 if
+// the pattern has no such group
+func (p *searchPattern) group(name string) int {
+	if n, err := strconv.Atoi(name); err == nil {
+		if n >= 0 && n <= p.re.NumSubexp() {
+			return n
+		}
+		return -1
+	}
+	return p.re.SubexpIndex(name)
+}
+
+// matchCase gives text the case of the text it replaces: all upper case,
+// all lower case or capitalized. Text of mixed case is left as it is.
+func matchCase(text, replaced string) string {
+	upper, lower := strings.ToUpper(replaced), strings.ToLower(replaced)
+	switch {
+	case text == "" || upper == lower:
+		return text
+	case replaced == upper:
+		return strings.ToUpper(text)
+	case replaced == lower:
+		return strings.ToLower(text)
+	}
+	first, size := utf8.DecodeRuneInString(replaced)
+	if unicode.IsUpper(first) && replaced[size:] == strings.ToLower(replaced[size:]) {
+		head, size := utf8.DecodeRuneInString(text)
+		return string(unicode.ToUpper(head)) + text[size:]
+	}
+	return text
+}
+
+// replaceMatches returns text with every match replaced
+func (p *searchPattern) replaceMatches(text string, matches []searchMatch, template string, preserveCase bool) string {
+	var out strings.Builder
+	runes := []rune(text)
+	last := 0
+	for _, m := range matches {
+		out.WriteString(string(runes[last:m.start]))
+		out.WriteString(p.replacement(template, m, preserveCase))
+		last = m.end
+	}
+	out.WriteString(string(runes[last:]))
+	return out.String()
+}
+
+// isWholeWord reports whether the text between two byte offsets is not
+// joined to a word before or after it
+func isWholeWord(text string, start, end int) bool {
+	if before, _ := utf8.DecodeLastRuneInString(text[:start]); start > 0 && isWordRune(before) {
+		first, _ := utf8.DecodeRuneInString(text[start:])
+		if isWordRune(first) {
+			return false
+		}
+	}
+	if after, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWordRune(after) {
+		last, _ := utf8.DecodeLastRuneInString(text[:end])
+		if isWordRune(last) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAfter returns the first match that starts at or after an offset,
+// wrapping around to the first match, or -1 if there are none
+func matchAfter(matches []searchMatch, offset int) int {
+	for i, m := range matches {
+		if m.start >= offset {
+			return i
+		}
+	}
+	if len(matches) > 0 {
+		return 0
+	}
+	return -1
+}
+
+// matchBefore returns the last match that starts before an offset,
+// wrapping around to the last match, or -1 if there are none
+func matchBefore(matches []searchMatch, offset int) int {
+	for i := len(matches) - 1; i >= 0; i-- {
+		if matches[i].start < offset {
+			return i
+		}
+	}
+	return len(matches) - 1
+}
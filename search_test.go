@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestReplaceMatches(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		query        string
+		options      searchOptions
+		template     string
+		preserveCase bool
+		want         string
+	}{
+		{name: "literal", text: "a.b a.b axb", query: "a.b", template: "c", want: "c c axb"},
+		{name: "literal ignores case", text: "Cat cat CAT", query: "cat", template: "dog", want: "dog dog dog"},
+		{name: "literal match case", text: "Cat cat CAT", query: "cat", options: searchOptions{matchCase: true}, template: "dog", want: "Cat dog CAT"},
+		{name: "literal dollar", text: "cost", query: "cost", template: "$1 each", want: "$1 each"},
+		{name: "whole word", text: "cat concat cats cat.", query: "cat", options: searchOptions{wholeWord: true}, template: "dog", want: "dog concat cats dog."},
+		// Underscores mark emphasis in markdown rather than joining words
+		{name: "whole word emphasis", text: "_cat_ cat_s", query: "cat", options: searchOptions{wholeWord: true}, template: "dog", want: "_dog_ dog_s"},
+		{name: "whole word unicode", text: "über übermut", query: "über", options: searchOptions{wholeWord: true}, template: "x", want: "x übermut"},
+		{name: "regex groups", text: "John Smith, Ada Lovelace", query: `(\w+) (\w+)`, options: searchOptions{regex: true}, template: "$2 $1", want: "Smith John, Lovelace Ada"},
+		{name: "regex named group", text: "v1.2", query: `v(?P<major>\d)\.(\d)`, options: searchOptions{regex: true}, template: "${major}-$2-$0", want: "1-2-v1.2"},
+		{name: "regex missing group", text: "ab", query: `(a)b`, options: searchOptions{regex: true}, template: "$3${x}$$", want: "${x}$"},
+		{name: "regex group then digit", text: "ab", query: `(a)b`, options: searchOptions{regex: true}, template: "$10", want: "a0"},
+		{name: "regex escapes", text: "a,b", query: ",", options: searchOptions{regex: true}, template: `\n\t\\`, want: "a\n\t\\b"},
+		{name: "regex line anchors", text: "one\ntwo", query: "^", options: searchOptions{regex: true}, template: "> ", want: "one\ntwo"},
+		{name: "regex line end", text: "one\ntwo", query: `(\w+)$`, options: searchOptions{regex: true}, template: "[$1]", want: "[one]\n[two]"},
+		{name: "preserve lower", text: "cat", query: "CAT", template: "Dog", preserveCase: true, want: "dog"},
+		{name: "preserve upper", text: "CAT", query: "cat", template: "dog", preserveCase: true, want: "DOG"},
+		{name: "preserve title", text: "Cat", query: "cat", template: "dog house", preserveCase: true, want: "Dog house"},
+		{name: "preserve mixed", text: "cAt", query: "cat", template: "dog", preserveCase: true, want: "dog"},
+		{name: "preserve each match", text: "cat Cat CAT", query: "cat", template: "dog", preserveCase: true, want: "dog Dog DOG"},
+		{name: "preserve with groups", text: "Hello world", query: `(\w+) (\w+)`, options: searchOptions{regex: true}, template: "$2 $1", preserveCase: true, want: "World Hello"},
+		{name: "preserve no letters", text: "123", query: "123", template: "abc", preserveCase: true, want: "abc"},
+		{name: "runes", text: "é cat é cat", query: "cat", template: "dög", want: "é dög é dög"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pattern, err := compileSearch(test.query, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			matches := pattern.findAll(test.text)
+			if got := pattern.replaceMatches(test.text, matches, test.template, test.preserveCase); got != test.want {
+				t.Errorf("replaced to %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMatchCase(t *testing.T) {
+	tests := []struct {
+		text, replaced string
+		want           string
+	}{
+		{text: "dog", replaced: "cat", want: "dog"},
+		{text: "Dog", replaced: "cat", want: "dog"},
+		{text: "dog", replaced: "CAT", want: "DOG"},
+		{text: "dog", replaced: "Cat", want: "Dog"},
+		{text: "dOG", replaced: "Cat", want: "DOG"},
+		{text: "dog", replaced: "cAT", want: "dog"},
+		{text: "ünd", replaced: "Über", want: "Ünd"},
+		{text: "dog", replaced: "C", want: "DOG"},
+		{text: "dog", replaced: "1", want: "dog"},
+		{text: "", replaced: "Cat", want: ""},
+	}
+	for _, test := range tests {
+		if got := matchCase(test.text, test.replaced); got != test.want {
+			t.Errorf("matchCase(%q, %q) = %q, want %q", test.text, test.replaced, got, test.want)
+		}
+	}
+}
+
+func TestCompileSearchError(t *testing.T) {
+	if _, err := compileSearch("(a", searchOptions{regex: true}); err == nil || err.Error() != "invalid pattern: missing closing )" {
+		t.Errorf("error %v, want an invalid pattern", err)
+	}
+	if _, err := compileSearch("(a", searchOptions{}); err != nil {
+		t.Errorf("literal text is not a pattern: %v", err)
+	}
+}
@@ -0,0 +1,589 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// preferenceSearchPanelVisible stores whether the folder search panel is shown
+const preferenceSearchPanelVisible = "searchPanelVisible"
+
+// preferenceSearchFolder stores the folder searched last
+const preferenceSearchFolder = "searchFolder"
+
+// searchPanelWidth is the width the folder search panel asks for
+const searchPanelWidth = 320
+
+// searchPreviewContext is how much of a line is shown before a match
+const searchPreviewContext = 24
+
+// replacePreviewLines is how many changed lines the replace preview lists
+const replacePreviewLines = 500
+
+// SearchPanel is the side panel that finds and replaces text in every
+// markdown file of a folder
+type SearchPanel struct {
+	controller *AppController
+	container  *fyne.Container
+	folder     *widget.Label
+	query      *widget.Entry
+	replace    *widget.Entry
+	regex      *widget.Check
+	matchCase  *widget.Check
+	wholeWord  *widget.Check
+	preserve   *widget.Check
+	status     *widget.Label
+	tree       *widget.Tree
+	undoButton *widget.Button
+
+	root    string
+	pattern *searchPattern
+	files   []folderFile
+	// limited is set when files stop at folderSearchLimit
+	limited bool
+	// cancel stops the search that is running, if any
+	cancel context.CancelFunc
+	// undo holds the files changed by the last replace
+	undo []folderEdit
+}
+
+// NewSearchPanel creates a new folder search panel
+func NewSearchPanel(controller *AppController) *SearchPanel {
+	return &SearchPanel{controller: controller}
+}
+
+// Create creates the folder search UI component
+func (p *SearchPanel) Create() fyne.CanvasObject {
+	p.folder = widget.NewLabel("")
+	p.folder.Truncation = fyne.TextTruncateEllipsis
+	chooseFolder := widget.NewButtonWithIcon("", theme.FolderOpenIcon(), p.chooseFolder)
+
+	p.query = widget.NewEntry()
+	p.query.PlaceHolder = "Find in folder..."
+	p.query.OnSubmitted = func(string) { p.search(nil) }
+	p.replace = widget.NewEntry()
+	p.replace.PlaceHolder = "Replace with..."
+	p.replace.OnSubmitted = func(string) { p.replaceAll() }
+
+	p.regex = widget.NewCheck("Regular expression", nil)
+	p.matchCase = widget.NewCheck("Match case", nil)
+	p.wholeWord = widget.NewCheck("Whole word", nil)
+	p.preserve = widget.NewCheck("Preserve case", nil)
+	rerun := func(bool) {
+		if p.pattern != nil {
+			p.search(nil)
+		}
+	}
+	p.regex.OnChanged, p.matchCase.OnChanged, p.wholeWord.OnChanged = rerun, rerun, rerun
+
+	p.undoButton = widget.NewButton("Undo", p.undoReplace)
+	p.undoButton.Disable()
+	buttons := container.NewGridWithColumns(3,
+		widget.NewButton("Search", func() { p.search(nil) }),
+		widget.NewButton("Replace...", p.replaceAll),
+		p.undoButton,
+	)
+
+	p.status = widget.NewLabel("")
+	p.status.Wrapping = fyne.TextWrapWord
+
+	p.tree = widget.NewTree(p.childIDs, p.isBranch, p.createNode, p.updateNode)
+	p.tree.OnSelected = func(id widget.TreeNodeID) {
+		p.tree.UnselectAll()
+		file, match := p.node(id)
+		switch {
+		case file >= 0 && match >= 0:
+			p.controller.OpenFolderMatch(p.files[file], p.files[file].matches[match])
+		case file >= 0:
+			p.tree.ToggleBranch(id)
+		}
+	}
+
+	title := widget.NewLabelWithStyle("Find in Folder", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	closeButton := widget.NewButtonWithIcon("", theme.CancelIcon(), p.Hide)
+	closeButton.Importance = widget.LowImportance
+	titleContainer := container.NewBorder(nil, widget.NewSeparator(), nil, closeButton, container.NewPadded(title))
+
+	form := container.NewVBox(
+		container.NewBorder(nil, nil, nil, chooseFolder, p.folder),
+		p.query,
+		p.replace,
+		container.NewGridWithColumns(2, p.regex, p.matchCase, p.wholeWord, p.preserve),
+		buttons,
+		p.status,
+	)
+
+	width := canvas.NewRectangle(color.Transparent)
+	width.SetMinSize(fyne.NewSize(searchPanelWidth, 0))
+
+	p.container = container.NewBorder(
+		titleContainer,
+		nil,
+		widget.NewSeparator(),
+		nil,
+		container.NewStack(width, container.NewBorder(container.NewPadded(form), nil, nil, nil, p.tree)),
+	)
+	if prefs := p.controller.preferences(); prefs != nil {
+		if root := prefs.String(preferenceSearchFolder); root != "" {
+			p.setRoot(root)
+		}
+		if !prefs.BoolWithFallback(preferenceSearchPanelVisible, false) {
+			p.container.Hide()
+		}
+	} else {
+		p.container.Hide()
+	}
+	return p.container
+}
+
+// Show shows the panel with the cursor in the query, searching the folder
+// given if none was chosen yet
+func (p *SearchPanel) Show(query, folder string) {
+	if p.container == nil {
+		return
+	}
+	if p.root == "" {
+		p.setRoot(folder)
+	}
+	if query != "" {
+		p.query.SetText(query)
+	}
+	p.setVisible(true)
+	p.controller.window.Canvas().Focus(p.query)
+}
+
+// Hide hides the panel, stopping any search that is running
+func (p *SearchPanel) Hide() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.setVisible(false)
+}
+
+func (p *SearchPanel) setVisible(visible bool) {
+	if visible {
+		p.container.Show()
+	} else {
+		p.container.Hide()
+	}
+	if prefs := p.controller.preferences(); prefs != nil {
+		prefs.SetBool(preferenceSearchPanelVisible, visible)
+	}
+}
+
+// setRoot changes the folder that is searched
+func (p *SearchPanel) setRoot(root string) {
+	if root == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			root = home
+		}
+	}
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	p.root = root
+	p.folder.SetText(root)
+	if prefs := p.controller.preferences(); prefs != nil {
+		prefs.SetString(preferenceSearchFolder, root)
+	}
+}
+
+// chooseFolder asks for the folder to search, starting from the current one
+func (p *SearchPanel) chooseFolder() {
+	d := dialog.NewFolderOpen(func(uri fyne.ListableURI, err error) {
+		if err != nil {
+			dialog.ShowError(err, p.controller.window)
+			return
+		}
+		if uri == nil {
+			return
+		}
+		p.setRoot(uri.Path())
+		if p.query.Text != "" {
+			p.search(nil)
+		}
+	}, p.controller.window)
+	if location, err := storage.ListerForURI(storage.NewFileURI(p.root)); err == nil {
+		d.SetLocation(location)
+	}
+	d.Show()
+}
+
+// options returns the search options that are checked
+func (p *SearchPanel) options() searchOptions {
+	return searchOptions{regex: p.regex.Checked, matchCase: p.matchCase.Checked, wholeWord: p.wholeWord.Checked}
+}
+
+// search searches the folder in the background, taking open documents as
+// they are in the editor, then shows the matches and calls done if given
+func (p *SearchPanel) search(done func()) {
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+	if p.query.Text == "" {
+		p.pattern, p.files = nil, nil
+		p.status.SetText("Enter search text")
+		p.tree.Refresh()
+		return
+	}
+	pattern, err := compileSearch(p.query.Text, p.options())
+	if err != nil {
+		message := err.Error()
+		p.status.SetText(strings.ToUpper(message[:1]) + message[1:])
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.status.SetText("Searching...")
+	root, buffers := p.root, p.buffers()
+	go func() {
+		files, limited, err := searchFolder(ctx, root, pattern, buffers, folderSearchLimit)
+		fyne.Do(func() {
+			if ctx.Err() != nil {
+				return
+			}
+			cancel()
+			p.cancel = nil
+			if err != nil {
+				p.pattern, p.files, p.limited = nil, nil, false
+				p.status.SetText(err.Error())
+				p.tree.Refresh()
+				return
+			}
+			p.show(pattern, files, limited)
+			if done != nil {
+				done()
+			}
+		})
+	}()
+}
+
+// buffers returns the text of the open documents by path, which is searched
+// in place of what is on disk
+func (p *SearchPanel) buffers() map[string]string {
+	buffers := make(map[string]string)
+	for _, doc := range p.controller.documents {
+		if doc.uri != nil && doc.uri.Scheme() == "file" {
+			buffers[doc.uri.Path()] = doc.editor.GetContent()
+		}
+	}
+	return buffers
+}
+
+// show lists the matches of a search by file, with every file open
+func (p *SearchPanel) show(pattern *searchPattern, files []folderFile, limited bool) {
+	p.pattern, p.files, p.limited = pattern, files, limited
+	count := 0
+	for _, file := range files {
+		count += len(file.matches)
+	}
+	status := fmt.Sprintf("%s in %s", plural(count, "match", "matches"), plural(len(files), "file", "files"))
+	switch {
+	case count == 0:
+		status = "No matches"
+	case limited:
+		status += fmt.Sprintf(", stopped after the first %d", folderSearchLimit)
+	}
+	p.status.SetText(status)
+
+	p.tree.Refresh()
+	p.tree.OpenAllBranches()
+	p.tree.ScrollToTop()
+}
+
+// replaceAll searches again, then shows the changes a replace would make
+// and makes them once confirmed
+func (p *SearchPanel) replaceAll() {
+	if p.query.Text == "" {
+		p.status.SetText("Enter search text")
+		return
+	}
+	p.search(func() {
+		if !p.limited {
+			p.confirmReplace(p.pattern, p.files)
+			return
+		}
+
+		// The list stops at folderSearchLimit, but every match is replaced
+		status := p.status.Text
+		p.status.SetText("Finding every match...")
+		ctx, cancel := context.WithCancel(context.Background())
+		p.cancel = cancel
+		pattern, root, buffers := p.pattern, p.root, p.buffers()
+		go func() {
+			files, _, err := searchFolder(ctx, root, pattern, buffers, 0)
+			fyne.Do(func() {
+				if ctx.Err() != nil {
+					return
+				}
+				cancel()
+				p.cancel = nil
+				p.status.SetText(status)
+				if err != nil {
+					dialog.ShowError(err, p.controller.window)
+					return
+				}
+				p.confirmReplace(pattern, files)
+			})
+		}()
+	})
+}
+
+// confirmReplace shows the changes replacing the matches in files would
+// make, and makes them once confirmed
+func (p *SearchPanel) confirmReplace(pattern *searchPattern, files []folderFile) {
+	edits := replaceInFolder(files, pattern, p.replace.Text, p.preserve.Checked)
+	if len(edits) == 0 {
+		return
+	}
+	count := 0
+	for _, file := range files {
+		count += len(file.matches)
+	}
+
+	preview := widget.NewRichText(p.replacePreview(pattern, files)...)
+	preview.Wrapping = fyne.TextWrapOff
+	message := widget.NewLabel(fmt.Sprintf("Replace %s in %s?", plural(count, "match", "matches"), plural(len(edits), "file", "files")))
+	content := container.NewBorder(message, nil, nil, nil, container.NewScroll(preview))
+
+	d := dialog.NewCustomConfirm("Replace in Files", "Replace", "Cancel", content, func(ok bool) {
+		if ok {
+			p.applyReplace(edits, count)
+		}
+	}, p.controller.window)
+	d.Resize(fyne.NewSize(640, 480))
+	d.Show()
+}
+
+// applyReplace makes the edits of a confirmed replace and keeps them to undo
+func (p *SearchPanel) applyReplace(edits []folderEdit, count int) {
+	applied, skipped := p.controller.applyFolderEdits(edits)
+	p.undo = applied
+	if len(applied) > 0 {
+		p.undoButton.Enable()
+	} else {
+		p.undoButton.Disable()
+	}
+	p.search(func() {
+		p.status.SetText(fmt.Sprintf("Replaced %s in %s", plural(count, "match", "matches"), plural(len(applied), "file", "files")))
+	})
+	p.showSkipped("These files changed since they were searched, or could not be saved, and were left as they are:", skipped)
+}
+
+// undoReplace puts back the files changed by the last replace, unless they
+// were changed again since
+func (p *SearchPanel) undoReplace() {
+	if len(p.undo) == 0 {
+		return
+	}
+	reverse := make([]folderEdit, len(p.undo))
+	for i, edit := range p.undo {
+		reverse[i] = folderEdit{path: edit.path, before: edit.after, after: edit.before}
+	}
+	p.undo = nil
+	p.undoButton.Disable()
+
+	restored, skipped := p.controller.applyFolderEdits(reverse)
+	status := "Restored " + plural(len(restored), "file", "files")
+	if p.query.Text != "" {
+		p.search(func() { p.status.SetText(status) })
+	} else {
+		p.status.SetText(status)
+	}
+	p.showSkipped("These files changed since the replace, or could not be saved, and were not restored:", skipped)
+}
+
+// showSkipped lists the files a replace or undo left alone
+func (p *SearchPanel) showSkipped(message string, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		names[i] = p.relative(path)
+	}
+	dialog.ShowInformation("Replace in Files", message+"\n\n"+strings.Join(names, "\n"), p.controller.window)
+}
+
+// replacePreview lists each changed line as it is and as it would be
+func (p *SearchPanel) replacePreview(pattern *searchPattern, files []folderFile) []widget.RichTextSegment {
+	var segments []widget.RichTextSegment
+	heading := widget.RichTextStyleStrong
+	heading.Inline = false
+	lines := 0
+	for _, file := range files {
+		if lines >= replacePreviewLines {
+			break
+		}
+		segments = append(segments, &widget.TextSegment{Style: heading, Text: p.relative(file.path)})
+
+		for i := 0; i < len(file.matches) && lines < replacePreviewLines; lines++ {
+			// Every match starting on the same line is replaced in one preview
+			first := file.matches[i]
+			runes := []rune(first.preview)
+			var after strings.Builder
+			last := 0
+			for ; i < len(file.matches) && file.matches[i].line == first.line; i++ {
+				m := file.matches[i]
+				after.WriteString(string(runes[last:m.start]))
+				after.WriteString(pattern.replacement(p.replace.Text, m.match, p.preserve.Checked))
+				last = max(last, m.end)
+			}
+			after.WriteString(string(runes[last:]))
+
+			number := strconv.Itoa(first.line) + ": "
+			segments = append(segments,
+				&widget.TextSegment{Style: previewStyle(theme.ColorNameError), Text: number + "- " + previewLine(first.preview)},
+				&widget.TextSegment{Style: previewStyle(theme.ColorNameSuccess), Text: strings.Repeat(" ", len(number)) + "+ " + previewLine(after.String())},
+			)
+		}
+	}
+
+	total := 0
+	for _, file := range files {
+		total += len(file.matches)
+	}
+	if lines >= replacePreviewLines && total > lines {
+		segments = append(segments, &widget.TextSegment{
+			Style: widget.RichTextStyleParagraph,
+			Text:  "Only the first " + strconv.Itoa(replacePreviewLines) + " changed lines are shown",
+		})
+	}
+	return segments
+}
+
+// previewStyle is a monospace line of the replace preview in a color
+func previewStyle(color fyne.ThemeColorName) widget.RichTextStyle {
+	style := widget.RichTextStyleCodeBlock
+	style.ColorName = color
+	return style
+}
+
+// previewLine shows line breaks in a line of the preview
+func previewLine(line string) string {
+	return strings.ReplaceAll(line, "\n", "⏎")
+}
+
+// relative returns a path as it is shown in the panel, from the folder
+func (p *SearchPanel) relative(path string) string {
+	if rel, err := filepath.Rel(p.root, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// node returns the file and match of a tree node, or -1 for either when the
+// node is not one
+func (p *SearchPanel) node(id widget.TreeNodeID) (file, match int) {
+	fileID, matchID, isMatch := strings.Cut(id, "/")
+	file, err := strconv.Atoi(fileID)
+	if err != nil || file < 0 || file >= len(p.files) {
+		return -1, -1
+	}
+	if !isMatch {
+		return file, -1
+	}
+	match, err = strconv.Atoi(matchID)
+	if err != nil || match < 0 || match >= len(p.files[file].matches) {
+		return -1, -1
+	}
+	return file, match
+}
+
+func (p *SearchPanel) childIDs(id widget.TreeNodeID) []widget.TreeNodeID {
+	if id == "" {
+		ids := make([]widget.TreeNodeID, len(p.files))
+		for i := range p.files {
+			ids[i] = strconv.Itoa(i)
+		}
+		return ids
+	}
+	file, match := p.node(id)
+	if file < 0 || match >= 0 {
+		return nil
+	}
+	ids := make([]widget.TreeNodeID, len(p.files[file].matches))
+	for i := range ids {
+		ids[i] = id + "/" + strconv.Itoa(i)
+	}
+	return ids
+}
+
+func (p *SearchPanel) isBranch(id widget.TreeNodeID) bool {
+	return id == "" || !strings.Contains(id, "/")
+}
+
+func (p *SearchPanel) createNode(branch bool) fyne.CanvasObject {
+	if branch {
+		label := widget.NewLabel("")
+		label.Truncation = fyne.TextTruncateEllipsis
+		return label
+	}
+	line := widget.NewRichText()
+	line.Truncation = fyne.TextTruncateEllipsis
+	return line
+}
+
+func (p *SearchPanel) updateNode(id widget.TreeNodeID, branch bool, object fyne.CanvasObject) {
+	file, match := p.node(id)
+	if file < 0 {
+		return
+	}
+	if branch {
+		object.(*widget.Label).SetText(fmt.Sprintf("%s (%d)", p.relative(p.files[file].path), len(p.files[file].matches)))
+		return
+	}
+	if match < 0 {
+		return
+	}
+	line := object.(*widget.RichText)
+	line.Segments = matchPreview(p.files[file].matches[match])
+	line.Refresh()
+}
+
+// matchPreview shows the line of a match with the match in bold, cutting
+// the start of long lines so that the match is in view
+func matchPreview(m folderMatch) []widget.RichTextSegment {
+	runes := []rune(m.preview)
+	start, end := m.start, max(m.end, m.start)
+	before := strings.TrimLeft(string(runes[:start]), " \t")
+	if utf8.RuneCountInString(before) > searchPreviewContext {
+		before = "…" + string([]rune(before)[utf8.RuneCountInString(before)-searchPreviewContext:])
+	}
+
+	number := widget.RichTextStyleInline
+	number.ColorName = theme.ColorNamePlaceHolder
+	inline := widget.RichTextStyleInline
+	strong := widget.RichTextStyleStrong
+	strong.ColorName = theme.ColorNamePrimary
+	return []widget.RichTextSegment{
+		&widget.TextSegment{Style: number, Text: strconv.Itoa(m.line) + ": "},
+		&widget.TextSegment{Style: inline, Text: before},
+		&widget.TextSegment{Style: strong, Text: string(runes[start:end])},
+		&widget.TextSegment{Style: inline, Text: string(runes[end:])},
+	}
+}
+
+// plural returns a count with the singular or plural form of a word
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return strconv.Itoa(n) + " " + many
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+
+	"fyne.io/fyne/v2"
+)
+
+const (
+	// preferenceRecentFiles stores the most recently used file URIs, newest first
+	preferenceRecentFiles = "recentFiles"
+	// preferenceSession stores the sessionState of the last run as JSON
+	preferenceSession = "session"
+
+	maxRecentFiles = 10
+)
+
+// sessionState is what is remembered between runs of the editor
+type sessionState struct {
+	Documents []sessionDocument `json:"documents"`
+	Active    int               `json:"active"`
+	Width     float32           `json:"width"`
+	Height    float32           `json:"height"`
+}
+
+// sessionDocument is the remembered state of one open file
+type sessionDocument struct {
+	URI            string  `json:"uri"`
+	Line           int     `json:"line"`
+	Column         int     `json:"column"`
+	Split          float64 `json:"split"`
+	PreviewVisible bool    `json:"previewVisible"`
+}
+
+// recentFiles returns the most recently used file URIs, newest first
+func recentFiles(prefs fyne.Preferences) []string {
+	return prefs.StringList(preferenceRecentFiles)
+}
+
+// addRecentFile moves a URI to the front of the recent files list
+func addRecentFile(prefs fyne.Preferences, uri fyne.URI) {
+	removeRecentFile(prefs, uri.String())
+	recent := append([]string{uri.String()}, recentFiles(prefs)...)
+	if len(recent) > maxRecentFiles {
+		recent = recent[:maxRecentFiles]
+	}
+	prefs.SetStringList(preferenceRecentFiles, recent)
+}
+
+// removeRecentFile drops a URI from the recent files list
+func removeRecentFile(prefs fyne.Preferences, uri string) {
+	var kept []string
+	for _, item := range recentFiles(prefs) {
+		if item != uri {
+			kept = append(kept, item)
+		}
+	}
+	prefs.SetStringList(preferenceRecentFiles, kept)
+}
+
+// loadSession reads the state saved by the last run, if there is one
+func loadSession(prefs fyne.Preferences) (*sessionState, bool) {
+	data := prefs.String(preferenceSession)
+	if data == "" {
+		return nil, false
+	}
+
+	state := &sessionState{}
+	if err := json.Unmarshal([]byte(data), state); err != nil {
+		fyne.LogError("Failed to read the saved session", err)
+		return nil, false
+	}
+	return state, true
+}
+
+// saveSession stores the session state for the next run
+func saveSession(prefs fyne.Preferences, state *sessionState) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		fyne.LogError("Failed to save the session", err)
+		return
+	}
+	prefs.SetString(preferenceSession, string(data))
+}
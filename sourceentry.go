@@ -0,0 +1,1551 @@
+package main
+
+import (
+	"image/color"
+	"sort"
+	"strings"
+	"unicode"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/driver/desktop"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// tabWidth is how many spaces a tab is drawn as
+const tabWidth = 4
+
+// editKind decides which consecutive edits are undone together
+type editKind int
+
+const (
+	editOther editKind = iota
+	editTyping
+	editBackspace
+	editDelete
+)
+
+// sourceEdit is one change to the text of a SourceEntry, kept for undo
+type sourceEdit struct {
+	row, column int
+	removed     []rune
+	inserted    []rune
+	kind        editKind
+	// follows is set for an edit made along with the one before it, such as
+	// renumbering a list, which is undone and redone with it
+	follows bool
+}
+
+// sourceRange is the text between two ordered 0-based positions
+type sourceRange struct {
+	startRow, startColumn int
+	endRow, endColumn     int
+}
+
+// SourceEntry is a multi-line editor for markdown source with syntax
+// highlighting. Only the lines in view are laid out and highlighted, so it
+// stays responsive on documents with many thousands of lines.
+type SourceEntry struct {
+	widget.BaseWidget
+
+	PlaceHolder string
+	// OnChanged is called with the new text after every edit
+	OnChanged func(string)
+	// OnCursorChanged is called when the cursor moves
+	OnCursorChanged func()
+	// OnScrolled is called when the user scrolls the text
+	OnScrolled func()
+
+	lines        [][]rune
+	row, column  int
+	anchorRow    int
+	anchorColumn int
+	selecting    bool
+	// goalX keeps the cursor's horizontal position while moving up and down
+	goalX float32
+
+	focused   bool
+	shiftDown bool
+	pressed   bool
+
+	undo, redo  []*sourceEdit
+	highlighter *markdownHighlighter
+	// highlights are marked behind the text until it next changes
+	highlights  []sourceRange
+	scroll      *container.Scroll
+	content     *sourceContent
+	contentSize fyne.Size
+
+	// wrap breaks long lines at spaces to fit the width of the view, so a
+	// line may take several screen rows
+	wrap bool
+	// breaks holds, for each line, the columns where its screen rows after
+	// the first start, or nil where they are still to be worked out
+	breaks [][]int
+	// rowStarts holds the first screen row of each line, and the number of
+	// screen rows at the end, while the text is wrapped
+	rowStarts   []int
+	wrapAtWidth float32
+}
+
+// NewSourceEntry creates an empty markdown source editor
+func NewSourceEntry() *SourceEntry {
+	e := &SourceEntry{
+		lines:       [][]rune{{}},
+		goalX:       -1,
+		highlighter: newMarkdownHighlighter(),
+	}
+	e.content = &sourceContent{entry: e}
+	e.content.ExtendBaseWidget(e.content)
+	e.scroll = container.NewScroll(e.content)
+	e.scroll.OnScrolled = func(fyne.Position) {
+		e.content.Refresh()
+		if e.OnScrolled != nil {
+			e.OnScrolled()
+		}
+	}
+	e.ExtendBaseWidget(e)
+	e.updateSize()
+	return e
+}
+
+// CreateRenderer returns the renderer for the editor frame
+func (e *SourceEntry) CreateRenderer() fyne.WidgetRenderer {
+	r := &sourceEntryRenderer{
+		entry:      e,
+		background: canvas.NewRectangle(color.Transparent),
+		border:     canvas.NewRectangle(color.Transparent),
+	}
+	r.objects = []fyne.CanvasObject{r.background, r.border, e.scroll}
+	r.Refresh()
+	return r
+}
+
+// Text returns the whole text
+func (e *SourceEntry) Text() string {
+	size := len(e.lines)
+	for _, line := range e.lines {
+		size += len(line)
+	}
+
+	var buf strings.Builder
+	buf.Grow(size)
+	for i, line := range e.lines {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(string(line))
+	}
+	return buf.String()
+}
+
+// SetText replaces the whole text, clearing the undo history
+func (e *SourceEntry) SetText(text string) {
+	e.lines = splitLines([]rune(text))
+	e.row, e.column = 0, 0
+	e.selecting = false
+	e.goalX = -1
+	e.undo, e.redo = nil, nil
+	e.highlights = nil
+	e.highlighter = newMarkdownHighlighter()
+	e.breaks = nil
+	e.updateSize()
+	e.ScrollToOffset(e.scroll.Offset)
+
+	if e.OnChanged != nil {
+		e.OnChanged(e.Text())
+	}
+}
+
+// LineCount returns the number of lines
+func (e *SourceEntry) LineCount() int {
+	return len(e.lines)
+}
+
+// Line returns a 0-based line of the text
+func (e *SourceEntry) Line(row int) string {
+	if row < 0 || row >= len(e.lines) {
+		return ""
+	}
+	return string(e.lines[row])
+}
+
+// CursorPosition returns the 0-based row and column of the cursor
+func (e *SourceEntry) CursorPosition() (row, column int) {
+	return e.row, e.column
+}
+
+// SetCursor moves the cursor to a 0-based row and column, clamped to the text
+func (e *SourceEntry) SetCursor(row, column int) {
+	row, column = e.clamp(row, column)
+	e.moveTo(row, column, false)
+}
+
+// SelectedText returns the selected text, or an empty string
+func (e *SourceEntry) SelectedText() string {
+	if !e.selecting {
+		return ""
+	}
+	r1, c1, r2, c2 := e.selection()
+	return string(e.textBetween(r1, c1, r2, c2))
+}
+
+// Select selects the text between two 0-based positions, leaving the cursor at the end
+func (e *SourceEntry) Select(startRow, startColumn, endRow, endColumn int) {
+	startRow, startColumn = e.clamp(startRow, startColumn)
+	endRow, endColumn = e.clamp(endRow, endColumn)
+	e.anchorRow, e.anchorColumn = startRow, startColumn
+	e.selecting = startRow != endRow || startColumn != endColumn
+	e.row, e.column = endRow, endColumn
+	e.cursorMoved()
+}
+
+// SetHighlights marks search matches behind the text until it next changes
+func (e *SourceEntry) SetHighlights(matches []searchMatch) {
+	e.highlights = e.highlights[:0]
+	row, lineStart := 0, 0
+	position := func(offset int) (int, int) {
+		for row < len(e.lines)-1 && offset > lineStart+len(e.lines[row]) {
+			lineStart += len(e.lines[row]) + 1
+			row++
+		}
+		return row, min(offset-lineStart, len(e.lines[row]))
+	}
+	for _, m := range matches {
+		startRow, startColumn := position(m.start)
+		endRow, endColumn := position(m.end)
+		e.highlights = append(e.highlights, sourceRange{startRow, startColumn, endRow, endColumn})
+	}
+	e.content.Refresh()
+}
+
+// PositionOf returns the 0-based row and column of a rune offset in the text
+func (e *SourceEntry) PositionOf(offset int) (row, column int) {
+	for row < len(e.lines)-1 && offset > len(e.lines[row]) {
+		offset -= len(e.lines[row]) + 1
+		row++
+	}
+	return row, max(0, min(offset, len(e.lines[row])))
+}
+
+// OffsetOf returns the rune offset in the text of a 0-based row and column
+func (e *SourceEntry) OffsetOf(row, column int) int {
+	row, column = e.clamp(row, column)
+	offset := column
+	for _, line := range e.lines[:row] {
+		offset += len(line) + 1
+	}
+	return offset
+}
+
+// SelectionRange returns the rune offsets of the start and end of the
+// selection, which are both the cursor when nothing is selected
+func (e *SourceEntry) SelectionRange() (start, end int) {
+	if !e.selecting {
+		cursor := e.OffsetOf(e.row, e.column)
+		return cursor, cursor
+	}
+	r1, c1, r2, c2 := e.selection()
+	return e.OffsetOf(r1, c1), e.OffsetOf(r2, c2)
+}
+
+// ReplaceSelection replaces the selection with text, or inserts it at the cursor
+func (e *SourceEntry) ReplaceSelection(text string) {
+	e.paste([]rune(text))
+}
+
+// Replace replaces the text between two 0-based positions as one step that
+// can be undone, leaving the cursor after the new text
+func (e *SourceEntry) Replace(startRow, startColumn, endRow, endColumn int, text string) {
+	startRow, startColumn = e.clamp(startRow, startColumn)
+	endRow, endColumn = e.clamp(endRow, endColumn)
+	if endRow < startRow || (endRow == startRow && endColumn < startColumn) {
+		startRow, startColumn, endRow, endColumn = endRow, endColumn, startRow, startColumn
+	}
+	e.replace(startRow, startColumn, endRow, endColumn, []rune(text), editOther)
+}
+
+// Undo reverts the last group of edits
+func (e *SourceEntry) Undo() {
+	if len(e.undo) == 0 {
+		return
+	}
+	row := len(e.lines)
+	for len(e.undo) > 0 {
+		edit := e.undo[len(e.undo)-1]
+		e.undo = e.undo[:len(e.undo)-1]
+		e.redo = append(e.redo, edit)
+
+		endRow, endColumn := endOf(edit.row, edit.column, edit.inserted)
+		e.splice(edit.row, edit.column, endRow, endColumn, edit.removed)
+		e.row, e.column = endOf(edit.row, edit.column, edit.removed)
+		row = min(row, edit.row)
+		if !edit.follows {
+			break
+		}
+	}
+	e.selecting = false
+	e.changed(row)
+}
+
+// Redo applies the last group of edits that was undone
+func (e *SourceEntry) Redo() {
+	if len(e.redo) == 0 {
+		return
+	}
+	row := len(e.lines)
+	for first := true; len(e.redo) > 0; first = false {
+		edit := e.redo[len(e.redo)-1]
+		if !first && !edit.follows {
+			break
+		}
+		e.redo = e.redo[:len(e.redo)-1]
+		e.undo = append(e.undo, edit)
+
+		endRow, endColumn := endOf(edit.row, edit.column, edit.removed)
+		e.splice(edit.row, edit.column, endRow, endColumn, edit.inserted)
+		if first {
+			e.row, e.column = endOf(edit.row, edit.column, edit.inserted)
+		}
+		row = min(row, edit.row)
+	}
+	e.selecting = false
+	e.changed(row)
+}
+
+// LineHeight returns the distance between the tops of two lines
+func (e *SourceEntry) LineHeight() float32 {
+	return fyne.MeasureText("M", e.textSize(), fyne.TextStyle{}).Height
+}
+
+// LineTop returns the offset of the top of a 0-based line in the scrolled text
+func (e *SourceEntry) LineTop(row int) float32 {
+	screen, _ := e.screenRowOf(max(0, min(row, len(e.lines)-1)), 0)
+	return e.inset() + float32(screen)*e.LineHeight()
+}
+
+// TopLine returns the fractional 0-based line shown at the top of the view
+func (e *SourceEntry) TopLine() float32 {
+	screen := e.scroll.Offset.Y / e.LineHeight()
+	row, _, _ := e.screenRowSpan(max(0, min(int(screen), e.screenRowCount()-1)))
+	first, _ := e.screenRowOf(row, 0)
+	return float32(row) + (screen-float32(first))/float32(e.screenRowsOf(row))
+}
+
+// ScrollToLine scrolls so that a fractional 0-based line is at the top of the view
+func (e *SourceEntry) ScrollToLine(line float32) {
+	row := max(0, min(int(line), len(e.lines)-1))
+	first, _ := e.screenRowOf(row, 0)
+	screen := float32(first) + (line-float32(row))*float32(e.screenRowsOf(row))
+	e.ScrollToOffset(fyne.NewPos(e.scroll.Offset.X, screen*e.LineHeight()))
+}
+
+// Wrap reports whether long lines are wrapped to the width of the view
+func (e *SourceEntry) Wrap() bool {
+	return e.wrap
+}
+
+// SetWrap turns wrapping long lines at spaces on or off
+func (e *SourceEntry) SetWrap(wrap bool) {
+	if wrap == e.wrap {
+		return
+	}
+	e.wrap = wrap
+	e.breaks = nil
+	e.updateSize()
+	e.showCursor()
+	e.content.Refresh()
+}
+
+// ScrollOffset returns how far the text is scrolled
+func (e *SourceEntry) ScrollOffset() fyne.Position {
+	return e.scroll.Offset
+}
+
+// ScrollToOffset scrolls the text, clamped to its size
+func (e *SourceEntry) ScrollToOffset(offset fyne.Position) {
+	view := e.scroll.Size()
+	offset.X = fyne.Min(offset.X, e.contentSize.Width-view.Width)
+	offset.Y = fyne.Min(offset.Y, e.contentSize.Height-view.Height)
+	offset.X = fyne.Max(offset.X, 0)
+	offset.Y = fyne.Max(offset.Y, 0)
+
+	e.scroll.ScrollToOffset(offset)
+	e.content.Refresh()
+}
+
+// AcceptsTab lets the tab key indent rather than move the focus
+func (e *SourceEntry) AcceptsTab() bool {
+	return true
+}
+
+// FocusGained is called when the editor receives keyboard focus
+func (e *SourceEntry) FocusGained() {
+	e.focused = true
+	e.Refresh()
+}
+
+// FocusLost is called when the editor loses keyboard focus
+func (e *SourceEntry) FocusLost() {
+	e.focused = false
+	e.shiftDown = false
+	e.Refresh()
+}
+
+// KeyDown tracks the shift key for extending the selection
+func (e *SourceEntry) KeyDown(key *fyne.KeyEvent) {
+	if key.Name == desktop.KeyShiftLeft || key.Name == desktop.KeyShiftRight {
+		e.shiftDown = true
+	}
+}
+
+// KeyUp tracks the shift key for extending the selection
+func (e *SourceEntry) KeyUp(key *fyne.KeyEvent) {
+	if key.Name == desktop.KeyShiftLeft || key.Name == desktop.KeyShiftRight {
+		e.shiftDown = false
+	}
+}
+
+// TypedRune inserts a typed character
+func (e *SourceEntry) TypedRune(r rune) {
+	e.insert([]rune{r}, editTyping)
+}
+
+// TypedKey handles editing and cursor movement keys
+func (e *SourceEntry) TypedKey(key *fyne.KeyEvent) {
+	switch key.Name {
+	case fyne.KeyBackspace:
+		if e.deleteSelection() {
+			return
+		}
+		if e.column > 0 {
+			e.replace(e.row, e.column-1, e.row, e.column, nil, editBackspace)
+		} else if e.row > 0 {
+			e.replace(e.row-1, len(e.lines[e.row-1]), e.row, 0, nil, editBackspace)
+		}
+	case fyne.KeyDelete:
+		if e.deleteSelection() {
+			return
+		}
+		if e.column < len(e.lines[e.row]) {
+			e.replace(e.row, e.column, e.row, e.column+1, nil, editDelete)
+		} else if e.row < len(e.lines)-1 {
+			e.replace(e.row, e.column, e.row+1, 0, nil, editDelete)
+		}
+	case fyne.KeyReturn, fyne.KeyEnter:
+		e.newLine()
+	case fyne.KeyTab:
+		e.indent(e.shiftDown)
+	case fyne.KeyLeft:
+		if e.selecting && !e.shiftDown {
+			r1, c1, _, _ := e.selection()
+			e.moveTo(r1, c1, false)
+		} else if e.column > 0 {
+			e.moveTo(e.row, e.column-1, e.shiftDown)
+		} else if e.row > 0 {
+			e.moveTo(e.row-1, len(e.lines[e.row-1]), e.shiftDown)
+		}
+	case fyne.KeyRight:
+		if e.selecting && !e.shiftDown {
+			_, _, r2, c2 := e.selection()
+			e.moveTo(r2, c2, false)
+		} else if e.column < len(e.lines[e.row]) {
+			e.moveTo(e.row, e.column+1, e.shiftDown)
+		} else if e.row < len(e.lines)-1 {
+			e.moveTo(e.row+1, 0, e.shiftDown)
+		}
+	case fyne.KeyUp:
+		e.moveVertically(-1)
+	case fyne.KeyDown:
+		e.moveVertically(1)
+	case fyne.KeyPageUp:
+		e.moveVertically(-e.pageLines())
+	case fyne.KeyPageDown:
+		e.moveVertically(e.pageLines())
+	case fyne.KeyHome:
+		e.moveTo(e.row, 0, e.shiftDown)
+	case fyne.KeyEnd:
+		e.moveTo(e.row, len(e.lines[e.row]), e.shiftDown)
+	}
+}
+
+// TypedShortcut handles clipboard, undo and word movement shortcuts
+func (e *SourceEntry) TypedShortcut(shortcut fyne.Shortcut) {
+	switch s := shortcut.(type) {
+	case *fyne.ShortcutCopy:
+		e.copySelection(s.Clipboard)
+	case *fyne.ShortcutCut:
+		e.copySelection(s.Clipboard)
+		if e.deleteSelection() && e.renumber(e.row, e.row) {
+			e.changed(e.row)
+		}
+	case *fyne.ShortcutPaste:
+		if text := clipboardOrDefault(s.Clipboard).Content(); text != "" {
+			e.paste([]rune(strings.ReplaceAll(text, "\r\n", "\n")))
+		}
+	case *fyne.ShortcutSelectAll:
+		last := len(e.lines) - 1
+		e.Select(0, 0, last, len(e.lines[last]))
+	case *fyne.ShortcutUndo:
+		e.Undo()
+	case *fyne.ShortcutRedo:
+		e.Redo()
+	case *desktop.CustomShortcut:
+		if !e.moveByShortcut(s) {
+			e.forwardShortcut(s)
+		}
+	default:
+		e.forwardShortcut(shortcut)
+	}
+}
+
+// moveByShortcut handles the word and document movement shortcuts, reporting
+// whether the shortcut was one of them
+func (e *SourceEntry) moveByShortcut(s *desktop.CustomShortcut) bool {
+	extend := s.Modifier&fyne.KeyModifierShift != 0
+	if s.Modifier&^fyne.KeyModifierShift != fyne.KeyModifierShortcutDefault {
+		return false
+	}
+
+	switch s.KeyName {
+	case fyne.KeyLeft:
+		e.moveTo(e.row, e.wordStart(e.row, e.column), extend)
+	case fyne.KeyRight:
+		e.moveTo(e.row, e.wordEnd(e.row, e.column), extend)
+	case fyne.KeyHome:
+		e.moveTo(0, 0, extend)
+	case fyne.KeyEnd:
+		last := len(e.lines) - 1
+		e.moveTo(last, len(e.lines[last]), extend)
+	case fyne.KeyZ:
+		if !extend {
+			return false
+		}
+		e.Redo()
+	default:
+		return false
+	}
+	return true
+}
+
+// forwardShortcut passes a shortcut the editor does not use on to the window,
+// so that the formatting shortcuts also work while typing
+func (e *SourceEntry) forwardShortcut(shortcut fyne.Shortcut) {
+	if c, ok := fyne.CurrentApp().Driver().CanvasForObject(e).(fyne.Shortcutable); ok {
+		c.TypedShortcut(shortcut)
+	}
+}
+
+// insert replaces the selection with text, or inserts it at the cursor
+func (e *SourceEntry) insert(text []rune, kind editKind) {
+	if e.selecting {
+		r1, c1, r2, c2 := e.selection()
+		e.replace(r1, c1, r2, c2, text, editOther)
+		return
+	}
+	e.replace(e.row, e.column, e.row, e.column, text, kind)
+}
+
+// paste inserts text in place of the selection, renumbering any ordered
+// list it goes into
+func (e *SourceEntry) paste(text []rune) {
+	first := e.row
+	if e.selecting {
+		first, _, _, _ = e.selection()
+	}
+	e.insert(text, editOther)
+	if e.renumber(first, e.row) {
+		e.changed(first)
+	}
+}
+
+// deleteSelection removes the selected text, reporting whether there was any
+func (e *SourceEntry) deleteSelection() bool {
+	if !e.selecting {
+		return false
+	}
+	r1, c1, r2, c2 := e.selection()
+	e.replace(r1, c1, r2, c2, nil, editOther)
+	return true
+}
+
+func (e *SourceEntry) copySelection(clipboard fyne.Clipboard) {
+	if text := e.SelectedText(); text != "" {
+		clipboardOrDefault(clipboard).SetContent(text)
+	}
+}
+
+// replace swaps the text between two ordered positions for text and records
+// the change so that it can be undone
+func (e *SourceEntry) replace(r1, c1, r2, c2 int, text []rune, kind editKind) {
+	if !e.apply(r1, c1, r2, c2, text, kind, false) {
+		e.selecting = false
+		return
+	}
+	e.row, e.column = endOf(r1, c1, text)
+	e.selecting = false
+	e.changed(r1)
+}
+
+// apply swaps the text between two ordered positions for text and records
+// the change, without moving the cursor or updating the display, so that
+// several changes can be made as one. It reports whether anything changed.
+func (e *SourceEntry) apply(r1, c1, r2, c2 int, text []rune, kind editKind, follows bool) bool {
+	removed := e.textBetween(r1, c1, r2, c2)
+	if len(removed) == 0 && len(text) == 0 {
+		return false
+	}
+
+	e.splice(r1, c1, r2, c2, text)
+	e.record(&sourceEdit{
+		row:      r1,
+		column:   c1,
+		removed:  removed,
+		inserted: append([]rune(nil), text...),
+		kind:     kind,
+		follows:  follows,
+	})
+	e.redo = nil
+	return true
+}
+
+// newLine breaks the line at the cursor, carrying a list item or quote on
+// to the new line, numbered after it. Enter on an empty item ends the list.
+func (e *SourceEntry) newLine() {
+	line := e.lines[e.row]
+	m, ok := parseListPrefix(string(line))
+	if e.selecting || !ok || e.column < m.width {
+		e.insert([]rune{'\n'}, editOther)
+		return
+	}
+	if strings.TrimSpace(string(line[m.width:])) == "" {
+		e.replace(e.row, 0, e.row, len(line), []rune(m.end()), editOther)
+		return
+	}
+
+	// Spaces after the cursor would otherwise follow the new marker
+	end := e.column
+	for end < len(line) && (line[end] == ' ' || line[end] == '\t') {
+		end++
+	}
+	row := e.row
+	text := []rune("\n" + m.next())
+	e.apply(row, e.column, row, end, text, editOther, false)
+	e.row, e.column = endOf(row, e.column, text)
+	e.renumber(row+1, row+1)
+	e.changed(row)
+}
+
+// indent moves the selected lines, or the list item at the cursor with the
+// items nested in it, in by a level or out by one. List items line up with
+// the text of the item they are nested in. Tab elsewhere types a tab.
+func (e *SourceEntry) indent(outdent bool) {
+	first, last := e.row, e.row
+	if e.selecting {
+		var endColumn int
+		first, _, last, endColumn = e.selection()
+		if endColumn == 0 && last > first {
+			last--
+		}
+	}
+	m, ok := parseListPrefix(string(e.lines[first]))
+	isItem := ok && m.item()
+	if first == last && !isItem && !outdent {
+		e.insert([]rune{'\t'}, editTyping)
+		return
+	}
+	if first == last && isItem {
+		for row := last + 1; row < len(e.lines); row++ {
+			text := string(e.lines[row])
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			if quote, indent := lineIndent(text); quote != m.quote || indentWidth(indent) <= indentWidth(m.indent) {
+				break
+			}
+			last = row
+		}
+	}
+
+	// Work out how far to move the lines
+	var add string
+	remove := 0
+	switch {
+	case !outdent && isItem:
+		target := m.childIndent()
+		if sibling, ok := listParent(e.Line, first, true); ok {
+			target = sibling.childIndent()
+		}
+		add = strings.Repeat(" ", max(indentWidth(target)-indentWidth(m.indent), 1))
+	case !outdent:
+		add = "\t"
+	case isItem:
+		remove = indentWidth(m.indent)
+		if parent, ok := listParent(e.Line, first, false); ok {
+			remove -= indentWidth(parent.indent)
+		}
+	default:
+		remove = tabWidth
+	}
+
+	follows := false
+	for row := first; row <= last; row++ {
+		text := string(e.lines[row])
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		quote, indent := lineIndent(text)
+		start := len([]rune(quote))
+		if add != "" {
+			follows = e.apply(row, start, row, start, []rune(add), editOther, follows) || follows
+			e.shiftColumns(row, start, start, len(add))
+			continue
+		}
+
+		end, width := start, 0
+		for _, r := range indent {
+			if width >= remove {
+				break
+			}
+			if r == '\t' {
+				width += tabWidth - width%tabWidth
+			} else {
+				width++
+			}
+			end++
+		}
+		if end > start {
+			follows = e.apply(row, start, row, end, nil, editOther, follows) || follows
+			e.shiftColumns(row, start, end, 0)
+		}
+	}
+	if !follows {
+		return
+	}
+	// An item moved in to start a nested list is its first item
+	if _, ok := listParent(e.Line, first, true); add != "" && m.ordered() && m.number != 1 && !ok {
+		start := len(m.quote) + len(m.indent) + len(add)
+		e.apply(first, start, first, start+m.digits, []rune("1"), editOther, true)
+		e.shiftColumns(first, start, start+m.digits, 1)
+	}
+	e.renumber(first, last)
+	e.changed(first)
+}
+
+// shiftColumns keeps the cursor and the selection anchor on the same text
+// when the columns from start to end of a row are replaced by length runes
+func (e *SourceEntry) shiftColumns(row, start, end, length int) {
+	shift := func(column int) int {
+		if column >= end {
+			return column + length - (end - start)
+		}
+		if column > start {
+			return min(column, start+length)
+		}
+		return column
+	}
+	if e.row == row {
+		e.column = shift(e.column)
+	}
+	if e.anchorRow == row {
+		e.anchorColumn = shift(e.anchorColumn)
+	}
+}
+
+// renumber numbers the ordered lists the rows are in one after another, as
+// part of the edit just made, keeping the cursor in place. It reports
+// whether any numbers changed.
+func (e *SourceEntry) renumber(first, last int) bool {
+	changes := renumberLists(e.Line, len(e.lines), first, last)
+	for _, change := range changes {
+		e.apply(change.row, change.start, change.row, change.end, []rune(change.number), editOther, true)
+		e.shiftColumns(change.row, change.start, change.end, len(change.number))
+	}
+	return len(changes) > 0
+}
+
+// record adds an edit to the undo history, merging it into the previous one
+// while the user keeps typing a word or deleting
+func (e *SourceEntry) record(edit *sourceEdit) {
+	if n := len(e.undo); n > 0 {
+		last := e.undo[n-1]
+		switch {
+		case edit.kind == editTyping && last.kind == editTyping && len(edit.removed) == 0:
+			row, column := endOf(last.row, last.column, last.inserted)
+			startsWord := unicode.IsSpace(last.inserted[len(last.inserted)-1]) && !unicode.IsSpace(edit.inserted[0])
+			if row == edit.row && column == edit.column && !startsWord {
+				last.inserted = append(last.inserted, edit.inserted...)
+				return
+			}
+		case edit.kind == editBackspace && last.kind == editBackspace:
+			row, column := endOf(edit.row, edit.column, edit.removed)
+			if row == last.row && column == last.column {
+				last.row, last.column = edit.row, edit.column
+				last.removed = append(edit.removed, last.removed...)
+				return
+			}
+		case edit.kind == editDelete && last.kind == editDelete:
+			if edit.row == last.row && edit.column == last.column {
+				last.removed = append(last.removed, edit.removed...)
+				return
+			}
+		}
+	}
+	e.undo = append(e.undo, edit)
+}
+
+// splice replaces the text between two ordered positions without recording it
+func (e *SourceEntry) splice(r1, c1, r2, c2 int, text []rune) {
+	parts := splitLines(text)
+	head := e.lines[r1][:c1]
+	tail := e.lines[r2][c2:]
+
+	replacement := make([][]rune, len(parts))
+	for i, part := range parts {
+		var line []rune
+		if i == 0 {
+			line = append(line, head...)
+		}
+		line = append(line, part...)
+		if i == len(parts)-1 {
+			line = append(line, tail...)
+		}
+		replacement[i] = line
+	}
+
+	if e.breaks != nil {
+		breaks := make([][]int, 0, len(e.breaks)-(r2-r1+1)+len(replacement))
+		breaks = append(breaks, e.breaks[:r1]...)
+		breaks = append(breaks, make([][]int, len(replacement))...)
+		e.breaks = append(breaks, e.breaks[r2+1:]...)
+	}
+	if len(replacement) == r2-r1+1 {
+		copy(e.lines[r1:], replacement)
+		return
+	}
+	lines := make([][]rune, 0, len(e.lines)-(r2-r1+1)+len(replacement))
+	lines = append(lines, e.lines[:r1]...)
+	lines = append(lines, replacement...)
+	e.lines = append(lines, e.lines[r2+1:]...)
+}
+
+// changed updates the display after the text changed from a row onwards
+func (e *SourceEntry) changed(row int) {
+	e.goalX = -1
+	e.highlights = nil
+	e.highlighter.invalidate(row)
+	e.updateSize()
+	e.showCursor()
+	e.content.Refresh()
+
+	if e.OnChanged != nil {
+		e.OnChanged(e.Text())
+	}
+	if e.OnCursorChanged != nil {
+		e.OnCursorChanged()
+	}
+}
+
+// moveTo moves the cursor, extending the selection from where it was if asked
+func (e *SourceEntry) moveTo(row, column int, extend bool) {
+	if extend && !e.selecting {
+		e.anchorRow, e.anchorColumn = e.row, e.column
+	}
+	e.row, e.column = row, column
+	e.selecting = extend && (e.anchorRow != row || e.anchorColumn != column)
+	e.goalX = -1
+	e.cursorMoved()
+}
+
+// moveVertically moves the cursor up or down by a number of screen rows,
+// keeping close to the horizontal position it started from
+func (e *SourceEntry) moveVertically(lines int) {
+	goal := e.goalX
+	if goal < 0 {
+		goal = e.pointOf(e.row, e.column).X - e.inset()
+	}
+
+	screen, _ := e.screenRowOf(e.row, e.column)
+	target := max(0, min(screen+lines, e.screenRowCount()-1))
+	row, column := e.columnOnScreenRow(target, goal)
+	if target == screen {
+		if lines < 0 {
+			column = 0
+		} else if lines > 0 {
+			column = len(e.lines[row])
+		}
+	}
+	e.moveTo(row, column, e.shiftDown)
+	e.goalX = goal
+}
+
+func (e *SourceEntry) cursorMoved() {
+	e.showCursor()
+	e.content.Refresh()
+	if e.OnCursorChanged != nil {
+		e.OnCursorChanged()
+	}
+}
+
+// showCursor scrolls the cursor into view
+func (e *SourceEntry) showCursor() {
+	inset := e.inset()
+	height := e.LineHeight()
+	view := e.scroll.Size()
+	offset := e.scroll.Offset
+
+	point := e.pointOf(e.row, e.column)
+	top := point.Y
+	if top-inset < offset.Y {
+		offset.Y = top - inset
+	} else if top+height+inset > offset.Y+view.Height {
+		offset.Y = top + height + inset - view.Height
+	}
+
+	left := point.X
+	if left-inset < offset.X {
+		offset.X = left - inset
+	} else if left+inset > offset.X+view.Width {
+		offset.X = left + inset - view.Width
+	}
+
+	if offset != e.scroll.Offset {
+		e.ScrollToOffset(offset)
+	}
+}
+
+// updateSize works out how large the scrolled text is. The width is taken
+// from the longest line rather than measuring every line, or from the view
+// when the text is wrapped.
+func (e *SourceEntry) updateSize() {
+	inset := e.inset()
+	e.wrapLines()
+	var width float32
+	if e.rowStarts != nil {
+		width = e.scroll.Size().Width
+	} else {
+		widest := 0
+		for i, line := range e.lines {
+			if len(line) > len(e.lines[widest]) {
+				widest = i
+			}
+		}
+		width = e.columnX(widest, len(e.lines[widest])) + inset*2 + e.cursorWidth()
+	}
+
+	size := fyne.NewSize(width, float32(e.screenRowCount())*e.LineHeight()+inset*2)
+	if size != e.contentSize {
+		e.contentSize = size
+		e.scroll.Refresh()
+	}
+}
+
+// selection returns the selected range in order
+func (e *SourceEntry) selection() (r1, c1, r2, c2 int) {
+	r1, c1, r2, c2 = e.anchorRow, e.anchorColumn, e.row, e.column
+	if r2 < r1 || (r2 == r1 && c2 < c1) {
+		r1, c1, r2, c2 = r2, c2, r1, c1
+	}
+	return r1, c1, r2, c2
+}
+
+// textBetween returns the text between two ordered positions
+func (e *SourceEntry) textBetween(r1, c1, r2, c2 int) []rune {
+	if r1 == r2 {
+		return append([]rune(nil), e.lines[r1][c1:c2]...)
+	}
+	text := append([]rune(nil), e.lines[r1][c1:]...)
+	for row := r1 + 1; row < r2; row++ {
+		text = append(text, '\n')
+		text = append(text, e.lines[row]...)
+	}
+	text = append(text, '\n')
+	return append(text, e.lines[r2][:c2]...)
+}
+
+func (e *SourceEntry) clamp(row, column int) (int, int) {
+	row = max(0, min(row, len(e.lines)-1))
+	column = max(0, min(column, len(e.lines[row])))
+	return row, column
+}
+
+// wordStart returns the column of the start of the word before a position
+func (e *SourceEntry) wordStart(row, column int) int {
+	line := e.lines[row]
+	for column > 0 && !isWordRune(line[column-1]) {
+		column--
+	}
+	for column > 0 && isWordRune(line[column-1]) {
+		column--
+	}
+	return column
+}
+
+// wordEnd returns the column of the end of the word after a position
+func (e *SourceEntry) wordEnd(row, column int) int {
+	line := e.lines[row]
+	for column < len(line) && !isWordRune(line[column]) {
+		column++
+	}
+	for column < len(line) && isWordRune(line[column]) {
+		column++
+	}
+	return column
+}
+
+// positionAt returns the row and column nearest to a point in the scrolled text
+func (e *SourceEntry) positionAt(pos fyne.Position) (int, int) {
+	screen := int((pos.Y - e.inset()) / e.LineHeight())
+	screen = max(0, min(screen, e.screenRowCount()-1))
+	return e.columnOnScreenRow(screen, pos.X-e.inset())
+}
+
+// pointOf returns where a position is drawn in the scrolled text
+func (e *SourceEntry) pointOf(row, column int) fyne.Position {
+	screen, start := e.screenRowOf(row, column)
+	x := e.columnX(row, column)
+	if start > 0 {
+		x -= e.columnX(row, start)
+	}
+	return fyne.NewPos(e.inset()+x, e.inset()+float32(screen)*e.LineHeight())
+}
+
+// columnOnScreenRow returns the position nearest to a horizontal offset on
+// a screen row. A wrapped row ends before the column the next one starts at.
+func (e *SourceEntry) columnOnScreenRow(screen int, x float32) (int, int) {
+	row, start, end := e.screenRowSpan(screen)
+	if start > 0 {
+		x += e.columnX(row, start)
+	}
+	column := max(start, min(e.columnAt(row, x), end))
+	if column == end && end < len(e.lines[row]) {
+		column--
+	}
+	return row, column
+}
+
+// wrapLines works out the screen rows of the lines that changed since the
+// text was last wrapped, or of every line when the view changed width
+func (e *SourceEntry) wrapLines() {
+	width := e.scroll.Size().Width - e.inset()*2 - e.cursorWidth()
+	if !e.wrap || width <= 0 {
+		e.breaks, e.rowStarts = nil, nil
+		return
+	}
+	if width != e.wrapAtWidth || len(e.breaks) != len(e.lines) {
+		e.breaks = make([][]int, len(e.lines))
+		e.wrapAtWidth = width
+	}
+
+	e.rowStarts = e.rowStarts[:0]
+	rows := 0
+	for row := range e.lines {
+		if e.breaks[row] == nil {
+			e.breaks[row] = e.wrapLine(row, width)
+		}
+		e.rowStarts = append(e.rowStarts, rows)
+		rows += len(e.breaks[row]) + 1
+	}
+	e.rowStarts = append(e.rowStarts, rows)
+}
+
+// wrapLine returns the columns where a line is broken to fit a width, after
+// the last space that fits or else after the last character that does
+func (e *SourceEntry) wrapLine(row int, width float32) []int {
+	line := e.lines[row]
+	breaks := []int{}
+	for start := 0; ; {
+		left := e.columnX(row, start)
+		if e.columnX(row, len(line))-left <= width {
+			return breaks
+		}
+		fits := start + sort.Search(len(line)-start, func(i int) bool {
+			return e.columnX(row, start+i+1)-left > width
+		})
+		end := max(fits, start+1)
+		for column := fits; column > start; column-- {
+			if unicode.IsSpace(line[column-1]) {
+				end = column
+				break
+			}
+		}
+		breaks = append(breaks, end)
+		start = end
+	}
+}
+
+// screenRowCount returns how many screen rows the text takes
+func (e *SourceEntry) screenRowCount() int {
+	if e.rowStarts == nil {
+		return len(e.lines)
+	}
+	return e.rowStarts[len(e.rowStarts)-1]
+}
+
+// screenRowsOf returns how many screen rows a line takes
+func (e *SourceEntry) screenRowsOf(row int) int {
+	if e.rowStarts == nil {
+		return 1
+	}
+	return len(e.breaks[row]) + 1
+}
+
+// screenRowOf returns the screen row a position is shown on, and the column
+// that row starts at
+func (e *SourceEntry) screenRowOf(row, column int) (screen, start int) {
+	if e.rowStarts == nil {
+		return row, 0
+	}
+	breaks := e.breaks[row]
+	n := sort.SearchInts(breaks, column+1)
+	if n > 0 {
+		start = breaks[n-1]
+	}
+	return e.rowStarts[row] + n, start
+}
+
+// screenRowSpan returns the line shown on a screen row and the columns of
+// the part of it that is shown
+func (e *SourceEntry) screenRowSpan(screen int) (row, start, end int) {
+	if e.rowStarts == nil {
+		return screen, 0, len(e.lines[screen])
+	}
+	row = sort.Search(len(e.lines)-1, func(i int) bool { return e.rowStarts[i+1] > screen })
+	breaks := e.breaks[row]
+	n := screen - e.rowStarts[row]
+	end = len(e.lines[row])
+	if n > 0 {
+		start = breaks[n-1]
+	}
+	if n < len(breaks) {
+		end = breaks[n]
+	}
+	return row, start, end
+}
+
+// columnX returns the horizontal offset of a column from the start of its line
+func (e *SourceEntry) columnX(row, column int) float32 {
+	line := e.lines[row]
+	x := float32(0)
+	for _, span := range e.highlighter.lineSpans(e.lines, row) {
+		if column <= span.start {
+			break
+		}
+		x += e.measure(line[span.start:min(column, span.end)], span.style)
+	}
+	return x
+}
+
+// columnAt returns the column nearest to a horizontal offset in a line
+func (e *SourceEntry) columnAt(row int, x float32) int {
+	n := len(e.lines[row])
+	column := sort.Search(n+1, func(c int) bool {
+		return e.columnX(row, c) >= x
+	})
+	if column > n {
+		return n
+	}
+	if column > 0 && x-e.columnX(row, column-1) < e.columnX(row, column)-x {
+		column--
+	}
+	return column
+}
+
+func (e *SourceEntry) measure(text []rune, style spanStyle) float32 {
+	return fyne.MeasureText(displayText(text), e.textSize(), style.textStyle()).Width
+}
+
+// pageLines returns how many lines fit in the visible area
+func (e *SourceEntry) pageLines() int {
+	return max(1, int(e.scroll.Size().Height/e.LineHeight())-1)
+}
+
+func (e *SourceEntry) textSize() float32 {
+	return e.Theme().Size(theme.SizeNameText)
+}
+
+// inset returns the space between the edge of the editor and the text
+func (e *SourceEntry) inset() float32 {
+	return e.Theme().Size(theme.SizeNameInnerPadding)
+}
+
+func (e *SourceEntry) cursorWidth() float32 {
+	return e.Theme().Size(theme.SizeNameInputBorder)
+}
+
+func (e *SourceEntry) requestFocus() {
+	if c := fyne.CurrentApp().Driver().CanvasForObject(e); c != nil && c.Focused() != e {
+		c.Focus(e)
+	}
+}
+
+// sourceEntryRenderer draws the frame around the scrolled text
+type sourceEntryRenderer struct {
+	entry      *SourceEntry
+	background *canvas.Rectangle
+	border     *canvas.Rectangle
+	objects    []fyne.CanvasObject
+}
+
+func (r *sourceEntryRenderer) Layout(size fyne.Size) {
+	border := r.entry.Theme().Size(theme.SizeNameInputBorder)
+	r.background.Resize(size)
+	r.border.Resize(size)
+	r.entry.scroll.Move(fyne.NewPos(border, border))
+	r.entry.scroll.Resize(size.Subtract(fyne.NewSize(border*2, border*2)))
+	if r.entry.wrap {
+		r.entry.updateSize()
+	}
+	r.entry.content.Refresh()
+}
+
+func (r *sourceEntryRenderer) MinSize() fyne.Size {
+	border := r.entry.Theme().Size(theme.SizeNameInputBorder)
+	return r.entry.scroll.MinSize().Add(fyne.NewSize(border*2, border*2))
+}
+
+func (r *sourceEntryRenderer) Refresh() {
+	th := r.entry.Theme()
+	v := fyne.CurrentApp().Settings().ThemeVariant()
+
+	r.background.FillColor = th.Color(theme.ColorNameInputBackground, v)
+	r.background.CornerRadius = th.Size(theme.SizeNameInputRadius)
+	r.border.FillColor = color.Transparent
+	r.border.StrokeWidth = th.Size(theme.SizeNameInputBorder)
+	r.border.CornerRadius = th.Size(theme.SizeNameInputRadius)
+	r.border.StrokeColor = th.Color(theme.ColorNameInputBorder, v)
+	if r.entry.focused {
+		r.border.StrokeColor = th.Color(theme.ColorNamePrimary, v)
+	}
+	r.background.Refresh()
+	r.border.Refresh()
+	r.entry.content.Refresh()
+}
+
+func (r *sourceEntryRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *sourceEntryRenderer) Destroy() {}
+
+// sourceContent is the scrolled area of a SourceEntry. It handles the mouse
+// and draws the lines that are in view.
+type sourceContent struct {
+	widget.BaseWidget
+	entry *SourceEntry
+}
+
+// CreateRenderer returns the renderer for the visible lines
+func (c *sourceContent) CreateRenderer() fyne.WidgetRenderer {
+	return &sourceContentRenderer{
+		content:     c,
+		cursor:      canvas.NewRectangle(color.Transparent),
+		placeholder: canvas.NewText("", nil),
+	}
+}
+
+// Cursor shows the text cursor over the editor
+func (c *sourceContent) Cursor() desktop.Cursor {
+	return desktop.TextCursor
+}
+
+// MouseDown moves the cursor to where the text was pressed, or extends the
+// selection to it with shift held
+func (c *sourceContent) MouseDown(ev *desktop.MouseEvent) {
+	e := c.entry
+	e.requestFocus()
+	if ev.Button != desktop.MouseButtonPrimary {
+		return
+	}
+	e.pressed = true
+	row, column := e.positionAt(ev.Position)
+	e.moveTo(row, column, ev.Modifier&fyne.KeyModifierShift != 0)
+}
+
+// MouseUp is called when a mouse button is released
+func (c *sourceContent) MouseUp(*desktop.MouseEvent) {}
+
+// Tapped moves the cursor to where the text was tapped
+func (c *sourceContent) Tapped(ev *fyne.PointEvent) {
+	e := c.entry
+	if e.pressed {
+		// Already handled by MouseDown
+		e.pressed = false
+		return
+	}
+	e.requestFocus()
+	row, column := e.positionAt(ev.Position)
+	e.moveTo(row, column, false)
+}
+
+// DoubleTapped selects the word that was tapped
+func (c *sourceContent) DoubleTapped(ev *fyne.PointEvent) {
+	e := c.entry
+	row, column := e.positionAt(ev.Position)
+	line := e.lines[row]
+	start, end := column, column
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWordRune(line[end]) {
+		end++
+	}
+	e.Select(row, start, row, end)
+}
+
+// TappedSecondary shows the clipboard menu
+func (c *sourceContent) TappedSecondary(ev *fyne.PointEvent) {
+	e := c.entry
+	e.requestFocus()
+	canvas := fyne.CurrentApp().Driver().CanvasForObject(c)
+	if canvas == nil {
+		return
+	}
+
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem("Cut", func() { e.TypedShortcut(&fyne.ShortcutCut{}) }),
+		fyne.NewMenuItem("Copy", func() { e.TypedShortcut(&fyne.ShortcutCopy{}) }),
+		fyne.NewMenuItem("Paste", func() { e.TypedShortcut(&fyne.ShortcutPaste{}) }),
+		fyne.NewMenuItem("Select All", func() { e.TypedShortcut(&fyne.ShortcutSelectAll{}) }),
+	)
+	widget.ShowPopUpMenuAtPosition(menu, canvas, ev.AbsolutePosition)
+}
+
+// Dragged extends the selection to the pointer
+func (c *sourceContent) Dragged(ev *fyne.DragEvent) {
+	e := c.entry
+	row, column := e.positionAt(ev.Position)
+	e.moveTo(row, column, true)
+}
+
+// DragEnd finishes selecting with the pointer
+func (c *sourceContent) DragEnd() {
+	c.entry.pressed = false
+}
+
+// screenRow is the part of a line shown on one row of the view, from the
+// start column to the end column, with its offset in the scrolled text
+type screenRow struct {
+	row, start, end int
+	y               float32
+}
+
+// sourceContentRenderer lays out text objects for the lines in view only,
+// reusing them as the text scrolls
+type sourceContentRenderer struct {
+	content     *sourceContent
+	rows        []screenRow
+	texts       []*canvas.Text
+	marks       []*canvas.Rectangle
+	selections  []*canvas.Rectangle
+	cursor      *canvas.Rectangle
+	placeholder *canvas.Text
+	objects     []fyne.CanvasObject
+}
+
+func (r *sourceContentRenderer) Layout(fyne.Size) {
+	r.Refresh()
+}
+
+func (r *sourceContentRenderer) MinSize() fyne.Size {
+	return r.content.entry.contentSize
+}
+
+func (r *sourceContentRenderer) Refresh() {
+	e := r.content.entry
+	th := e.Theme()
+	v := fyne.CurrentApp().Settings().ThemeVariant()
+	size := e.textSize()
+	height := e.LineHeight()
+	inset := e.inset()
+
+	offset := e.scroll.Offset
+	view := e.scroll.Size()
+	first := max(0, int((offset.Y-inset)/height))
+	last := min(e.screenRowCount()-1, int((offset.Y+view.Height-inset)/height))
+	rows := r.rows[:0]
+	for screen := first; screen <= last; screen++ {
+		row, start, end := e.screenRowSpan(screen)
+		rows = append(rows, screenRow{row, start, end, inset + float32(screen)*height})
+	}
+	r.rows = rows
+	r.objects = r.objects[:0]
+
+	// Highlights are drawn as they would be selected, in a softer color
+	mark := th.Color(theme.ColorNameWarning, v)
+	red, green, blue, _ := mark.RGBA()
+	mark = color.NRGBA{R: uint8(red >> 8), G: uint8(green >> 8), B: uint8(blue >> 8), A: 0x60}
+	marks := 0
+	if len(rows) > 0 {
+		firstRow, lastRow := rows[0].row, rows[len(rows)-1].row
+		from := sort.Search(len(e.highlights), func(i int) bool { return e.highlights[i].endRow >= firstRow })
+		for _, h := range e.highlights[from:] {
+			if h.startRow > lastRow {
+				break
+			}
+			r.rangeRects(h, func(x, y, width float32) {
+				rect := r.mark(marks)
+				marks++
+				rect.FillColor = mark
+				rect.Move(fyne.NewPos(x, y))
+				rect.Resize(fyne.NewSize(width, height))
+				r.objects = append(r.objects, rect)
+			})
+		}
+	}
+
+	if e.selecting {
+		r1, c1, r2, c2 := e.selection()
+		n := 0
+		r.rangeRects(sourceRange{r1, c1, r2, c2}, func(x, y, width float32) {
+			rect := r.selection(n)
+			n++
+			rect.FillColor = th.Color(theme.ColorNameSelection, v)
+			rect.Move(fyne.NewPos(x, y))
+			rect.Resize(fyne.NewSize(width, height))
+			r.objects = append(r.objects, rect)
+		})
+	}
+
+	n := 0
+	for _, screen := range rows {
+		line := e.lines[screen.row]
+		x := inset
+		for _, span := range e.highlighter.lineSpans(e.lines, screen.row) {
+			start, end := max(span.start, screen.start), min(span.end, screen.end)
+			if start >= end {
+				continue
+			}
+			text := r.text(n)
+			n++
+			text.Text = displayText(line[start:end])
+			text.Color = th.Color(span.style.color, v)
+			text.TextStyle = span.style.textStyle()
+			text.TextSize = size
+			width := fyne.MeasureText(text.Text, size, text.TextStyle).Width
+			text.Move(fyne.NewPos(x, screen.y))
+			text.Resize(fyne.NewSize(width, height))
+			x += width
+			r.objects = append(r.objects, text)
+		}
+	}
+
+	if len(e.lines) == 1 && len(e.lines[0]) == 0 && e.PlaceHolder != "" {
+		r.placeholder.Text = e.PlaceHolder
+		r.placeholder.Color = th.Color(theme.ColorNamePlaceHolder, v)
+		r.placeholder.TextSize = size
+		r.placeholder.Move(fyne.NewPos(inset, inset))
+		r.placeholder.Resize(r.placeholder.MinSize())
+		r.objects = append(r.objects, r.placeholder)
+	}
+
+	if cursor, _ := e.screenRowOf(e.row, e.column); e.focused && cursor >= first && cursor <= last {
+		r.cursor.FillColor = th.Color(theme.ColorNamePrimary, v)
+		r.cursor.Move(e.pointOf(e.row, e.column))
+		r.cursor.Resize(fyne.NewSize(e.cursorWidth(), height))
+		r.objects = append(r.objects, r.cursor)
+	}
+
+	canvas.Refresh(r.content)
+}
+
+// rangeRects calls add with the extent of the text in a range on each
+// screen row in view. A line break in the range is shown as a short space.
+func (r *sourceContentRenderer) rangeRects(span sourceRange, add func(x, y, width float32)) {
+	e := r.content.entry
+	for _, screen := range r.rows {
+		if screen.row < span.startRow || screen.row > span.endRow {
+			continue
+		}
+		start, end := screen.start, screen.end
+		if screen.row == span.startRow {
+			start = max(start, span.startColumn)
+		}
+		if screen.row == span.endRow {
+			end = min(end, span.endColumn)
+		}
+		if start > end {
+			continue
+		}
+
+		left := e.columnX(screen.row, screen.start)
+		x1 := e.columnX(screen.row, start) - left
+		x2 := e.columnX(screen.row, end) - left
+		if screen.row < span.endRow && screen.end == len(e.lines[screen.row]) {
+			x2 += e.textSize() / 2
+		}
+		add(e.inset()+x1, screen.y, x2-x1)
+	}
+}
+
+func (r *sourceContentRenderer) text(i int) *canvas.Text {
+	for len(r.texts) <= i {
+		r.texts = append(r.texts, canvas.NewText("", nil))
+	}
+	return r.texts[i]
+}
+
+func (r *sourceContentRenderer) mark(i int) *canvas.Rectangle {
+	for len(r.marks) <= i {
+		r.marks = append(r.marks, canvas.NewRectangle(color.Transparent))
+	}
+	return r.marks[i]
+}
+
+func (r *sourceContentRenderer) selection(i int) *canvas.Rectangle {
+	for len(r.selections) <= i {
+		r.selections = append(r.selections, canvas.NewRectangle(color.Transparent))
+	}
+	return r.selections[i]
+}
+
+func (r *sourceContentRenderer) Objects() []fyne.CanvasObject {
+	return r.objects
+}
+
+func (r *sourceContentRenderer) Destroy() {}
+
+// splitLines splits text into lines without their line breaks
+func splitLines(text []rune) [][]rune {
+	lines := [][]rune{nil}
+	start := 0
+	for i, r := range text {
+		if r == '\n' {
+			lines[len(lines)-1] = append([]rune(nil), text[start:i]...)
+			lines = append(lines, nil)
+			start = i + 1
+		}
+	}
+	lines[len(lines)-1] = append([]rune(nil), text[start:]...)
+	return lines
+}
+
+// endOf returns the position after text when it is inserted at a position
+func endOf(row, column int, text []rune) (int, int) {
+	for _, r := range text {
+		if r == '\n' {
+			row++
+			column = 0
+		} else {
+			column++
+		}
+	}
+	return row, column
+}
+
+// displayReplacer draws tabs as spaces and leaves out stray carriage returns
+var displayReplacer = strings.NewReplacer("\t", strings.Repeat(" ", tabWidth), "\r", "")
+
+// displayText returns a line segment as it is drawn
+func displayText(text []rune) string {
+	return displayReplacer.Replace(string(text))
+}
+
+func clipboardOrDefault(clipboard fyne.Clipboard) fyne.Clipboard {
+	if clipboard != nil {
+		return clipboard
+	}
+	return fyne.CurrentApp().Clipboard()
+}
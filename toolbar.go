@@ -40,7 +40,7 @@ func (t *Toolbar) Create() fyne.CanvasObject {
 		
 		// View and Export
 		widget.NewToolbarAction(theme.VisibilityIcon(), t.controller.TogglePreview),
-		widget.NewToolbarAction(theme.DocumentPrintIcon(), t.controller.ExportHTML),
+		widget.NewToolbarAction(theme.DocumentPrintIcon(), t.controller.ExportPDF),
 	)
 	
 	// Text formatting buttons (since we don't have specific icons)
@@ -0,0 +1,103 @@
+// Command fetchkatex downloads a KaTeX release from npm and keeps the files
+// that the editor bundles for offline HTML exports: the minified stylesheet
+// and scripts, the auto-render extension, the WOFF2 fonts and the license.
+//
+// It is run by go generate in the root of the module.
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	version := flag.String("version", "", "KaTeX version to fetch, such as 0.16.11")
+	out := flag.String("out", "katex", "folder to write the files to")
+	flag.Parse()
+	if *version == "" {
+		fmt.Fprintln(os.Stderr, "fetchkatex: -version is required")
+		os.Exit(2)
+	}
+	if err := fetch(*version, *out); err != nil {
+		fmt.Fprintln(os.Stderr, "fetchkatex:", err)
+		os.Exit(1)
+	}
+}
+
+// bundled reports whether a file of the npm package is kept, and where it
+// goes in the output folder
+func bundled(name string) (string, bool) {
+	switch name {
+	case "package/LICENSE":
+		return "LICENSE", true
+	case "package/dist/katex.min.css", "package/dist/katex.min.js", "package/dist/contrib/auto-render.min.js":
+		return strings.TrimPrefix(name, "package/dist/"), true
+	}
+	if path.Dir(name) == "package/dist/fonts" && path.Ext(name) == ".woff2" {
+		return "fonts/" + path.Base(name), true
+	}
+	return "", false
+}
+
+func fetch(version, out string) error {
+	url := "https://registry.npmjs.org/katex/-/katex-" + version + ".tgz"
+	resp, err := http.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// Files of an older release are replaced, the notes in the folder kept
+	for _, dir := range []string{"fonts", "contrib"} {
+		if err := os.RemoveAll(filepath.Join(out, dir)); err != nil {
+			return err
+		}
+	}
+	count := 0
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name, ok := bundled(header.Name)
+		if !ok || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		target := filepath.Join(out, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, data, 0o644); err != nil {
+			return err
+		}
+		count++
+	}
+	if _, err := os.Stat(filepath.Join(out, "katex.min.css")); err != nil {
+		return fmt.Errorf("%s has no dist/katex.min.css", url)
+	}
+	fmt.Printf("fetchkatex: wrote %d files of KaTeX %s to %s\n", count, version, out)
+	return nil
+}
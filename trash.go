@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// moveToTrash moves a file or folder to the trash of the desktop, from
+// where it can be restored
+func moveToTrash(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(path); err != nil {
+		return err
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		// Finder keeps where the file came from, for Put Back
+		return runTrashCommand(exec.Command("osascript",
+			"-e", "on run argv",
+			"-e", `tell application "Finder" to delete POSIX file (item 1 of argv)`,
+			"-e", "end run",
+			path))
+	case "windows":
+		script := `Add-Type -AssemblyName Microsoft.VisualBasic
+$path = $env:FYNEMD_TRASH
+if (Test-Path -LiteralPath $path -PathType Container) {
+	[Microsoft.VisualBasic.FileIO.FileSystem]::DeleteDirectory($path, 'OnlyErrorDialogs', 'SendToRecycleBin')
+} else {
+	[Microsoft.VisualBasic.FileIO.FileSystem]::DeleteFile($path, 'OnlyErrorDialogs', 'SendToRecycleBin')
+}`
+		cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+		cmd.Env = append(os.Environ(), "FYNEMD_TRASH="+path)
+		return runTrashCommand(cmd)
+	}
+	return moveToFreedesktopTrash(path)
+}
+
+// runTrashCommand runs a command that trashes a file, with its output as
+// the error if it fails
+func runTrashCommand(cmd *exec.Cmd) error {
+	output, err := cmd.CombinedOutput()
+	if message := strings.TrimSpace(string(output)); err != nil && message != "" {
+		return errors.New(message)
+	}
+	return err
+}
+
+// moveToFreedesktopTrash moves a file to the home trash of the freedesktop.org
+// specification, which Linux and BSD desktops share
+func moveToFreedesktopTrash(path string) error {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	trash := filepath.Join(dataHome, "Trash")
+	files, info := filepath.Join(trash, "files"), filepath.Join(trash, "info")
+	for _, dir := range []string{files, info} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return err
+		}
+	}
+
+	// The info file is created first and exclusively, which reserves the
+	// name in the trash
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	for i := 1; ; i++ {
+		candidate := name
+		if i > 1 {
+			candidate = strings.TrimSuffix(name, ext) + "." + strconv.Itoa(i) + ext
+		}
+		infoPath := filepath.Join(info, candidate+".trashinfo")
+		f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: path}).EscapedPath(), time.Now().Format("2006-01-02T15:04:05"))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(path, filepath.Join(files, candidate))
+		}
+		if err != nil {
+			os.Remove(infoPath)
+			if errors.Is(err, syscall.EXDEV) {
+				return errors.New("the file is on a different drive from the trash")
+			}
+			return err
+		}
+		return nil
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchSettleDelay lets a burst of events from a single save settle before reporting it
+const watchSettleDelay = 200 * time.Millisecond
+
+// FileWatcher reports changes made to open files by other programs.
+// Parent directories are watched rather than the files themselves so that
+// tools which save by renaming a new file into place are still noticed.
+// A file opened through a symbolic link is watched where the link points
+// too, and changes there are reported for the link.
+type FileWatcher struct {
+	watcher  *fsnotify.Watcher
+	onChange func(path string)
+
+	lock    sync.Mutex
+	files   map[string]int
+	dirs    map[string]int
+	pending map[string]*time.Timer
+	// targets holds the file each watched link pointed to when it was added
+	targets map[string]string
+}
+
+// NewFileWatcher creates a watcher that calls onChange on the UI thread
+func NewFileWatcher(onChange func(path string)) (*FileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &FileWatcher{
+		watcher:  watcher,
+		onChange: onChange,
+		files:    make(map[string]int),
+		dirs:     make(map[string]int),
+		pending:  make(map[string]*time.Timer),
+		targets:  make(map[string]string),
+	}
+	go w.run()
+	return w, nil
+}
+
+// Add starts watching a file
+func (w *FileWatcher) Add(path string) {
+	if w == nil || path == "" {
+		return
+	}
+	path = filepath.Clean(path)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.files[path] == 0 {
+		if target, err := filepath.EvalSymlinks(path); err == nil && target != path {
+			w.targets[path] = target
+			w.add(target)
+		}
+	}
+	w.add(path)
+}
+
+func (w *FileWatcher) add(path string) {
+	dir := filepath.Dir(path)
+	w.files[path]++
+	if w.dirs[dir] == 0 {
+		if err := w.watcher.Add(dir); err != nil {
+			fyne.LogError("Failed to watch "+dir, err)
+		}
+	}
+	w.dirs[dir]++
+}
+
+// Remove stops watching a file once every Add for it has been matched
+func (w *FileWatcher) Remove(path string) {
+	if w == nil || path == "" {
+		return
+	}
+	path = filepath.Clean(path)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.files[path] == 0 {
+		return
+	}
+	w.remove(path)
+	if target, ok := w.targets[path]; ok && w.files[path] == 0 {
+		delete(w.targets, path)
+		w.remove(target)
+	}
+}
+
+func (w *FileWatcher) remove(path string) {
+	dir := filepath.Dir(path)
+	if w.files[path]--; w.files[path] == 0 {
+		delete(w.files, path)
+	}
+	if w.dirs[dir]--; w.dirs[dir] <= 0 {
+		delete(w.dirs, dir)
+		w.watcher.Remove(dir)
+	}
+}
+
+func (w *FileWatcher) run() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+			w.changed(filepath.Clean(event.Name))
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			fyne.LogError("File watcher error", err)
+		}
+	}
+}
+
+// changed schedules a report for a changed file and the links that point to it
+func (w *FileWatcher) changed(path string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.files[path] == 0 {
+		return
+	}
+	linked := 0
+	for link, target := range w.targets {
+		if target == path {
+			w.schedule(link)
+			linked++
+		}
+	}
+	if w.files[path] > linked {
+		w.schedule(path)
+	}
+}
+
+// schedule reports a change to a file once its events settle
+func (w *FileWatcher) schedule(path string) {
+
+	if timer, ok := w.pending[path]; ok {
+		timer.Reset(watchSettleDelay)
+		return
+	}
+	w.pending[path] = time.AfterFunc(watchSettleDelay, func() {
+		w.lock.Lock()
+		delete(w.pending, path)
+		w.lock.Unlock()
+
+		fyne.Do(func() {
+			w.onChange(path)
+		})
+	})
+}
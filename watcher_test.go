@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fyne.io/fyne/v2/test"
+)
+
+func TestFileWatcherSymlink(t *testing.T) {
+	test.NewApp()
+	dir := t.TempDir()
+	target := filepath.Join(dir, "notes", "real.md")
+	link := filepath.Join(dir, "link.md")
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symbolic links are not available:", err)
+	}
+
+	changes := make(chan string, 10)
+	watcher, err := NewFileWatcher(func(path string) { changes <- path })
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher.Add(link)
+
+	// The file is changed where the link points, in a folder of its own
+	if err := os.WriteFile(target, []byte("two"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case path := <-changes:
+		if path != link {
+			t.Errorf("change reported for %s, want %s", path, link)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported for the link")
+	}
+
+	watcher.Remove(link)
+	if len(watcher.files) != 0 || len(watcher.dirs) != 0 || len(watcher.targets) != 0 {
+		t.Errorf("still watching %v %v %v", watcher.files, watcher.dirs, watcher.targets)
+	}
+}
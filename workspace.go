@@ -0,0 +1,616 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/fsnotify/fsnotify"
+)
+
+// preferenceWorkspaceVisible stores whether the workspace panel is shown
+const preferenceWorkspaceVisible = "workspaceVisible"
+
+// preferenceWorkspaceFolder stores the folder open as the workspace
+const preferenceWorkspaceFolder = "workspaceFolder"
+
+// workspaceWidth is the width the workspace panel asks for
+const workspaceWidth = 240
+
+// Workspace is the side panel showing the markdown files of a folder, which
+// can be created, renamed, moved and trashed from it
+type Workspace struct {
+	controller *AppController
+	container  *fyne.Container
+	title      *widget.Label
+	tree       *widget.Tree
+	empty      fyne.CanvasObject
+	overlay    *fyne.Container
+	indicator  *canvas.Rectangle
+	rows       []*workspaceRow
+
+	root string
+	// listings holds the entries of each folder listed so far, and dirs
+	// which of the paths listed are folders
+	listings map[string][]string
+	dirs     map[string]bool
+	selected string
+	// revealing is set while a path is selected without opening it
+	revealing bool
+
+	// watcher follows the folders that have been listed, refreshing the
+	// tree when files are added, removed or renamed in them
+	watcher *fsnotify.Watcher
+	lock    sync.Mutex
+	watched map[string]bool
+	pending *time.Timer
+
+	dragFrom   string
+	dragTarget string
+}
+
+// NewWorkspace creates a new workspace panel
+func NewWorkspace(controller *AppController) *Workspace {
+	w := &Workspace{
+		controller: controller,
+		listings:   make(map[string][]string),
+		dirs:       make(map[string]bool),
+		watched:    make(map[string]bool),
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fyne.LogError("Failed to start workspace watcher", err)
+		return w
+	}
+	w.watcher = watcher
+	go w.watch()
+	return w
+}
+
+// Create creates the workspace UI component
+func (w *Workspace) Create() fyne.CanvasObject {
+	w.tree = widget.NewTree(
+		w.childIDs,
+		func(id widget.TreeNodeID) bool {
+			return id == "" || w.dirs[id]
+		},
+		func(bool) fyne.CanvasObject {
+			row := newWorkspaceRow(w)
+			w.rows = append(w.rows, row)
+			return row
+		},
+		func(id widget.TreeNodeID, branch bool, object fyne.CanvasObject) {
+			object.(*workspaceRow).setPath(id, branch)
+		},
+	)
+	w.tree.OnSelected = func(id widget.TreeNodeID) {
+		w.selected = id
+		if !w.dirs[id] && !w.revealing {
+			w.controller.OpenPath(id, 0, 0)
+		}
+	}
+	w.tree.OnUnselected = func(widget.TreeNodeID) {
+		w.selected = ""
+	}
+
+	w.indicator = canvas.NewRectangle(theme.Color(theme.ColorNameHover))
+	w.indicator.StrokeColor = theme.Color(theme.ColorNamePrimary)
+	w.indicator.StrokeWidth = 1
+	w.indicator.Hide()
+	w.overlay = container.NewWithoutLayout(w.indicator)
+
+	w.title = widget.NewLabelWithStyle("Workspace", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	w.title.Truncation = fyne.TextTruncateEllipsis
+	toolbar := widget.NewToolbar(
+		widget.NewToolbarAction(theme.DocumentCreateIcon(), func() { w.newFile(w.targetDir(w.selected)) }),
+		widget.NewToolbarAction(theme.FolderNewIcon(), func() { w.newFolder(w.targetDir(w.selected)) }),
+		widget.NewToolbarAction(theme.FolderOpenIcon(), w.controller.OpenFolder),
+	)
+	titleContainer := container.NewBorder(nil, widget.NewSeparator(), nil, toolbar, container.NewPadded(w.title))
+
+	w.empty = container.NewCenter(container.NewVBox(
+		widget.NewLabelWithStyle("No folder open", fyne.TextAlignCenter, fyne.TextStyle{}),
+		widget.NewButton("Open Folder...", w.controller.OpenFolder),
+	))
+
+	width := canvas.NewRectangle(color.Transparent)
+	width.SetMinSize(fyne.NewSize(workspaceWidth, 0))
+
+	w.container = container.NewBorder(
+		titleContainer,
+		nil,
+		nil,
+		widget.NewSeparator(),
+		container.NewStack(width, w.tree, w.overlay, w.empty),
+	)
+
+	root := ""
+	visible := false
+	if prefs := w.controller.preferences(); prefs != nil {
+		root = prefs.String(preferenceWorkspaceFolder)
+		visible = prefs.BoolWithFallback(preferenceWorkspaceVisible, false)
+	}
+	if info, err := os.Stat(root); root != "" && err == nil && info.IsDir() {
+		w.SetRoot(root)
+	} else {
+		w.SetRoot("")
+	}
+	if !visible {
+		w.container.Hide()
+	}
+	return w.container
+}
+
+// Root returns the folder open as the workspace, or an empty string
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+// SetRoot opens a folder as the workspace, or closes it for an empty path
+func (w *Workspace) SetRoot(root string) {
+	if root != "" {
+		if abs, err := filepath.Abs(root); err == nil {
+			root = abs
+		}
+	}
+	w.root = root
+	w.selected = ""
+	w.unwatchAll()
+	clear(w.listings)
+	clear(w.dirs)
+
+	if root == "" {
+		w.title.SetText("Workspace")
+		w.tree.Hide()
+		w.empty.Show()
+	} else {
+		w.title.SetText(filepath.Base(root))
+		w.empty.Hide()
+		w.tree.Show()
+		w.tree.UnselectAll()
+		w.tree.CloseAllBranches()
+		w.tree.ScrollToTop()
+	}
+	w.tree.Refresh()
+	if prefs := w.controller.preferences(); prefs != nil {
+		prefs.SetString(preferenceWorkspaceFolder, root)
+	}
+}
+
+// Show shows the workspace panel
+func (w *Workspace) Show() {
+	w.setVisible(true)
+}
+
+// ToggleVisibility shows or hides the workspace panel
+func (w *Workspace) ToggleVisibility() {
+	if w.container != nil {
+		w.setVisible(!w.container.Visible())
+	}
+}
+
+func (w *Workspace) setVisible(visible bool) {
+	if w.container == nil {
+		return
+	}
+	if visible {
+		w.container.Show()
+	} else {
+		w.container.Hide()
+	}
+	if prefs := w.controller.preferences(); prefs != nil {
+		prefs.SetBool(preferenceWorkspaceVisible, visible)
+	}
+}
+
+// childIDs lists a folder, caching the listing until the folder changes.
+// Folders come first, and only markdown files are shown.
+func (w *Workspace) childIDs(id widget.TreeNodeID) []widget.TreeNodeID {
+	dir := id
+	if id == "" {
+		dir = w.root
+	}
+	if dir == "" || (id != "" && !w.dirs[id]) {
+		return nil
+	}
+	if listing, ok := w.listings[dir]; ok {
+		return listing
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fyne.LogError("Failed to list "+dir, err)
+	}
+	var folders, files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		switch {
+		case strings.HasPrefix(name, "."):
+		case entry.IsDir() || (entry.Type()&os.ModeSymlink != 0 && isDir(path)):
+			folders = append(folders, path)
+			w.dirs[path] = true
+		case isMarkdownFile(name):
+			files = append(files, path)
+		}
+	}
+	byName := func(a, b string) int {
+		return strings.Compare(strings.ToLower(filepath.Base(a)), strings.ToLower(filepath.Base(b)))
+	}
+	slices.SortFunc(folders, byName)
+	slices.SortFunc(files, byName)
+
+	listing := append(folders, files...)
+	w.listings[dir] = listing
+	w.watchDir(dir)
+	return listing
+}
+
+// isDir reports whether a path is a folder, following symlinks
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// refresh lists the folders again after they change on disk
+func (w *Workspace) refresh() {
+	clear(w.listings)
+	clear(w.dirs)
+	if w.selected != "" {
+		if _, err := os.Lstat(w.selected); err != nil {
+			w.tree.UnselectAll()
+		}
+	}
+	w.tree.Refresh()
+}
+
+// watchDir starts watching a listed folder
+func (w *Workspace) watchDir(dir string) {
+	if w.watcher == nil {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.watched[dir] {
+		return
+	}
+	if err := w.watcher.Add(dir); err != nil {
+		fyne.LogError("Failed to watch "+dir, err)
+		return
+	}
+	w.watched[dir] = true
+}
+
+// unwatchAll stops watching the folders of the previous workspace
+func (w *Workspace) unwatchAll() {
+	if w.watcher == nil {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for dir := range w.watched {
+		w.watcher.Remove(dir)
+	}
+	clear(w.watched)
+}
+
+func (w *Workspace) watch() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			// Only files and folders coming and going change the tree
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Remove) && !event.Has(fsnotify.Rename) {
+				continue
+			}
+			w.schedule(filepath.Clean(event.Name), event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename))
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			fyne.LogError("Workspace watcher error", err)
+		}
+	}
+}
+
+// schedule refreshes the tree once a burst of changes settles. A folder
+// that went away is no longer watched, so it is dropped to be watched again
+// if it comes back.
+func (w *Workspace) schedule(path string, removed bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if removed && w.watched[path] {
+		w.watcher.Remove(path)
+		delete(w.watched, path)
+	}
+
+	if w.pending != nil {
+		w.pending.Reset(watchSettleDelay)
+		return
+	}
+	w.pending = time.AfterFunc(watchSettleDelay, func() {
+		w.lock.Lock()
+		w.pending = nil
+		w.lock.Unlock()
+
+		fyne.Do(w.refresh)
+	})
+}
+
+// targetDir returns the folder new files go in for a path: the path if it
+// is a folder, its folder if it is a file, or the workspace itself
+func (w *Workspace) targetDir(path string) string {
+	switch {
+	case path == "":
+		return w.root
+	case w.dirs[path]:
+		return path
+	}
+	return filepath.Dir(path)
+}
+
+// askName asks for the name of a file or folder in dir, refusing names that
+// are taken. current is the name being changed, if any.
+func (w *Workspace) askName(title, confirm, dir, current string, done func(name string)) {
+	entry := widget.NewEntry()
+	entry.SetText(current)
+	entry.Validator = func(name string) error {
+		name = strings.TrimSpace(name)
+		switch {
+		case name == "" || name == "." || name == "..":
+			return errors.New("enter a name")
+		case strings.ContainsAny(name, `/\`):
+			return errors.New("a name cannot contain / or \\")
+		case name == current:
+			return nil
+		}
+		if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+			return fmt.Errorf("%s already exists", name)
+		}
+		return nil
+	}
+	form := dialog.NewForm(title, confirm, "Cancel", []*widget.FormItem{widget.NewFormItem("Name", entry)}, func(ok bool) {
+		if name := strings.TrimSpace(entry.Text); ok && name != current {
+			done(name)
+		}
+	}, w.controller.window)
+	form.Resize(fyne.NewSize(400, 160))
+	form.Show()
+	w.controller.window.Canvas().Focus(entry)
+}
+
+// newFile asks for a name and creates an empty markdown file in dir,
+// adding .md if the name has no markdown extension, and opens it
+func (w *Workspace) newFile(dir string) {
+	if dir == "" {
+		return
+	}
+	w.askName("New File", "Create", dir, "", func(name string) {
+		if !isMarkdownFile(name) {
+			name += ".md"
+		}
+		path := filepath.Join(dir, name)
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			dialog.ShowError(err, w.controller.window)
+			return
+		}
+		f.Close()
+		w.reveal(path)
+		w.controller.OpenPath(path, 0, 0)
+	})
+}
+
+// newFolder asks for a name and creates a folder in dir
+func (w *Workspace) newFolder(dir string) {
+	if dir == "" {
+		return
+	}
+	w.askName("New Folder", "Create", dir, "", func(name string) {
+		path := filepath.Join(dir, name)
+		if err := os.Mkdir(path, 0o755); err != nil {
+			dialog.ShowError(err, w.controller.window)
+			return
+		}
+		w.reveal(path)
+	})
+}
+
+// rename asks for a new name for a file or folder
+func (w *Workspace) rename(path string) {
+	dir := filepath.Dir(path)
+	w.askName("Rename", "Rename", dir, filepath.Base(path), func(name string) {
+		w.move(path, filepath.Join(dir, name))
+	})
+}
+
+// moveInto moves a file or folder into a folder of the workspace, refusing
+// to move a folder into itself
+func (w *Workspace) moveInto(path, dir string) {
+	if dir == filepath.Dir(path) || dir == path || strings.HasPrefix(dir, path+string(filepath.Separator)) {
+		return
+	}
+	to := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Lstat(to); err == nil {
+		dialog.ShowError(fmt.Errorf("%s already exists in %s", filepath.Base(path), filepath.Base(dir)), w.controller.window)
+		return
+	}
+	w.move(path, to)
+}
+
+// move renames a file or folder, keeping documents open from it pointed at
+// their new paths
+func (w *Workspace) move(from, to string) {
+	if err := os.Rename(from, to); err != nil {
+		dialog.ShowError(err, w.controller.window)
+		return
+	}
+	w.controller.MovedPath(from, to)
+	w.reveal(to)
+}
+
+// trash moves a file or folder to the trash once confirmed
+func (w *Workspace) trash(path string) {
+	kind := "file"
+	if w.dirs[path] {
+		kind = "folder"
+	}
+	message := fmt.Sprintf("Move the %s %s to the trash?", kind, filepath.Base(path))
+	dialog.ShowConfirm("Move to Trash", message, func(ok bool) {
+		if !ok {
+			return
+		}
+		if err := moveToTrash(path); err != nil {
+			dialog.ShowError(fmt.Errorf("could not move %s to the trash: %w", filepath.Base(path), err), w.controller.window)
+			return
+		}
+		w.refresh()
+	}, w.controller.window)
+}
+
+// reveal lists the workspace again and selects a path in it, opening the
+// folders above it
+func (w *Workspace) reveal(path string) {
+	w.refresh()
+	var dirs []string
+	for dir := filepath.Dir(path); strings.HasPrefix(dir, w.root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	w.childIDs("")
+	for i := len(dirs) - 1; i >= 0; i-- {
+		w.childIDs(dirs[i])
+		w.tree.OpenBranch(dirs[i])
+	}
+
+	w.revealing = true
+	w.tree.Select(path)
+	w.revealing = false
+	w.tree.ScrollTo(path)
+}
+
+// showMenu shows the actions for a row of the tree
+func (w *Workspace) showMenu(row *workspaceRow, position fyne.Position) {
+	dir := w.targetDir(row.path)
+	menu := fyne.NewMenu("",
+		fyne.NewMenuItem("New File...", func() { w.newFile(dir) }),
+		fyne.NewMenuItem("New Folder...", func() { w.newFolder(dir) }),
+		fyne.NewMenuItemSeparator(),
+		fyne.NewMenuItem("Rename...", func() { w.rename(row.path) }),
+		fyne.NewMenuItem("Move to Trash", func() { w.trash(row.path) }),
+	)
+	widget.ShowPopUpMenuAtPosition(menu, w.controller.window.Canvas(), position)
+}
+
+// dragged tracks a file or folder being dragged from row, highlighting the
+// row it would be dropped on. Dropping on a file moves into its folder.
+func (w *Workspace) dragged(row *workspaceRow, ev *fyne.DragEvent) {
+	if w.dragFrom == "" {
+		w.dragFrom = row.path
+	}
+	driver := fyne.CurrentApp().Driver()
+	pointer := driver.AbsolutePositionForObject(row).Add(ev.Position)
+
+	treeTop := driver.AbsolutePositionForObject(w.tree).Y
+	treeBottom := treeTop + w.tree.Size().Height
+	w.dragTarget = ""
+	if pointer.Y >= treeTop && pointer.Y < treeBottom {
+		// Below the last row is the workspace folder itself
+		w.dragTarget = w.root
+	}
+	for _, candidate := range w.rows {
+		if !candidate.Visible() || candidate.path == "" {
+			continue
+		}
+		top := driver.AbsolutePositionForObject(candidate).Y
+		height := candidate.Size().Height
+		if top < treeTop || top+height > treeBottom || pointer.Y < top || pointer.Y >= top+height {
+			continue
+		}
+
+		w.dragTarget = w.targetDir(candidate.path)
+		origin := driver.AbsolutePositionForObject(w.overlay)
+		w.indicator.Move(fyne.NewPos(0, top-origin.Y))
+		w.indicator.Resize(fyne.NewSize(w.overlay.Size().Width, height))
+		w.indicator.Show()
+		return
+	}
+	w.indicator.Hide()
+}
+
+// dragEnd moves the dragged file or folder to where it was dropped
+func (w *Workspace) dragEnd() {
+	from, to := w.dragFrom, w.dragTarget
+	w.dragFrom, w.dragTarget = "", ""
+	w.indicator.Hide()
+
+	if from == "" || to == "" {
+		return
+	}
+	w.moveInto(from, to)
+}
+
+// workspaceRow is a file or folder in the workspace tree, which can be
+// dragged and has a menu of actions
+type workspaceRow struct {
+	widget.BaseWidget
+	workspace *Workspace
+	icon      *widget.Icon
+	label     *widget.Label
+	path      string
+}
+
+func newWorkspaceRow(workspace *Workspace) *workspaceRow {
+	row := &workspaceRow{
+		workspace: workspace,
+		icon:      widget.NewIcon(nil),
+		label:     widget.NewLabel(""),
+	}
+	row.label.Truncation = fyne.TextTruncateEllipsis
+	row.ExtendBaseWidget(row)
+	return row
+}
+
+// setPath shows a file or folder in the row
+func (r *workspaceRow) setPath(path string, folder bool) {
+	r.path = path
+	r.label.SetText(filepath.Base(path))
+	if folder {
+		r.icon.SetResource(theme.FolderIcon())
+	} else {
+		r.icon.SetResource(theme.FileTextIcon())
+	}
+}
+
+// CreateRenderer returns the renderer for the row
+func (r *workspaceRow) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(container.NewBorder(nil, nil, r.icon, nil, r.label))
+}
+
+// TappedSecondary shows the actions for the row
+func (r *workspaceRow) TappedSecondary(ev *fyne.PointEvent) {
+	r.workspace.showMenu(r, ev.AbsolutePosition)
+}
+
+// Dragged is called while the row is being dragged
+func (r *workspaceRow) Dragged(ev *fyne.DragEvent) {
+	r.workspace.dragged(r, ev)
+}
+
+// DragEnd is called when the row is dropped
+func (r *workspaceRow) DragEnd() {
+	r.workspace.dragEnd()
+}
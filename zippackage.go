@@ -0,0 +1,86 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// packageFile is one part of a zip based document package
+type packageFile struct {
+	name string
+	data []byte
+	// stored leaves the part uncompressed, as ODF requires of its mimetype
+	stored bool
+}
+
+// writePackage writes the parts of a document package as a zip archive,
+// in order
+func writePackage(w io.Writer, files []packageFile) error {
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		header := &zip.FileHeader{Name: file.name, Method: zip.Deflate}
+		if file.stored {
+			header.Method = zip.Store
+		}
+		part, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if _, err := part.Write(file.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// escapeXML escapes text for XML content or attribute values, replacing
+// characters that XML cannot hold
+func escapeXML(text string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(text))
+	return buf.String()
+}
+
+// bookmarkNames gives each heading ID a bookmark name that word processors
+// accept: a letter, then at most 39 letters, digits and underscores
+type bookmarkNames map[string]string
+
+// add registers a heading ID and returns its bookmark name
+func (b bookmarkNames) add(id string) string {
+	if name, ok := b[id]; ok {
+		return name
+	}
+
+	var buf strings.Builder
+	buf.WriteString("h_")
+	for _, r := range id {
+		if r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			buf.WriteRune(r)
+		} else {
+			buf.WriteByte('_')
+		}
+	}
+	base := buf.String()
+	if len(base) > 36 {
+		base = base[:36]
+	}
+
+	name := base
+	for n := 2; b.taken(name); n++ {
+		name = base + "_" + strconv.Itoa(n)
+	}
+	b[id] = name
+	return name
+}
+
+func (b bookmarkNames) taken(name string) bool {
+	for _, existing := range b {
+		if existing == name {
+			return true
+		}
+	}
+	return false
+}